@@ -1,14 +1,39 @@
 package devstats
 
 import (
+	"database/sql"
 	"fmt"
+	"os"
 	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Annotation categories
+const (
+	AnnotationTag       = "tag"       // git tags of project repositories
+	AnnotationRelease   = "release"   // GitHub releases (gha_releases)
+	AnnotationMilestone = "milestone" // GitHub milestones due dates (gha_milestones)
+	AnnotationProject   = "project"   // project start and join dates (when project has no repositories)
+	AnnotationEvent     = "event"     // default category of annotations.yaml entries
+)
+
+// Annotation sources (projects.yaml `annotation_sources`)
+const (
+	AnnotationSourceTags       = "tags"
+	AnnotationSourceReleases   = "releases"
+	AnnotationSourceMilestones = "milestones"
 )
 
+// DefaultAnnotationSources - annotation sources used when project doesn't define them
+var DefaultAnnotationSources = []string{AnnotationSourceTags}
+
+// DefaultQuickRangesCategories - annotation categories used to create quick ranges when project doesn't define them
+var DefaultQuickRangesCategories = []string{AnnotationTag, AnnotationProject}
+
 // Annotations contain list of annotations
 type Annotations struct {
 	Annotations []Annotation
@@ -19,6 +44,20 @@ type Annotation struct {
 	Name        string
 	Description string
 	Date        time.Time
+	Category    string
+}
+
+// CustomAnnotations contain manual annotations from annotations.yaml (conferences, governance changes etc.)
+type CustomAnnotations struct {
+	Annotations []CustomAnnotation `yaml:"annotations"`
+}
+
+// CustomAnnotation contain single annotations.yaml entry, category defaults to "event"
+type CustomAnnotation struct {
+	Name        string    `yaml:"name"`
+	Description string    `yaml:"description"`
+	Date        time.Time `yaml:"date"`
+	Category    string    `yaml:"category"`
 }
 
 // AnnotationsByDate annotations Sort interface
@@ -45,6 +84,7 @@ func GetFakeAnnotations(startDate, joinDate time.Time) (annotations Annotations)
 			Name:        "Project start",
 			Description: ToYMDDate(startDate) + " - project starts",
 			Date:        startDate,
+			Category:    AnnotationProject,
 		},
 	)
 	annotations.Annotations = append(
@@ -53,12 +93,13 @@ func GetFakeAnnotations(startDate, joinDate time.Time) (annotations Annotations)
 			Name:        "First CNCF project join date",
 			Description: ToYMDDate(joinDate),
 			Date:        joinDate,
+			Category:    AnnotationProject,
 		},
 	)
 	return
 }
 
-// GetAnnotations queries uses `git` to get `orgRepo` all tags list
+// GetAnnotations reads `orgRepo` git repository all tags list
 // for all tags and returns those matching `annoRegexp`
 func GetAnnotations(ctx *Ctx, orgRepo, annoRegexp string) (annotations Annotations) {
 	// Get org and repo from orgRepo
@@ -73,81 +114,331 @@ func GetAnnotations(ctx *Ctx, orgRepo, annoRegexp string) (annotations Annotatio
 		re = regexp.MustCompile(annoRegexp)
 	}
 
-	// Local or cron mode?
-	cmdPrefix := ""
-	if ctx.Local {
-		cmdPrefix = LocalGitScripts
-	}
-
-	// We need this to capture 'git_tags.sh' output.
-	ctx.ExecOutput = true
-
-	// Get tags is using shell script that does 'chdir'
-	// We cannot chdir because this is a multithreaded app
-	// And all threads share CWD (current working directory)
+	// Read tags directly from git repository
 	if ctx.Debug > 0 {
 		Printf("Getting tags for repo %s\n", orgRepo)
 	}
 	dtStart := time.Now()
-	rwd := ctx.ReposDir + orgRepo
-	tagsStr, err := ExecCommand(
-		ctx,
-		[]string{cmdPrefix + "git_tags.sh", rwd},
-		map[string]string{"GIT_TERMINAL_PROMPT": "0"},
-	)
-	dtEnd := time.Now()
+	repo, err := OpenGitRepo(ctx.ReposDir + orgRepo)
 	FatalOnError(err)
-
-	tags := strings.Split(tagsStr, "\n")
+	tags, err := repo.Tags()
+	FatalOnError(err)
+	FatalOnError(repo.Close())
+	dtEnd := time.Now()
 	nTags := 0
 
-	for _, tagData := range tags {
-		data := strings.TrimSpace(tagData)
-		if data == "" {
+	for _, tag := range tags {
+		if re != nil && !re.MatchString(tag.Name) {
 			continue
 		}
-		// Use '♂♀' separator to avoid any character that can appear inside tag name or description
-		tagDataAry := strings.Split(data, "♂♀")
-		if len(tagDataAry) != 3 {
-			Fatalf("invalid tagData returned for repo: %s: '%s'", orgRepo, data)
-		}
-		tagName := tagDataAry[0]
-		if re != nil && !re.MatchString(tagName) {
+		annotations.Annotations = append(
+			annotations.Annotations,
+			Annotation{
+				Name:        tag.Name,
+				Description: annotationDescription(tag.Subject),
+				Date:        tag.Date,
+				Category:    AnnotationTag,
+			},
+		)
+		nTags++
+	}
+
+	if ctx.Debug > 0 {
+		Printf("Got %d tags for %s, took %v\n", nTags, orgRepo, dtEnd.Sub(dtStart))
+	}
+
+	return
+}
+
+// annotationDescription returns single line description, shortened to 40 characters
+func annotationDescription(message string) string {
+	if len(message) > 40 {
+		message = message[0:40]
+	}
+	replacer := strings.NewReplacer("\n", " ", "\r", " ", "\t", " ")
+	return replacer.Replace(message)
+}
+
+// annotationName returns annotation name, names from repos other than main repo are prefixed with repo name
+func annotationName(repo, mainRepo, name string) string {
+	if repo == mainRepo {
+		return name
+	}
+	ary := strings.Split(repo, "/")
+	return ary[len(ary)-1] + " " + name
+}
+
+// AnnotationRepos returns project's main repo and additional annotation repos
+func AnnotationRepos(proj *Project) (repos []string) {
+	seen := make(map[string]struct{})
+	for _, repo := range append([]string{proj.MainRepo}, proj.AnnotationRepos...) {
+		if _, ok := seen[repo]; ok || repo == "" {
 			continue
 		}
-		unixTimeStamp, err := strconv.ParseInt(tagDataAry[1], 10, 64)
-		if err != nil {
-			Printf("Invalid time returned for repo: %s, tag: %s: '%s'\n", orgRepo, tagName, data)
+		seen[repo] = struct{}{}
+		repos = append(repos, repo)
+	}
+	return
+}
+
+// AnnotationSources returns project's annotation sources (tags by default)
+func AnnotationSources(proj *Project) ([]string, error) {
+	if len(proj.AnnotationSources) == 0 {
+		return DefaultAnnotationSources, nil
+	}
+	for _, source := range proj.AnnotationSources {
+		switch source {
+		case AnnotationSourceTags, AnnotationSourceReleases, AnnotationSourceMilestones:
+		default:
+			return nil, fmt.Errorf("unknown annotation source '%s', allowed: tags, releases, milestones", source)
 		}
-		FatalOnError(err)
-		creatorDate := time.Unix(unixTimeStamp, 0)
-		message := tagDataAry[2]
-		if len(message) > 40 {
-			message = message[0:40]
+	}
+	return proj.AnnotationSources, nil
+}
+
+// QuickRangesCategories returns annotation categories used to create project's quick ranges
+func QuickRangesCategories(proj *Project) []string {
+	if len(proj.QuickRangesCategories) == 0 {
+		return DefaultQuickRangesCategories
+	}
+	return proj.QuickRangesCategories
+}
+
+// GetReposAnnotations returns `repos` tags matching `annoRegexp` (see GetAnnotations)
+// Tag names from repos other than `mainRepo` are prefixed with repo name
+func GetReposAnnotations(ctx *Ctx, mainRepo string, repos []string, annoRegexp string) (annotations Annotations) {
+	for _, repo := range repos {
+		repoAnnotations := GetAnnotations(ctx, repo, annoRegexp)
+		for _, annotation := range repoAnnotations.Annotations {
+			annotation.Name = annotationName(repo, mainRepo, annotation.Name)
+			annotations.Annotations = append(annotations.Annotations, annotation)
 		}
-		replacer := strings.NewReplacer("\n", " ", "\r", " ", "\t", " ")
-		message = replacer.Replace(message)
+	}
+	return
+}
 
+// reposCondition returns `column in ($1, ...)` condition and its arguments
+func reposCondition(column string, repos []string) (string, []interface{}) {
+	args := []interface{}{}
+	values := []string{}
+	for i, repo := range repos {
+		args = append(args, repo)
+		values = append(values, NValue(i+1))
+	}
+	return column + " in (" + strings.Join(values, ", ") + ")", args
+}
+
+// GetReleasesAnnotations returns published (non-draft) GitHub releases of `repos` with tag names matching `annoRegexp`
+// Releases are read from gha_releases, release date is its publish date
+func GetReleasesAnnotations(ctx *Ctx, con *sql.DB, mainRepo string, repos []string, annoRegexp string) (annotations Annotations) {
+	if len(repos) == 0 {
+		return
+	}
+	var re *regexp.Regexp
+	if annoRegexp != "" {
+		re = regexp.MustCompile(annoRegexp)
+	}
+	cond, args := reposCondition("dup_repo_name", repos)
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select tag_name, coalesce(name, ''), coalesce(published_at, created_at), dup_repo_name from ("+
+			"select distinct on (id) tag_name, name, published_at, created_at, draft, dup_repo_name "+
+			"from gha_releases where "+cond+" order by id, event_id desc"+
+			") r where not draft",
+		args...,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	var (
+		tag, name, repo string
+		dt              time.Time
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&tag, &name, &dt, &repo))
+		if re != nil && !re.MatchString(tag) {
+			continue
+		}
+		if name == "" {
+			name = tag
+		}
 		annotations.Annotations = append(
 			annotations.Annotations,
 			Annotation{
-				Name:        tagName,
-				Description: message,
-				Date:        creatorDate,
+				Name:        annotationName(repo, mainRepo, tag),
+				Description: annotationDescription(name),
+				Date:        dt,
+				Category:    AnnotationRelease,
 			},
 		)
-		nTags++
 	}
+	FatalOnError(rows.Err())
+	if ctx.Debug > 0 {
+		Printf("Got %d releases for %v\n", len(annotations.Annotations), repos)
+	}
+	return
+}
 
+// GetMilestonesAnnotations returns past due dates of `repos` GitHub milestones (from gha_milestones)
+func GetMilestonesAnnotations(ctx *Ctx, con *sql.DB, mainRepo string, repos []string) (annotations Annotations) {
+	if len(repos) == 0 {
+		return
+	}
+	cond, args := reposCondition("dup_repo_name", repos)
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select title, coalesce(description, ''), due_on, dup_repo_name from ("+
+			"select distinct on (id) title, description, due_on, dup_repo_name "+
+			"from gha_milestones where "+cond+" order by id, event_id desc"+
+			") m where due_on is not null and due_on <= now()",
+		args...,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	var (
+		title, description, repo string
+		dt                       time.Time
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&title, &description, &dt, &repo))
+		if description == "" {
+			description = title + " due date"
+		}
+		annotations.Annotations = append(
+			annotations.Annotations,
+			Annotation{
+				Name:        annotationName(repo, mainRepo, title),
+				Description: annotationDescription(description),
+				Date:        dt,
+				Category:    AnnotationMilestone,
+			},
+		)
+	}
+	FatalOnError(rows.Err())
 	if ctx.Debug > 0 {
-		Printf("Got %d tags for %s, took %v\n", nTags, orgRepo, dtEnd.Sub(dtStart))
+		Printf("Got %d milestones for %v\n", len(annotations.Annotations), repos)
 	}
+	return
+}
 
+// ReadCustomAnnotations reads manual annotations from annotations.yaml file, missing file means no annotations
+func ReadCustomAnnotations(ctx *Ctx, fn string) (annotations Annotations) {
+	data, err := ReadFile(ctx, fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		FatalOnError(err)
+	}
+	var custom CustomAnnotations
+	FatalOnError(yaml.Unmarshal(data, &custom))
+	for i, annotation := range custom.Annotations {
+		if annotation.Name == "" || annotation.Date.IsZero() {
+			Fatalf("%s: annotation #%d must have non-empty 'name' and 'date'", fn, i+1)
+		}
+		if annotation.Category == "" {
+			annotation.Category = AnnotationEvent
+		}
+		annotations.Annotations = append(
+			annotations.Annotations,
+			Annotation{
+				Name:        annotation.Name,
+				Description: annotationDescription(annotation.Description),
+				Date:        annotation.Date,
+				Category:    annotation.Category,
+			},
+		)
+	}
+	return
+}
+
+// UniqueAnnotations returns annotations without duplicated names, the first annotation with a given name is kept
+// So when the same tag is also a release or a milestone, only one of them is used
+// Such release or milestone keeps tag's category, so it is still used for quick ranges
+func UniqueAnnotations(annotations []Annotation) (unique []Annotation) {
+	seen := make(map[string]int)
+	for _, annotation := range annotations {
+		if i, ok := seen[annotation.Name]; ok {
+			kept := &unique[i]
+			if annotation.Category == AnnotationTag && (kept.Category == AnnotationRelease || kept.Category == AnnotationMilestone) {
+				kept.Category = AnnotationTag
+			}
+			continue
+		}
+		seen[annotation.Name] = len(unique)
+		unique = append(unique, annotation)
+	}
+	return
+}
+
+// AnnotationTime returns annotation's series time (hour start) not used yet
+// sannotations primary key is (time, period), so annotations from the same hour are moved to the next free hours
+func AnnotationTime(used map[time.Time]struct{}, dt time.Time) time.Time {
+	t := HourStart(dt)
+	for {
+		if _, ok := used[t]; !ok {
+			break
+		}
+		t = t.Add(time.Hour)
+	}
+	used[t] = struct{}{}
+	return t
+}
+
+// GetProjectAnnotations returns annotations from all project's sources and from `customFile` (annotations.yaml)
+// Annotations are taken from main repo and annotation repos, duplicates are removed in this order:
+// annotations.yaml, releases, milestones, tags
+func GetProjectAnnotations(ctx *Ctx, proj *Project, customFile string) (annotations Annotations) {
+	sources, err := AnnotationSources(proj)
+	FatalOnError(err)
+	sourcesMap := make(map[string]struct{})
+	for _, source := range sources {
+		sourcesMap[source] = struct{}{}
+	}
+	repos := AnnotationRepos(proj)
+	all := ReadCustomAnnotations(ctx, customFile).Annotations
+	for _, source := range []string{AnnotationSourceReleases, AnnotationSourceMilestones, AnnotationSourceTags} {
+		if _, ok := sourcesMap[source]; !ok || len(repos) == 0 {
+			continue
+		}
+		var sourceAnnotations Annotations
+		switch source {
+		case AnnotationSourceReleases, AnnotationSourceMilestones:
+			con := PgConn(ctx)
+			if source == AnnotationSourceReleases {
+				sourceAnnotations = GetReleasesAnnotations(ctx, con, proj.MainRepo, repos, proj.AnnotationRegexp)
+			} else {
+				sourceAnnotations = GetMilestonesAnnotations(ctx, con, proj.MainRepo, repos)
+			}
+			FatalOnError(con.Close())
+		case AnnotationSourceTags:
+			sourceAnnotations = GetReposAnnotations(ctx, proj.MainRepo, repos, proj.AnnotationRegexp)
+		}
+		all = append(all, sourceAnnotations.Annotations...)
+	}
+	annotations.Annotations = UniqueAnnotations(all)
+	return
+}
+
+// QuickRangesAnnotations returns annotations of given categories (used to create quick ranges), nil categories means all
+func QuickRangesAnnotations(annotations []Annotation, categories []string) (result []Annotation) {
+	if categories == nil {
+		return annotations
+	}
+	categoriesMap := make(map[string]struct{})
+	for _, category := range categories {
+		categoriesMap[category] = struct{}{}
+	}
+	for _, annotation := range annotations {
+		if _, ok := categoriesMap[annotation.Category]; ok {
+			result = append(result, annotation)
+		}
+	}
 	return
 }
 
 // ProcessAnnotations Creates IfluxDB annotations and quick_series
-func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate *time.Time) {
+// All annotations are saved, quick ranges are only created from annotations of given categories (nil means all)
+func ProcessAnnotations(ctx *Ctx, annotations *Annotations, categories []string, startDate, joinDate *time.Time) {
 	// Connect to Postgres
 	ic := PgConn(ctx)
 	defer func() { FatalOnError(ic.Close()) }()
@@ -158,23 +449,28 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 	// Annotations must be sorted to create quick ranges
 	sort.Sort(AnnotationsByDate(annotations.Annotations))
 
+	// Hours already used by annotations
+	used := make(map[time.Time]struct{})
+
 	// Iterate annotations
 	for _, annotation := range annotations.Annotations {
 		fields := map[string]interface{}{
 			"title":       annotation.Name,
 			"description": annotation.Description,
+			"category":    annotation.Category,
 		}
 		// Add batch point
 		if ctx.Debug > 0 {
 			Printf(
-				"Series: %v: Date: %v: '%v', '%v'\n",
+				"Series: %v: Date: %v: '%v', '%v', '%v'\n",
 				"annotations",
 				ToYMDDate(annotation.Date),
 				annotation.Name,
 				annotation.Description,
+				annotation.Category,
 			)
 		}
-		pt := NewTSPoint(ctx, "annotations", "", nil, fields, annotation.Date)
+		pt := NewTSPoint(ctx, "annotations", "", nil, fields, AnnotationTime(used, annotation.Date))
 		AddTSPoint(ctx, &pts, pt)
 	}
 
@@ -185,6 +481,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 			fields := map[string]interface{}{
 				"title":       "Project start date",
 				"description": ToYMDDate(*startDate) + " - project starts",
+				"category":    AnnotationProject,
 			}
 			// Add batch point
 			if ctx.Debug > 0 {
@@ -195,7 +492,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 					fields["description"],
 				)
 			}
-			pt := NewTSPoint(ctx, "annotations", "", nil, fields, *startDate)
+			pt := NewTSPoint(ctx, "annotations", "", nil, fields, AnnotationTime(used, *startDate))
 			AddTSPoint(ctx, &pts, pt)
 		}
 
@@ -204,6 +501,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 			fields := map[string]interface{}{
 				"title":       "CNCF join date",
 				"description": ToYMDDate(*joinDate) + " - joined CNCF",
+				"category":    AnnotationProject,
 			}
 			// Add batch point
 			if ctx.Debug > 0 {
@@ -214,7 +512,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 					fields["description"],
 				)
 			}
-			pt := NewTSPoint(ctx, "annotations", "", nil, fields, *joinDate)
+			pt := NewTSPoint(ctx, "annotations", "", nil, fields, AnnotationTime(used, *joinDate))
 			AddTSPoint(ctx, &pts, pt)
 		}
 	}
@@ -239,7 +537,8 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 	// to: only filled when using annotations range - exact date to
 	tags := make(map[string]string)
 
-	// Add special periods
+	// Add special periods, quick ranges are a separate batch that replaces all live quick ranges
+	var qrPts TSPoints
 	tagName := "quick_ranges"
 	tm := TimeParseAny("2014-01-01")
 
@@ -257,13 +556,14 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 		}
 		// Add batch point
 		pt := NewTSPoint(ctx, tagName, "", tags, nil, tm)
-		AddTSPoint(ctx, &pts, pt)
+		AddTSPoint(ctx, &qrPts, pt)
 		tm = tm.Add(time.Hour)
 	}
 
 	// Add '(i) - (i+1)' annotation ranges
-	lastIndex := len(annotations.Annotations) - 1
-	for index, annotation := range annotations.Annotations {
+	ranges := QuickRangesAnnotations(annotations.Annotations, categories)
+	lastIndex := len(ranges) - 1
+	for index, annotation := range ranges {
 		if index == lastIndex {
 			sfx := fmt.Sprintf("a_%d_n", index)
 			tags[tagName+"_suffix"] = sfx
@@ -278,11 +578,11 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 			}
 			// Add batch point
 			pt := NewTSPoint(ctx, tagName, "", tags, nil, tm)
-			AddTSPoint(ctx, &pts, pt)
+			AddTSPoint(ctx, &qrPts, pt)
 			tm = tm.Add(time.Hour)
 			break
 		}
-		nextAnnotation := annotations.Annotations[index+1]
+		nextAnnotation := ranges[index+1]
 		sfx := fmt.Sprintf("a_%d_%d", index, index+1)
 		tags[tagName+"_suffix"] = sfx
 		tags[tagName+"_name"] = fmt.Sprintf("%s - %s", annotation.Name, nextAnnotation.Name)
@@ -296,7 +596,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 		}
 		// Add batch point
 		pt := NewTSPoint(ctx, tagName, "", tags, nil, tm)
-		AddTSPoint(ctx, &pts, pt)
+		AddTSPoint(ctx, &qrPts, pt)
 		tm = tm.Add(time.Hour)
 	}
 
@@ -316,7 +616,7 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 		}
 		// Add batch point
 		pt := NewTSPoint(ctx, tagName, "", tags, nil, tm)
-		AddTSPoint(ctx, &pts, pt)
+		AddTSPoint(ctx, &qrPts, pt)
 		tm = tm.Add(time.Hour)
 
 		// From CNCF join date till now
@@ -333,18 +633,17 @@ func ProcessAnnotations(ctx *Ctx, annotations *Annotations, startDate, joinDate
 		}
 		// Add batch point
 		pt = NewTSPoint(ctx, tagName, "", tags, nil, tm)
-		AddTSPoint(ctx, &pts, pt)
+		AddTSPoint(ctx, &qrPts, pt)
 		tm = tm.Add(time.Hour)
 	}
 
-	// Write the batch
+	// Write the batch, quick ranges are written into a shadow schema and replace live quick ranges in a single transaction
 	if !ctx.SkipTSDB {
-		table := "tquick_ranges"
-		column := "quick_ranges_suffix"
-		if TableExists(ic, ctx, table) && TableColumnExists(ic, ctx, table, column) {
-			ExecSQLWithErr(ic, ctx, fmt.Sprintf("delete from %s where %s like '%%_n'", table, column))
-		}
 		WriteTSPoints(ctx, ic, &pts, "", nil)
+		shadow := NewShadow(ic, ctx)
+		defer shadow.Close(ic, ctx)
+		WriteTSPoints(ctx, shadow.Con, &qrPts, "", nil)
+		shadow.SwapTables(ic, ctx, "t"+tagName)
 	} else if ctx.Debug > 0 {
 		Printf("Skipping annotations series write\n")
 	}
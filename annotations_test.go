@@ -3,6 +3,8 @@ package devstats
 import (
 	lib "devstats"
 	testlib "devstats/test"
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -29,11 +31,13 @@ func TestGetFakeAnnotations(t *testing.T) {
 						Name:        "Project start",
 						Description: lib.ToYMDDate(startDate[0]) + " - project starts",
 						Date:        startDate[0],
+						Category:    lib.AnnotationProject,
 					},
 					{
 						Name:        "First CNCF project join date",
 						Description: lib.ToYMDDate(joinDate[0]),
 						Date:        joinDate[0],
+						Category:    lib.AnnotationProject,
 					},
 				},
 			},
@@ -69,3 +73,128 @@ func TestGetFakeAnnotations(t *testing.T) {
 		}
 	}
 }
+
+func TestAnnotationsConfig(t *testing.T) {
+	proj := lib.Project{MainRepo: "org/main", AnnotationRepos: []string{"org/other", "org/main", ""}}
+	if got, expected := lib.AnnotationRepos(&proj), []string{"org/main", "org/other"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected repos %+v, got %+v", expected, got)
+	}
+	if got := lib.AnnotationRepos(&lib.Project{}); got != nil {
+		t.Errorf("expected no repos, got %+v", got)
+	}
+	sources, err := lib.AnnotationSources(&proj)
+	if err != nil || !reflect.DeepEqual(sources, []string{"tags"}) {
+		t.Errorf("expected default sources, got %+v, %v", sources, err)
+	}
+	proj.AnnotationSources = []string{"releases", "milestones"}
+	sources, err = lib.AnnotationSources(&proj)
+	if err != nil || !reflect.DeepEqual(sources, proj.AnnotationSources) {
+		t.Errorf("expected %+v, got %+v, %v", proj.AnnotationSources, sources, err)
+	}
+	proj.AnnotationSources = []string{"tags", "commits"}
+	if _, err = lib.AnnotationSources(&proj); err == nil {
+		t.Errorf("expected error for unknown annotation source")
+	}
+	if got := lib.QuickRangesCategories(&proj); !reflect.DeepEqual(got, []string{"tag", "project"}) {
+		t.Errorf("expected default quick ranges categories, got %+v", got)
+	}
+	proj.QuickRangesCategories = []string{"release"}
+	if got := lib.QuickRangesCategories(&proj); !reflect.DeepEqual(got, proj.QuickRangesCategories) {
+		t.Errorf("expected %+v, got %+v", proj.QuickRangesCategories, got)
+	}
+}
+
+func TestUniqueAndQuickRangesAnnotations(t *testing.T) {
+	ft := testlib.YMDHMS
+	annotations := []lib.Annotation{
+		{Name: "KubeCon", Date: ft(2018, 5), Category: "conference"},
+		{Name: "v1.0", Description: "release", Date: ft(2017, 2), Category: lib.AnnotationRelease},
+		{Name: "v1.1", Date: ft(2017, 6), Category: lib.AnnotationMilestone},
+		{Name: "v1.0", Description: "tag", Date: ft(2017, 1), Category: lib.AnnotationTag},
+		{Name: "v1.1", Date: ft(2017, 5), Category: lib.AnnotationTag},
+		{Name: "v1.2", Date: ft(2017, 9), Category: lib.AnnotationTag},
+		{Name: "v0.9", Date: ft(2016, 12), Category: lib.AnnotationRelease},
+	}
+	unique := lib.UniqueAnnotations(annotations)
+	release, milestone := annotations[1], annotations[2]
+	release.Category = lib.AnnotationTag
+	milestone.Category = lib.AnnotationTag
+	expected := []lib.Annotation{annotations[0], release, milestone, annotations[5], annotations[6]}
+	if !reflect.DeepEqual(unique, expected) {
+		t.Errorf("expected unique annotations:\n%+v\ngot:\n%+v", expected, unique)
+	}
+	var testCases = []struct {
+		categories []string
+		expected   []lib.Annotation
+	}{
+		{categories: nil, expected: unique},
+		{categories: []string{lib.AnnotationTag}, expected: []lib.Annotation{unique[1], unique[2], unique[3]}},
+		{categories: []string{lib.AnnotationRelease, "conference"}, expected: []lib.Annotation{unique[0], unique[4]}},
+		{categories: []string{"governance"}},
+	}
+	for index, test := range testCases {
+		got := lib.QuickRangesAnnotations(unique, test.categories)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected:\n%+v\ngot:\n%+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestReadCustomAnnotations(t *testing.T) {
+	var ctx lib.Ctx
+	if got := lib.ReadCustomAnnotations(&ctx, "/this/file/does/not/exist.yaml"); len(got.Annotations) != 0 {
+		t.Errorf("expected no annotations for missing file, got %+v", got)
+	}
+	f, err := ioutil.TempFile("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := f.Name()
+	defer func() { _ = os.Remove(fn) }()
+	_, err = f.WriteString(
+		"annotations:\n" +
+			"  - name: KubeCon EU\n    description: \"KubeCon + CloudNativeCon\\nCopenhagen\"\n    date: 2018-05-02\n    category: conference\n" +
+			"  - name: Steering committee\n    date: 2017-10-04T12:00:00Z\n",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	expected := []lib.Annotation{
+		{
+			Name:        "KubeCon EU",
+			Description: "KubeCon + CloudNativeCon Copenhagen",
+			Date:        time.Date(2018, 5, 2, 0, 0, 0, 0, time.UTC),
+			Category:    "conference",
+		},
+		{
+			Name:     "Steering committee",
+			Date:     time.Date(2017, 10, 4, 12, 0, 0, 0, time.UTC),
+			Category: lib.AnnotationEvent,
+		},
+	}
+	got := lib.ReadCustomAnnotations(&ctx, fn)
+	if !reflect.DeepEqual(got.Annotations, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, got.Annotations)
+	}
+}
+
+func TestAnnotationTime(t *testing.T) {
+	ft := testlib.YMDHMS
+	used := make(map[time.Time]struct{})
+	var testCases = []struct {
+		dt       time.Time
+		expected time.Time
+	}{
+		{dt: ft(2017, 5, 1, 10, 20), expected: ft(2017, 5, 1, 10)},
+		{dt: ft(2017, 5, 1, 10, 40), expected: ft(2017, 5, 1, 11)},
+		{dt: ft(2017, 5, 1, 11), expected: ft(2017, 5, 1, 12)},
+		{dt: ft(2017, 5, 1, 9, 59, 59), expected: ft(2017, 5, 1, 9)},
+		{dt: ft(2017, 5, 2), expected: ft(2017, 5, 2)},
+	}
+	for index, test := range testCases {
+		if got := lib.AnnotationTime(used, test.dt); !got.Equal(test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
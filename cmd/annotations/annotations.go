@@ -31,19 +31,24 @@ func makeAnnotations() {
 	var projects lib.AllProjects
 	lib.FatalOnError(yaml.Unmarshal(data, &projects))
 
-	// Get current project's main repo and annotation regexp
+	// Get current project's annotation repos, sources and regexp
 	proj, ok := projects.Projects[ctx.Project]
 	if !ok {
 		lib.Fatalf("project '%s' not found in '%s'", ctx.Project, ctx.ProjectsYaml)
 	}
 
-	// Get annotations using GitHub API and add annotations and quick ranges to TSDB
-	if proj.MainRepo != "" {
-		annotations := lib.GetAnnotations(&ctx, proj.MainRepo, proj.AnnotationRegexp)
-		lib.ProcessAnnotations(&ctx, &annotations, proj.StartDate, proj.JoinDate)
+	// Get annotations from project's repos (tags, releases, milestones) and annotations.yaml
+	// and add annotations and quick ranges to TSDB
+	annotations := lib.GetProjectAnnotations(&ctx, &proj, dataPrefix+ctx.AnnotationsYaml)
+	categories := lib.QuickRangesCategories(&proj)
+	if len(lib.AnnotationRepos(&proj)) > 0 {
+		lib.ProcessAnnotations(&ctx, &annotations, categories, proj.StartDate, proj.JoinDate)
 	} else if proj.StartDate != nil && proj.JoinDate != nil {
-		annotations := lib.GetFakeAnnotations(*proj.StartDate, *proj.JoinDate)
-		lib.ProcessAnnotations(&ctx, &annotations, nil, nil)
+		fake := lib.GetFakeAnnotations(*proj.StartDate, *proj.JoinDate)
+		annotations.Annotations = append(annotations.Annotations, fake.Annotations...)
+		lib.ProcessAnnotations(&ctx, &annotations, categories, nil, nil)
+	} else if len(annotations.Annotations) > 0 {
+		lib.ProcessAnnotations(&ctx, &annotations, categories, nil, nil)
 	}
 }
 
@@ -12,278 +12,99 @@ import (
 	lib "devstats"
 )
 
-// valueDescription - return string description for given float value
-// descFunc specifies how to treat value
-// currently supported:
-// `time_diff_as_string`: return string description of value that holds number of hours passed
-// like 30 -> 1 day 6 hours, 100 -> 4 days 4 hours, etc...
-func valueDescription(descFunc string, value float64) (result string) {
-	switch descFunc {
-	case "time_diff_as_string":
-		return lib.DescriblePeriodInHours(value)
-	default:
-		lib.Printf("Error\nUnknown value description function '%v'\n", descFunc)
-		fmt.Fprintf(os.Stdout, "Error\nUnknown value description function '%v'\n", descFunc)
-		os.Exit(1)
+// Round float64 to int
+func roundF2I(val float64) int {
+	if val < 0.0 {
+		return int(val - 0.5)
 	}
-	return
+	return int(val + 0.5)
 }
 
-// Returns multi row and multi column series names array (different for different rows)
-// Each row must be in format: 'prefix;rowName;series1,series2,..,seriesN' serVal1 serVal2 ... serValN
-// if multivalue is true then rowName is not used for generating series name
-// Series name is independent from rowName, and metric returns "series_name;rowName"
-// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
-func multiRowMultiColumn(expr string, multivalue, escapeValueName bool) (result []string) {
-	ary := strings.Split(expr, ";")
-	pref := ary[0]
-	if pref == "" {
-		lib.Printf("multiRowMultiColumn: Info: prefix '%v' (ary=%+v,expr=%+v,mv=%+v) skipping\n", pref, ary, expr, multivalue)
-		return
-	}
-	splitColumns := strings.Split(ary[2], ",")
-	if multivalue {
-		rowNameAry := strings.Split(ary[1], "`")
-		rowName := rowNameAry[0]
-		if escapeValueName {
-			rowName = lib.NormalizeName(rowName)
-		}
-		if len(rowNameAry) > 1 {
-			rowNameNonMulti := lib.NormalizeName(rowNameAry[1])
-			for _, series := range splitColumns {
-				result = append(result, fmt.Sprintf("%s%s%s;%s", pref, rowNameNonMulti, series, rowName))
-			}
-			return
-		}
-		for _, series := range splitColumns {
-			result = append(result, fmt.Sprintf("%s%s;%s", pref, series, rowName))
-		}
-		return
-	}
-	rowName := lib.NormalizeName(ary[1])
-	if rowName == "" {
-		lib.Printf("multiRowMultiColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
-		return
-	}
-	for _, series := range splitColumns {
-		result = append(result, fmt.Sprintf("%s%s%s", pref, rowName, series))
+// connectSources - connects to metric source databases (cross-project metrics)
+// There is one connection pool per source database, it is shared by all threads
+func connectSources(ctx *lib.Ctx, sources []string) (cons []*sql.DB) {
+	for _, db := range sources {
+		cons = append(cons, lib.PgConnDB(ctx, db))
 	}
 	return
 }
 
-// Return default series names from multi row result single column
-// Each row is "prefix,rowName", value (prefix is hardcoded in metric, so it is assumed safe)
-// and returns array [a_q, b_q, c_q, .., z_q]
-// if multivalue is true then rowName is not used for generating series name
-// Series name is independent from rowName, and metric returns "series_name;rowName"
-// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
-func multiRowSingleColumn(col string, multivalue, escapeValueName bool) (result []string) {
-	ary := strings.Split(col, ",")
-	pref := ary[0]
-	if pref == "" {
-		lib.Printf("multiRowSingleColumn: Info: prefix '%v' (ary=%+v,col=%+v,mv=%+v) skipping\n", pref, ary, col, multivalue)
-		return
+// closeSources - closes metric source databases connections
+func closeSources(cons []*sql.DB) {
+	for _, con := range cons {
+		lib.FatalOnError(con.Close())
 	}
-	if multivalue {
-		rowNameAry := strings.Split(ary[1], "`")
-		rowName := rowNameAry[0]
-		if escapeValueName {
-			rowName = lib.NormalizeName(rowName)
-		}
-		if len(rowNameAry) > 1 {
-			rowNameNonMulti := lib.NormalizeName(rowNameAry[1])
-			return []string{fmt.Sprintf("%s%s;%s", pref, rowNameNonMulti, rowName)}
-		}
-		return []string{fmt.Sprintf("%s;%s", pref, rowName)}
-	}
-	rowName := lib.NormalizeName(ary[1])
-	if rowName == "" {
-		lib.Printf("multiRowSingleColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
-		return
-	}
-	return []string{fmt.Sprintf("%s%s", pref, rowName)}
 }
 
-// Generate name for given series row and period
-func nameForMetricsRow(metric, name string, multivalue, escapeValueName bool) []string {
-	switch metric {
-	case "single_row_multi_column":
-		return strings.Split(name, ",")
-	case "multi_row_single_column":
-		return multiRowSingleColumn(name, multivalue, escapeValueName)
-	case "multi_row_multi_column":
-		return multiRowMultiColumn(name, multivalue, escapeValueName)
-	default:
-		lib.Printf("Error\nUnknown metric '%v'\n", metric)
-		fmt.Fprintf(os.Stdout, "Error\nUnknown metric '%v'\n", metric)
-		os.Exit(1)
+// queryMetric - runs metric SQL on the current database, or on all source databases and combines results
+func queryMetric(ctx *lib.Ctx, sqlc *sql.DB, sourceCons []*sql.DB, combine, sqlQuery string) lib.MetricRows {
+	if len(sourceCons) == 0 {
+		return lib.QueryMetricRows(sqlc, ctx, sqlQuery)
 	}
-	return []string{""}
-}
-
-// Round float64 to int
-func roundF2I(val float64) int {
-	if val < 0.0 {
-		return int(val - 0.5)
+	// Query all source databases in parallel
+	results := make([]lib.MetricRows, len(sourceCons))
+	var wg sync.WaitGroup
+	for i, con := range sourceCons {
+		wg.Add(1)
+		go func(i int, con *sql.DB) {
+			defer wg.Done()
+			results[i] = lib.QueryMetricRows(con, ctx, sqlQuery)
+		}(i, con)
 	}
-	return int(val + 0.5)
+	wg.Wait()
+	res, err := lib.CombineMetricRows(combine, results)
+	lib.FatalOnError(err)
+	return res
 }
 
 func workerThread(
 	ch chan bool,
 	ctx *lib.Ctx,
-	seriesNameOrFunc, sqlQueryOrig, excludeBots, period, desc, mergeSeries string,
-	multivalue, escapeValueName bool,
+	tmpl *lib.SQLTemplate,
+	seriesNameOrFunc, sqlQueryOrig, period, desc, mergeSeries string,
+	multivalue, escapeValueName, typedValues bool,
 	nIntervals int,
 	dtAry, fromAry, toAry []time.Time,
+	sourceCons []*sql.DB,
+	combine string,
+	shadow *lib.Shadow,
 	mut *sync.Mutex,
 ) {
 	// Connect to Postgres DB
 	sqlc := lib.PgConn(ctx)
 	defer func() { lib.FatalOnError(sqlc.Close()) }()
 
+	// Write points into shadow schema if used
+	wcon := sqlc
+	if shadow != nil {
+		wcon = shadow.Con
+	}
+
 	// Get BatchPoints
 	var pts lib.TSPoints
-	sqlQueryOrig = strings.Replace(sqlQueryOrig, "{{n}}", strconv.Itoa(nIntervals)+".0", -1)
-	sqlQueryOrig = strings.Replace(sqlQueryOrig, "{{exclude_bots}}", excludeBots, -1)
+	tmpl = tmpl.With(map[string]interface{}{"n": strconv.Itoa(nIntervals) + ".0"})
 	for idx, dt := range dtAry {
 		from := fromAry[idx]
 		to := toAry[idx]
 
 		// Prepare SQL query
-		sFrom := lib.ToYMDHMSDate(from)
-		sTo := lib.ToYMDHMSDate(to)
-		sqlQuery := strings.Replace(sqlQueryOrig, "{{from}}", sFrom, -1)
-		sqlQuery = strings.Replace(sqlQuery, "{{to}}", sTo, -1)
+		sqlQuery := tmpl.With(map[string]interface{}{"from": from, "to": to}).MustRender(sqlQueryOrig)
 
 		// Execute SQL query
-		rows := lib.QuerySQLWithErr(sqlc, ctx, sqlQuery)
+		rows := queryMetric(ctx, sqlc, sourceCons, combine, sqlQuery)
 
-		// Get Number of columns
+		// Get points for this interval
 		// We support either query returnign single row with single numeric value
 		// Or multiple rows, each containing string (series name) and its numeric value(s)
-		columns, err := rows.Columns()
-		lib.FatalOnError(err)
-		nColumns := len(columns)
-
-		// Use value descriptions?
-		useDesc := desc != ""
-
-		// Metric Results, assume they're floats
-		var (
-			pValue *float64
-			value  float64
-			name   string
-		)
-		// Single row & single column result
-		if nColumns == 1 {
-			rowCount := 0
-			for rows.Next() {
-				lib.FatalOnError(rows.Scan(&pValue))
-				rowCount++
-			}
-			lib.FatalOnError(rows.Err())
-			lib.FatalOnError(rows.Close())
-			if rowCount != 1 {
-				lib.Printf(
-					"Error:\nQuery should return either single value or "+
-						"multiple rows, each containing string and numbers\n"+
-						"Got %d rows, each containing single number\nQuery:%s\n",
-					rowCount, sqlQuery,
-				)
-			}
-			// Handle nulls
-			if pValue != nil {
-				value = *pValue
-			}
-			// In this simplest case 1 row, 1 column - series name is taken directly from YAML (metrics.yaml)
-			// It usually uses `add_period_to_name: true` to have _period suffix, period{=h,d,w,m,q,y}
-			name = seriesNameOrFunc
-			if ctx.Debug > 0 {
-				lib.Printf("%v - %v -> %v, %v\n", from, to, name, value)
-			}
-			// Add batch point
-			fields := map[string]interface{}{"value": value}
-			if useDesc {
-				fields["descr"] = valueDescription(desc, value)
-			}
-			lib.AddTSPoint(
-				ctx,
-				&pts,
-				lib.NewTSPoint(ctx, name, period, nil, fields, dt),
-			)
-		} else if nColumns >= 2 {
-			// Multiple rows, each with (series name, value(s))
-			// Alocate nColumns numeric values (first is series name)
-			pValues := make([]interface{}, nColumns)
-			for i := range columns {
-				pValues[i] = new(sql.RawBytes)
-			}
-			allFields := make(map[string]map[string]interface{})
-			for rows.Next() {
-				// Get row values
-				lib.FatalOnError(rows.Scan(pValues...))
-				// Get first column name, and using it all series names
-				// First column should contain nColumns - 1 names separated by ","
-				name := string(*pValues[0].(*sql.RawBytes))
-				names := nameForMetricsRow(seriesNameOrFunc, name, multivalue, escapeValueName)
-				if ctx.Debug > 0 {
-					lib.Printf("nameForMetricsRow: %s -> %v\n", name, names)
-				}
-				if len(names) > 0 {
-					// Iterate values
-					pFloats := pValues[1:]
-					for idx, pVal := range pFloats {
-						if pVal != nil {
-							value, _ = strconv.ParseFloat(string(*pVal.(*sql.RawBytes)), 64)
-						} else {
-							value = 0.0
-						}
-						if multivalue {
-							nameArr := strings.Split(names[idx], ";")
-							seriesName := nameArr[0]
-							seriesValueName := nameArr[1]
-							if ctx.Debug > 0 {
-								lib.Printf("%v - %v -> %v: %v[%v], %v\n", from, to, idx, seriesName, seriesValueName, value)
-							}
-							if _, ok := allFields[seriesName]; !ok {
-								allFields[seriesName] = make(map[string]interface{})
-							}
-							allFields[seriesName][seriesValueName] = value
-						} else {
-							name = names[idx]
-							if ctx.Debug > 0 {
-								lib.Printf("%v - %v -> %v: %v, %v\n", from, to, idx, name, value)
-							}
-							// Add batch point
-							fields := map[string]interface{}{"value": value}
-							if useDesc {
-								fields["descr"] = valueDescription(desc, value)
-							}
-							lib.AddTSPoint(
-								ctx,
-								&pts,
-								lib.NewTSPoint(ctx, name, period, nil, fields, dt),
-							)
-						}
-					}
-				}
-			}
-			// Multivalue series if any
-			for seriesName, seriesValues := range allFields {
-				lib.AddTSPoint(
-					ctx,
-					&pts,
-					lib.NewTSPoint(ctx, seriesName, period, nil, seriesValues, dt),
-				)
-			}
-			lib.FatalOnError(rows.Err())
-			lib.FatalOnError(rows.Close())
+		intervalPts, err := lib.MetricPoints(ctx, rows, seriesNameOrFunc, period, desc, multivalue, escapeValueName, typedValues, dt)
+		if err != nil {
+			lib.Fatalf("%v - %v: %v\nQuery:%s\n", from, to, err, sqlQuery)
 		}
+		pts = append(pts, intervalPts...)
 	}
 	// Write the batch
 	if !ctx.SkipTSDB {
-		lib.WriteTSPoints(ctx, sqlc, &pts, mergeSeries, mut)
+		lib.WriteTSPoints(ctx, wcon, &pts, mergeSeries, mut)
 	} else if ctx.Debug > 0 {
 		lib.Printf("Skipping series write\n")
 	}
@@ -348,10 +169,13 @@ func setAlreadyComputed(con *sql.DB, ctx *lib.Ctx, key, from string) {
 
 func calcHistogram(
 	ctx *lib.Ctx,
-	seriesNameOrFunc, sqlFile, sqlQuery, excludeBots, interval, intervalAbbr string,
+	tmpl *lib.SQLTemplate,
+	seriesNameOrFunc, sqlFile, sqlQuery, interval, intervalAbbr string,
 	nIntervals int,
 	annotationsRanges, skipPast, multivalue bool,
 	mergeSeries string,
+	sourceCons []*sql.DB,
+	combine string,
 ) {
 	// Connect to Postgres DB
 	sqlc := lib.PgConn(ctx)
@@ -360,6 +184,9 @@ func calcHistogram(
 	// Get BatchPoints
 	var pts lib.TSPoints
 
+	// Live series tables whose period data is replaced
+	clearTables := []string{}
+
 	lib.Printf("calc_metric.go: Histogram running interval '%v,%v' n:%d anno:%v past:%v multi:%v\n", interval, intervalAbbr, nIntervals, annotationsRanges, skipPast, multivalue)
 
 	// If using annotations ranges, then get their values
@@ -389,8 +216,7 @@ func calcHistogram(
 						return
 					}
 				}
-				sqlQuery = lib.PrepareQuickRangeQuery(sqlQuery, period, from, to)
-				sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+				sqlQuery = tmpl.WithQuickRange(period, from, to).MustRender(sqlQuery)
 				if period == "" {
 					dtTo := lib.TimeParseAny(to)
 					prevHour := lib.PrevHourStart(time.Now())
@@ -410,19 +236,14 @@ func calcHistogram(
 		if interval == lib.Quarter {
 			dbInterval = fmt.Sprintf("%d month", nIntervals*3)
 		}
-		sqlQuery = strings.Replace(sqlQuery, "{{period}}", dbInterval, -1)
-		sqlQuery = strings.Replace(sqlQuery, "{{n}}", strconv.Itoa(nIntervals)+".0", -1)
-		sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
+		sqlQuery = tmpl.With(map[string]interface{}{"period": dbInterval, "n": strconv.Itoa(nIntervals) + ".0"}).MustRender(sqlQuery)
 	}
 
 	// Execute SQL query
-	rows := lib.QuerySQLWithErr(sqlc, ctx, sqlQuery)
-	defer func() { lib.FatalOnError(rows.Close()) }()
+	rows := queryMetric(ctx, sqlc, sourceCons, combine, sqlQuery)
 
 	// Get number of columns, for histograms there should be exactly 2 columns
-	columns, err := rows.Columns()
-	lib.FatalOnError(err)
-	nColumns := len(columns)
+	nColumns := len(rows.Columns)
 
 	// Expect 2 columns: string column with name and float column with value
 	var (
@@ -430,9 +251,10 @@ func calcHistogram(
 		name  string
 	)
 	if nColumns == 2 {
-		if !ctx.SkipTSDB {
+		table := "s" + seriesNameOrFunc
+		clearTables = append(clearTables, table)
+		if !ctx.SkipTSDB && !ctx.Shadow {
 			// Drop existing data
-			table := "s" + seriesNameOrFunc
 			if lib.TableExists(sqlc, ctx, table) {
 				lib.ExecSQLWithErr(sqlc, ctx, fmt.Sprintf("delete from "+table+" where period = %s", lib.NValue(1)), intervalAbbr)
 				if ctx.Debug > 0 {
@@ -444,8 +266,14 @@ func calcHistogram(
 		// Add new data
 		tm := lib.TimeParseAny("2014-01-01")
 		rowCount := 0
-		for rows.Next() {
-			lib.FatalOnError(rows.Scan(&name, &value))
+		for _, row := range rows.Rows {
+			if row[0] == nil || row[1] == nil {
+				lib.Fatalf("nulls are unsupported in histogram %v: %+v", seriesNameOrFunc, row)
+			}
+			name = *row[0]
+			var err error
+			value, err = strconv.ParseFloat(*row[1], 64)
+			lib.FatalOnError(err)
 			if ctx.Debug > 0 {
 				lib.Printf("hist %v, %v %v -> %v, %v\n", seriesNameOrFunc, nIntervals, interval, name, value)
 			}
@@ -462,27 +290,18 @@ func calcHistogram(
 		if ctx.Debug > 0 {
 			lib.Printf("hist %v, %v %v: %v rows\n", seriesNameOrFunc, nIntervals, interval, rowCount)
 		}
-		lib.FatalOnError(rows.Err())
 	} else if nColumns >= 3 {
 		var (
 			fValue float64
 			sValue string
 		)
-		columns, err := rows.Columns()
-		lib.FatalOnError(err)
-		nColumns := len(columns)
-		pValues := make([]interface{}, nColumns)
-		for i := range columns {
-			pValues[i] = new(sql.RawBytes)
-		}
 		seriesToClear := make(map[string]time.Time)
-		for rows.Next() {
-			// Get row values
-			lib.FatalOnError(rows.Scan(pValues...))
-			name := string(*pValues[0].(*sql.RawBytes))
-			names := nameForMetricsRow(seriesNameOrFunc, name, multivalue, false)
+		for _, pValues := range rows.Rows {
+			name := lib.MetricString(pValues[0])
+			names, err := lib.MetricRowNames(seriesNameOrFunc, name, multivalue, false)
+			lib.FatalOnError(err)
 			if ctx.Debug > 0 {
-				lib.Printf("nameForMetricsRow: %s -> %v\n", name, names)
+				lib.Printf("MetricRowNames: %s -> %v\n", name, names)
 			}
 			// multivalue will return names as [ser_name1;a,b,c]
 			valueNames := []string{}
@@ -504,21 +323,15 @@ func calcHistogram(
 					va := strings.Split(valueData, ":")
 					valueName := va[0]
 					valueType := va[1]
-					if pValues[i+1] == nil {
-						fields[valueName] = nil
-						lib.Fatalf("nulls are unsupported, name: %+v, i: %d, valueData: %s", name, i, valueData)
-					} else {
-						switch valueType {
-						case "s":
-							v := string(*pValues[i+1].(*sql.RawBytes))
-							fields[valueName] = v
-						case "f":
-							v, e := strconv.ParseFloat(string(*pValues[i+1].(*sql.RawBytes)), 64)
-							lib.FatalOnError(e)
-							fields[valueName] = v
-						default:
-							lib.Fatalf("unknown data type: %v (%v), i: %d, valuedata: %s", valueType, valueData, i, valueData)
-						}
+					switch valueType {
+					case "s":
+						fields[valueName] = lib.MetricString(pValues[i+1])
+					case "f":
+						v, e := strconv.ParseFloat(lib.MetricString(pValues[i+1]), 64)
+						lib.FatalOnError(e)
+						fields[valueName] = v
+					default:
+						lib.Fatalf("unknown data type: %v (%v), i: %d, valuedata: %s", valueType, valueData, i, valueData)
 					}
 				}
 				tm, ok := seriesToClear[name]
@@ -543,16 +356,11 @@ func calcHistogram(
 					for i := 0; i < nNames; i++ {
 						pName := pValues[2*i+1]
 						if pName != nil {
-							sValue = string(*pName.(*sql.RawBytes))
+							sValue = *pName
 						} else {
 							sValue = "(nil)"
 						}
-						pVal := pValues[2*i+2]
-						if pVal != nil {
-							fValue, _ = strconv.ParseFloat(string(*pVal.(*sql.RawBytes)), 64)
-						} else {
-							fValue = 0.0
-						}
+						fValue = lib.MetricFloat(pValues[2*i+2])
 						name = names[i]
 						if ctx.Debug > 0 {
 							lib.Printf("hist %v, %v %v -> %v, %v\n", name, nIntervals, interval, sValue, fValue)
@@ -576,8 +384,10 @@ func calcHistogram(
 				}
 			}
 		}
-		lib.FatalOnError(rows.Err())
-		if len(seriesToClear) > 0 && !ctx.SkipTSDB {
+		for series := range seriesToClear {
+			clearTables = append(clearTables, "s"+series)
+		}
+		if len(seriesToClear) > 0 && !ctx.SkipTSDB && !ctx.Shadow {
 			for series := range seriesToClear {
 				table := "s" + series
 				if lib.TableExists(sqlc, ctx, table) {
@@ -591,8 +401,16 @@ func calcHistogram(
 	}
 	// Write the batch
 	if !ctx.SkipTSDB {
+		if ctx.Shadow {
+			// Replace all period data in a single transaction
+			shadow := lib.NewShadow(sqlc, ctx)
+			lib.WriteTSPoints(ctx, shadow.Con, &pts, mergeSeries, nil)
+			shadow.SwapSeries(sqlc, ctx, intervalAbbr, nil, nil, clearTables...)
+			shadow.Close(sqlc, ctx)
+		} else {
+			lib.WriteTSPoints(ctx, sqlc, &pts, mergeSeries, nil)
+		}
 		// Mark this metric & period as already computed if this is a QR period
-		lib.WriteTSPoints(ctx, sqlc, &pts, mergeSeries, nil)
 		if qrFrom != nil {
 			setAlreadyComputed(sqlc, ctx, sqlFile, *qrFrom)
 		}
@@ -603,8 +421,10 @@ func calcHistogram(
 
 func calcMetric(
 	seriesNameOrFunc, sqlFile, from, to, intervalAbbr string,
-	hist, multivalue, escapeValueName, annotationsRanges, skipPast bool,
-	desc, mergeSeries string,
+	hist, multivalue, escapeValueName, typedValues, annotationsRanges, skipPast bool,
+	desc, mergeSeries string, params map[string]string,
+	sources []string, combine string,
+	retention *lib.RetentionRule,
 ) {
 	if intervalAbbr == "" {
 		lib.Fatalf("you need to define period")
@@ -613,32 +433,29 @@ func calcMetric(
 	var ctx lib.Ctx
 	ctx.Init()
 
-	// Local or cron mode?
-	dataPrefix := lib.DataDir
-	if ctx.Local {
-		dataPrefix = "./"
-	}
-
 	// Read SQL file.
 	bytes, err := lib.ReadFile(&ctx, sqlFile)
 	lib.FatalOnError(err)
 	sqlQuery := string(bytes)
 
-	// Read bots exclusion partial SQL
-	bytes, err = lib.ReadFile(&ctx, dataPrefix+"util_sql/exclude_bots.sql")
-	lib.FatalOnError(err)
-	excludeBots := string(bytes)
+	// SQL template: metric params from metrics.yaml, `{{exclude_bots}}` partial and period abbreviation for conditionals
+	tmpl := lib.NewSQLTemplate(&ctx).SetStrings(params)
+	tmpl.Params["period_abbr"] = intervalAbbr
+
+	// Connect to source databases of cross-project metrics
+	sourceCons := connectSources(&ctx, sources)
+	defer closeSources(sourceCons)
 
 	// Process interval
-	interval, nIntervals, intervalStart, nextIntervalStart, prevIntervalStart := lib.GetIntervalFunctions(intervalAbbr, annotationsRanges)
+	interval, nIntervals, intervalStart, nextIntervalStart, _ := lib.GetIntervalFunctions(intervalAbbr, annotationsRanges)
 
 	if hist {
 		calcHistogram(
 			&ctx,
+			tmpl,
 			seriesNameOrFunc,
 			sqlFile,
 			sqlQuery,
-			excludeBots,
 			interval,
 			intervalAbbr,
 			nIntervals,
@@ -646,6 +463,8 @@ func calcMetric(
 			skipPast,
 			multivalue,
 			mergeSeries,
+			sourceCons,
+			combine,
 		)
 		return
 	}
@@ -654,28 +473,32 @@ func calcMetric(
 	dFrom := lib.TimeParseAny(from)
 	dTo := lib.TimeParseAny(to)
 
-	// Round dates to the given interval
-	dFrom = intervalStart(dFrom)
-	dTo = nextIntervalStart(dTo)
+	// Points older than retention cutoff would be expired by the next retention run
+	if retention != nil {
+		retentionFrom, err := lib.RetentionComputeFrom(retention, dFrom, time.Now())
+		lib.FatalOnError(err)
+		if retentionFrom.After(dFrom) {
+			lib.Printf("calc_metric.go: Retention %s, computing from %v instead of %v\n", retention.String(), retentionFrom, dFrom)
+			dFrom = retentionFrom
+		}
+		if dFrom.After(dTo) {
+			lib.Printf("calc_metric.go: Retention %s, all points before %v are expired, nothing to compute\n", retention.String(), dTo)
+			return
+		}
+	}
 
 	// Get number of CPUs available
 	thrN := lib.GetThreadsNum(&ctx)
 
 	// Run
-	lib.Printf("calc_metric.go: Running (on %d CPUs): %v - %v with interval %s, descriptions '%s', multivalue: %v, escape_value_name: %v\n", thrN, dFrom, dTo, interval, desc, multivalue, escapeValueName)
-	dt := dFrom
+	lib.Printf("calc_metric.go: Running (on %d CPUs): %v - %v with interval %s, descriptions '%s', multivalue: %v, escape_value_name: %v, typed_values: %v\n", thrN, intervalStart(dFrom), nextIntervalStart(dTo), interval, desc, multivalue, escapeValueName, typedValues)
+	if len(sources) > 0 {
+		lib.Printf("calc_metric.go: Cross-project metric, sources: %v, combine: '%s'\n", sources, combine)
+	}
 	dta := [][]time.Time{}
 	ndta := [][]time.Time{}
 	pdta := [][]time.Time{}
-	i := 0
-	var pDt time.Time
-	for dt.Before(dTo) {
-		nDt := nextIntervalStart(dt)
-		if nIntervals <= 1 {
-			pDt = dt
-		} else {
-			pDt = lib.AddNIntervals(dt, 1-nIntervals, nextIntervalStart, prevIntervalStart)
-		}
+	for i, iv := range lib.MetricIntervals(intervalAbbr, annotationsRanges, dFrom, dTo) {
 		t := i % thrN
 		if len(dta) < t+1 {
 			dta = append(dta, []time.Time{})
@@ -686,13 +509,23 @@ func calcMetric(
 		if len(pdta) < t+1 {
 			pdta = append(pdta, []time.Time{})
 		}
-		dta[t] = append(dta[t], dt)
-		ndta[t] = append(ndta[t], nDt)
-		pdta[t] = append(pdta[t], pDt)
-		dt = nDt
-		i++
+		dta[t] = append(dta[t], iv.Dt)
+		ndta[t] = append(ndta[t], iv.To)
+		pdta[t] = append(pdta[t], iv.From)
 	}
 	ldt := len(dta)
+
+	// Shadow schema: recomputed series are swapped into live tables when all intervals are computed
+	var (
+		con    *sql.DB
+		shadow *lib.Shadow
+	)
+	if ctx.Shadow && !ctx.SkipTSDB {
+		con = lib.PgConn(&ctx)
+		defer func() { lib.FatalOnError(con.Close()) }()
+		shadow = lib.NewShadow(con, &ctx)
+		defer shadow.Close(con, &ctx)
+	}
 	if thrN > 1 {
 		mut := &sync.Mutex{}
 		ch := make(chan bool)
@@ -703,18 +536,22 @@ func calcMetric(
 			go workerThread(
 				ch,
 				&ctx,
+				tmpl,
 				seriesNameOrFunc,
 				sqlQuery,
-				excludeBots,
 				intervalAbbr,
 				desc,
 				mergeSeries,
 				multivalue,
 				escapeValueName,
+				typedValues,
 				nIntervals,
 				dta[i],
 				pdta[i],
 				ndta[i],
+				sourceCons,
+				combine,
+				shadow,
 				mut,
 			)
 		}
@@ -729,22 +566,32 @@ func calcMetric(
 			workerThread(
 				nil,
 				&ctx,
+				tmpl,
 				seriesNameOrFunc,
 				sqlQuery,
-				excludeBots,
 				intervalAbbr,
 				desc,
 				mergeSeries,
 				multivalue,
 				escapeValueName,
+				typedValues,
 				nIntervals,
 				dta[0],
 				pdta[0],
 				ndta[0],
+				sourceCons,
+				combine,
+				shadow,
 				nil,
 			)
 		}
 	}
+	if shadow != nil {
+		from, to := intervalStart(dFrom), nextIntervalStart(dTo)
+		// Remove live rows of series that have no data anymore (no points were written to the shadow schema)
+		shadow.SwapSeries(con, &ctx, intervalAbbr, &from, &to, lib.MetricSeriesTables(seriesNameOrFunc, mergeSeries)...)
+		lib.Printf("Swapped shadow series %v - %v\n", from, to)
+	}
 	// Finished
 	lib.Printf("All done.\n")
 }
@@ -754,7 +601,7 @@ func main() {
 	if len(os.Args) < 6 {
 		lib.Printf(
 			"Required series name, SQL file name, from, to, period " +
-				"[series_name_or_func some.sql '2015-08-03' '2017-08-21' h|d|w|m|q|y [hist,desc:time_diff_as_string,multivalue,escape_value_name,annotations_ranges,skip_past]]\n",
+				"[series_name_or_func some.sql '2015-08-03' '2017-08-21' h|d|w|m|q|y [hist,desc:time_diff_as_string,multivalue,escape_value_name,typed_values,annotations_ranges,skip_past,params:url_encoded_params,sources:db1;db2,combine:sum|max|min|distinct,retention:N unit,retention_rollup:period]]\n",
 		)
 		lib.Printf(
 			"Series name (series_name_or_func) will become exact series name if " +
@@ -767,10 +614,17 @@ func main() {
 	hist := false
 	multivalue := false
 	escapeValueName := false
+	typedValues := false
 	annotationsRanges := false
 	skipPast := false
 	desc := ""
 	mergeSeries := ""
+	combine := ""
+	var retention *lib.RetentionRule
+	var (
+		params  map[string]string
+		sources []string
+	)
 	if len(os.Args) > 6 {
 		opts := strings.Split(os.Args[6], ",")
 		optMap := make(map[string]string)
@@ -792,6 +646,9 @@ func main() {
 		if _, ok := optMap["escape_value_name"]; ok {
 			escapeValueName = true
 		}
+		if _, ok := optMap["typed_values"]; ok {
+			typedValues = true
+		}
 		if _, ok := optMap["annotations_ranges"]; ok {
 			annotationsRanges = true
 		}
@@ -804,6 +661,20 @@ func main() {
 		if ms, ok := optMap["merge_series"]; ok {
 			mergeSeries = ms
 		}
+		if p, ok := optMap["params"]; ok {
+			var err error
+			params, err = lib.DecodeMetricParams(p)
+			lib.FatalOnError(err)
+		}
+		if s, ok := optMap["sources"]; ok && s != "" {
+			sources = strings.Split(s, ";")
+		}
+		if c, ok := optMap["combine"]; ok {
+			combine = c
+		}
+		if k, ok := optMap["retention"]; ok {
+			retention = &lib.RetentionRule{Period: os.Args[5], Keep: k, RollUp: optMap["retention_rollup"]}
+		}
 	}
 	lib.Printf("%s...\n", os.Args[2])
 	calcMetric(
@@ -815,10 +686,15 @@ func main() {
 		hist,
 		multivalue,
 		escapeValueName,
+		typedValues,
 		annotationsRanges,
 		skipPast,
 		desc,
 		mergeSeries,
+		params,
+		sources,
+		combine,
+		retention,
 	)
 	dtEnd := time.Now()
 	lib.Printf("Time(%s): %v\n", os.Args[2], dtEnd.Sub(dtStart))
@@ -9,18 +9,6 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-// columns contains list of columns that must be present on a certain series
-type columns struct {
-	Columns []column `yaml:"columns"`
-}
-
-// column contain configuration of columns needed on a specific series
-type column struct {
-	TableRegexp string `yaml:"table_regexp"`
-	Tag         string `yaml:"tag"`
-	Column      string `yaml:"column"`
-}
-
 // Ensure that specific TSDB series have all needed columns
 func ensureColumns() {
 	// Environment context parse
@@ -43,7 +31,7 @@ func ensureColumns() {
 		lib.FatalOnError(err)
 		return
 	}
-	var allColumns columns
+	var allColumns lib.AllColumns
 	lib.FatalOnError(yaml.Unmarshal(data, &allColumns))
 
 	// Per project directory for SQL files
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	lib "devstats"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// readMetricsFile - reads file from project's metrics directory, falls back to shared metrics directory
+// Returns file's contents and path or error if file is not present in both directories
+func readMetricsFile(ctx *lib.Ctx, dataPrefix, project, name string) (data []byte, path string, err error) {
+	for _, dir := range []string{project, "shared"} {
+		path = dataPrefix + lib.Metrics + dir + "/" + name
+		data, err = lib.ReadFile(ctx, path)
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// projectSchema - builds time series tables schema from project's metrics, tags and columns YAMLs
+func projectSchema(ctx *lib.Ctx, dataPrefix, project string) (*lib.TSSchema, []lib.DashboardIssue) {
+	issues := []lib.DashboardIssue{}
+	schema := lib.NewTSSchema(ctx.LastSeries)
+	for _, file := range []string{"metrics.yaml", "metrics_affs.yaml"} {
+		_, path, err := readMetricsFile(ctx, dataPrefix, project, file)
+		if err != nil {
+			continue
+		}
+		allMetrics, err := lib.LoadMetrics(ctx, path)
+		lib.FatalOnError(err)
+		sqls := make(map[string]string)
+		for _, metric := range allMetrics.Metrics {
+			sql, _, err := readMetricsFile(ctx, dataPrefix, project, metric.MetricSQL+".sql")
+			if err != nil {
+				issues = append(issues, lib.DashboardIssue{File: path, Path: metric.Name, Message: "missing SQL file '" + metric.MetricSQL + ".sql'"})
+			}
+			sqls[metric.MetricSQL] = lib.ReplaceMetricParams(string(sql), metric.Params)
+		}
+		schema.AddMetrics(allMetrics, sqls)
+	}
+	for _, file := range []string{"tags.yaml", "tags_affs.yaml"} {
+		data, _, err := readMetricsFile(ctx, dataPrefix, project, file)
+		if err != nil {
+			continue
+		}
+		var tags lib.Tags
+		lib.FatalOnError(yaml.Unmarshal(data, &tags))
+		schema.AddTags(&tags)
+	}
+	data, path, err := readMetricsFile(ctx, dataPrefix, project, "columns.yaml")
+	if err == nil {
+		var allColumns lib.AllColumns
+		lib.FatalOnError(yaml.Unmarshal(data, &allColumns))
+		schema.AddColumns(&allColumns)
+		issues = append(issues, schema.CheckColumns(path)...)
+	}
+	return schema, issues
+}
+
+// jsonFiles - returns dashboards JSON files names in a given directory
+func jsonFiles(dir string) []string {
+	files := []string{}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+			files = append(files, info.Name())
+		}
+	}
+	return files
+}
+
+// projects - returns given projects names or all enabled projects from projects.yaml
+func projects(ctx *lib.Ctx, dataPrefix string, args []string) (map[string]lib.Project, []string) {
+	data, err := lib.ReadFile(ctx, dataPrefix+ctx.ProjectsYaml)
+	lib.FatalOnError(err)
+	var allProjects lib.AllProjects
+	lib.FatalOnError(yaml.Unmarshal(data, &allProjects))
+	if len(args) > 0 {
+		for _, name := range args {
+			if _, ok := allProjects.Projects[name]; !ok {
+				lib.Fatalf("project '%s' not found in '%s'", name, ctx.ProjectsYaml)
+			}
+		}
+		return allProjects.Projects, args
+	}
+	names, _ := lib.GetProjectsList(ctx, &allProjects)
+	return allProjects.Projects, names
+}
+
+// lint - checks all dashboards of given projects, returns number of issues found
+func lint(ctx *lib.Ctx, dataPrefix string, args []string) int {
+	_, names := projects(ctx, dataPrefix, args)
+	nIssues := 0
+	for _, project := range names {
+		schema, issues := projectSchema(ctx, dataPrefix, project)
+		dir := dataPrefix + "grafana/dashboards/" + project + "/"
+		files := jsonFiles(dir)
+		for _, file := range files {
+			data, err := lib.ReadFile(ctx, dir+file)
+			lib.FatalOnError(err)
+			issues = append(issues, lib.LintDashboard(dir+file, data, schema)...)
+		}
+		for _, issue := range issues {
+			lib.Printf("%s\n", issue.String())
+		}
+		lib.Printf("%s: %d dashboards, %d issues\n", project, len(files), len(issues))
+		nIssues += len(issues)
+	}
+	return nIssues
+}
+
+// generate - generates projects dashboards from shared templates
+func generate(ctx *lib.Ctx, dataPrefix, templateDir string, args []string) {
+	all, names := projects(ctx, dataPrefix, args)
+	templates := jsonFiles(templateDir)
+	for _, project := range names {
+		proj := all[project]
+		replaces := lib.DashboardTemplateReplaces(project, &proj)
+		dir := dataPrefix + "grafana/dashboards/" + project + "/"
+		n := 0
+		for _, file := range templates {
+			if !lib.SharedDashboard(&proj, file) {
+				continue
+			}
+			n++
+			template, err := lib.ReadFile(ctx, templateDir+"/"+file)
+			lib.FatalOnError(err)
+			current, _ := ioutil.ReadFile(dir + file)
+			data, err := lib.GenerateDashboard(template, replaces, current)
+			lib.FatalOnError(err)
+			if string(data) == string(current) {
+				continue
+			}
+			lib.Printf("%s%s\n", dir, file)
+			lib.FatalOnError(ioutil.WriteFile(dir+file, data, 0644))
+		}
+		lib.Printf("%s: %d dashboards generated, %d customized skipped\n", project, n, len(templates)-n)
+	}
+}
+
+func main() {
+	dtStart := time.Now()
+	if len(os.Args) < 2 || (os.Args[1] != "lint" && (os.Args[1] != "generate" || len(os.Args) < 3)) {
+		lib.Printf("Usage: %s lint [project1 project2 ... projectN]\n", os.Args[0])
+		lib.Printf("Usage: %s generate template_dir [project1 project2 ... projectN]\n", os.Args[0])
+		lib.Printf("Without projects given it processes all projects from projects.yaml\n")
+		os.Exit(1)
+	}
+
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	nIssues := 0
+	if os.Args[1] == "lint" {
+		nIssues = lint(&ctx, dataPrefix, os.Args[2:])
+	} else {
+		generate(&ctx, dataPrefix, os.Args[2], os.Args[3:])
+	}
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+	if nIssues > 0 {
+		os.Exit(1)
+	}
+}
@@ -127,7 +127,59 @@ func syncAllProjects() bool {
 	return true
 }
 
+// repl - interactive metric development session bound to a project database
+// Project is given as an argument (its database and environment are taken from "projects.yaml")
+// or via GHA2DB_PROJECT and PG_DB environment variables
+func repl(args []string) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read defined projects, they're needed to bind project and for cross-project metrics
+	var projects *lib.AllProjects
+	data, err := lib.ReadFile(&ctx, dataPrefix+ctx.ProjectsYaml)
+	if err == nil {
+		projects = &lib.AllProjects{}
+		lib.FatalOnError(yaml.Unmarshal(data, projects))
+	}
+	if len(args) > 0 {
+		if projects == nil {
+			lib.Fatalf("cannot read projects file: %v", err)
+		}
+		proj, ok := projects.Projects[args[0]]
+		if !ok {
+			lib.Fatalf("project '%s' not found", args[0])
+		}
+		lib.FatalOnError(os.Setenv("GHA2DB_PROJECT", args[0]))
+		lib.FatalOnError(os.Setenv("PG_DB", proj.PDB))
+		for envName, envValue := range proj.Env {
+			lib.FatalOnError(os.Setenv(envName, envValue))
+		}
+		ctx.Init()
+	}
+
+	r := lib.NewRepl(&ctx, os.Stdout)
+	r.Projects = projects
+	defer func() { lib.FatalOnError(r.Close()) }()
+	allMetrics, err := lib.LoadMetrics(&ctx, dataPrefix+ctx.MetricsYaml)
+	if err != nil {
+		fmt.Printf("Cannot load metrics: %v, only 'sql' command can be used to choose metric\n", err)
+	} else {
+		r.Metrics = allMetrics.Metrics
+	}
+	fmt.Printf("Project: '%s', database: '%s', %d metrics, use 'help' to list commands\n", ctx.Project, ctx.PgDB, len(r.Metrics))
+	lib.FatalOnError(r.Run(os.Stdin))
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "repl" {
+		repl(os.Args[2:])
+		return
+	}
 	dtStart := time.Now()
 	synced := syncAllProjects()
 	dtEnd := time.Now()
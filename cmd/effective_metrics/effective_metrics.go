@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	lib "devstats"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// effectiveMetric - metric with resolved SQL file
+type effectiveMetric struct {
+	lib.Metric `yaml:",inline"`
+	SQLFile    string `yaml:"sql_file"`
+}
+
+// showMetrics displays effective metrics set of a project: after resolving `extends`,
+// `include`, overrides and params, with SQL files from project or shared directory
+func showMetrics(ctx *lib.Ctx, dataPrefix, project, metricsYaml string) {
+	ctx.Project = project
+	path := lib.ResolveFile(ctx, dataPrefix+metricsYaml)
+	allMetrics, err := lib.LoadMetrics(ctx, path)
+	lib.FatalOnError(err)
+	dir := dataPrefix + lib.Metrics
+	if project != "" {
+		dir += project + "/"
+	}
+	var effective struct {
+		Params  map[string]string `yaml:"params,omitempty"`
+		Metrics []effectiveMetric `yaml:"metrics"`
+	}
+	effective.Params = allMetrics.Params
+	missing := 0
+	for _, metric := range allMetrics.Metrics {
+		sqlFile := lib.ResolveFile(ctx, dir+metric.MetricSQL+".sql")
+		if _, err := os.Stat(sqlFile); err != nil {
+			lib.Printf("%s: metric '%s': missing SQL file '%s'\n", project, metric.Name, sqlFile)
+			missing++
+		}
+		effective.Metrics = append(effective.Metrics, effectiveMetric{Metric: metric, SQLFile: sqlFile})
+	}
+	data, err := yaml.Marshal(&effective)
+	lib.FatalOnError(err)
+	fmt.Printf("# %s: %s, %d metrics\n%s", project, path, len(effective.Metrics), string(data))
+	if missing > 0 {
+		lib.Fatalf("%s: %d metrics SQL files missing", project, missing)
+	}
+}
+
+func main() {
+	dtStart := time.Now()
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	if len(os.Args) < 2 {
+		// Current project, uses GHA2DB_METRICS_YAML if set
+		showMetrics(&ctx, dataPrefix, ctx.Project, ctx.MetricsYaml)
+	}
+	for _, project := range os.Args[1:] {
+		showMetrics(&ctx, dataPrefix, project, lib.Metrics+project+"/metrics.yaml")
+	}
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+}
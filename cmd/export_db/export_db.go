@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	lib "devstats"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// exportDB exports database tables to a pg_dump compatible plain SQL file `dump.sql` in outDir using export policy
+// All tables are read from a single repeatable read snapshot (exported by the main transaction and shared by all threads)
+// Emails (and other columns configured in the policy) are pseudonymized using a keyed hash, free texts are exported as NULL
+// and identifiers hidden in hide/hide.csv are anonymized. Tables are created with primary keys and indexes (after loading data)
+// It also writes `manifest.json` describing transformations
+func exportDB(ctx *lib.Ctx, db, outDir string, policy *lib.ExportPolicy, key []byte) {
+	hidden := lib.GetHidden(lib.HideCfgFile)
+	con := lib.PgConnDB(ctx, db)
+	defer func() { lib.FatalOnError(con.Close()) }()
+	stx, err := con.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	lib.FatalOnError(err)
+	defer func() { lib.FatalOnError(stx.Rollback()) }()
+	var snapshot string
+	lib.FatalOnError(lib.QueryRowSQLTx(stx, ctx, "select pg_export_snapshot()").Scan(&snapshot))
+	schemas := lib.ExportSchemas(stx, ctx)
+	tables := make(map[string][]lib.GDPRColumn)
+	for _, col := range lib.SchemaColumns(con, ctx) {
+		if policy.ExportTable(col.Table) {
+			tables[col.Table] = append(tables[col.Table], col)
+		}
+	}
+	names := []string{}
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	lib.FatalOnError(os.MkdirAll(outDir, 0755))
+
+	var mtx sync.Mutex
+	results := make(map[string]lib.ExportTableResult)
+	thrN := lib.GetThreadsNum(ctx)
+	ch := make(chan bool)
+	nThreads := 0
+	for _, table := range names {
+		go func(ch chan bool, table string) {
+			con := lib.PgConnDB(ctx, db)
+			defer func() { lib.FatalOnError(con.Close()) }()
+			tx, err := con.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+			lib.FatalOnError(err)
+			lib.ExecSQLTxWithErr(tx, ctx, "set transaction snapshot '"+snapshot+"'")
+			oFile, err := os.Create(filepath.Join(outDir, table+".part"))
+			lib.FatalOnError(err)
+			res := lib.ExportTableData(tx, ctx, tables[table], schemas[table], policy, key, hidden, oFile)
+			lib.FatalOnError(oFile.Close())
+			lib.FatalOnError(tx.Rollback())
+			lib.Printf("%s: %s: exported %d rows, anonymized %d hidden values\n", db, table, res.Rows, res.HiddenValues)
+			mtx.Lock()
+			results[table] = res
+			mtx.Unlock()
+			ch <- true
+		}(ch, table)
+		nThreads++
+		if nThreads == thrN {
+			<-ch
+			nThreads--
+		}
+	}
+	for nThreads > 0 {
+		<-ch
+		nThreads--
+	}
+
+	// Tables data in names order, then primary keys, unique constraints and indexes (like pg_dump does)
+	manifest := lib.ExportManifest{
+		Database:       db,
+		File:           "dump.sql",
+		Snapshot:       snapshot,
+		GeneratedAt:    time.Now(),
+		KeyFingerprint: lib.ExportKeyFingerprint(key),
+		HiddenSHAs:     len(hidden),
+	}
+	oFile, err := os.Create(filepath.Join(outDir, manifest.File))
+	lib.FatalOnError(err)
+	_, err = oFile.WriteString("SET client_encoding = 'UTF8';\nSET standard_conforming_strings = on;\nSET check_function_bodies = false;\n")
+	lib.FatalOnError(err)
+	postData := ""
+	for _, table := range names {
+		res := results[table]
+		manifest.Tables = append(manifest.Tables, res)
+		part := filepath.Join(outDir, table+".part")
+		iFile, err := os.Open(part)
+		lib.FatalOnError(err)
+		_, err = io.Copy(oFile, iFile)
+		lib.FatalOnError(err)
+		lib.FatalOnError(iFile.Close())
+		lib.FatalOnError(os.Remove(part))
+		postData += lib.ExportPostDataSQL(&res, schemas[table])
+	}
+	_, err = oFile.WriteString("\n" + postData)
+	lib.FatalOnError(err)
+	lib.FatalOnError(oFile.Close())
+	lib.ObjectToJSON(manifest, filepath.Join(outDir, "manifest.json"))
+}
+
+func main() {
+	dtStart := time.Now()
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	if len(os.Args) < 3 {
+		fmt.Printf("Required database name and output directory\n")
+		fmt.Printf("Usage: GHA2DB_EXPORT_KEY=secret [GHA2DB_EXPORT_POLICY=export.yaml] %s db output_dir\n", os.Args[0])
+		os.Exit(1)
+	}
+	key := os.Getenv("GHA2DB_EXPORT_KEY")
+	if key == "" {
+		lib.Fatalf("GHA2DB_EXPORT_KEY must be set, it is used to pseudonymize data")
+	}
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+	policyFile := os.Getenv("GHA2DB_EXPORT_POLICY")
+	if policyFile == "" {
+		policyFile = dataPrefix + "export.yaml"
+	}
+	data, err := lib.ReadFile(&ctx, policyFile)
+	lib.FatalOnError(err)
+	var policy lib.ExportPolicy
+	lib.FatalOnError(yaml.Unmarshal(data, &policy))
+	lib.FatalOnError(policy.Validate())
+
+	exportDB(&ctx, os.Args[1], os.Args[2], &policy, []byte(key))
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"database/sql"
 	"fmt"
 	"os"
@@ -14,14 +15,25 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
+// gitCommitsBatch - maximum number of commits from the same repo processed by a single thread
+const gitCommitsBatch = 1000
+
 // dbCommits holds all commits for given projec (DB connection)
 type dbCommits struct {
 	shas             []string
 	repos            []string
 	con              *sql.DB
+	project          string
 	filesSkipPattern string
 }
 
+// dbProject holds project name, its configuration and repos for a given database
+type dbProject struct {
+	name  string
+	proj  lib.Project
+	repos []string
+}
+
 // dirExists checks if given path exist and if is a directory
 func dirExists(path string) (bool, error) {
 	if path[len(path)-1:] == "/" {
@@ -41,7 +53,8 @@ func dirExists(path string) (bool, error) {
 }
 
 // getRepos returns map { 'org' --> list of repos } for all devstats projects
-func getRepos(ctx *lib.Ctx) (map[string]string, map[string][]string) {
+// and map { 'db' --> project using this database }
+func getRepos(ctx *lib.Ctx) (map[string]dbProject, map[string][]string) {
 	// Process all projects, or restrict from environment variable?
 	onlyProjects := make(map[string]bool)
 	selectedProjects := false
@@ -65,12 +78,12 @@ func getRepos(ctx *lib.Ctx) (map[string]string, map[string][]string) {
 
 	var projects lib.AllProjects
 	lib.FatalOnError(yaml.Unmarshal(data, &projects))
-	dbs := make(map[string]string)
+	dbs := make(map[string]dbProject)
 	for name, proj := range projects.Projects {
 		if lib.IsProjectDisabled(ctx, name, proj.Disabled) || (selectedProjects && !onlyProjects[name]) {
 			continue
 		}
-		dbs[proj.PDB] = proj.FilesSkipPattern
+		dbs[proj.PDB] = dbProject{name: name, proj: proj}
 	}
 
 	allRepos := make(map[string][]string)
@@ -92,6 +105,9 @@ func getRepos(ctx *lib.Ctx) (map[string]string, map[string][]string) {
 			repos = append(repos, repo)
 		}
 		lib.FatalOnError(rows.Err())
+		dbProj := dbs[db]
+		dbProj.repos = repos
+		dbs[db] = dbProj
 
 		// Create map of distinct "org" --> list of repos
 		for _, repo := range repos {
@@ -306,7 +322,7 @@ func processRepos(ctx *lib.Ctx, allRepos map[string][]string) {
 
 // processCommitsDB creates/updates mapping between commits and list of files they refer to on databse 'db'
 // using 'query' to get the list of unprocessed commits
-func processCommitsDB(ch chan dbCommits, ctx *lib.Ctx, db, filesSkipPattern, query string) {
+func processCommitsDB(ch chan dbCommits, ctx *lib.Ctx, db, project, filesSkipPattern, query string) {
 	// Result struct to be passed by the channel
 	var commits dbCommits
 
@@ -332,97 +348,99 @@ func processCommitsDB(ch chan dbCommits, ctx *lib.Ctx, db, filesSkipPattern, que
 	dtEnd := time.Now()
 	lib.Printf("Database '%s' processed took %v, new commits: %d\n", db, dtEnd.Sub(dtStart), len(commits.shas))
 	commits.con = con
+	commits.project = project
 	commits.filesSkipPattern = filesSkipPattern
 	ch <- commits
 }
 
-// getCommitFiles get given commit's list of files and saves it in the database
-func getCommitFiles(ch chan int, ctx *lib.Ctx, con *sql.DB, filesSkipPattern *regexp.Regexp, repo, sha string) {
-	// Local or cron mode?
-	cmdPrefix := ""
-	if ctx.Local {
-		cmdPrefix = lib.LocalGitScripts
-	}
+// commitsBatch holds commits from a single repo that are processed by one thread
+type commitsBatch struct {
+	con              *sql.DB
+	filesSkipPattern *regexp.Regexp
+	repo             string
+	shas             []string
+}
 
-	// Get files using shell script that does 'chdir'
-	// We cannot chdir because this is a multithreaded app
-	// And all threads share CWD (current working directory)
-	if ctx.Debug > 1 {
-		lib.Printf("Getting files for commit %s:%s\n", repo, sha)
-	}
-	dtStart := time.Now()
-	rwd := ctx.ReposDir + repo
-	filesStr, err := lib.ExecCommand(
+// skipCommit marks given commit SHA as skipped, so it won't be processed again
+func skipCommit(ctx *lib.Ctx, con *sql.DB, sha string) {
+	lib.ExecSQLWithErr(
+		con,
 		ctx,
-		[]string{cmdPrefix + "git_files.sh", rwd, sha},
-		map[string]string{"GIT_TERMINAL_PROMPT": "0"},
+		lib.InsertIgnore("into gha_skip_commits(sha, dt) "+lib.NValues(2)),
+		lib.AnyArray{sha, time.Now()}...,
 	)
+}
+
+// getCommitsFiles gets list of files for all commits in batch and saves them in the database
+// It reads all batch commits with a single `git log` call, opening repository once for the entire batch
+// Returns statuses counts via channel, see `processCommits` for statuses meaning
+func getCommitsFiles(ch chan map[int]int, ctx *lib.Ctx, batch commitsBatch) {
+	statuses := map[int]int{-1: 0, 0: 0, 1: 0}
+	repo, err := lib.OpenGitRepo(ctx.ReposDir + batch.repo)
+	var commits map[string]*lib.GitCommit
+	dtStart := time.Now()
+	if err == nil {
+		defer func() { lib.FatalOnError(repo.Close()) }()
+		commits, err = repo.CommitsFiles(batch.shas)
+	}
 	dtEnd := time.Now()
 	if err != nil {
 		if ctx.Debug > 1 {
-			lib.Printf("Warning git_files.sh failed: %s:%s (took %v): %+v\n", repo, sha, dtEnd.Sub(dtStart), err)
-			fmt.Fprintf(os.Stderr, "Warning git_files.sh failed: %s:%s (took %v): %+v\n", repo, sha, dtEnd.Sub(dtStart), err)
+			lib.Printf("Warning cannot get commits files %s: %+v\n", batch.repo, err)
+			fmt.Fprintf(os.Stderr, "Warning cannot get commits files %s: %+v\n", batch.repo, err)
 		}
-		lib.ExecSQLWithErr(
-			con,
-			ctx,
-			lib.InsertIgnore("into gha_skip_commits(sha, dt) "+lib.NValues(2)),
-			lib.AnyArray{sha, time.Now()}...,
-		)
-		ch <- -1
+		for _, sha := range batch.shas {
+			skipCommit(ctx, batch.con, sha)
+		}
+		statuses[-1] = len(batch.shas)
+		ch <- statuses
 		return
 	}
-	files := strings.Split(filesStr, "\n")
+	if ctx.Debug > 0 {
+		lib.Printf("Got %d/%d commits from %s (took %v)\n", len(commits), len(batch.shas), batch.repo, dtEnd.Sub(dtStart))
+	}
+	for _, sha := range batch.shas {
+		statuses[getCommitFiles(ctx, batch.con, repo, commits[sha], batch.filesSkipPattern, batch.repo, sha)]++
+	}
+	ch <- statuses
+}
+
+// getCommitFiles saves given commit's list of files in the database
+// Commit is nil when it was not found in the repository (or is at the shallow clone boundary)
+func getCommitFiles(ctx *lib.Ctx, con *sql.DB, repo *lib.GitRepo, commit *lib.GitCommit, filesSkipPattern *regexp.Regexp, repoName, sha string) int {
+	if commit == nil {
+		if ctx.Debug > 1 {
+			lib.Printf("Warning cannot get commit files: %s:%s: not found (shallow: %v)\n", repoName, sha, repo.Shallow)
+			fmt.Fprintf(os.Stderr, "Warning cannot get commit files: %s:%s: not found (shallow: %v)\n", repoName, sha, repo.Shallow)
+		}
+		skipCommit(ctx, con, sha)
+		return -1
+	}
 	nFiles := 0
-	var commitDate time.Time
 
 	// Insert files in transaction: all or none
 	tx, err := con.Begin()
 	lib.FatalOnError(err)
-	for i, data := range files {
-		if i == 0 {
-			unixTimeStamp, err := strconv.ParseInt(data, 10, 64)
-			if err != nil {
-				lib.Printf("Invalid time returned for repo: %s, sha: %s: '%s'\n", repo, sha, data)
-			}
-			lib.FatalOnError(err)
-			commitDate = time.Unix(unixTimeStamp, 0)
-			// fmt.Printf("unixTimeStamp: %v, commitDate: %v\n", unixTimeStamp, commitDate)
-			continue
-		}
-		fileData := strings.TrimSpace(data)
-		if fileData == "" {
-			continue
-		}
-		// Use '♂♀' separator to avoid any character that can appear inside file name
-		fileDataAry := strings.Split(fileData, "♂♀")
-		if len(fileDataAry) != 2 {
-			lib.Fatalf("invalid fileData returned for repo: %s, sha: %s: '%s'", repo, sha, fileData)
-		}
-		fileName := fileDataAry[0]
+	for _, file := range commit.Files {
 		// If file matches exclude pattern, skip it
-		if fileName == "" || (filesSkipPattern != nil && filesSkipPattern.MatchString(fileName)) {
+		if file.Path == "" || (filesSkipPattern != nil && filesSkipPattern.MatchString(file.Path)) {
 			continue
 		}
-		// fileSize can be:
+		// file.Size can be:
 		// > 0 - normal file size
 		// 0 - file created - no contenets
 		// -1 - file referenced in the commit SHA but not found in this commit (means deleted)
-		// -2 - file size returned as "-" from git ls-tree - means some special file, directory
-		fileSize, err := strconv.ParseInt(fileDataAry[1], 10, 64)
-		if err != nil {
-			fileSize = -2
-		}
-		// fmt.Printf("repo: %v, sha: %v, fileData: %v, fileDataAry: %v, fileName: %v, fileSize: %v\n", repo, sha, fileData, fileDataAry, fileName, fileSize)
+		// -2 - special file (submodule)
+		// file.Additions and file.Deletions are -1 for binary files
 		lib.ExecSQLTxWithErr(
 			tx,
 			ctx,
-			lib.InsertIgnore("into gha_commits_files(sha, dt, path, size) "+lib.NValues(4)),
-			lib.AnyArray{sha, commitDate, fileName, fileSize}...,
+			lib.InsertIgnore("into gha_commits_files(sha, dt, path, size, additions, deletions, language) "+lib.NValues(7)),
+			lib.AnyArray{sha, commit.Date, file.Path, file.Size, file.Additions, file.Deletions, lib.FileLanguage(file.Path)}...,
 		)
 		nFiles++
 	}
-	// Some commits have no files (for example only renames)
+	// Some commits have no files (for example merge commits or only changes in skipped files)
 	// Mark them as skipped not to process again
 	if nFiles == 0 {
 		lib.ExecSQLTxWithErr(
@@ -433,22 +451,173 @@ func getCommitFiles(ch chan int, ctx *lib.Ctx, con *sql.DB, filesSkipPattern *re
 		)
 		// Commit transaction
 		lib.FatalOnError(tx.Commit())
-		ch <- 0
-		return
+		return 0
 	}
 	// Commit transaction
 	lib.FatalOnError(tx.Commit())
 	if ctx.Debug > 1 {
-		lib.Printf("Got %s:%s commit: %d files: took %v\n", repo, sha, nFiles, dtEnd.Sub(dtStart))
+		lib.Printf("Got %s:%s commit: %d files\n", repoName, sha, nFiles)
+	}
+	return 1
+}
+
+// backfillCommitsFilesLanguages - sets language for commits files saved before languages were stored
+func backfillCommitsFilesLanguages(ctx *lib.Ctx, con *sql.DB) {
+	rows := lib.QuerySQLWithErr(con, ctx, "select distinct path from gha_commits_files where language is null")
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	paths := make(map[string][]string)
+	path := ""
+	n := 0
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&path))
+		lang := lib.FileLanguage(path)
+		paths[lang] = append(paths[lang], path)
+		n++
+	}
+	lib.FatalOnError(rows.Err())
+	if n == 0 {
+		return
+	}
+	dtStart := time.Now()
+	for lang, langPaths := range paths {
+		for from := 0; from < len(langPaths); from += 1000 {
+			to := from + 1000
+			if to > len(langPaths) {
+				to = len(langPaths)
+			}
+			args := []interface{}{lang}
+			values := []string{}
+			for _, path := range langPaths[from:to] {
+				args = append(args, path)
+				values = append(values, lib.NValue(len(args)))
+			}
+			lib.ExecSQLWithErr(
+				con,
+				ctx,
+				"update gha_commits_files set language = $1 where language is null and path in ("+strings.Join(values, ", ")+")",
+				args...,
+			)
+		}
+	}
+	dtEnd := time.Now()
+	lib.Printf("Set languages for %d commits files paths, took %v\n", n, dtEnd.Sub(dtStart))
+}
+
+// backfillCommitsFilesLines - sets additions and deletions for commits files saved before line stats were stored
+// It reads all such commits again from repositories clones, one `git log` call per repository batch
+func backfillCommitsFilesLines(ctx *lib.Ctx, con *sql.DB, db string) {
+	rows := lib.QuerySQLWithErr(
+		con,
+		ctx,
+		"select distinct cf.sha, c.dup_repo_name from gha_commits_files cf, gha_commits c "+
+			"where cf.sha = c.sha and cf.additions is null",
+	)
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	repoShas := make(map[string][]string)
+	sha, repo := "", ""
+	n := 0
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&sha, &repo))
+		repoShas[repo] = append(repoShas[repo], sha)
+		n++
 	}
+	lib.FatalOnError(rows.Err())
+	if n == 0 {
+		return
+	}
+	dtStart := time.Now()
+	updated, failed := 0, 0
+	for repoName, shas := range repoShas {
+		repo, err := lib.OpenGitRepo(ctx.ReposDir + repoName)
+		if err != nil {
+			lib.Printf("Warning cannot open git repository %s: %+v\n", repoName, err)
+			failed += len(shas)
+			continue
+		}
+		for from := 0; from < len(shas); from += gitCommitsBatch {
+			to := from + gitCommitsBatch
+			if to > len(shas) {
+				to = len(shas)
+			}
+			commits, err := repo.CommitsFiles(shas[from:to])
+			if err != nil {
+				lib.Printf("Warning cannot get commits files %s: %+v\n", repoName, err)
+				failed += to - from
+				continue
+			}
+			failed += to - from - len(commits)
+			for _, commit := range commits {
+				tx, err := con.Begin()
+				lib.FatalOnError(err)
+				for _, file := range commit.Files {
+					lib.ExecSQLTxWithErr(
+						tx,
+						ctx,
+						"update gha_commits_files set additions = $1, deletions = $2 "+
+							"where sha = $3 and path = $4 and additions is null",
+						lib.AnyArray{file.Additions, file.Deletions, commit.SHA, file.Path}...,
+					)
+				}
+				lib.FatalOnError(tx.Commit())
+				updated++
+			}
+		}
+		lib.FatalOnError(repo.Close())
+	}
+	// Events commits files are copies of commits files
+	lib.ExecSQLWithErr(
+		con,
+		ctx,
+		"update gha_events_commits_files ecf set additions = cf.additions, deletions = cf.deletions "+
+			"from gha_commits_files cf where ecf.sha = cf.sha and ecf.path = ecf.dup_repo_name || '/' || cf.path "+
+			"and ecf.additions is null and cf.additions is not null",
+	)
+	dtEnd := time.Now()
+	lib.Printf("%s: set lines stats for %d/%d commits, %d failed, took %v\n", db, updated, n, failed, dtEnd.Sub(dtStart))
+}
+
+// backfillCommitsFilesDB - sets languages and lines stats of commits files saved before they were stored on a given database
+func backfillCommitsFilesDB(ch chan int, ctx *lib.Ctx, db string) {
+	con := lib.PgConnDB(ctx, db)
+	backfillCommitsFilesLanguages(ctx, con)
+	backfillCommitsFilesLines(ctx, con, db)
+	lib.FatalOnError(con.Close())
 	ch <- 1
 }
 
+// backfillCommitsFiles - one-off mode, sets languages and lines stats of commits files saved before they were stored
+// Both need full `gha_commits_files` scans, so they are not run on every hourly sync
+func backfillCommitsFiles(ctx *lib.Ctx, dbs map[string]dbProject) {
+	dtStart := time.Now()
+	thrN := lib.GetThreadsNum(ctx)
+	ch := make(chan int)
+	nThreads := 0
+	for db := range dbs {
+		go backfillCommitsFilesDB(ch, ctx, db)
+		nThreads++
+		if nThreads == thrN {
+			<-ch
+			nThreads--
+		}
+	}
+	for nThreads > 0 {
+		<-ch
+		nThreads--
+	}
+	dtEnd := time.Now()
+	lib.Printf("Backfilled commits files, took %v\n", dtEnd.Sub(dtStart))
+}
+
 // postprocessCommitsDB - calls given SQL on a given database
 // to postprocess just created commit SHAs-files connections
-func postprocessCommitsDB(ch chan int, ctx *lib.Ctx, con *sql.DB, query string) {
+// then updates lines stats and languages of already existing connections
+// then applies project's file path based repository groups rules
+func postprocessCommitsDB(ch chan int, ctx *lib.Ctx, con *sql.DB, project, query, updateQuery string) {
 	_, err := con.Query(query)
 	lib.FatalOnError(err)
+	lib.ExecSQLWithErr(con, ctx, updateQuery)
+	filesGroups := lib.ReadFilesGroups(lib.FilesGroupsYaml(ctx, project))
+	lib.ProcessFilesGroups(con, ctx, &filesGroups)
 	// Close connection
 	lib.FatalOnError(con.Close())
 	ch <- 1
@@ -457,7 +626,7 @@ func postprocessCommitsDB(ch chan int, ctx *lib.Ctx, con *sql.DB, query string)
 // processCommits process all databases given in `dbs`
 // on each database it creates/updates mapping between commits and list of files they refer to
 // It is multithreaded processing up to NCPU databases at the same time
-func processCommits(ctx *lib.Ctx, dbs map[string]string) {
+func processCommits(ctx *lib.Ctx, dbs map[string]dbProject) {
 	// Read SQL to get commits to sync from 'util_sql/list_unprocessed_commits.sql' file.
 	// Local or cron mode?
 	dataPrefix := lib.DataDir
@@ -477,8 +646,8 @@ func processCommits(ctx *lib.Ctx, dbs map[string]string) {
 	chC := make(chan dbCommits)
 	nThreads := 0
 	allCommits := []dbCommits{}
-	for db, filesSkipPattern := range dbs {
-		go processCommitsDB(chC, ctx, db, filesSkipPattern, sqlQuery)
+	for db, dbProj := range dbs {
+		go processCommitsDB(chC, ctx, db, dbProj.name, dbProj.proj.FilesSkipPattern, sqlQuery)
 		nThreads++
 		if nThreads == thrN {
 			commits := <-chC
@@ -494,13 +663,37 @@ func processCommits(ctx *lib.Ctx, dbs map[string]string) {
 	dtEnd := time.Now()
 	lib.Printf("Got new commits list: took %v\n", dtEnd.Sub(dtStart))
 
-	// Set non-fatal exec mode, we want to run sync for next project(s) if current fails
-	// Also set quite mode, many git-pulls or git-clones can fail and this is not needed to log it to DB
-	// User can set higher debug level and run manually to debug this
-	// Also set capture command's stdout mode
-	ctx.ExecFatal = false
-	ctx.ExecQuiet = true
-	ctx.ExecOutput = true
+	// Group commits by repository, and split them into batches
+	// Each batch is processed by a single thread that opens git repository once
+	batches := []commitsBatch{}
+	for _, commits := range allCommits {
+		var re *regexp.Regexp
+		if commits.filesSkipPattern != "" {
+			re = regexp.MustCompile(commits.filesSkipPattern)
+		}
+		repoShas := make(map[string][]string)
+		for i, sha := range commits.shas {
+			repo := commits.repos[i]
+			repoShas[repo] = append(repoShas[repo], sha)
+		}
+		for repo, shas := range repoShas {
+			for from := 0; from < len(shas); from += gitCommitsBatch {
+				to := from + gitCommitsBatch
+				if to > len(shas) {
+					to = len(shas)
+				}
+				batches = append(
+					batches,
+					commitsBatch{
+						con:              commits.con,
+						filesSkipPattern: re,
+						repo:             repo,
+						shas:             shas[from:to],
+					},
+				)
+			}
+		}
+	}
 
 	// Create final 'commits - file list' associations
 	dtStart = time.Now()
@@ -519,32 +712,27 @@ func processCommits(ctx *lib.Ctx, dbs map[string]string) {
 	for _, commits := range allCommits {
 		allN += len(commits.shas)
 	}
-	// process all commits
-	ch := make(chan int)
-	nThreads = 0
-	for _, commits := range allCommits {
-		con := commits.con
-		filesSkipPattern := commits.filesSkipPattern
-		var re *regexp.Regexp
-		if filesSkipPattern != "" {
-			re = regexp.MustCompile(filesSkipPattern)
+	// process all batches
+	ch := make(chan map[int]int)
+	addStatuses := func(batchStatuses map[int]int) {
+		for status, n := range batchStatuses {
+			statuses[status] += n
+			checked += n
 		}
-		for i, sha := range commits.shas {
-			repo := commits.repos[i]
-			go getCommitFiles(ch, ctx, con, re, repo, sha)
-			nThreads++
-			if nThreads == thrN {
-				statuses[<-ch]++
-				nThreads--
-				checked++
-				lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, repo)
-			}
+	}
+	nThreads = 0
+	for _, batch := range batches {
+		go getCommitsFiles(ch, ctx, batch)
+		nThreads++
+		if nThreads == thrN {
+			addStatuses(<-ch)
+			nThreads--
+			lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, batch.repo)
 		}
 	}
 	for nThreads > 0 {
-		statuses[<-ch]++
+		addStatuses(<-ch)
 		nThreads--
-		checked++
 		lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, "final join...")
 	}
 	dtEnd = time.Now()
@@ -567,6 +755,7 @@ func processCommits(ctx *lib.Ctx, dbs map[string]string) {
 	// This SQL updates 'gha_events_commits_files' table that
 	// holds connections between commits SHA and events that refer to it
 	// So we can query for files modified in the given events (via commits)
+	// Then apply file path based repo groups from 'metrics/{{project}}/files_groups.yaml' (if present)
 	dtStart = time.Now()
 	bytes, err = lib.ReadFile(
 		ctx,
@@ -574,25 +763,687 @@ func processCommits(ctx *lib.Ctx, dbs map[string]string) {
 	)
 	lib.FatalOnError(err)
 	sqlQuery = string(bytes)
-	ch = make(chan int)
+	bytes, err = lib.ReadFile(
+		ctx,
+		dataPrefix+"util_sql/update_events_commits_files.sql",
+	)
+	lib.FatalOnError(err)
+	updateQuery := string(bytes)
+	chP := make(chan int)
 	nThreads = 0
 	for _, commits := range allCommits {
 		con := commits.con
-		go postprocessCommitsDB(ch, ctx, con, sqlQuery)
+		go postprocessCommitsDB(chP, ctx, con, commits.project, sqlQuery, updateQuery)
 		nThreads++
 		if nThreads == thrN {
-			<-ch
+			<-chP
 			nThreads--
 		}
 	}
 	for nThreads > 0 {
-		<-ch
+		<-chP
 		nThreads--
 	}
 	dtEnd = time.Now()
 	lib.Printf("Postprocessed all new commits, took %v\n", dtEnd.Sub(dtStart))
 }
 
+// getOwners gets given repo's owners files at a given revision and saves parsed data in the database
+// For "HEAD" ref it replaces previous data, for tags (dt given) data is saved once
+func getOwners(ch chan int, ctx *lib.Ctx, con *sql.DB, repo, ref string, dt *time.Time) {
+	// Local or cron mode?
+	cmdPrefix := ""
+	if ctx.Local {
+		cmdPrefix = lib.LocalGitScripts
+	}
+
+	// Tags data never changes, so only process them once
+	if dt != nil {
+		rows := lib.QuerySQLWithErr(
+			con,
+			ctx,
+			"select 1 from gha_owners where repo = $1 and ref = $2 limit 1",
+			repo,
+			ref,
+		)
+		defer func() { lib.FatalOnError(rows.Close()) }()
+		got := false
+		for rows.Next() {
+			got = true
+		}
+		lib.FatalOnError(rows.Err())
+		if got {
+			ch <- 0
+			return
+		}
+	}
+
+	// Get owners files using shell script that does 'chdir'
+	// We cannot chdir because this is a multithreaded app
+	// And all threads share CWD (current working directory)
+	if ctx.Debug > 1 {
+		lib.Printf("Getting owners for %s:%s\n", repo, ref)
+	}
+	dtStart := time.Now()
+	rwd := ctx.ReposDir + repo
+	filesStr, err := lib.ExecCommand(
+		ctx,
+		[]string{cmdPrefix + "git_owners.sh", rwd, ref},
+		map[string]string{"GIT_TERMINAL_PROMPT": "0"},
+	)
+	dtEnd := time.Now()
+	if err != nil {
+		if ctx.Debug > 1 {
+			lib.Printf("Warning git_owners.sh failed: %s:%s (took %v): %+v\n", repo, ref, dtEnd.Sub(dtStart), err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning git_owners.sh failed: %s:%s (took %v): %+v\n", repo, ref, dtEnd.Sub(dtStart), err)
+		ch <- -1
+		return
+	}
+
+	// First line is a commit date, then each file starts with an empty line and '♂♀file/path' line followed by its contents
+	// Use '♂♀' separator to avoid any character that can appear inside file name
+	// Newline added before each separator (and the final one) is not a part of file's contents
+	lines := strings.Split(filesStr, "\n")
+	unixTimeStamp, err := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	if err != nil {
+		lib.Printf("Invalid time returned for repo: %s, ref: %s: '%s'\n", repo, ref, lines[0])
+	}
+	lib.FatalOnError(err)
+	if dt == nil {
+		commitDate := time.Unix(unixTimeStamp, 0)
+		dt = &commitDate
+	}
+	files := make(map[string][]byte)
+	fileName := ""
+	endFile := func() {
+		if fileName != "" {
+			files[fileName] = bytes.TrimSuffix(files[fileName], []byte("\n"))
+		}
+	}
+	for _, line := range lines[1:] {
+		if strings.HasPrefix(line, "♂♀") {
+			endFile()
+			fileName = line[len("♂♀"):]
+			files[fileName] = []byte{}
+			continue
+		}
+		if fileName == "" {
+			continue
+		}
+		files[fileName] = append(files[fileName], []byte(line+"\n")...)
+	}
+	endFile()
+	owners, aliases, errs := lib.ParseAllOwners(files)
+	for fn, err := range errs {
+		fmt.Fprintf(os.Stderr, "Warning: %s:%s: cannot parse '%s': %+v\n", repo, ref, fn, err)
+	}
+
+	// Insert owners in transaction: all or none
+	tx, err := con.Begin()
+	lib.FatalOnError(err)
+	lib.ExecSQLTxWithErr(tx, ctx, "delete from gha_owners where repo = $1 and ref = $2", repo, ref)
+	lib.ExecSQLTxWithErr(tx, ctx, "delete from gha_owners_aliases where repo = $1 and ref = $2", repo, ref)
+	for _, owner := range owners {
+		lib.ExecSQLTxWithErr(
+			tx,
+			ctx,
+			lib.InsertIgnore("into gha_owners(repo, ref, dt, file, path, role, login) "+lib.NValues(7)),
+			lib.AnyArray{repo, ref, *dt, owner.File, owner.Path, owner.Role, lib.TruncToBytes(owner.Login, 120)}...,
+		)
+	}
+	for _, alias := range aliases {
+		lib.ExecSQLTxWithErr(
+			tx,
+			ctx,
+			lib.InsertIgnore("into gha_owners_aliases(repo, ref, dt, file, alias, login) "+lib.NValues(6)),
+			lib.AnyArray{repo, ref, *dt, alias.File, lib.TruncToBytes(alias.Alias, 160), lib.TruncToBytes(alias.Login, 120)}...,
+		)
+	}
+	lib.FatalOnError(tx.Commit())
+	if ctx.Debug > 1 {
+		lib.Printf("Got %s:%s owners: %d files, %d owners, %d aliases: took %v\n", repo, ref, len(files), len(owners), len(aliases), dtEnd.Sub(dtStart))
+	}
+	if len(owners) == 0 && len(aliases) == 0 {
+		ch <- 0
+		return
+	}
+	ch <- 1
+}
+
+// processOwners process all databases given in `dbs`
+// It imports owners files data for all database's repos at HEAD
+// and for project's main repo at each annotation tag
+// It is multithreaded processing up to NCPU repos at the same time
+func processOwners(ctx *lib.Ctx, dbs map[string]dbProject) {
+	// Set non-fatal exec mode, we want to process next repo(s) if current fails
+	// Also set quite mode, many repos can be missing or failing and this is not needed to log it to DB
+	// User can set higher debug level and run manually to debug this
+	// Also set capture command's stdout mode
+	ctx.ExecFatal = false
+	ctx.ExecQuiet = true
+	ctx.ExecOutput = true
+
+	dtStart := time.Now()
+	lastTime := dtStart
+	thrN := lib.GetThreadsNum(ctx)
+	// statuses:
+	// -1: error
+	// 0: no owners data (or already processed tag)
+	// 1: owners data saved
+	statuses := map[int]int{-1: 0, 0: 0, 1: 0}
+	allN := 0
+	checked := 0
+	for _, dbProj := range dbs {
+		allN += len(dbProj.repos)
+	}
+	ch := make(chan int)
+	nThreads := 0
+	for db, dbProj := range dbs {
+		con := lib.PgConnDB(ctx, db)
+		defer func() { lib.FatalOnError(con.Close()) }()
+		refs := []string{}
+		repos := []string{}
+		dts := []*time.Time{}
+		for _, repo := range dbProj.repos {
+			refs = append(refs, "HEAD")
+			repos = append(repos, repo)
+			dts = append(dts, nil)
+		}
+		mainRepo := dbProj.proj.MainRepo
+		if mainRepo != "" {
+			exists, err := dirExists(ctx.ReposDir + mainRepo)
+			lib.FatalOnError(err)
+			if exists {
+				annotations := lib.GetAnnotations(ctx, mainRepo, dbProj.proj.AnnotationRegexp)
+				for i := range annotations.Annotations {
+					annotation := &annotations.Annotations[i]
+					refs = append(refs, annotation.Name)
+					repos = append(repos, mainRepo)
+					dts = append(dts, &annotation.Date)
+				}
+				allN += len(annotations.Annotations)
+			}
+		}
+		for i, repo := range repos {
+			go getOwners(ch, ctx, con, repo, refs[i], dts[i])
+			nThreads++
+			if nThreads == thrN {
+				statuses[<-ch]++
+				nThreads--
+				checked++
+				lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, repo)
+			}
+		}
+	}
+	for nThreads > 0 {
+		statuses[<-ch]++
+		nThreads--
+		checked++
+		lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, "final join...")
+	}
+	dtEnd := time.Now()
+	lib.Printf(
+		"Owners: %d repos/tags with owners data, %d without data or already processed, %d failed, took %v\n",
+		statuses[1],
+		statuses[0],
+		statuses[-1],
+		dtEnd.Sub(dtStart),
+	)
+}
+
+// locRef - single ref to compute lines of code for
+// Annotation refs of repos other than main repo are computed at their last commit before annotation date
+type locRef struct {
+	ref    string
+	dt     *time.Time
+	atDate bool
+}
+
+// getLOC - computes lines of code per language of a given repo for all given refs and saves them in `gha_loc`
+// HEAD data is replaced on each run, annotation tags data never changes, so tags are only processed once
+func getLOC(ch chan int, ctx *lib.Ctx, con *sql.DB, repoName string, filesSkipPattern *regexp.Regexp, refs []locRef) {
+	dtStart := time.Now()
+	repo, err := lib.OpenGitRepo(ctx.ReposDir + repoName)
+	if err != nil {
+		if ctx.Debug > 1 {
+			lib.Printf("Warning: cannot open %s: %+v\n", repoName, err)
+		}
+		ch <- -1
+		return
+	}
+	defer func() { _ = repo.Close() }()
+	saved := 0
+	for _, ref := range refs {
+		if ref.dt != nil {
+			rows := lib.QuerySQLWithErr(
+				con,
+				ctx,
+				"select 1 from gha_loc where repo = $1 and ref = $2 limit 1",
+				repoName,
+				ref.ref,
+			)
+			got := false
+			for rows.Next() {
+				got = true
+			}
+			lib.FatalOnError(rows.Err())
+			lib.FatalOnError(rows.Close())
+			if got {
+				continue
+			}
+		}
+		sha := ref.ref
+		if ref.atDate {
+			sha, err = repo.CommitAt("HEAD", *ref.dt)
+			if err == nil && sha == "" {
+				// Repo didn't exist at annotation date
+				continue
+			}
+		} else {
+			sha, err = repo.ResolveRef(ref.ref)
+		}
+		var locs []lib.GitLOC
+		if err == nil {
+			locs, err = repo.LinesOfCode(sha, filesSkipPattern)
+		}
+		dt := ref.dt
+		if err == nil && dt == nil {
+			var commitDate time.Time
+			commitDate, err = repo.CommitDate(sha)
+			dt = &commitDate
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: cannot compute lines of code %s:%s: %+v\n", repoName, ref.ref, err)
+			ch <- -1
+			return
+		}
+		// Insert lines of code in transaction: all or none
+		tx, err := con.Begin()
+		lib.FatalOnError(err)
+		lib.ExecSQLTxWithErr(tx, ctx, "delete from gha_loc where repo = $1 and ref = $2", repoName, ref.ref)
+		for _, loc := range locs {
+			lib.ExecSQLTxWithErr(
+				tx,
+				ctx,
+				lib.InsertIgnore("into gha_loc(repo, ref, dt, sha, language, files, lines, size) "+lib.NValues(8)),
+				lib.AnyArray{repoName, ref.ref, *dt, sha, loc.Language, loc.Files, loc.Lines, loc.Size}...,
+			)
+		}
+		lib.FatalOnError(tx.Commit())
+		saved++
+	}
+	if ctx.Debug > 1 {
+		lib.Printf("Got %s lines of code for %d/%d refs: took %v\n", repoName, saved, len(refs), time.Now().Sub(dtStart))
+	}
+	if saved == 0 {
+		ch <- 0
+		return
+	}
+	ch <- 1
+}
+
+// processLOC process all databases given in `dbs`
+// It computes lines of code per language for all database's repos at HEAD and at each annotation
+// Project's main repo uses annotation tags, other repos use their last commits before annotation dates
+// It is multithreaded processing up to NCPU repos at the same time
+func processLOC(ctx *lib.Ctx, dbs map[string]dbProject) {
+	dtStart := time.Now()
+	lastTime := dtStart
+	thrN := lib.GetThreadsNum(ctx)
+	// statuses:
+	// -1: error
+	// 0: nothing new to compute
+	// 1: lines of code data saved
+	statuses := map[int]int{-1: 0, 0: 0, 1: 0}
+	allN := 0
+	checked := 0
+	for _, dbProj := range dbs {
+		allN += len(dbProj.repos)
+	}
+	ch := make(chan int)
+	nThreads := 0
+	for db, dbProj := range dbs {
+		con := lib.PgConnDB(ctx, db)
+		defer func() { lib.FatalOnError(con.Close()) }()
+		var filesSkipPattern *regexp.Regexp
+		if dbProj.proj.FilesSkipPattern != "" {
+			filesSkipPattern = regexp.MustCompile(dbProj.proj.FilesSkipPattern)
+		}
+		var annotations lib.Annotations
+		mainRepo := dbProj.proj.MainRepo
+		if mainRepo != "" {
+			exists, err := dirExists(ctx.ReposDir + mainRepo)
+			lib.FatalOnError(err)
+			if exists {
+				annotations = lib.GetAnnotations(ctx, mainRepo, dbProj.proj.AnnotationRegexp)
+			}
+		}
+		for _, repo := range dbProj.repos {
+			refs := []locRef{{ref: "HEAD"}}
+			for i := range annotations.Annotations {
+				annotation := &annotations.Annotations[i]
+				refs = append(refs, locRef{ref: annotation.Name, dt: &annotation.Date, atDate: repo != mainRepo})
+			}
+			go getLOC(ch, ctx, con, repo, filesSkipPattern, refs)
+			nThreads++
+			if nThreads == thrN {
+				statuses[<-ch]++
+				nThreads--
+				checked++
+				lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, repo)
+			}
+		}
+	}
+	for nThreads > 0 {
+		statuses[<-ch]++
+		nThreads--
+		checked++
+		lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, "final join...")
+	}
+	dtEnd := time.Now()
+	lib.Printf(
+		"Lines of code: %d repos with new data, %d without new data, %d failed, took %v\n",
+		statuses[1],
+		statuses[0],
+		statuses[-1],
+		dtEnd.Sub(dtStart),
+	)
+}
+
+// gitActor - actor used for commits imported from git repositories
+type gitActor struct {
+	id    int64
+	login string
+}
+
+// gitCommitActor - returns actor for a given commit's author
+// Author is found by email in `gha_actors_emails` (preferring GitHub actors over artificial ones)
+// When not found, artificial actor (negative ID) is created with "git-<SHA1 of lowercased email>" login,
+// so no email is used as login, email is only stored in `gha_actors_emails`
+// New actors are inserted in a given transaction (the one that inserts commits batch)
+func gitCommitActor(ctx *lib.Ctx, con *sql.DB, tx *sql.Tx, actors map[string]gitActor, name, email string, maybeHide func(string) string) gitActor {
+	key := strings.ToLower(email)
+	if key == "" {
+		key = name
+	}
+	if actor, ok := actors[key]; ok {
+		return actor
+	}
+	actor := gitActor{}
+	rows := lib.QuerySQLWithErr(
+		con,
+		ctx,
+		"select a.id, a.login from gha_actors a, gha_actors_emails ae "+
+			"where a.id = ae.actor_id and lower(ae.email) = $1 order by a.id desc limit 1",
+		key,
+	)
+	got := false
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&actor.id, &actor.login))
+		got = true
+	}
+	lib.FatalOnError(rows.Err())
+	lib.FatalOnError(rows.Close())
+	if !got {
+		// Login is generated from the anonymized email for GDPR hidden authors
+		actor.login = "git-" + lib.SHA1(maybeHide(key))
+		actor.id = int64(lib.HashStrings([]string{actor.login}))
+		lib.ExecSQLTxWithErr(
+			tx,
+			ctx,
+			lib.InsertIgnore("into gha_actors(id, login, name) "+lib.NValues(3)),
+			lib.AnyArray{actor.id, actor.login, maybeHide(lib.TruncToBytes(name, 120))}...,
+		)
+		if email != "" {
+			lib.ExecSQLTxWithErr(
+				tx,
+				ctx,
+				lib.InsertIgnore("into gha_actors_emails(actor_id, email) "+lib.NValues(2)),
+				lib.AnyArray{actor.id, maybeHide(lib.TruncToBytes(key, 120))}...,
+			)
+		}
+	}
+	actors[key] = actor
+	return actor
+}
+
+// importRepoGitCommits imports all commits reachable from given repo's HEAD that are not yet in `gha_commits`
+// Each commit gets its own artificial push event with ID generated from repo name and SHA
+// Commits files are then processed by the standard commits processing (which uses `gha_skip_commits`)
+// Returns number of imported commits via channel, -1 on error
+func importRepoGitCommits(ch chan int, ctx *lib.Ctx, con *sql.DB, repoName string) {
+	repo, err := lib.OpenGitRepo(ctx.ReposDir + repoName)
+	if err == nil {
+		defer func() { lib.FatalOnError(repo.Close()) }()
+	}
+	var commits []lib.GitCommit
+	if err == nil {
+		commits, err = repo.Log("HEAD")
+	}
+	if err == nil && repo.Shallow {
+		lib.Printf("Warning %s is a shallow clone, only %d commits above the shallow boundary are available\n", repoName, len(commits))
+	}
+	if err != nil {
+		if ctx.Debug > 1 {
+			lib.Printf("Warning cannot read git log %s: %+v\n", repoName, err)
+		}
+		fmt.Fprintf(os.Stderr, "Warning cannot read git log %s: %+v\n", repoName, err)
+		ch <- -1
+		return
+	}
+
+	// Repository ID, GitHub one if present, artificial otherwise
+	var (
+		repoID int64
+		orgID  *int64
+	)
+	rows := lib.QuerySQLWithErr(con, ctx, "select id, org_id from gha_repos where name = $1 order by id desc limit 1", repoName)
+	got := false
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&repoID, &orgID))
+		got = true
+	}
+	lib.FatalOnError(rows.Err())
+	lib.FatalOnError(rows.Close())
+	if !got {
+		repoID = int64(lib.HashStrings([]string{repoName}))
+		lib.ExecSQLWithErr(
+			con,
+			ctx,
+			lib.InsertIgnore("into gha_repos(id, name, org_login) "+lib.NValues(3)),
+			lib.AnyArray{repoID, repoName, strings.Split(repoName, "/")[0]}...,
+		)
+	}
+
+	// To handle GDPR
+	maybeHide := lib.MaybeHideFunc(lib.GetHidden(lib.HideCfgFile))
+	actors := make(map[string]gitActor)
+	imported := 0
+	for from := 0; from < len(commits); from += gitCommitsBatch {
+		to := from + gitCommitsBatch
+		if to > len(commits) {
+			to = len(commits)
+		}
+		batch := commits[from:to]
+
+		// Skip commits that are already present (from GitHub archives, other repos or previous imports)
+		args := []interface{}{}
+		values := []string{}
+		for _, commit := range batch {
+			args = append(args, commit.SHA)
+			values = append(values, lib.NValue(len(args)))
+		}
+		rows := lib.QuerySQLWithErr(
+			con,
+			ctx,
+			"select distinct sha from gha_commits where sha in ("+strings.Join(values, ", ")+")",
+			args...,
+		)
+		existing := make(map[string]struct{})
+		sha := ""
+		for rows.Next() {
+			lib.FatalOnError(rows.Scan(&sha))
+			existing[sha] = struct{}{}
+		}
+		lib.FatalOnError(rows.Err())
+		lib.FatalOnError(rows.Close())
+		if len(existing) == len(batch) {
+			continue
+		}
+
+		// Insert commits batch in transaction: all or none
+		tx, err := con.Begin()
+		lib.FatalOnError(err)
+		for _, commit := range batch {
+			if _, ok := existing[commit.SHA]; ok {
+				continue
+			}
+			actor := gitCommitActor(ctx, con, tx, actors, commit.AuthorName, commit.AuthorEmail, maybeHide)
+			eventID := int64(lib.HashStrings([]string{"git", repoName, commit.SHA}))
+			lib.ExecSQLTxWithErr(
+				tx,
+				ctx,
+				lib.InsertIgnore(
+					"into gha_events("+
+						"id, type, actor_id, repo_id, public, created_at, "+
+						"dup_actor_login, dup_repo_name, org_id, forkee_id) "+lib.NValues(10),
+				),
+				lib.AnyArray{eventID, "PushEvent", actor.id, repoID, true, commit.Date, actor.login, repoName, orgID, nil}...,
+			)
+			lib.ExecSQLTxWithErr(
+				tx,
+				ctx,
+				lib.InsertIgnore(
+					"into gha_commits("+
+						"sha, event_id, author_name, message, is_distinct, "+
+						"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
+						") "+lib.NValues(11),
+				),
+				lib.AnyArray{
+					commit.SHA,
+					eventID,
+					maybeHide(lib.TruncToBytes(commit.AuthorName, 160)),
+					lib.TruncToBytes(strings.TrimSpace(commit.Message), 0xffff),
+					true,
+					actor.id,
+					actor.login,
+					repoID,
+					repoName,
+					"PushEvent",
+					commit.Date,
+				}...,
+			)
+			lib.ExecSQLTxWithErr(
+				tx,
+				ctx,
+				lib.InsertIgnore("into gha_git_commits(sha, repo, event_id, dt) "+lib.NValues(4)),
+				lib.AnyArray{commit.SHA, repoName, eventID, commit.Date}...,
+			)
+			imported++
+		}
+		lib.FatalOnError(tx.Commit())
+	}
+	if ctx.Debug > 0 {
+		lib.Printf("Git log %s: %d commits, %d imported\n", repoName, len(commits), imported)
+	}
+	ch <- imported
+}
+
+// removeDuplicatedGitCommits removes commits imported from git repositories that are now also present
+// in GitHub archives data (for example when archive push event was processed after the import)
+func removeDuplicatedGitCommits(ctx *lib.Ctx, con *sql.DB) int {
+	rows := lib.QuerySQLWithErr(
+		con,
+		ctx,
+		"select distinct g.event_id from gha_git_commits g, gha_commits c "+
+			"where g.sha = c.sha and g.event_id <> c.event_id",
+	)
+	eventIDs := []interface{}{}
+	eventID := int64(0)
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&eventID))
+		eventIDs = append(eventIDs, eventID)
+	}
+	lib.FatalOnError(rows.Err())
+	lib.FatalOnError(rows.Close())
+	for from := 0; from < len(eventIDs); from += gitCommitsBatch {
+		to := from + gitCommitsBatch
+		if to > len(eventIDs) {
+			to = len(eventIDs)
+		}
+		values := []string{}
+		for i := range eventIDs[from:to] {
+			values = append(values, lib.NValue(i+1))
+		}
+		in := " where event_id in (" + strings.Join(values, ", ") + ")"
+		tx, err := con.Begin()
+		lib.FatalOnError(err)
+		for _, table := range []string{"gha_events_commits_files", "gha_commits", "gha_git_commits"} {
+			lib.ExecSQLTxWithErr(tx, ctx, "delete from "+table+in, eventIDs[from:to]...)
+		}
+		lib.ExecSQLTxWithErr(tx, ctx, "delete from gha_events where id in ("+strings.Join(values, ", ")+")", eventIDs[from:to]...)
+		lib.FatalOnError(tx.Commit())
+	}
+	return len(eventIDs)
+}
+
+// importGitCommits process all databases given in `dbs`
+// It imports commits history from all cloned repositories, so commits not present in GitHub archives
+// (before project's start date, force pushed or from repos mirrored from outside of GitHub) are also available
+// It is multithreaded processing up to NCPU repos at the same time
+func importGitCommits(ctx *lib.Ctx, dbs map[string]dbProject) {
+	dtStart := time.Now()
+	lastTime := dtStart
+	thrN := lib.GetThreadsNum(ctx)
+	allN := 0
+	checked := 0
+	for _, dbProj := range dbs {
+		allN += len(dbProj.repos)
+	}
+	imported := 0
+	removed := 0
+	failed := 0
+	collect := func(n int) {
+		if n < 0 {
+			failed++
+			return
+		}
+		imported += n
+	}
+	ch := make(chan int)
+	nThreads := 0
+	for db, dbProj := range dbs {
+		con := lib.PgConnDB(ctx, db)
+		defer func() { lib.FatalOnError(con.Close()) }()
+		removed += removeDuplicatedGitCommits(ctx, con)
+		for _, repo := range dbProj.repos {
+			go importRepoGitCommits(ch, ctx, con, repo)
+			nThreads++
+			if nThreads == thrN {
+				collect(<-ch)
+				nThreads--
+				checked++
+				lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, repo)
+			}
+		}
+	}
+	for nThreads > 0 {
+		collect(<-ch)
+		nThreads--
+		checked++
+		lib.ProgressInfo(checked, allN, dtStart, &lastTime, time.Duration(10)*time.Second, "final join...")
+	}
+	dtEnd := time.Now()
+	lib.Printf(
+		"Git commits: %d imported, %d removed (present in GitHub archives), %d repos failed, took %v\n",
+		imported,
+		removed,
+		failed,
+		dtEnd.Sub(dtStart),
+	)
+}
+
 func main() {
 	dtStart := time.Now()
 	// Environment context parse
@@ -609,9 +1460,21 @@ func main() {
 		if ctx.ProcessRepos {
 			processRepos(&ctx, repos)
 		}
+		if ctx.ImportGitCommits {
+			importGitCommits(&ctx, dbs)
+		}
+		if ctx.BackfillCommits {
+			backfillCommitsFiles(&ctx, dbs)
+		}
 		if ctx.ProcessCommits {
 			processCommits(&ctx, dbs)
 		}
+		if ctx.ProcessOwners {
+			processOwners(&ctx, dbs)
+		}
+		if ctx.ProcessLOC {
+			processLOC(&ctx, dbs)
+		}
 	}
 	dtEnd := time.Now()
 	lib.Printf("All repos processed in: %v\n", dtEnd.Sub(dtStart))
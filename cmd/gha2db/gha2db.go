@@ -31,12 +31,12 @@ func ghaActor(con *sql.Tx, ctx *lib.Ctx, actor *lib.Actor, maybeHide func(string
 }
 
 // Inserts single GHA Repo
-func ghaRepo(db *sql.DB, ctx *lib.Ctx, repo *lib.Repo, orgID, orgLogin interface{}) {
+func ghaRepo(con *sql.Tx, ctx *lib.Ctx, repo *lib.Repo, orgID, orgLogin interface{}) {
 	// gha_repos
 	// {"id:Fixnum"=>48592, "name:String"=>48592, "url:String"=>48592}
 	// {"id"=>8, "name"=>111, "url"=>140}
-	lib.ExecSQLWithErr(
-		db,
+	lib.ExecSQLTxWithErr(
+		con,
 		ctx,
 		lib.InsertIgnore("into gha_repos(id, name, org_id, org_login) "+lib.NValues(4)),
 		lib.AnyArray{repo.ID, repo.Name, orgID, orgLogin}...,
@@ -44,14 +44,14 @@ func ghaRepo(db *sql.DB, ctx *lib.Ctx, repo *lib.Repo, orgID, orgLogin interface
 }
 
 // Inserts single GHA Org
-func ghaOrg(db *sql.DB, ctx *lib.Ctx, org *lib.Org) {
+func ghaOrg(con *sql.Tx, ctx *lib.Ctx, org *lib.Org) {
 	// gha_orgs
 	// {"id:Fixnum"=>18494, "login:String"=>18494, "gravatar_id:String"=>18494,
 	// "url:String"=>18494, "avatar_url:String"=>18494}
 	// {"id"=>8, "login"=>38, "gravatar_id"=>0, "url"=>66, "avatar_url"=>49}
 	if org != nil {
-		lib.ExecSQLWithErr(
-			db,
+		lib.ExecSQLTxWithErr(
+			con,
 			ctx,
 			lib.InsertIgnore("into gha_orgs(id, login) "+lib.NValues(2)),
 			lib.AnyArray{org.ID, org.Login}...,
@@ -286,10 +286,10 @@ func lookupLabel(con *sql.Tx, ctx *lib.Ctx, name string, color string) int {
 
 // Search for given actor using his/her login
 // If not found, return hash as its ID
-func lookupActor(db *sql.DB, ctx *lib.Ctx, login string, maybeHide func(string) string) int {
+func lookupActorTx(con *sql.Tx, ctx *lib.Ctx, login string, maybeHide func(string) string) int {
 	hlogin := maybeHide(login)
-	rows := lib.QuerySQLWithErr(
-		db,
+	rows := lib.QuerySQLTxWithErr(
+		con,
 		ctx,
 		fmt.Sprintf("select id from gha_actors where login=%s", lib.NValue(1)),
 		hlogin,
@@ -306,34 +306,63 @@ func lookupActor(db *sql.DB, ctx *lib.Ctx, login string, maybeHide func(string)
 	return aid
 }
 
-// Search for given actor using his/her login
-// If not found, return hash as its ID
-func lookupActorTx(con *sql.Tx, ctx *lib.Ctx, login string, maybeHide func(string) string) int {
-	hlogin := maybeHide(login)
+// Search for the last known state of a given issue, used by pre 2015 events that only give issue's ID
+// Returns nil if not found
+func lookupIssueTx(con *sql.Tx, ctx *lib.Ctx, iid int) *lib.Issue {
 	rows := lib.QuerySQLTxWithErr(
 		con,
 		ctx,
-		fmt.Sprintf("select id from gha_actors where login=%s", lib.NValue(1)),
-		hlogin,
+		fmt.Sprintf(
+			"select number, comments, title, state, locked, body, user_id, dup_user_login, "+
+				"assignee_id, dupn_assignee_login, created_at, closed_at, is_pull_request "+
+				"from gha_issues where id = %s order by updated_at desc, event_id desc limit 1",
+			lib.NValue(1),
+		),
+		iid,
 	)
 	defer func() { lib.FatalOnError(rows.Close()) }()
-	aid := 0
+	var (
+		issue         *lib.Issue
+		assigneeID    *int
+		assigneeLogin *string
+		isPR          bool
+	)
 	for rows.Next() {
-		lib.FatalOnError(rows.Scan(&aid))
+		issue = &lib.Issue{ID: iid}
+		lib.FatalOnError(
+			rows.Scan(
+				&issue.Number,
+				&issue.Comments,
+				&issue.Title,
+				&issue.State,
+				&issue.Locked,
+				&issue.Body,
+				&issue.User.ID,
+				&issue.User.Login,
+				&assigneeID,
+				&assigneeLogin,
+				&issue.CreatedAt,
+				&issue.ClosedAt,
+				&isPR,
+			),
+		)
+		if assigneeID != nil && assigneeLogin != nil {
+			issue.Assignee = &lib.Actor{ID: *assigneeID, Login: *assigneeLogin}
+		}
+		if isPR {
+			issue.PullRequest = &lib.Dummy{}
+		}
 	}
 	lib.FatalOnError(rows.Err())
-	if aid == 0 {
-		aid = lib.HashStrings([]string{login})
-	}
-	return aid
+	return issue
 }
 
 // Try to find Repo by name and Organization
-func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *int) (int, bool) {
+func findRepoFromNameAndOrg(con *sql.Tx, ctx *lib.Ctx, repoName string, orgID *int) (int, bool) {
 	var rows *sql.Rows
 	if orgID != nil {
-		rows = lib.QuerySQLWithErr(
-			db,
+		rows = lib.QuerySQLTxWithErr(
+			con,
 			ctx,
 			fmt.Sprintf(
 				"select id from gha_repos where name=%s and org_id=%s",
@@ -344,8 +373,8 @@ func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *in
 			orgID,
 		)
 	} else {
-		rows = lib.QuerySQLWithErr(
-			db,
+		rows = lib.QuerySQLTxWithErr(
+			con,
 			ctx,
 			fmt.Sprintf(
 				"select id from gha_repos where name=%s and org_id is null",
@@ -366,13 +395,13 @@ func findRepoFromNameAndOrg(db *sql.DB, ctx *lib.Ctx, repoName string, orgID *in
 }
 
 // Try to find OrgID for given OrgLogin (returns nil for nil)
-func findOrgIDOrNil(db *sql.DB, ctx *lib.Ctx, orgLogin *string) *int {
+func findOrgIDOrNil(con *sql.Tx, ctx *lib.Ctx, orgLogin *string) *int {
 	var orgID int
 	if orgLogin == nil {
 		return nil
 	}
-	rows := lib.QuerySQLWithErr(
-		db,
+	rows := lib.QuerySQLTxWithErr(
+		con,
 		ctx,
 		fmt.Sprintf(
 			"select id from gha_orgs where login=%s",
@@ -390,8 +419,8 @@ func findOrgIDOrNil(db *sql.DB, ctx *lib.Ctx, orgLogin *string) *int {
 }
 
 // Check if given event existis (given by ID)
-func eventExists(db *sql.DB, ctx *lib.Ctx, eventID string) bool {
-	rows := lib.QuerySQLWithErr(db, ctx, fmt.Sprintf("select 1 from gha_events where id=%s", lib.NValue(1)), eventID)
+func eventExists(con *sql.Tx, ctx *lib.Ctx, eventID string) bool {
+	rows := lib.QuerySQLTxWithErr(con, ctx, fmt.Sprintf("select 1 from gha_events where id=%s", lib.NValue(1)), eventID)
 	defer func() { lib.FatalOnError(rows.Close()) }()
 	exists := false
 	for rows.Next() {
@@ -486,6 +515,126 @@ func ghaComment(con *sql.Tx, ctx *lib.Ctx, payloadComment *lib.Comment, eventID
 	)
 }
 
+// gha_issues
+// Table details and analysis in `analysis/analysis.txt` and `analysis/issue_*.json`
+func ghaIssue(con *sql.Tx, ctx *lib.Ctx, payloadIssue *lib.Issue, eventID string, ev *lib.Event, maybeHide func(string) string) {
+	if payloadIssue == nil {
+		return
+	}
+	issue := *payloadIssue
+
+	// user, assignee
+	ghaActor(con, ctx, &issue.User, maybeHide)
+	if issue.Assignee != nil {
+		ghaActor(con, ctx, issue.Assignee, maybeHide)
+	}
+
+	// issue
+	iid := issue.ID
+	isPR := false
+	if issue.PullRequest != nil {
+		isPR = true
+	}
+	lib.ExecSQLTxWithErr(
+		con,
+		ctx,
+		"insert into gha_issues("+
+			"id, event_id, assignee_id, body, closed_at, comments, created_at, "+
+			"locked, milestone_id, number, state, title, updated_at, user_id, "+
+			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
+			"dup_user_login, dupn_assignee_login, is_pull_request) "+lib.NValues(23),
+		lib.AnyArray{
+			iid,
+			eventID,
+			lib.ActorIDOrNil(issue.Assignee),
+			lib.TruncStringOrNil(issue.Body, 0xffff),
+			lib.TimeOrNil(issue.ClosedAt),
+			issue.Comments,
+			issue.CreatedAt,
+			issue.Locked,
+			lib.MilestoneIDOrNil(issue.Milestone),
+			issue.Number,
+			issue.State,
+			issue.Title,
+			issue.UpdatedAt,
+			issue.User.ID,
+			ev.Actor.ID,
+			maybeHide(ev.Actor.Login),
+			ev.Repo.ID,
+			ev.Repo.Name,
+			ev.Type,
+			ev.CreatedAt,
+			maybeHide(issue.User.Login),
+			lib.ActorLoginOrNil(issue.Assignee, maybeHide),
+			isPR,
+		}...,
+	)
+
+	// milestone
+	if issue.Milestone != nil {
+		ghaMilestone(con, ctx, eventID, issue.Milestone, ev, maybeHide)
+	}
+
+	pAid := lib.ActorIDOrNil(issue.Assignee)
+	for _, assignee := range issue.Assignees {
+		aid := assignee.ID
+		if aid == pAid {
+			continue
+		}
+
+		// assignee
+		ghaActor(con, ctx, &assignee, maybeHide)
+
+		// issue-assignee connection
+		lib.ExecSQLTxWithErr(
+			con,
+			ctx,
+			"insert into gha_issues_assignees(issue_id, event_id, assignee_id) "+lib.NValues(3),
+			lib.AnyArray{iid, eventID, aid}...,
+		)
+	}
+
+	// labels
+	for _, label := range issue.Labels {
+		lid := lib.IntOrNil(label.ID)
+		if lid == nil {
+			lid = lookupLabel(con, ctx, lib.TruncToBytes(label.Name, 160), label.Color)
+		}
+
+		// label
+		lib.ExecSQLTxWithErr(
+			con,
+			ctx,
+			lib.InsertIgnore("into gha_labels(id, name, color, is_default) "+lib.NValues(4)),
+			lib.AnyArray{lid, lib.TruncToBytes(label.Name, 160), label.Color, lib.BoolOrNil(label.Default)}...,
+		)
+
+		// issue-label connection
+		lib.ExecSQLTxWithErr(
+			con,
+			ctx,
+			lib.InsertIgnore(
+				"into gha_issues_labels(issue_id, event_id, label_id, "+
+					"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
+					"dup_issue_number, dup_label_name"+
+					") "+lib.NValues(11)),
+			lib.AnyArray{
+				iid,
+				eventID,
+				lid,
+				ev.Actor.ID,
+				maybeHide(ev.Actor.Login),
+				ev.Repo.ID,
+				ev.Repo.Name,
+				ev.Type,
+				ev.CreatedAt,
+				issue.Number,
+				label.Name,
+			}...,
+		)
+	}
+}
+
 // gha_releases
 // Table details and analysis in `analysis/analysis.txt` and `analysis/release_*.json`
 func ghaRelease(con *sql.Tx, ctx *lib.Ctx, payloadRelease *lib.Release, eventID string, actor *lib.Actor, repo *lib.Repo, eType string, eCreatedAt time.Time, maybeHide func(string) string) {
@@ -767,9 +916,9 @@ func ghaTeam(con *sql.Tx, ctx *lib.Ctx, payloadTeam *lib.Team, payloadRepo *lib.
 	}
 }
 
-// Write GHA entire event (in old pre 2015 format) into Postgres DB
-func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld, shas map[string]string) int {
-	if eventExists(db, ctx, eventID) {
+// Write GHA entire event (in old pre 2015 format) into Postgres DB using a given transaction
+func writeEventOldFmt(con *sql.Tx, ctx *lib.Ctx, eventID string, ev *lib.EventOld, shas map[string]string) int {
+	if eventExists(con, ctx, eventID) {
 		return 0
 	}
 
@@ -777,24 +926,23 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 	maybeHide := lib.MaybeHideFunc(shas)
 
 	// Lookup author by GitHub login
-	aid := lookupActor(db, ctx, ev.Actor, maybeHide)
+	aid := lookupActorTx(con, ctx, ev.Actor, maybeHide)
 	actor := lib.Actor{ID: aid, Login: ev.Actor}
 
 	// Repository
 	repository := ev.Repository
 
 	// Find Org ID from Repository.Organization
-	oid := findOrgIDOrNil(db, ctx, repository.Organization)
+	oid := findOrgIDOrNil(con, ctx, repository.Organization)
 
 	// Find Repo ID from Repository (this is a ForkeeOld before 2015).
-	rid, ok := findRepoFromNameAndOrg(db, ctx, repository.Name, oid)
+	rid, ok := findRepoFromNameAndOrg(con, ctx, repository.Name, oid)
 	if !ok {
 		rid = repository.ID
 	}
 
-	// We defer transaction create until we're inserting data that can be shared between different events
-	lib.ExecSQLWithErr(
-		db,
+	lib.ExecSQLTxWithErr(
+		con,
 		ctx,
 		"insert into gha_events("+
 			"id, type, actor_id, repo_id, public, created_at, "+
@@ -819,12 +967,12 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 			h := lib.HashStrings([]string{*repository.Organization})
 			oid = &h
 		}
-		ghaOrg(db, ctx, &lib.Org{ID: *oid, Login: *repository.Organization})
+		ghaOrg(con, ctx, &lib.Org{ID: *oid, Login: *repository.Organization})
 	}
 
 	// Add Repository
 	repo := lib.Repo{ID: rid, Name: repository.Name}
-	ghaRepo(db, ctx, &repo, oid, repository.Organization)
+	ghaRepo(con, ctx, &repo, oid, repository.Organization)
 
 	// Pre 2015 Payload
 	pl := ev.Payload
@@ -832,14 +980,8 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 		return 0
 	}
 
-	iid := lib.FirstIntOrNil([]*int{pl.Issue, pl.IssueID})
-	cid := lib.CommentIDOrNil(pl.Comment)
-	if cid == nil {
-		cid = lib.IntOrNil(pl.CommentID)
-	}
-
-	lib.ExecSQLWithErr(
-		db,
+	lib.ExecSQLTxWithErr(
+		con,
 		ctx,
 		"insert into gha_payloads("+
 			"event_id, push_id, size, ref, head, befor, action, "+
@@ -847,38 +989,17 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 			"description, number, forkee_id, release_id, member_id, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
 			") "+lib.NValues(24),
-		lib.AnyArray{
-			eventID,
-			nil,
-			lib.IntOrNil(pl.Size),
-			lib.TruncStringOrNil(pl.Ref, 200),
-			lib.StringOrNil(pl.Head),
-			nil,
-			lib.StringOrNil(pl.Action),
-			iid,
-			lib.PullRequestIDOrNil(pl.PullRequest),
-			cid,
-			lib.StringOrNil(pl.RefType),
-			lib.TruncStringOrNil(pl.MasterBranch, 200),
-			lib.StringOrNil(pl.Commit),
-			lib.TruncStringOrNil(pl.Description, 0xffff),
-			lib.IntOrNil(pl.Number),
-			lib.ForkeeIDOrNil(pl.Repository),
-			lib.ReleaseIDOrNil(pl.Release),
-			lib.ActorIDOrNil(pl.Member),
+		append(
+			append(lib.AnyArray{eventID}, pl.Row()...),
 			actor.ID,
 			maybeHide(actor.Login),
 			repo.ID,
 			repo.Name,
 			ev.Type,
 			ev.CreatedAt,
-		}...,
+		)...,
 	)
 
-	// Start transaction for data possibly shared between events
-	con, err := db.Begin()
-	lib.FatalOnError(err)
-
 	// gha_actors
 	ghaActor(con, ctx, &actor, maybeHide)
 
@@ -898,39 +1019,28 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 	}
 
 	// SHAs - commits
-	if pl.SHAs != nil {
-		commits := *pl.SHAs
-		for _, comm := range commits {
-			commit, ok := comm.([]interface{})
-			if !ok {
-				lib.Fatalf("comm is not []interface{}: %+v", comm)
-			}
-			sha, ok := commit[0].(string)
-			if !ok {
-				lib.Fatalf("commit[0] is not string: %+v", commit[0])
-			}
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				"insert into gha_commits("+
-					"sha, event_id, author_name, message, is_distinct, "+
-					"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
-					") "+lib.NValues(11),
-				lib.AnyArray{
-					sha,
-					eventID,
-					maybeHide(lib.TruncToBytes(commit[3].(string), 160)),
-					lib.TruncToBytes(commit[2].(string), 0xffff),
-					commit[4].(bool),
-					actor.ID,
-					maybeHide(actor.Login),
-					repo.ID,
-					repo.Name,
-					ev.Type,
-					ev.CreatedAt,
-				}...,
-			)
-		}
+	for _, commit := range pl.GitCommits() {
+		lib.ExecSQLTxWithErr(
+			con,
+			ctx,
+			"insert into gha_commits("+
+				"sha, event_id, author_name, message, is_distinct, "+
+				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
+				") "+lib.NValues(11),
+			lib.AnyArray{
+				commit.SHA,
+				eventID,
+				maybeHide(lib.TruncToBytes(commit.Author.Name, 160)),
+				lib.TruncToBytes(commit.Message, 0xffff),
+				commit.Distinct,
+				actor.ID,
+				maybeHide(actor.Login),
+				repo.ID,
+				repo.Name,
+				ev.Type,
+				ev.CreatedAt,
+			}...,
+		)
 	}
 
 	// Pages
@@ -941,8 +1051,13 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 		ghaActor(con, ctx, pl.Member, maybeHide)
 	}
 
-	// Comment
-	ghaComment(con, ctx, pl.Comment, eventID, &actor, &repo, ev.Type, ev.CreatedAt, maybeHide)
+	// Comment (pre 2015 IssueCommentEvent only gives comment's ID)
+	ghaComment(con, ctx, ev.OldComment(actor), eventID, &actor, &repo, ev.Type, ev.CreatedAt, maybeHide)
+
+	// Issue (pre 2015 IssuesEvent and IssueCommentEvent only give issue's ID, so its last known state is used)
+	issue := ev.OldIssue(actor, func(iid int) *lib.Issue { return lookupIssueTx(con, ctx, iid) })
+	artificialEv := lib.Event{Actor: actor, Repo: repo, Type: ev.Type, CreatedAt: ev.CreatedAt}
+	ghaIssue(con, ctx, issue, eventID, &artificialEv, maybeHide)
 
 	// Release & assets
 	ghaRelease(con, ctx, pl.Release, eventID, &actor, &repo, ev.Type, ev.CreatedAt, maybeHide)
@@ -964,7 +1079,7 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 		pr := *pl.PullRequest
 
 		// issue
-		iid = -pr.ID
+		iid := -pr.ID
 		isPR := true
 		comments := 0
 		locked := false
@@ -1037,22 +1152,19 @@ func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld,
 		}
 	}
 
-	// Final commit
-	lib.FatalOnError(con.Commit())
 	return 1
 }
 
-// Write entire GHA event (in a new 2015+ format) into Postgres DB
-func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string) int {
+// Write entire GHA event (in a new 2015+ format) into Postgres DB using a given transaction
+func writeEvent(con *sql.Tx, ctx *lib.Ctx, ev *lib.Event, shas map[string]string) int {
 	eventID := ev.ID
-	if eventExists(db, ctx, eventID) {
+	if eventExists(con, ctx, eventID) {
 		return 0
 	}
 
 	// To handle GDPR
 	maybeHide := lib.MaybeHideFunc(shas)
 
-	// We defer transaction create until we're inserting data that can be shared between different events
 	// gha_events
 	// {"id:String"=>48592, "type:String"=>48592, "actor:Hash"=>48592, "repo:Hash"=>48592,
 	// "payload:Hash"=>48592, "public:TrueClass"=>48592, "created_at:String"=>48592,
@@ -1061,8 +1173,8 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 	// "created_at"=>20, "org"=>230}
 	// Fields dup_actor_login, dup_repo_name are copied from (gha_actors and gha_repos) to save
 	// joins on complex queries (MySQL has no hash joins and is very slow on big tables joins)
-	lib.ExecSQLWithErr(
-		db,
+	lib.ExecSQLTxWithErr(
+		con,
 		ctx,
 		"insert into gha_events("+
 			"id, type, actor_id, repo_id, public, created_at, "+
@@ -1084,11 +1196,11 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 	// Repository
 	repo := ev.Repo
 	org := ev.Org
-	ghaRepo(db, ctx, &repo, lib.OrgIDOrNil(org), lib.OrgLoginOrNil(org))
+	ghaRepo(con, ctx, &repo, lib.OrgIDOrNil(org), lib.OrgLoginOrNil(org))
 
 	// Organization
 	if org != nil {
-		ghaOrg(db, ctx, org)
+		ghaOrg(con, ctx, org)
 	}
 
 	// gha_payloads
@@ -1107,8 +1219,8 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 	// using exec_stmt (without select), because payload are per event_id.
 	// Columns duplicated from gha_events starts with "dup_"
 	pl := ev.Payload
-	lib.ExecSQLWithErr(
-		db,
+	lib.ExecSQLTxWithErr(
+		con,
 		ctx,
 		"insert into gha_payloads("+
 			"event_id, push_id, size, ref, head, befor, action, "+
@@ -1116,38 +1228,17 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 			"description, number, forkee_id, release_id, member_id, "+
 			"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at"+
 			") "+lib.NValues(24),
-		lib.AnyArray{
-			eventID,
-			lib.IntOrNil(pl.PushID),
-			lib.IntOrNil(pl.Size),
-			lib.TruncStringOrNil(pl.Ref, 200),
-			lib.StringOrNil(pl.Head),
-			lib.StringOrNil(pl.Before),
-			lib.StringOrNil(pl.Action),
-			lib.IssueIDOrNil(pl.Issue),
-			lib.PullRequestIDOrNil(pl.PullRequest),
-			lib.CommentIDOrNil(pl.Comment),
-			lib.StringOrNil(pl.RefType),
-			lib.TruncStringOrNil(pl.MasterBranch, 200),
-			nil,
-			lib.TruncStringOrNil(pl.Description, 0xffff),
-			lib.IntOrNil(pl.Number),
-			lib.ForkeeIDOrNil(pl.Forkee),
-			lib.ReleaseIDOrNil(pl.Release),
-			lib.ActorIDOrNil(pl.Member),
+		append(
+			append(lib.AnyArray{eventID}, pl.Row()...),
 			ev.Actor.ID,
 			maybeHide(ev.Actor.Login),
 			ev.Repo.ID,
 			ev.Repo.Name,
 			ev.Type,
 			ev.CreatedAt,
-		}...,
+		)...,
 	)
 
-	// Start transaction for data possibly shared between events
-	con, err := db.Begin()
-	lib.FatalOnError(err)
-
 	// gha_actors
 	ghaActor(con, ctx, &ev.Actor, maybeHide)
 
@@ -1158,11 +1249,7 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 	// author: {"name:String"=>23265, "email:String"=>23265} (only git username/email)
 	// author: {"name"=>96, "email"=>95}
 	// 23265
-	commits := []lib.Commit{}
-	if pl.Commits != nil {
-		commits = *pl.Commits
-	}
-	for _, commit := range commits {
+	for _, commit := range pl.GitCommits() {
 		sha := commit.SHA
 		lib.ExecSQLTxWithErr(
 			con,
@@ -1199,140 +1286,165 @@ func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string)
 	ghaComment(con, ctx, pl.Comment, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, maybeHide)
 
 	// gha_issues
-	// Table details and analysis in `analysis/analysis.txt` and `analysis/issue_*.json`
-	if pl.Issue != nil {
-		issue := *pl.Issue
+	ghaIssue(con, ctx, pl.Issue, eventID, ev, maybeHide)
 
-		// user, assignee
-		ghaActor(con, ctx, &issue.User, maybeHide)
-		if issue.Assignee != nil {
-			ghaActor(con, ctx, issue.Assignee, maybeHide)
-		}
+	// gha_forkees
+	if pl.Forkee != nil {
+		ghaForkee(con, ctx, eventID, pl.Forkee, ev, maybeHide)
+	}
 
-		// issue
-		iid := issue.ID
-		isPR := false
-		if issue.PullRequest != nil {
-			isPR = true
-		}
-		lib.ExecSQLTxWithErr(
-			con,
-			ctx,
-			"insert into gha_issues("+
-				"id, event_id, assignee_id, body, closed_at, comments, created_at, "+
-				"locked, milestone_id, number, state, title, updated_at, user_id, "+
-				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_user_login, dupn_assignee_login, is_pull_request) "+lib.NValues(23),
-			lib.AnyArray{
-				iid,
-				eventID,
-				lib.ActorIDOrNil(issue.Assignee),
-				lib.TruncStringOrNil(issue.Body, 0xffff),
-				lib.TimeOrNil(issue.ClosedAt),
-				issue.Comments,
-				issue.CreatedAt,
-				issue.Locked,
-				lib.MilestoneIDOrNil(issue.Milestone),
-				issue.Number,
-				issue.State,
-				issue.Title,
-				issue.UpdatedAt,
-				issue.User.ID,
-				ev.Actor.ID,
-				maybeHide(ev.Actor.Login),
-				ev.Repo.ID,
-				ev.Repo.Name,
-				ev.Type,
-				ev.CreatedAt,
-				maybeHide(issue.User.Login),
-				lib.ActorLoginOrNil(issue.Assignee, maybeHide),
-				isPR,
-			}...,
-		)
+	// Release & assets
+	ghaRelease(con, ctx, pl.Release, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, maybeHide)
 
-		// milestone
-		if issue.Milestone != nil {
-			ghaMilestone(con, ctx, eventID, issue.Milestone, ev, maybeHide)
-		}
+	// Pull Request
+	ghaPullRequest(con, ctx, pl.PullRequest, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, []int{}, maybeHide)
 
-		pAid := lib.ActorIDOrNil(issue.Assignee)
-		for _, assignee := range issue.Assignees {
-			aid := assignee.ID
-			if aid == pAid {
-				continue
-			}
+	return 1
+}
 
-			// assignee
-			ghaActor(con, ctx, &assignee, maybeHide)
+// Write GHA entire event (in old pre 2015 format) into Postgres DB in a single transaction
+func writeToDBOldFmt(db *sql.DB, ctx *lib.Ctx, eventID string, ev *lib.EventOld, shas map[string]string) int {
+	con, err := db.Begin()
+	lib.FatalOnError(err)
+	n := writeEventOldFmt(con, ctx, eventID, ev, shas)
+	lib.FatalOnError(con.Commit())
+	return n
+}
 
-			// issue-assignee connection
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				"insert into gha_issues_assignees(issue_id, event_id, assignee_id) "+lib.NValues(3),
-				lib.AnyArray{iid, eventID, aid}...,
-			)
-		}
+// Write entire GHA event (in a new 2015+ format) into Postgres DB in a single transaction
+func writeToDB(db *sql.DB, ctx *lib.Ctx, ev *lib.Event, shas map[string]string) int {
+	con, err := db.Begin()
+	lib.FatalOnError(err)
+	n := writeEvent(con, ctx, ev, shas)
+	lib.FatalOnError(con.Commit())
+	return n
+}
 
-		// labels
-		for _, label := range issue.Labels {
-			lid := lib.IntOrNil(label.ID)
-			if lid == nil {
-				lid = lookupLabel(con, ctx, lib.TruncToBytes(label.Name, 160), label.Color)
-			}
+// writeRawEvent - stores full event JSON in `gha_raw_events` table (when not already stored)
+// It contains all fields, also those not defined in lib.Event, so they can be re-parsed later
+func writeRawEvent(con *sql.DB, ctx *lib.Ctx, eid string, dt time.Time, repo, eType string, jsonStr []byte) {
+	lib.ExecSQLWithErr(
+		con,
+		ctx,
+		lib.InsertIgnore("into gha_raw_events(id, dt, repo, type, payload) "+lib.NValues(5)),
+		lib.AnyArray{eid, dt, repo, eType, lib.RawEventJSON(jsonStr)}...,
+	)
+}
 
-			// label
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				lib.InsertIgnore("into gha_labels(id, name, color, is_default) "+lib.NValues(4)),
-				lib.AnyArray{lid, lib.TruncToBytes(label.Name, 160), label.Color, lib.BoolOrNil(label.Default)}...,
-			)
+// reparseHour - rebuilds typed tables data of events from `gha_raw_events` stored in [from, to) range
+// Existing events data is deleted first, so newly added columns and tables are also filled
+// Boolean channel `ch` is used to synchronize go routines
+func reparseHour(ch chan bool, ctx *lib.Ctx, from, to time.Time, shas map[string]string) {
+	// Connect to Postgres DB
+	con := lib.PgConn(ctx)
+	defer func() { lib.FatalOnError(con.Close()) }()
 
-			// issue-label connection
-			lib.ExecSQLTxWithErr(
-				con,
-				ctx,
-				lib.InsertIgnore(
-					"into gha_issues_labels(issue_id, event_id, label_id, "+
-						"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-						"dup_issue_number, dup_label_name"+
-						") "+lib.NValues(11)),
-				lib.AnyArray{
-					iid,
-					eventID,
-					lid,
-					ev.Actor.ID,
-					maybeHide(ev.Actor.Login),
-					ev.Repo.ID,
-					ev.Repo.Name,
-					ev.Type,
-					ev.CreatedAt,
-					issue.Number,
-					label.Name,
-				}...,
-			)
+	rows := lib.QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"select id, payload::text from gha_raw_events where dt >= %s and dt < %s order by dt, id",
+			lib.NValue(1),
+			lib.NValue(2),
+		),
+		from,
+		to,
+	)
+	var (
+		ids      []int64
+		payloads []string
+		id       int64
+		payload  string
+	)
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&id, &payload))
+		ids = append(ids, id)
+		payloads = append(payloads, payload)
+	}
+	lib.FatalOnError(rows.Err())
+	lib.FatalOnError(rows.Close())
+
+	// Old data is deleted and new data is written in a single transaction, so readers never see a partially reparsed hour
+	tc, err := con.Begin()
+	lib.FatalOnError(err)
+	lib.DeleteEventsData(tc, ctx, ids)
+	// Pre 2015 format is detected once per hour, GHA2DB_OLDFMT forces it
+	oldFmt := ctx.OldFormat || lib.IsOldFormatDate(from)
+	e := 0
+	for i, payload := range payloads {
+		eid := strconv.FormatInt(ids[i], 10)
+		if oldFmt {
+			var hOld lib.EventOld
+			lib.FatalOnError(json.Unmarshal([]byte(payload), &hOld))
+			e += writeEventOldFmt(tc, ctx, eid, &hOld, shas)
+		} else {
+			var h lib.Event
+			lib.FatalOnError(json.Unmarshal([]byte(payload), &h))
+			e += writeEvent(tc, ctx, &h, shas)
 		}
 	}
+	lib.RebuildEventsData(tc, ctx, ids)
+	lib.FatalOnError(tc.Commit())
+	lib.Printf("Reparsed %v - %v: %d raw events, %d events written\n", lib.ToYMDHMSDate(from), lib.ToYMDHMSDate(to), len(ids), e)
+	if ch != nil {
+		ch <- true
+	}
+}
 
-	// gha_forkees
-	if pl.Forkee != nil {
-		ghaForkee(con, ctx, eventID, pl.Forkee, ev, maybeHide)
+// reparse - rebuilds typed tables from events stored in `gha_raw_events` table, no GHA archives are downloaded
+// Optional args: date_from and date_to (formats supported by lib.TimeParseAny), by default all stored events
+func reparse(args []string) {
+	var ctx lib.Ctx
+	ctx.Init()
+	if !ctx.DBOut {
+		lib.Fatalf("reparse requires database output")
 	}
 
-	// Release & assets
-	ghaRelease(con, ctx, pl.Release, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, maybeHide)
+	// Connect to Postgres DB
+	con := lib.PgConn(&ctx)
+	var minDt, maxDt *time.Time
+	lib.FatalOnError(lib.QueryRowSQL(con, &ctx, "select min(dt), max(dt) from gha_raw_events").Scan(&minDt, &maxDt))
+	lib.FatalOnError(con.Close())
+	if minDt == nil || maxDt == nil {
+		lib.Printf("No raw events stored, nothing to reparse\n")
+		return
+	}
+	dFrom := lib.HourStart(*minDt)
+	dTo := lib.NextHourStart(*maxDt)
+	if len(args) >= 1 {
+		dFrom = lib.HourStart(lib.TimeParseAny(args[0]))
+	}
+	if len(args) >= 2 {
+		dTo = lib.TimeParseAny(args[1])
+	}
 
-	// Pull Request
-	ghaPullRequest(con, ctx, pl.PullRequest, eventID, &ev.Actor, &ev.Repo, ev.Type, ev.CreatedAt, []int{}, maybeHide)
+	// Get number of CPUs available
+	thrN := lib.GetThreadsNum(&ctx)
+	lib.Printf("gha2db.go: Reparsing (%v CPUs): %v - %v\n", thrN, dFrom, dTo)
 
-	// Final commit
-	lib.FatalOnError(con.Commit())
-	return 1
+	// GDPR data hiding
+	shaMap := lib.GetHidden(lib.HideCfgFile)
+
+	ch := make(chan bool)
+	nThreads := 0
+	for dt := dFrom; dt.Before(dTo); dt = dt.Add(time.Hour) {
+		go reparseHour(ch, &ctx, dt, dt.Add(time.Hour), shaMap)
+		nThreads++
+		if nThreads == thrN {
+			<-ch
+			nThreads--
+		}
+	}
+	for nThreads > 0 {
+		<-ch
+		nThreads--
+	}
+	lib.Printf("All done.\n")
 }
 
 // parseJSON - parse signle GHA JSON event
-func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt time.Time, forg, frepo map[string]struct{}, shas map[string]string) (f int, e int) {
+// oldFmt - JSON is in pre 2015 GHA format
+func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt time.Time, oldFmt bool, forg, frepo map[string]struct{}, shas map[string]string) (f int, e int) {
 	var (
 		h         lib.Event
 		hOld      lib.EventOld
@@ -1341,7 +1453,7 @@ func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt ti
 		eid       string
 		actorName string
 	)
-	if ctx.OldFormat {
+	if oldFmt {
 		err = json.Unmarshal(jsonStr, &hOld)
 	} else {
 		err = json.Unmarshal(jsonStr, &h)
@@ -1360,7 +1472,7 @@ func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt ti
 		fmt.Fprintf(os.Stderr, "%v: JSON Unmarshal failed for:\n'%v'\n", dt, string(pretty))
 	}
 	lib.FatalOnError(err)
-	if ctx.OldFormat {
+	if oldFmt {
 		fullName = lib.MakeOldRepoName(&hOld.Repository)
 		actorName = hOld.Actor
 	} else {
@@ -1368,8 +1480,8 @@ func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt ti
 		actorName = h.Actor.Login
 	}
 	if lib.RepoHit(ctx, fullName, forg, frepo) && lib.ActorHit(ctx, actorName) {
-		if ctx.OldFormat {
-			eid = fmt.Sprintf("%v", lib.HashStrings([]string{hOld.Type, hOld.Actor, hOld.Repository.Name, lib.ToYMDHMSDate(hOld.CreatedAt)}))
+		if oldFmt {
+			eid = lib.OldEventID(&hOld)
 		} else {
 			eid = h.ID
 		}
@@ -1379,8 +1491,15 @@ func parseJSON(con *sql.DB, ctx *lib.Ctx, idx, njsons int, jsonStr []byte, dt ti
 			ofn := fmt.Sprintf("jsons/%v_%v.json", dt.Unix(), eid)
 			lib.FatalOnError(ioutil.WriteFile(ofn, pretty, 0644))
 		}
+		if ctx.DBOut && ctx.RawEvents {
+			if oldFmt {
+				writeRawEvent(con, ctx, eid, hOld.CreatedAt, fullName, hOld.Type, jsonStr)
+			} else {
+				writeRawEvent(con, ctx, eid, h.CreatedAt, fullName, h.Type, jsonStr)
+			}
+		}
 		if ctx.DBOut {
-			if ctx.OldFormat {
+			if oldFmt {
 				e = writeToDBOldFmt(con, ctx, eid, &hOld, shas)
 			} else {
 				e = writeToDB(con, ctx, &h, shas)
@@ -1458,6 +1577,9 @@ func getGHAJSON(ch chan bool, ctx *lib.Ctx, dt time.Time, forg map[string]struct
 	jsonsArray := bytes.Split(jsonsBytes, []byte("\n"))
 	lib.Printf("Splitted %s, %d JSONs\n", fn, len(jsonsArray))
 
+	// Pre 2015 format is detected once per hour file, GHA2DB_OLDFMT forces it
+	oldFmt := ctx.OldFormat || lib.IsOldFormatDate(dt)
+
 	// Process JSONs one by one
 	n, f, e := 0, 0, 0
 	njsons := len(jsonsArray)
@@ -1465,7 +1587,7 @@ func getGHAJSON(ch chan bool, ctx *lib.Ctx, dt time.Time, forg map[string]struct
 		if len(json) < 1 {
 			continue
 		}
-		fi, ei := parseJSON(con, ctx, i, njsons, json, dt, forg, frepo, shas)
+		fi, ei := parseJSON(con, ctx, i, njsons, json, dt, oldFmt, forg, frepo, shas)
 		n++
 		f += fi
 		e += ei
@@ -1597,11 +1719,18 @@ func gha2db(args []string) {
 
 func main() {
 	dtStart := time.Now()
+	// Rebuild typed tables from stored raw events
+	if len(os.Args) >= 2 && os.Args[1] == "reparse" {
+		reparse(os.Args[2:])
+		lib.Printf("Time: %v\n", time.Now().Sub(dtStart))
+		return
+	}
 	// Required args
 	if len(os.Args) < 5 {
 		lib.Printf(
 			"Arguments required: date_from_YYYY-MM-DD hour_from_HH date_to_YYYY-MM-DD hour_to_HH " +
-				"['org1,org2,...,orgN' ['repo1,repo2,...,repoN']]\n",
+				"['org1,org2,...,orgN' ['repo1,repo2,...,repoN']]\n" +
+				"or: reparse [date_from [date_to]]\n",
 		)
 		os.Exit(1)
 	}
@@ -12,28 +12,6 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-// metrics contain list of metrics to evaluate
-type metrics struct {
-	Metrics []metric `yaml:"metrics"`
-}
-
-// metric contain each metric data
-type metric struct {
-	Name              string `yaml:"name"`
-	Periods           string `yaml:"periods"`
-	SeriesNameOrFunc  string `yaml:"series_name_or_func"`
-	MetricSQL         string `yaml:"sql"`
-	AddPeriodToName   bool   `yaml:"add_period_to_name"`
-	Histogram         bool   `yaml:"histogram"`
-	Aggregate         string `yaml:"aggregate"`
-	Skip              string `yaml:"skip"`
-	Desc              string `yaml:"desc"`
-	MultiValue        bool   `yaml:"multi_value"`
-	EscapeValueName   bool   `yaml:"escape_value_name"`
-	AnnotationsRanges bool   `yaml:"annotations_ranges"`
-	MergeSeries       string `yaml:"merge_series"`
-}
-
 // Add _period to all array items
 func addPeriodSuffix(seriesArr []string, period string) (result []string) {
 	for _, series := range seriesArr {
@@ -222,15 +200,22 @@ func sync(ctx *lib.Ctx, args []string) {
 		// Now let's update new commits files (from newest hour)
 		if !ctx.SkipGetRepos {
 			lib.Printf("Update git commits\n")
+			env := map[string]string{
+				"GHA2DB_PROCESS_COMMITS":  "1",
+				"GHA2DB_PROJECTS_COMMITS": ctx.Project,
+			}
+			// OWNERS files and lines of code are imported once a day (and on full TSDB reset)
+			if ctx.ResetTSDB || time.Now().Hour() == 0 {
+				lib.Printf("Update OWNERS files data and lines of code\n")
+				env["GHA2DB_PROCESS_OWNERS"] = "1"
+				env["GHA2DB_PROCESS_LOC"] = "1"
+			}
 			_, err = lib.ExecCommand(
 				ctx,
 				[]string{
 					cmdPrefix + "get_repos",
 				},
-				map[string]string{
-					"GHA2DB_PROCESS_COMMITS":  "1",
-					"GHA2DB_PROJECTS_COMMITS": ctx.Project,
-				},
+				env,
 			)
 			lib.FatalOnError(err)
 		}
@@ -285,6 +270,16 @@ func sync(ctx *lib.Ctx, args []string) {
 		}
 		lib.Printf("TS range: %s - %s\n", lib.ToYMDHDate(from), lib.ToYMDHDate(to))
 
+		// Drop shadow schemas left by failed recomputes (tags and quick ranges always use shadow schemas)
+		lib.DropStaleShadowSchemas(con, ctx, lib.ShadowMaxAge)
+
+		// Metrics shadow schemas are only used by full recomputes, hourly runs only add the latest points
+		var metricEnv map[string]string
+		if ctx.Shadow && !ctx.ResetTSDB {
+			lib.Printf("GHA2DB_SHADOW is only used with GHA2DB_RESETTSDB, metrics are written directly to live tables\n")
+			metricEnv = map[string]string{"GHA2DB_SHADOW": ""}
+		}
+
 		// TSDB tags (repo groups template variable currently)
 		if ctx.ResetTSDB || time.Now().Hour() == 0 {
 			_, err := lib.ExecCommand(ctx, []string{cmdPrefix + "tags"}, nil)
@@ -312,13 +307,14 @@ func sync(ctx *lib.Ctx, args []string) {
 		lib.Printf("Quick ranges: %+v\n", quickRanges)
 
 		// Read metrics configuration
-		data, err := lib.ReadFile(ctx, dataPrefix+ctx.MetricsYaml)
+		allMetrics, err := lib.LoadMetrics(ctx, dataPrefix+ctx.MetricsYaml)
 		if err != nil {
 			lib.FatalOnError(err)
 			return
 		}
-		var allMetrics metrics
-		lib.FatalOnError(yaml.Unmarshal(data, &allMetrics))
+
+		// Projects are needed to resolve cross-project metrics sources
+		var projects *lib.AllProjects
 
 		// Keep all histograms here
 		var hists [][]string
@@ -345,12 +341,31 @@ func sync(ctx *lib.Ctx, args []string) {
 			if metric.EscapeValueName {
 				extraParams = append(extraParams, "escape_value_name")
 			}
+			if metric.TypedValues {
+				extraParams = append(extraParams, "typed_values")
+			}
 			if metric.Desc != "" {
 				extraParams = append(extraParams, "desc:"+metric.Desc)
 			}
 			if metric.MergeSeries != "" {
 				extraParams = append(extraParams, "merge_series:"+metric.MergeSeries)
 			}
+			if len(metric.Params) > 0 {
+				extraParams = append(extraParams, "params:"+lib.EncodeMetricParams(metric.Params))
+			}
+			if metric.Sources != "" {
+				if projects == nil {
+					projects = readProjects(ctx, dataPrefix)
+				}
+				dbs, err := lib.MetricSourcesDBs(ctx, projects, metric.Sources)
+				lib.FatalOnError(err)
+				extraParams = append(extraParams, "sources:"+strings.Join(dbs, ";"))
+				if metric.Combine != "" {
+					extraParams = append(extraParams, "combine:"+metric.Combine)
+				}
+			}
+			// SQL from project directory or shared one
+			sqlFile := lib.ResolveFile(ctx, fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL))
 			periods := strings.Split(metric.Periods, ",")
 			aggregate := metric.Aggregate
 			if aggregate == "" {
@@ -392,6 +407,14 @@ func sync(ctx *lib.Ctx, args []string) {
 					if metric.AddPeriodToName {
 						seriesNameOrFunc += "_" + periodAggr
 					}
+					// Expired points are not computed
+					periodParams := extraParams
+					if rule := lib.MetricRetentionRule(&metric, periodAggr); rule != nil {
+						periodParams = append(append([]string{}, extraParams...), "retention:"+rule.Keep)
+						if rule.RollUp != "" {
+							periodParams = append(periodParams, "retention_rollup:"+rule.RollUp)
+						}
+					}
 					// Histogram metrics usualy take long time, but executes single query, so there is no way to
 					// Implement multi threading inside "calc_metric" call fro them
 					// So we're creating array of such metrics to be executed at the end - each in a separate go routine
@@ -402,11 +425,11 @@ func sync(ctx *lib.Ctx, args []string) {
 							[]string{
 								cmdPrefix + "calc_metric",
 								seriesNameOrFunc,
-								fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL),
+								sqlFile,
 								lib.ToYMDHDate(from),
 								lib.ToYMDHDate(to),
 								periodAggr,
-								strings.Join(extraParams, ","),
+								strings.Join(periodParams, ","),
 							},
 						)
 					} else {
@@ -416,13 +439,13 @@ func sync(ctx *lib.Ctx, args []string) {
 							[]string{
 								cmdPrefix + "calc_metric",
 								seriesNameOrFunc,
-								fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL),
+								sqlFile,
 								lib.ToYMDHDate(from),
 								lib.ToYMDHDate(to),
 								periodAggr,
-								strings.Join(extraParams, ","),
+								strings.Join(periodParams, ","),
 							},
-							nil,
+							metricEnv,
 						)
 						lib.FatalOnError(err)
 					}
@@ -437,7 +460,7 @@ func sync(ctx *lib.Ctx, args []string) {
 			ch := make(chan bool)
 			nThreads := 0
 			for _, hist := range hists {
-				go calcHistogram(ch, ctx, hist)
+				go calcHistogram(ch, ctx, hist, metricEnv)
 				nThreads++
 				if nThreads == thrN {
 					<-ch
@@ -452,7 +475,7 @@ func sync(ctx *lib.Ctx, args []string) {
 		} else {
 			lib.Printf("Now processing %d histograms using ST version\n", len(hists))
 			for _, hist := range hists {
-				calcHistogram(nil, ctx, hist)
+				calcHistogram(nil, ctx, hist, metricEnv)
 			}
 		}
 
@@ -463,16 +486,24 @@ func sync(ctx *lib.Ctx, args []string) {
 		} else {
 			lib.Printf("Skipping `columns` recalculation, it is only computed once per day\n")
 		}
+
+		// Expire (and optionally roll up) old points according to metrics retention rules
+		if ctx.ResetTSDB || time.Now().Hour() == 0 {
+			_, err := lib.ExecCommand(ctx, []string{cmdPrefix + "retention"}, nil)
+			lib.FatalOnError(err)
+		} else {
+			lib.Printf("Skipping `retention`, it is only applied once per day\n")
+		}
 	}
 	lib.Printf("Sync success\n")
 }
 
 // calcHistogram - calculate single histogram by calling "calc_metric" program with parameters from "hist"
-func calcHistogram(ch chan bool, ctx *lib.Ctx, hist []string) {
+// and environment overrides from "env"
+func calcHistogram(ch chan bool, ctx *lib.Ctx, hist []string, env map[string]string) {
 	if len(hist) != 7 {
 		lib.Fatalf("calcHistogram, expected 7 strings, got: %d: %v", len(hist), hist)
 	}
-	envMap := make(map[string]string)
 	lib.Printf(
 		"Calculate histogram %s,%s,%s,%s,%s,%s ...\n",
 		hist[1],
@@ -494,7 +525,7 @@ func calcHistogram(ch chan bool, ctx *lib.Ctx, hist []string) {
 			hist[5],
 			hist[6],
 		},
-		envMap,
+		env,
 	)
 	lib.FatalOnError(err)
 	// Synchronize go routine
@@ -570,6 +601,15 @@ func getSyncArgs(ctx *lib.Ctx, osArgs []string) []string {
 	return []string{}
 }
 
+// readProjects - reads projects definitions from projects.yaml
+func readProjects(ctx *lib.Ctx, dataPrefix string) *lib.AllProjects {
+	data, err := lib.ReadFile(ctx, dataPrefix+ctx.ProjectsYaml)
+	lib.FatalOnError(err)
+	var projects lib.AllProjects
+	lib.FatalOnError(yaml.Unmarshal(data, &projects))
+	return &projects
+}
+
 func main() {
 	dtStart := time.Now()
 	// Environment context parse
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"math"
 	"os"
 	"sort"
 	"strconv"
@@ -26,7 +26,8 @@ import (
 // To use FROM and TO make sure you set GHA2DB_RECENT_RANGE to cover that range too.
 func syncEvents(ctx *lib.Ctx) {
 	// Connect to GitHub API
-	gctx, gc := lib.GHClient(ctx)
+	pool := lib.GHClientPool(ctx)
+	defer pool.Close()
 
 	// Connect to Postgres DB
 	c := lib.PgConn(ctx)
@@ -146,8 +147,9 @@ func syncEvents(ctx *lib.Ctx) {
 	// 403 You have triggered an abuse detection mechanism. Please wait a few minutes before you try again
 	// So let's get all GitHub stuff one-after-another (ugly and slow) and then spawn threads to speedup
 	// Damn GitHub! - this could be working Number of CPU times faster! We're trying some hardcoded value: maxThreads
-	// Seems like GitHub is not detecting abuse when using 16 threads, but it detects when using 32.
-	maxThreads := 16
+	// Seems like GitHub is not detecting abuse when using 16 threads per token, but it detects when using 32.
+	// See GHA2DB_MAX_GHAPI_THREADS
+	maxThreads := pool.MaxThreads()
 	if maxThreads > thrN {
 		maxThreads = thrN
 	}
@@ -155,6 +157,24 @@ func syncEvents(ctx *lib.Ctx) {
 	var thrMutex = &sync.Mutex{}
 	ch := make(chan bool)
 	nThreads := 0
+	// threadsLimit - lowers threads limit when GitHub API abuse is detected and rises it back after successful calls
+	threadsLimit := func(err error, info string) {
+		thrMutex.Lock()
+		defer thrMutex.Unlock()
+		if lib.ClassifyGHAPIError(err) == lib.Abuse {
+			if allowedThrN > 1 {
+				allowedThrN--
+				if ctx.Debug > 0 {
+					lib.Printf("Lower threads limit (%s): %d/%d\n", info, nThreads, allowedThrN)
+				}
+			}
+		} else if err == nil && allowedThrN < maxThreads {
+			allowedThrN++
+			if ctx.Debug > 0 {
+				lib.Printf("Rise threads limit (%s): %d/%d\n", info, nThreads, allowedThrN)
+			}
+		}
+	}
 	dtStart := time.Now()
 	lastTime := dtStart
 	checked := 0
@@ -170,6 +190,11 @@ func syncEvents(ctx *lib.Ctx) {
 	var eidsMutex = &sync.Mutex{}
 	prs := make(map[int64]github.PullRequest)
 	var prsMutex = &sync.Mutex{}
+	// PRs can be fetched using GraphQL API, up to lib.GHGraphQLMaxIssues per query
+	var graphQLIDs lib.GHGraphQLIDs
+	if ctx.GHAPIGraphQL {
+		graphQLIDs = lib.GHGraphQLDBIDs(c, ctx)
+	}
 	for _, orgRepo := range repos {
 		go func(ch chan bool, orgRepo string) {
 			if isSingleRepo && orgRepo != singleRepo {
@@ -198,85 +223,23 @@ func syncEvents(ctx *lib.Ctx) {
 			)
 			nPages := 0
 			lib.FatalOnError(err)
+			// PR numbers to get using GraphQL API (by issue ID), after all events pages are processed
+			graphQLPRs := make(map[int64]int)
 			for {
-				got := false
-				for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
-					_, rem, waitPeriod := lib.GetRateLimits(gctx, gc, true)
-					if ctx.Debug > 1 {
-						lib.Printf("Issues Repo Events Try: %d, rem: %v, waitPeriod: %v\n", tr, rem, waitPeriod)
-					}
-					if rem <= ctx.MinGHAPIPoints {
-						if waitPeriod.Seconds() <= float64(ctx.MaxGHAPIWaitSeconds) {
-							if ctx.Debug > 0 {
-								lib.Printf("API limit reached while getting events data, waiting %v (%d)\n", waitPeriod, tr)
-							}
-							time.Sleep(time.Duration(1) * time.Second)
-							time.Sleep(waitPeriod)
-							continue
-						} else {
-							if ctx.GHAPIErrorIsFatal {
-								lib.Fatalf("API limit reached while getting issues events data, aborting, don't want to wait %v", waitPeriod)
-								os.Exit(1)
-							} else {
-								lib.Printf("Error: API limit reached while getting issues events data, aborting, don't want to wait %v", waitPeriod)
-								ch <- false
-								return
-							}
-						}
-					}
+				ok := ghAPICall(ctx, pool, &gcfg, "Issues.ListRepositoryEvents", func(gctx context.Context, gc *github.Client) (err error) {
 					nPages++
 					if ctx.Debug > 1 {
-						lib.Printf("API call for issues events %s (%d), remaining GHAPI points %d\n", orgRepo, nPages, rem)
+						lib.Printf("API call for issues events %s (%d)\n", orgRepo, nPages)
 					}
-					// Returns events in GHA format
-					//events, response, err = gc.Activity.ListRepositoryEvents(gctx, org, repo, opt)
 					// Returns events in Issue Event format (UI events)
 					events, response, err = gc.Issues.ListRepositoryEvents(gctx, org, repo, opt)
-					res := lib.HandlePossibleError(err, &gcfg, "Issues.ListRepositoryEvents")
-					if res != "" {
-						if res == lib.Abuse {
-							wait := time.Duration(int(math.Pow(2.0, float64(tr+3)))) * time.Second
-							thrMutex.Lock()
-							if ctx.Debug > 0 {
-								lib.Printf("GitHub API abuse detected (issues events), wait %v\n", wait)
-							}
-							if allowedThrN > 1 {
-								allowedThrN--
-								if ctx.Debug > 0 {
-									lib.Printf("Lower threads limit (issues events): %d/%d\n", nThreads, allowedThrN)
-								}
-							}
-							thrMutex.Unlock()
-							time.Sleep(wait)
-						}
-						if res == lib.NotFound {
-							lib.Printf("Warning: not found: %s/%s", org, repo)
-							ch <- false
-							return
-						}
-						continue
-					} else {
-						thrMutex.Lock()
-						if allowedThrN < maxThreads {
-							allowedThrN++
-							if ctx.Debug > 0 {
-								lib.Printf("Rise threads limit (issues events): %d/%d\n", nThreads, allowedThrN)
-							}
-						}
-						thrMutex.Unlock()
-					}
-					got = true
-					break
-				}
-				if !got {
-					if ctx.GHAPIErrorIsFatal {
-						lib.Fatalf("GetRateLimit call failed %d times while getting events, aborting", ctx.MaxGHAPIRetry)
-						os.Exit(2)
-					} else {
-						lib.Printf("Error: GetRateLimit call failed %d times while getting events, aborting", ctx.MaxGHAPIRetry)
-						ch <- false
-						return
-					}
+					threadsLimit(err, "issues events")
+					return
+				})
+				if !ok {
+					lib.Printf("Warning: cannot get issues events for %s\n", orgRepo)
+					ch <- false
+					return
 				}
 				minCreatedAt := time.Now()
 				maxCreatedAt := recentDt
@@ -410,78 +373,19 @@ func syncEvents(ctx *lib.Ctx) {
 						prsMutex.Lock()
 						_, foundPR := prs[cfg.IssueID]
 						prsMutex.Unlock()
-						if !foundPR {
+						if !foundPR && ctx.GHAPIGraphQL {
+							graphQLPRs[cfg.IssueID] = *issue.Number
+						} else if !foundPR {
 							prNum := *issue.Number
-							got = false
-							for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
-								_, rem, waitPeriod := lib.GetRateLimits(gctx, gc, true)
-								if ctx.Debug > 1 {
-									lib.Printf("Get PR Try: %d, rem: %v, waitPeriod: %v\n", tr, rem, waitPeriod)
-								}
-								if rem <= ctx.MinGHAPIPoints {
-									if waitPeriod.Seconds() <= float64(ctx.MaxGHAPIWaitSeconds) {
-										if ctx.Debug > 0 {
-											lib.Printf("API limit reached while getting PR data, waiting %v (%d)\n", waitPeriod, tr)
-										}
-										time.Sleep(time.Duration(1) * time.Second)
-										time.Sleep(waitPeriod)
-										continue
-									} else {
-										if ctx.GHAPIErrorIsFatal {
-											lib.Fatalf("API limit reached while getting PR data, aborting, don't want to wait %v", waitPeriod)
-											os.Exit(1)
-										} else {
-											lib.Printf("Error: API limit reached while getting PR data, aborting, don't want to wait %v", waitPeriod)
-											ch <- false
-											return
-										}
-									}
-								}
+							pr = nil
+							ghAPICall(ctx, pool, &gcfg, "PullRequests.Get", func(gctx context.Context, gc *github.Client) (err error) {
 								if ctx.Debug > 1 {
-									lib.Printf("API call for %s PR: %d, remaining GHAPI points %d\n", orgRepo, prNum, rem)
+									lib.Printf("API call for %s PR: %d\n", orgRepo, prNum)
 								}
 								pr, _, err = gc.PullRequests.Get(gctx, org, repo, prNum)
-								res := lib.HandlePossibleError(err, &gcfg, "PullRequests.Get")
-								if res != "" {
-									if res == lib.Abuse {
-										wait := time.Duration(int(math.Pow(2.0, float64(tr+3)))) * time.Second
-										thrMutex.Lock()
-										if ctx.Debug > 0 {
-											lib.Printf("GitHub API abuse detected (get PR), wait %v\n", wait)
-										}
-										if allowedThrN > 1 {
-											allowedThrN--
-											if ctx.Debug > 0 {
-												lib.Printf("Lower threads limit (get PR): %d/%d\n", nThreads, allowedThrN)
-											}
-										}
-										thrMutex.Unlock()
-										time.Sleep(wait)
-									}
-									continue
-								} else {
-									thrMutex.Lock()
-									if allowedThrN < maxThreads {
-										allowedThrN++
-										if ctx.Debug > 0 {
-											lib.Printf("Rise threads limit (get PR): %d/%d\n", nThreads, allowedThrN)
-										}
-									}
-									thrMutex.Unlock()
-								}
-								got = true
-								break
-							}
-							if !got {
-								if ctx.GHAPIErrorIsFatal {
-									lib.Fatalf("GetRateLimit call failed %d times while getting PR, aborting", ctx.MaxGHAPIRetry)
-									os.Exit(2)
-								} else {
-									lib.Printf("Error: GetRateLimit call failed %d times while getting PR, aborting", ctx.MaxGHAPIRetry)
-									ch <- false
-									return
-								}
-							}
+								threadsLimit(err, "get PR")
+								return
+							})
 							if pr != nil {
 								prsMutex.Lock()
 								prs[cfg.IssueID] = *pr
@@ -502,6 +406,23 @@ func syncEvents(ctx *lib.Ctx) {
 				}
 				opt.Page = response.NextPage
 			}
+			if len(graphQLPRs) > 0 {
+				repoPRs, reviewDecisions := getGraphQLPRs(ctx, pool, graphQLIDs, orgRepo, graphQLPRs)
+				prsMutex.Lock()
+				for iid, pr := range repoPRs {
+					if _, found := prs[iid]; !found {
+						prs[iid] = pr
+					}
+				}
+				prsMutex.Unlock()
+				issuesMutex.Lock()
+				for iid, decision := range reviewDecisions {
+					for i := range issues[iid] {
+						issues[iid][i].ReviewDecision = decision
+					}
+				}
+				issuesMutex.Unlock()
+			}
 			// Synchronize go routine
 			ch <- true
 		}(ch, orgRepo)
@@ -511,7 +432,7 @@ func syncEvents(ctx *lib.Ctx) {
 			nThreads--
 			checked++
 			// Get RateLimits info
-			_, rem, wait := lib.GetRateLimits(gctx, gc, true)
+			rem, wait := pool.RateLimits()
 			lib.ProgressInfo(checked, nRepos, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
 		}
 	}
@@ -524,13 +445,319 @@ func syncEvents(ctx *lib.Ctx) {
 		nThreads--
 		checked++
 		// Get RateLimits info
-		_, rem, wait := lib.GetRateLimits(gctx, gc, true)
+		rem, wait := pool.RateLimits()
 		lib.ProgressInfo(checked, nRepos, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
 	}
 
 	// Do final corrections
 	// manual sync: false
-	lib.SyncIssuesState(gctx, gc, ctx, c, issues, prs, false)
+	lib.SyncIssuesState(pool, ctx, c, issues, prs, false)
+	lib.Printf("%s\n", pool.CacheSummary())
+}
+
+// getGraphQLPRs - gets given repo's PRs (issue ID -> PR number) using GitHub GraphQL API, up to lib.GHGraphQLMaxIssues per query
+// PRs not returned by GraphQL API (or from failed queries) are fetched one by one using REST API
+// Returns PRs and review decisions keyed by issue ID
+func getGraphQLPRs(
+	ctx *lib.Ctx, pool *lib.GHPool, ids lib.GHGraphQLIDs, orgRepo string, numbers map[int64]int,
+) (prs map[int64]github.PullRequest, reviewDecisions map[int64]string) {
+	prs = make(map[int64]github.PullRequest)
+	reviewDecisions = make(map[int64]string)
+	issueIDs := make(map[int]int64)
+	nums := []int{}
+	for iid, number := range numbers {
+		issueIDs[number] = iid
+		nums = append(nums, number)
+	}
+	sort.Ints(nums)
+	// Issue IDs are already known from issue events
+	repoIDs := ids
+	repoIDs.IssueID = func(repo string, number int) (int64, bool) {
+		if iid, ok := issueIDs[number]; ok {
+			return iid, true
+		}
+		return ids.IssueID(repo, number)
+	}
+	gcfg := lib.IssueConfig{Repo: orgRepo}
+	rest := []int{}
+	for from := 0; from < len(nums); from += lib.GHGraphQLMaxIssues {
+		to := from + lib.GHGraphQLMaxIssues
+		if to > len(nums) {
+			to = len(nums)
+		}
+		var (
+			ghPRs     map[int]*github.PullRequest
+			decisions map[int]string
+		)
+		ok := ghAPICall(ctx, pool, &gcfg, "GraphQL", func(gctx context.Context, gc *github.Client) (err error) {
+			if ctx.Debug > 1 {
+				lib.Printf("GraphQL call for %d PRs from %s\n", to-from, orgRepo)
+			}
+			_, ghPRs, decisions, err = lib.GHGraphQLIssues(gctx, gc, orgRepo, nums[from:to], repoIDs)
+			if _, isGraphQL := err.(*lib.GHGraphQLError); isGraphQL {
+				lib.Printf("Warning: %v, using REST API\n", err)
+				ghPRs = nil
+				return nil
+			}
+			return
+		})
+		for _, number := range nums[from:to] {
+			pr, found := ghPRs[number]
+			if !ok || !found {
+				rest = append(rest, number)
+				continue
+			}
+			prs[issueIDs[number]] = *pr
+			if decision, found := decisions[number]; found {
+				reviewDecisions[issueIDs[number]] = decision
+			}
+		}
+	}
+	ary := strings.Split(orgRepo, "/")
+	for _, number := range rest {
+		var pr *github.PullRequest
+		ok := ghAPICall(ctx, pool, &gcfg, "PullRequests.Get", func(gctx context.Context, gc *github.Client) (err error) {
+			pr, _, err = gc.PullRequests.Get(gctx, ary[0], ary[1], number)
+			return
+		})
+		if ok && pr != nil {
+			prs[issueIDs[number]] = *pr
+		}
+	}
+	if ctx.Debug > 0 {
+		lib.Printf("%s: got %d/%d PRs, %d using REST API\n", orgRepo, len(prs), len(nums), len(rest))
+	}
+	return
+}
+
+// ghAPICall - calls GitHub API using clients pool, waits for API points reset and backs off on abuse detection
+// Only rate limit, abuse and server (5xx) errors are retried, 404 and 422 responses are logged and skipped
+// Other errors abort the run when GitHub API errors are fatal (GHA2DB_GHAPI_ERROR_FATAL), otherwise they are logged and skipped
+// Returns false when resource was not found, API call failed with a non retryable error or failed too many times
+func ghAPICall(ctx *lib.Ctx, pool *lib.GHPool, cfg *lib.IssueConfig, info string, call func(gctx context.Context, gc *github.Client) error) bool {
+	for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
+		gctx, gc, rem, waitPeriod := pool.Get()
+		if rem <= ctx.MinGHAPIPoints {
+			if waitPeriod.Seconds() <= float64(ctx.MaxGHAPIWaitSeconds) {
+				if ctx.Debug > 0 {
+					lib.Printf("API limit reached while getting %s data, waiting %v (%d)\n", info, waitPeriod, tr)
+				}
+				time.Sleep(time.Duration(1) * time.Second)
+				time.Sleep(waitPeriod)
+				continue
+			}
+			if ctx.GHAPIErrorIsFatal {
+				lib.Fatalf("API limit reached while getting %s data, aborting, don't want to wait %v", info, waitPeriod)
+			}
+			lib.Printf("Error: API limit reached while getting %s data, aborting, don't want to wait %v\n", info, waitPeriod)
+			return false
+		}
+		err := call(gctx, gc)
+		res := lib.ClassifyGHAPIError(err)
+		switch res {
+		case "":
+			return true
+		case "rate":
+			lib.Printf("Rate limit (%s) for %v, retrying (%d)\n", info, cfg, tr)
+		case lib.Abuse:
+			wait := pool.Abuse(gc)
+			if ctx.Debug > 0 {
+				lib.Printf("GitHub API abuse detected (%s), token backoff %v\n", info, wait)
+			}
+		case lib.ServerError:
+			lib.Printf("Server error (%s) for %v: %v, retrying (%d)\n", info, cfg, err, tr)
+			if tr < 6 {
+				time.Sleep(time.Duration(1<<uint(tr)) * time.Second)
+			} else {
+				time.Sleep(time.Duration(64) * time.Second)
+			}
+		case lib.NotFound, lib.Unprocessable:
+			// Resource is gone or cannot be processed (for example PR head commit was force pushed), skip it
+			if ctx.Debug > 0 {
+				lib.Printf("Skipping %s for %v: %v\n", info, cfg, err)
+			}
+			return false
+		default:
+			if ctx.GHAPIErrorIsFatal {
+				lib.Fatalf("%s failed for %v: %v", info, cfg, err)
+			}
+			lib.Printf("Error: %s failed for %v: %v, skipping\n", info, cfg, err)
+			return false
+		}
+	}
+	if ctx.GHAPIErrorIsFatal {
+		lib.Fatalf("GetRateLimit call failed %d times while getting %s, aborting", ctx.MaxGHAPIRetry, info)
+	}
+	lib.Printf("Error: GetRateLimit call failed %d times while getting %s\n", ctx.MaxGHAPIRetry, info)
+	return false
+}
+
+// getPRReviews - gets all pages of PR reviews, review comments, head commit statuses and check runs
+func getPRReviews(ctx *lib.Ctx, pool *lib.GHPool, r *lib.GHPRReviews) bool {
+	ary := strings.Split(r.Repo, "/")
+	if len(ary) < 2 || ary[0] == "" || ary[1] == "" {
+		return false
+	}
+	org, repo := ary[0], ary[1]
+	cfg := lib.IssueConfig{Repo: r.Repo, Number: r.Number}
+	opt := &github.ListOptions{PerPage: 100}
+	for opt.Page = 1; opt.Page > 0; {
+		var (
+			reviews  []*github.PullRequestReview
+			response *github.Response
+		)
+		ok := ghAPICall(ctx, pool, &cfg, "PullRequests.ListReviews", func(gctx context.Context, gc *github.Client) (err error) {
+			reviews, response, err = gc.PullRequests.ListReviews(gctx, org, repo, r.Number, opt)
+			return
+		})
+		if !ok {
+			return false
+		}
+		r.Reviews = append(r.Reviews, reviews...)
+		opt.Page = response.NextPage
+	}
+	copt := &github.PullRequestListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for copt.Page = 1; copt.Page > 0; {
+		var (
+			comments []*github.PullRequestComment
+			response *github.Response
+		)
+		ok := ghAPICall(ctx, pool, &cfg, "PullRequests.ListComments", func(gctx context.Context, gc *github.Client) (err error) {
+			comments, response, err = gc.PullRequests.ListComments(gctx, org, repo, r.Number, copt)
+			return
+		})
+		if !ok {
+			return false
+		}
+		r.Comments = append(r.Comments, comments...)
+		copt.Page = response.NextPage
+	}
+	// Head commit can be already gone (force pushed), then it has no statuses and check runs
+	for opt.Page = 1; opt.Page > 0; {
+		var (
+			statuses []*github.RepoStatus
+			response *github.Response
+		)
+		ok := ghAPICall(ctx, pool, &cfg, "Repositories.ListStatuses", func(gctx context.Context, gc *github.Client) (err error) {
+			statuses, response, err = gc.Repositories.ListStatuses(gctx, org, repo, r.HeadSHA, opt)
+			return
+		})
+		if !ok {
+			break
+		}
+		r.Statuses = append(r.Statuses, statuses...)
+		opt.Page = response.NextPage
+	}
+	for opt.Page = 1; opt.Page > 0; {
+		var (
+			runs     []*lib.GHCheckRun
+			response *github.Response
+		)
+		ok := ghAPICall(ctx, pool, &cfg, "ListCheckRuns", func(gctx context.Context, gc *github.Client) (err error) {
+			runs, response, err = lib.GHListCheckRuns(gctx, gc, org, repo, r.HeadSHA, opt)
+			return
+		})
+		if !ok {
+			break
+		}
+		r.CheckRuns = append(r.CheckRuns, runs...)
+		opt.Page = response.NextPage
+	}
+	return true
+}
+
+// syncReviews - gets reviews, review comments, head commit statuses and check runs of PRs updated recently
+// (in GHA2DB_RECENT_RANGE) or in GHA2DB_GHAPI_REVIEWS_FROM - GHA2DB_GHAPI_REVIEWS_TO range (back-fill)
+// Saves them in `gha_reviews` and `gha_checks` tables
+func syncReviews(ctx *lib.Ctx) {
+	// Connect to GitHub API
+	pool := lib.GHClientPool(ctx)
+	defer pool.Close()
+
+	// Connect to Postgres DB
+	c := lib.PgConn(ctx)
+	defer func() { lib.FatalOnError(c.Close()) }()
+
+	from := ctx.GHAPIReviewsFrom
+	if from.IsZero() {
+		from = lib.GetDateAgo(c, ctx, lib.HourStart(time.Now()), ctx.RecentRange)
+	}
+	to := ctx.GHAPIReviewsTo
+	if to.IsZero() {
+		to = time.Now()
+	}
+
+	// Most recent state of each PR updated in a given range
+	rows := lib.QuerySQLWithErr(
+		c,
+		ctx,
+		fmt.Sprintf(
+			"select distinct on (dup_repo_name, number) dup_repo_name, number, id, head_sha "+
+				"from gha_pull_requests where updated_at >= %s and updated_at < %s "+
+				"order by dup_repo_name, number, updated_at desc, event_id desc",
+			lib.NValue(1),
+			lib.NValue(2),
+		),
+		from,
+		to,
+	)
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	prs := []*lib.GHPRReviews{}
+	for rows.Next() {
+		pr := &lib.GHPRReviews{}
+		lib.FatalOnError(rows.Scan(&pr.Repo, &pr.Number, &pr.PRID, &pr.HeadSHA))
+		prs = append(prs, pr)
+	}
+	lib.FatalOnError(rows.Err())
+	nPRs := len(prs)
+	lib.Printf("ghapi2db.go: Processing %d PRs updated %s - %s - reviews and checks\n", nPRs, lib.ToYMDHMSDate(from), lib.ToYMDHMSDate(to))
+
+	// Get number of CPUs available
+	thrN := lib.GetThreadsNum(ctx)
+	maxThreads := pool.MaxThreads()
+	if maxThreads > thrN {
+		maxThreads = thrN
+	}
+	ch := make(chan bool)
+	nThreads := 0
+	dtStart := time.Now()
+	lastTime := dtStart
+	checked := 0
+	saved := 0
+	for _, pr := range prs {
+		go func(ch chan bool, pr *lib.GHPRReviews) {
+			if !getPRReviews(ctx, pool, pr) {
+				ch <- false
+				return
+			}
+			if ctx.Debug > 0 {
+				lib.Printf("%s %d: %d reviews, %d review comments, %d statuses, %d check runs\n", pr.Repo, pr.Number, len(pr.Reviews), len(pr.Comments), len(pr.Statuses), len(pr.CheckRuns))
+			}
+			lib.WritePRReviews(c, ctx, pr)
+			ch <- true
+		}(ch, pr)
+		nThreads++
+		for nThreads >= maxThreads {
+			if <-ch {
+				saved++
+			}
+			nThreads--
+			checked++
+			rem, wait := pool.RateLimits()
+			lib.ProgressInfo(checked, nPRs, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
+		}
+	}
+	for nThreads > 0 {
+		if <-ch {
+			saved++
+		}
+		nThreads--
+		checked++
+		rem, wait := pool.RateLimits()
+		lib.ProgressInfo(checked, nPRs, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
+	}
+	lib.Printf("Saved reviews and checks of %d/%d PRs\n", saved, nPRs)
+	lib.Printf("%s\n", pool.CacheSummary())
 }
 
 func main() {
@@ -543,6 +770,10 @@ func main() {
 	if !ctx.SkipGHAPI {
 		syncEvents(&ctx)
 	}
+	// PR reviews, statuses and check runs
+	if ctx.GHAPIReviews {
+		syncReviews(&ctx)
+	}
 	dtEnd := time.Now()
 	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
 }
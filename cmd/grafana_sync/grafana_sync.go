@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	lib "devstats"
+)
+
+// syncDashboards pushes project's dashboards JSONs to Grafana using its HTTP API
+// JSONs are taken from grafana/dashboards/<project>/ unless given explicitly
+func syncDashboards(project string, files []string) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	if len(files) == 0 {
+		dir := dataPrefix + "grafana/dashboards/" + project + "/"
+		infos, err := ioutil.ReadDir(dir)
+		lib.FatalOnError(err)
+		for _, info := range infos {
+			if !info.IsDir() && strings.HasSuffix(info.Name(), ".json") {
+				files = append(files, dir+info.Name())
+			}
+		}
+	}
+	jsons := make(map[string][]byte)
+	for _, file := range files {
+		data, err := lib.ReadFile(&ctx, file)
+		lib.FatalOnError(err)
+		jsons[filepath.Base(file)] = data
+	}
+
+	// Datasource uses read only user, never fall back to PG_PASS (admin password)
+	var ds *lib.GrafanaDatasource
+	if os.Getenv("SKIP_DATASOURCE") == "" {
+		pwd := os.Getenv("PG_PASS_RO")
+		if pwd == "" {
+			lib.Fatalf("PG_PASS_RO (ro_user password) must be set to provision datasource, set SKIP_DATASOURCE to skip it")
+		}
+		ds = lib.GrafanaPsqlDatasource(&ctx, pwd)
+	}
+
+	gc := lib.NewGrafanaClient(&ctx)
+	changes, err := lib.GrafanaSync(gc, ctx.GrafanaFolder, ds, jsons, ctx.GrafanaDryRun)
+	stats := make(map[string]int)
+	for _, change := range changes {
+		stats[change.Action]++
+		if change.Action != "unchanged" || ctx.Debug > 0 {
+			lib.Printf("%s\n", change.String())
+		}
+	}
+	lib.FatalOnError(err)
+	mode := ""
+	if ctx.GrafanaDryRun {
+		mode = " (dry run)"
+	}
+	lib.Printf(
+		"%s: %d dashboards JSONs, created: %d, updated: %d, unchanged: %d%s\n",
+		project, len(jsons), stats["create"], stats["update"], stats["unchanged"], mode,
+	)
+}
+
+func main() {
+	dtStart := time.Now()
+	if len(os.Args) < 2 && os.Getenv("GHA2DB_PROJECT") == "" {
+		lib.Printf("Required arg: project name (or set GHA2DB_PROJECT) and optional list of JSONs to sync instead of grafana/dashboards/<project>/*.json\n")
+		lib.Printf("Set GHA2DB_GRAFANA_DRY_RUN to only display changes\n")
+		os.Exit(1)
+	}
+	project := os.Getenv("GHA2DB_PROJECT")
+	files := []string{}
+	if len(os.Args) >= 2 {
+		project = os.Args[1]
+		files = os.Args[2:]
+	}
+	syncDashboards(project, files)
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+}
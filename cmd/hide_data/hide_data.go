@@ -1,155 +1,22 @@
 package main
 
 import (
-	"crypto/sha1"
+	"database/sql"
 	lib "devstats"
 	"encoding/csv"
-	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
-type replaceConfig struct {
-	table  string
-	column string
-}
-
-func processHidden(ctx *lib.Ctx) {
-	replaces := []replaceConfig{
-		{
-			table:  "gha_actors",
-			column: "login",
-		},
-		{
-			table:  "gha_actors",
-			column: "name",
-		},
-		{
-			table:  "gha_actors_emails",
-			column: "email",
-		},
-		{
-			table:  "gha_actors_affiliations",
-			column: "company_name",
-		},
-		{
-			table:  "gha_companies",
-			column: "name",
-		},
-		{
-			table:  "gha_events",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_payloads",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_commits",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_commits",
-			column: "author_name",
-		},
-		{
-			table:  "gha_pages",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_comments",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_comments",
-			column: "dup_user_login",
-		},
-		{
-			table:  "gha_issues",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_issues",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_issues",
-			column: "dup_user_login",
-		},
-		{
-			table:  "gha_milestones",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_milestones",
-			column: "dupn_creator_login",
-		},
-		{
-			table:  "gha_issues_labels",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_forkees",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_forkees",
-			column: "dup_owner_login",
-		},
-		{
-			table:  "gha_releases",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_releases",
-			column: "dup_author_login",
-		},
-		{
-			table:  "gha_assets",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_assets",
-			column: "dup_uploader_login",
-		},
-		{
-			table:  "gha_pull_requests",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_pull_requests",
-			column: "dup_user_login",
-		},
-		{
-			table:  "gha_branches",
-			column: "dupn_forkee_name",
-		},
-		{
-			table:  "gha_branches",
-			column: "dupn_user_login",
-		},
-		{
-			table:  "gha_teams",
-			column: "dup_actor_login",
-		},
-		{
-			table:  "gha_texts",
-			column: "actor_login",
-		},
-		{
-			table:  "gha_issues_events_labels",
-			column: "actor_login",
-		},
-	}
-	configFile := lib.HideCfgFile
-	shaMap := lib.GetHidden(configFile)
-
+// getDatabases - returns projects databases (in projects order), honors ONLY env variable
+func getDatabases(ctx *lib.Ctx) (dbs []string) {
 	dataPrefix := lib.DataDir
 	if ctx.Local {
 		dataPrefix = "./"
@@ -186,8 +53,6 @@ func processHidden(ctx *lib.Ctx) {
 		bOnly = true
 	}
 
-	tasks := [][3]string{}
-	dbs := []string{}
 	for _, order := range orders {
 		name := projectsMap[order]
 		if bOnly {
@@ -196,45 +61,37 @@ func processHidden(ctx *lib.Ctx) {
 				continue
 			}
 		}
-		proj := projects.Projects[name]
-		for sha, anon := range shaMap {
-			tasks = append(tasks, [3]string{proj.PDB, sha, anon})
-		}
-		dbs = append(dbs, proj.PDB)
+		dbs = append(dbs, projects.Projects[name].PDB)
 	}
-	lib.Printf("Processing databases: %+v\n", dbs)
+	return
+}
+
+// requestsConn - connects to `devstats` database holding GDPR requests
+func requestsConn(ctx *lib.Ctx) *sql.DB {
+	con := lib.PgConnDB(ctx, lib.Devstats)
+	lib.GDPRRequestsStructure(con, ctx)
+	return con
+}
+
+// forEachDatabase - calls f for each database using up to threads number of connections
+// Results are audit entries per request ID
+func forEachDatabase(ctx *lib.Ctx, dbs []string, f func(*sql.DB, string) map[int64][]lib.GDPRAudit) map[string]map[int64][]lib.GDPRAudit {
+	var mtx sync.Mutex
+	results := make(map[string]map[int64][]lib.GDPRAudit)
 	thrN := lib.GetThreadsNum(ctx)
 	ch := make(chan bool)
 	nThreads := 0
-	for _, task := range tasks {
-		go func(ch chan bool, task [3]string) {
-			con := lib.PgConnDB(ctx, task[0])
+	for _, db := range dbs {
+		go func(ch chan bool, db string) {
+			con := lib.PgConnDB(ctx, db)
 			defer func() { lib.FatalOnError(con.Close()) }()
-			for _, replace := range replaces {
-				res := lib.ExecSQLWithErr(
-					con,
-					ctx,
-					fmt.Sprintf(
-						"update %s set %s = %s where encode(digest(%s, 'sha1'), 'hex') = %s",
-						replace.table,
-						replace.column,
-						lib.NValue(1),
-						replace.column,
-						lib.NValue(2),
-					),
-					lib.AnyArray{
-						task[2],
-						task[1],
-					}...,
-				)
-				rows, err := res.RowsAffected()
-				lib.FatalOnError(err)
-				if rows > 0 {
-					lib.Printf("DB: %s, table: %s, column: %s, sha: %s, updated %d rows\n", task[0], replace.table, replace.column, task[1], rows)
-				}
-			}
+			lib.GDPRAuditStructure(con, ctx)
+			res := f(con, db)
+			mtx.Lock()
+			results[db] = res
+			mtx.Unlock()
 			ch <- true
-		}(ch, task)
+		}(ch, db)
 		nThreads++
 		if nThreads == thrN {
 			<-ch
@@ -245,19 +102,160 @@ func processHidden(ctx *lib.Ctx) {
 		<-ch
 		nThreads--
 	}
+	return results
+}
+
+// processHidden - anonymizes SHA1s from hide/hide.csv and all pending GDPR requests in all databases
+// hide/hide.csv entries have no subject identifiers, so only exact columns are processed for them (audited as request 0)
+func processHidden(ctx *lib.Ctx) {
+	shaMap := lib.GetHidden(lib.HideCfgFile)
+	hidden := lib.GDPRRequest{}
+	for sha := range shaMap {
+		hidden.SHAs = append(hidden.SHAs, sha)
+	}
+	sort.Strings(hidden.SHAs)
+
+	rcon := requestsConn(ctx)
+	defer func() { lib.FatalOnError(rcon.Close()) }()
+	requests := lib.GDPRRequests(rcon, ctx, lib.GDPRReceived, lib.GDPRResidual)
+	if len(hidden.SHAs) > 0 {
+		requests = append([]lib.GDPRRequest{hidden}, requests...)
+	}
+	if len(requests) == 0 {
+		lib.Printf("Nothing to anonymize\n")
+		return
+	}
+
+	dbs := getDatabases(ctx)
+	lib.Printf("Processing databases: %+v, requests: %d\n", dbs, len(requests))
+	results := forEachDatabase(ctx, dbs, func(con *sql.DB, db string) map[int64][]lib.GDPRAudit {
+		registry := lib.GDPRRegistry(con, ctx)
+		res := make(map[int64][]lib.GDPRAudit)
+		for i := range requests {
+			req := &requests[i]
+			res[req.ID] = lib.GDPRAnonymize(con, ctx, req, registry)
+			total, nonZero := lib.GDPRAuditRows(res[req.ID])
+			if total > 0 {
+				lib.Printf("DB: %s, request: %d, updated %d rows: %s\n", db, req.ID, total, strings.Join(nonZero, ", "))
+			}
+		}
+		return res
+	})
+	for _, req := range requests {
+		if req.ID == 0 {
+			continue
+		}
+		total := int64(0)
+		for _, db := range dbs {
+			rows, _ := lib.GDPRAuditRows(results[db][req.ID])
+			total += rows
+		}
+		lib.SetGDPRRequestStatus(rcon, ctx, req.ID, lib.GDPRAnonymized)
+		lib.Printf("Request %d anonymized, %d rows updated in %d databases, run 'hide_data -verify' to verify it\n", req.ID, total, len(dbs))
+	}
+}
+
+// verifyRequests - checks that no rows matching anonymized requests subjects remain in any database
+// Requests without residual matches are marked as verified and their subject identifiers are purged
+func verifyRequests(ctx *lib.Ctx) {
+	rcon := requestsConn(ctx)
+	defer func() { lib.FatalOnError(rcon.Close()) }()
+	requests := lib.GDPRRequests(rcon, ctx, lib.GDPRAnonymized, lib.GDPRResidual)
+	if len(requests) == 0 {
+		lib.Printf("Nothing to verify\n")
+		return
+	}
+
+	dbs := getDatabases(ctx)
+	lib.Printf("Verifying databases: %+v, requests: %d\n", dbs, len(requests))
+	results := forEachDatabase(ctx, dbs, func(con *sql.DB, db string) map[int64][]lib.GDPRAudit {
+		registry := lib.GDPRRegistry(con, ctx)
+		res := make(map[int64][]lib.GDPRAudit)
+		for i := range requests {
+			req := &requests[i]
+			res[req.ID] = lib.GDPRVerify(con, ctx, req, registry)
+		}
+		return res
+	})
+	failed := false
+	for _, req := range requests {
+		residual := int64(0)
+		for _, db := range dbs {
+			total, nonZero := lib.GDPRAuditRows(results[db][req.ID])
+			if total > 0 {
+				lib.Printf("DB: %s, request: %d, %d residual rows: %s\n", db, req.ID, total, strings.Join(nonZero, ", "))
+			}
+			residual += total
+		}
+		if residual > 0 {
+			failed = true
+			lib.SetGDPRRequestStatus(rcon, ctx, req.ID, lib.GDPRResidual)
+			lib.Printf("Request %d has %d residual rows, run 'hide_data' again\n", req.ID, residual)
+			continue
+		}
+		lib.SetGDPRRequestStatus(rcon, ctx, req.ID, lib.GDPRVerified)
+		lib.Printf("Request %d verified in %d databases, subject identifiers purged\n", req.ID, len(dbs))
+	}
+	if failed {
+		os.Exit(1)
+	}
 }
 
+// addRequest - registers GDPR request for given subject identifiers (logins, emails, names)
+// Received date can be given via GDPR_RECEIVED (YYYY-MM-DD), defaults to now
+// SHA1s are also added to hide/hide.csv so newly imported data is anonymized too
+func addRequest(ctx *lib.Ctx, args []string) {
+	subjects := []string{}
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		if arg != "" {
+			subjects = append(subjects, arg)
+		}
+	}
+	if len(subjects) == 0 {
+		lib.Fatalf("%s", "request needs at least one subject identifier")
+	}
+	received := time.Now()
+	if s := os.Getenv("GDPR_RECEIVED"); s != "" {
+		received = lib.TimeParseAny(s)
+	}
+	rcon := requestsConn(ctx)
+	defer func() { lib.FatalOnError(rcon.Close()) }()
+	id := lib.AddGDPRRequest(rcon, ctx, subjects, received)
+	hideData(subjects)
+	lib.Printf("Added request %d received %s with %d subject(s), run 'hide_data' to process it\n", id, lib.ToYMDDate(received), len(subjects))
+}
+
+// listRequests - prints GDPR requests (without subject identifiers)
+func listRequests(ctx *lib.Ctx) {
+	rcon := requestsConn(ctx)
+	defer func() { lib.FatalOnError(rcon.Close()) }()
+	for _, req := range lib.GDPRRequests(rcon, ctx) {
+		fmt.Printf("%d\t%s\t%s\t%s\n", req.ID, lib.ToYMDDate(req.ReceivedAt), req.Status, strings.Join(req.SHAs, ","))
+	}
+}
+
+// listRegistry - prints columns that can hold personal data in all databases
+func listRegistry(ctx *lib.Ctx) {
+	for _, db := range getDatabases(ctx) {
+		con := lib.PgConnDB(ctx, db)
+		for _, col := range lib.GDPRRegistry(con, ctx) {
+			fmt.Printf("%s\t%s.%s\t%s\t%s\n", db, col.Table, col.Column, col.Type, col.Kind)
+		}
+		lib.FatalOnError(con.Close())
+	}
+}
+
+// hideData - adds SHA1s of given values to hide/hide.csv
 func hideData(args []string) {
 	shaMap := lib.GetHidden(lib.HideCfgFile)
 	added := false
 	for _, argo := range args {
 		arg := strings.TrimSpace(argo)
-		hash := sha1.New()
-		hash.Write([]byte(arg))
-		sha := hex.EncodeToString(hash.Sum(nil))
+		sha := lib.SHA1(arg)
 		_, ok := shaMap[sha]
 		if ok {
-			lib.Printf("Skipping '%s', SHA1 '%s' - already added\n", arg, sha)
+			lib.Printf("Skipping SHA1 '%s' - already added\n", sha)
 			continue
 		}
 		shaMap[sha] = ""
@@ -287,7 +285,18 @@ func main() {
 	if len(os.Args) < 2 {
 		processHidden(&ctx)
 	} else {
-		hideData(os.Args[1:])
+		switch os.Args[1] {
+		case "-request":
+			addRequest(&ctx, os.Args[2:])
+		case "-verify":
+			verifyRequests(&ctx)
+		case "-list":
+			listRequests(&ctx)
+		case "-registry":
+			listRegistry(&ctx)
+		default:
+			hideData(os.Args[1:])
+		}
 	}
 	dtEnd := time.Now()
 	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
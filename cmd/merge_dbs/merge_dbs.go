@@ -4,12 +4,211 @@ import (
 	"database/sql"
 	lib "devstats"
 	"fmt"
+	"strings"
 	"time"
+)
+
+// mergeTable - table to merge
+// Each table is split into buckets by the bucket column: ids are grouped by idWidth, dates by dtWidth seconds,
+// tables without bucket column are a single bucket. Buckets that are new or changed in a source database since
+// the last merge (rows count or rows hash differs) are merged again, other buckets are skipped
+// Only buckets at or above the last merged bucket (high-water mark) are fingerprinted, unless full verify is requested
+// key is a natural key of a table without primary key, an unique index is created on it in the output database
+// conds: 1st pass uses 1st condition, 2nd pass uses 2nd condition, "-" means that this pass is skipped
+type mergeTable struct {
+	name   string
+	key    []string
+	bucket string
+	dt     bool
+	conds  [2]string
+}
 
-	"github.com/lib/pq"
+// mergeStats - merge statistics of a single table
+type mergeStats struct {
+	rows      int
+	inserted  int
+	same      int
+	conflicts int
+}
+
+const (
+	// maxConflictsLog - maximum number of conflicts printed per table and source (all are saved in gha_merge_conflicts)
+	maxConflictsLog = 10
+	// idWidth - number of IDs in a single bucket
+	idWidth = 1000000
+	// dtWidth - number of seconds in a single bucket
+	dtWidth = 86400
 )
 
-func mergePDBs() {
+// bucketExpr returns SQL expression that computes row's bucket
+func (t *mergeTable) bucketExpr() string {
+	if t.bucket == "" {
+		return "0"
+	}
+	if t.dt {
+		return fmt.Sprintf("floor(extract(epoch from %s) / %d)::bigint", t.bucket, dtWidth)
+	}
+	return fmt.Sprintf("floor(%s::numeric / %d)::bigint", t.bucket, idWidth)
+}
+
+// rangesCond returns condition selecting rows from given buckets ranges (uses bucket column index)
+func (t *mergeTable) rangesCond(ranges [][2]int64) string {
+	if t.bucket == "" {
+		return ""
+	}
+	conds := []string{}
+	for _, r := range ranges {
+		if t.dt {
+			conds = append(
+				conds,
+				fmt.Sprintf(
+					"%s >= '%s' and %s < '%s'",
+					t.bucket,
+					lib.ToYMDHMSDate(time.Unix(r[0]*dtWidth, 0).UTC()),
+					t.bucket,
+					lib.ToYMDHMSDate(time.Unix((r[1]+1)*dtWidth, 0).UTC()),
+				),
+			)
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("%s >= %d and %s < %d", t.bucket, r[0]*idWidth, t.bucket, (r[1]+1)*idWidth))
+	}
+	return "(" + strings.Join(conds, ") or (") + ")"
+}
+
+// fromCond returns condition selecting rows from a given bucket and all later buckets
+func (t *mergeTable) fromCond(bucket int64) string {
+	if t.bucket == "" {
+		return ""
+	}
+	if t.dt {
+		return fmt.Sprintf("%s >= '%s'", t.bucket, lib.ToYMDHMSDate(time.Unix(bucket*dtWidth, 0).UTC()))
+	}
+	return fmt.Sprintf("%s >= %d", t.bucket, bucket*idWidth)
+}
+
+// sourceBuckets returns fingerprints of table buckets in the source database, all buckets or buckets at or above `from`
+func sourceBuckets(ctx *lib.Ctx, c *sql.DB, table *mergeTable, from *int64) map[int64]lib.MergeBucket {
+	buckets := make(map[int64]lib.MergeBucket)
+	where := ""
+	if from != nil {
+		if cond := table.fromCond(*from); cond != "" {
+			where = " where " + cond
+		}
+	}
+	rows := lib.QuerySQLWithErr(
+		c,
+		ctx,
+		fmt.Sprintf(
+			"select %s, count(*), coalesce(sum(hashtext(t::text)), 0) from %s t%s group by 1",
+			table.bucketExpr(),
+			table.name,
+			where,
+		),
+	)
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	var (
+		bucket int64
+		b      lib.MergeBucket
+	)
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(&bucket, &b.Rows, &b.Hash))
+		buckets[bucket] = b
+	}
+	lib.FatalOnError(rows.Err())
+	return buckets
+}
+
+// mergeRows copies rows matching condition from the source database, rows that already exist
+// (the same primary key or natural key) are compared and conflicts are recorded
+func mergeRows(ctx *lib.Ctx, c, co *sql.DB, source string, table *mergeTable, cond, info string) (stats mergeStats) {
+	key := lib.TablePrimaryKey(co, ctx, table.name)
+	if len(key) == 0 {
+		key = table.key
+	}
+	queryRoot := "from " + table.name
+	if cond != "" {
+		queryRoot += " where " + cond
+	}
+	rc := 0
+	lib.FatalOnError(lib.QueryRowSQL(c, ctx, "select count(*) "+queryRoot).Scan(&rc))
+	lib.Printf("%s: start table: %s, DB: %s, rows: %d...\n", info, table.name, source, rc)
+	if rc == 0 {
+		return
+	}
+	rows := lib.QuerySQLWithErr(c, ctx, "select * "+queryRoot)
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	columns, err := rows.Columns()
+	lib.FatalOnError(err)
+	nColumns := len(columns)
+	colIndex := make(map[string]int)
+	for i, column := range columns {
+		colIndex[column] = i
+	}
+
+	// Insert ignoring rows that already exist (primary key or natural key unique index)
+	// Rows with the same key are compared, unless the key contains expressions (then it covers row's content)
+	insert := lib.InsertIgnore(table.name + "(" + strings.Join(columns, ", ") + ") " + lib.NValues(nColumns))
+	compare := len(key) > 0
+	keyCond := []string{}
+	for i, column := range key {
+		if _, ok := colIndex[column]; !ok {
+			compare = false
+			break
+		}
+		keyCond = append(keyCond, fmt.Sprintf("%s = %s", column, lib.NValue(i+1)))
+	}
+	existing := "select " + strings.Join(columns, ", ") + " from " + table.name + " where " + strings.Join(keyCond, " and ")
+
+	ptrs := make([]interface{}, nColumns)
+	vals := make([]interface{}, nColumns)
+	for i := range ptrs {
+		ptrs[i] = &vals[i]
+	}
+	oPtrs := make([]interface{}, nColumns)
+	oVals := make([]interface{}, nColumns)
+	for i := range oPtrs {
+		oPtrs[i] = &oVals[i]
+	}
+	dtStart := time.Now()
+	lastTime := dtStart
+	for rows.Next() {
+		lib.FatalOnError(rows.Scan(ptrs...))
+		stats.rows++
+		lib.ProgressInfo(stats.rows, rc, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("%s: table %s, DB %s", info, table.name, source))
+		res := lib.ExecSQLWithErr(co, ctx, insert, vals...)
+		affected, err := res.RowsAffected()
+		lib.FatalOnError(err)
+		if affected > 0 {
+			stats.inserted++
+			continue
+		}
+		if !compare {
+			stats.same++
+			continue
+		}
+		keyVals := []interface{}{}
+		for _, column := range key {
+			keyVals = append(keyVals, vals[colIndex[column]])
+		}
+		lib.FatalOnError(lib.QueryRowSQL(co, ctx, existing, keyVals...).Scan(oPtrs...))
+		diff := lib.MergeRowDiff(columns, vals, oVals)
+		if len(diff) == 0 {
+			stats.same++
+			continue
+		}
+		stats.conflicts++
+		keyStr := lib.MergeKeyString(key, keyVals)
+		lib.AddMergeConflict(co, ctx, source, table.name, keyStr, diff)
+		if stats.conflicts <= maxConflictsLog {
+			lib.Printf("%s: conflict: table: %s, DB: %s, key: %s, columns: %s\n", info, table.name, source, keyStr, strings.Join(diff, ", "))
+		}
+	}
+	lib.FatalOnError(rows.Err())
+	return
+}
+
+func mergePDBs() (conflicts int) {
 	// Environment context parse
 	var ctx lib.Ctx
 	ctx.Init()
@@ -43,157 +242,126 @@ func mergePDBs() {
 	co := lib.PgConnDB(&ctx, ctx.OutputDB)
 	// Defer close output connection
 	defer func() { lib.FatalOnError(co.Close()) }()
+	lib.MergeStructure(co, &ctx)
 
 	// process this tables
-	// 1st pass uses 1st condition
-	// 2nd pass uses 2nd condition
-	// "-" means that this pass is skipped
 	// Some tables are commented out because we're going to
 	// run other tools on merged database to fill them
-	tableData := [][]string{
-		{"gha_actors", "id > 0", "id <= 0"},
-		//{"gha_actors_affiliations", "", "-"},
-		//{"gha_actors_emails", "", "-"},
-		{"gha_assets", "", "-"},
-		{"gha_branches", "", "-"},
-		{"gha_comments", "", "-"},
-		{"gha_commits", "", "-"},
-		{"gha_commits_files", "", "-"},
-		//{"gha_companies", "", "-"},
-		//{"gha_computed", "", "-"},
-		{"gha_events", "id > 0", "id <= 0"},
-		//{"gha_events_commits_files", "", "-"},
-		{"gha_forkees", "", "-"},
-		{"gha_issues", "id > 0", "id <= 0"},
-		{"gha_issues_assignees", "", "-"},
-		{"gha_issues_events_labels", "", "-"},
-		{"gha_issues_labels", "", "-"},
-		{"gha_issues_pull_requests", "", "-"},
-		{"gha_labels", "id > 0", "id <= 0"},
-		//{"gha_logs", "", "-"},
-		{"gha_milestones", "", "-"},
-		{"gha_orgs", "", "-"},
-		{"gha_pages", "", "-"},
-		{"gha_payloads", "event_id > 0", "event_id <= 0"},
-		//{"gha_postprocess_scripts", "", "-"},
-		{"gha_pull_requests", "", "-"},
-		{"gha_pull_requests_assignees", "", "-"},
-		{"gha_pull_requests_requested_reviewers", "", "-"},
-		{"gha_releases", "", "-"},
-		{"gha_releases_assets", "", "-"},
-		{"gha_repos", "", "-"},
-		{"gha_skip_commits", "", "-"},
-		{"gha_teams", "", "-"},
-		{"gha_teams_repositories", "", "-"},
-		{"gha_texts", "", "-"},
+	// Tables without primary key have a natural key
+	tableData := []mergeTable{
+		{"gha_actors", nil, "id", false, [2]string{"id > 0", "id <= 0"}},
+		{"gha_actors_affiliations", nil, "actor_id", false, [2]string{"", "-"}},
+		{"gha_actors_emails", nil, "actor_id", false, [2]string{"", "-"}},
+		{"gha_assets", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_branches", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_comments", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_commits", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_commits_files", nil, "dt", true, [2]string{"", "-"}},
+		{"gha_companies", nil, "", false, [2]string{"", "-"}},
+		//{"gha_computed", nil, "", false, [2]string{"", "-"}},
+		{"gha_events", nil, "id", false, [2]string{"id > 0", "id <= 0"}},
+		//{"gha_events_commits_files", nil, "", false, [2]string{"", "-"}},
+		{"gha_forkees", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_issues", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_issues_assignees", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_issues_events_labels", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_issues_labels", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_issues_pull_requests", []string{"issue_id", "pull_request_id"}, "issue_id", false, [2]string{"", "-"}},
+		{"gha_labels", nil, "id", false, [2]string{"id > 0", "id <= 0"}},
+		//{"gha_logs", nil, "", false, [2]string{"", "-"}},
+		{"gha_milestones", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_orgs", nil, "id", false, [2]string{"", "-"}},
+		{"gha_pages", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_parsed", nil, "dt", true, [2]string{"", "-"}},
+		{"gha_payloads", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		//{"gha_postprocess_scripts", nil, "", false, [2]string{"", "-"}},
+		{"gha_pull_requests", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_pull_requests_assignees", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_pull_requests_requested_reviewers", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_releases", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_releases_assets", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_repos", nil, "id", false, [2]string{"", "-"}},
+		{"gha_skip_commits", nil, "", false, [2]string{"", "-"}},
+		{"gha_teams", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_teams_repositories", nil, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+		{"gha_texts", []string{"event_id", "type", "md5(coalesce(body, ''))"}, "event_id", false, [2]string{"event_id > 0", "event_id <= 0"}},
+	}
+	for i := range tableData {
+		if tableData[i].key != nil {
+			lib.MergeKeyIndex(co, &ctx, tableData[i].name, tableData[i].key)
+		}
 	}
 
+	// Buckets fingerprints in source databases and buckets ranges to merge, per table and source
+	// Buckets are fingerprinted from the high-water mark (nil when all buckets are fingerprinted)
+	fingerprints := make([][]map[int64]lib.MergeBucket, len(tableData))
+	froms := make([][]*int64, len(tableData))
+	changed := make([][][][2]int64, len(tableData))
 	for pass, passInfo := range []string{"1st pass", "2nd pass"} {
-		for i, data := range tableData {
-			table := data[0]
-			cond := data[pass+1]
+		for i := range tableData {
+			table := &tableData[i]
+			cond := table.conds[pass]
 			if cond == "-" {
 				continue
 			}
-			allRows := 0
-			allErrs := 0
-			allIns := 0
+			last := pass == 1 || table.conds[1] == "-"
+			if pass == 0 {
+				fingerprints[i] = make([]map[int64]lib.MergeBucket, len(ci))
+				froms[i] = make([]*int64, len(ci))
+				changed[i] = make([][][2]int64, len(ci))
+			}
+			all := mergeStats{}
 			for dbi, c := range ci {
-				// First get row count
-				rc := 0
-				queryRoot := "from " + table
-				if cond != "" {
-					queryRoot += " where " + cond
+				// Incremental mode: only merge buckets that are new or changed since the last merge
+				if pass == 0 {
+					merged := lib.GetMergeBuckets(co, &ctx, iNames[dbi], table.name)
+					if mark, ok := lib.MergeHighWaterMark(merged); ok && !ctx.MergeFull {
+						froms[i][dbi] = &mark
+					}
+					fingerprints[i][dbi] = sourceBuckets(&ctx, c, table, froms[i][dbi])
+					changed[i][dbi] = lib.MergeChangedRanges(fingerprints[i][dbi], merged)
 				}
-				row := c.QueryRow("select count(*) " + queryRoot)
-				lib.FatalOnError(row.Scan(&rc))
-
-				// Now get all data
-				lib.Printf(
-					"%s: start table: #%d: %s, DB #%d: %s, rows: %d...\n",
-					passInfo, i, table, dbi, iNames[dbi], rc,
-				)
-				rows := lib.QuerySQLWithErr(
-					c,
-					&ctx,
-					"select * "+queryRoot,
-				)
-				//defer func() { lib.FatalOnError(rows.Close()) }()
-				// Now unknown rows, with unknown types
-				columns, err := rows.Columns()
-				lib.FatalOnError(err)
-
-				// Vals to hold any type as []interface{}
-				nColumns := len(columns)
-				vals := make([]interface{}, nColumns)
-				for i := range columns {
-					vals[i] = new(interface{})
+				ranges := changed[i][dbi]
+				if len(ranges) == 0 {
+					lib.Printf("%s: table: #%d: %s, DB #%d: %s, no new rows\n", passInfo, i, table.name, dbi, iNames[dbi])
+					continue
 				}
-
-				// Get results into `results` array of maps
-				rowCount := 0
-				errCount := 0
-				insCount := 0
-				// For ProgressInfo()
-				dtStart := time.Now()
-				lastTime := dtStart
-				for rows.Next() {
-					lib.FatalOnError(rows.Scan(vals...))
-					_, err := lib.ExecSQL(
-						co,
-						&ctx,
-						"insert into "+table+" "+lib.NValues(nColumns),
-						vals...,
-					)
-					if err != nil {
-						switch e := err.(type) {
-						case *pq.Error:
-							if e.Code.Name() != "unique_violation" {
-								lib.FatalOnError(err)
-							}
-						default:
-							lib.FatalOnError(err)
-						}
-						errCount++
-					} else {
-						insCount++
-					}
-					rowCount++
-					lib.ProgressInfo(
-						rowCount, rc, dtStart, &lastTime, time.Duration(10)*time.Second,
-						fmt.Sprintf("%s: table #%d %s, DB #%d %s", passInfo, i, table, dbi, iNames[dbi]),
-					)
+				tCond := cond
+				rCond := table.rangesCond(ranges)
+				if tCond == "" {
+					tCond = rCond
+				} else if rCond != "" {
+					tCond = tCond + " and (" + rCond + ")"
 				}
-				lib.FatalOnError(rows.Err())
-				lib.FatalOnError(rows.Close())
-				perc := 0.0
-				if rowCount > 0 {
-					perc = float64(errCount) * 100.0 / (float64(rowCount))
+				stats := mergeRows(&ctx, c, co, iNames[dbi], table, tCond, fmt.Sprintf("%s: #%d", passInfo, i))
+				if last {
+					lib.SetMergeBuckets(co, &ctx, iNames[dbi], table.name, fingerprints[i][dbi], froms[i][dbi])
 				}
 				lib.Printf(
-					"%s: done table: #%d: %s, DB #%d: %s, rows: %d, inserted: %d, collisions: %d (%.3f%%)\n",
-					passInfo, i, table, dbi, iNames[dbi], rowCount, insCount, errCount, perc,
+					"%s: done table: #%d: %s, DB #%d: %s, rows: %d, inserted: %d, existing: %d, conflicts: %d\n",
+					passInfo, i, table.name, dbi, iNames[dbi], stats.rows, stats.inserted, stats.same, stats.conflicts,
 				)
-				allRows += rowCount
-				allErrs += errCount
-				allIns += insCount
-			}
-			perc := 0.0
-			if allRows > 0 {
-				perc = float64(allErrs) * 100.0 / (float64(allRows))
+				all.rows += stats.rows
+				all.inserted += stats.inserted
+				all.same += stats.same
+				all.conflicts += stats.conflicts
 			}
 			lib.Printf(
-				"%s: done table: #%d: %s, all rows: %d, inserted: %d, collisions: %d (%.3f%%)\n",
-				passInfo, i, table, allRows, allIns, allErrs, perc,
+				"%s: done table: #%d: %s, all rows: %d, inserted: %d, existing: %d, conflicts: %d\n",
+				passInfo, i, table.name, all.rows, all.inserted, all.same, all.conflicts,
 			)
+			conflicts += all.conflicts
 		}
 	}
+	return
 }
 
 func main() {
 	dtStart := time.Now()
-	mergePDBs()
+	conflicts := mergePDBs()
 	dtEnd := time.Now()
 	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
-	fmt.Printf("Consider running './devel/remove_db_dups.sh' if you merged into existing database.\n")
+	if conflicts > 0 {
+		lib.Printf("Found %d conflicts (the same primary key, different content), see 'gha_merge_conflicts' table.\n", conflicts)
+	}
 }
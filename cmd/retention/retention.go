@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	lib "devstats"
+)
+
+// applyRetention enforces retention rules of all metrics from metrics.yaml
+func applyRetention(ctx *lib.Ctx, allMetrics *lib.AllMetrics) {
+	// Connect to Postgres DB
+	con := lib.PgConn(ctx)
+	defer func() { lib.FatalOnError(con.Close()) }()
+
+	// Validate all rules first, so a bad rule doesn't leave retention partially applied
+	nMetrics := 0
+	for i := range allMetrics.Metrics {
+		lib.FatalOnError(lib.ValidateRetention(&allMetrics.Metrics[i]))
+		if len(allMetrics.Metrics[i].Retention) > 0 {
+			nMetrics++
+		}
+	}
+	now := time.Now()
+	for i := range allMetrics.Metrics {
+		lib.FatalOnError(lib.ApplyRetention(con, ctx, &allMetrics.Metrics[i], now))
+	}
+	lib.Printf("Retention rules of %d metrics applied\n", nMetrics)
+}
+
+// report displays all series tables sizes with metrics writing them and their retention rules
+func report(ctx *lib.Ctx, allMetrics *lib.AllMetrics, format string) {
+	// Connect to Postgres DB
+	con := lib.PgConn(ctx)
+	defer func() { lib.FatalOnError(con.Close()) }()
+
+	out, err := lib.FormatRows(format, lib.SeriesTablesReport(lib.SeriesTablesSizes(con, ctx), allMetrics.Metrics))
+	lib.FatalOnError(err)
+	fmt.Print(out)
+}
+
+func main() {
+	dtStart := time.Now()
+	if len(os.Args) > 3 || (len(os.Args) > 1 && os.Args[1] != "report") {
+		lib.Printf("Usage: %s - apply metrics.yaml retention rules\n", os.Args[0])
+		lib.Printf("Usage: %s report [table|csv|tsv|json|md] - display series tables sizes and retention rules\n", os.Args[0])
+		os.Exit(1)
+	}
+
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Local or cron mode?
+	dataPrefix := lib.DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+
+	// Read metrics configuration
+	allMetrics, err := lib.LoadMetrics(&ctx, dataPrefix+ctx.MetricsYaml)
+	lib.FatalOnError(err)
+
+	if len(os.Args) > 1 {
+		format := lib.FormatTable
+		if len(os.Args) > 2 {
+			format = os.Args[2]
+		}
+		report(&ctx, allMetrics, format)
+		return
+	}
+	applyRetention(&ctx, allMetrics)
+	dtEnd := time.Now()
+	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+}
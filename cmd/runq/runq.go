@@ -1,227 +1,247 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/csv"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	lib "devstats"
 )
 
-func runq(sqlFile string, params []string) {
-	// Environment context parse
-	var ctx lib.Ctx
-	ctx.Init()
-
-	// SQL arguments number
-	if len(params)%2 > 0 {
-		lib.Printf("Must provide correct parameter value pairs: %+v\n", params)
-		os.Exit(1)
-	}
+// runqOptions - `--name=value` options given before SQL file name
+type runqOptions struct {
+	format     string // Output format: table (default), csv, tsv, json, md
+	params     string // YAML file with parameters, applied before command line parameters
+	compareDB  string // Run the same SQL on this database and show row differences
+	compareSQL string // Run this SQL file (with the same parameters) on the same database and show row differences
+	timing     bool   // Display query execution times
+	analyze    bool   // Display `explain (analyze, buffers)` summary
+}
 
+// renderSQL - reads SQL file and applies parameters to it
+func renderSQL(ctx *lib.Ctx, sqlFile string, params []string) string {
 	// SQL arguments parse
-	replaces := make(map[string]string)
-	paramName := ""
-	for index, param := range params {
-		if index%2 == 0 {
-			replaces[param] = ""
-			paramName = param
-		} else {
-			// Support special "readfile:replacement.dat" mode
-			if len(param) >= 10 && param[:9] == "readfile:" {
-				fn := param[9:]
-				if ctx.Debug > 0 {
-					lib.Printf("Reading file: %s\n", fn)
-				}
-				bytes, err := lib.ReadFile(&ctx, fn)
-				lib.FatalOnError(err)
-				param = string(bytes)
+	// `{{name}}` arguments are SQL template parameters, other arguments are raw string replacements
+	tmpl := lib.NewSQLTemplate(ctx)
+	replaces := [][]string{}
+	for index := 0; index < len(params); index += 2 {
+		from, to := params[index], params[index+1]
+		// Support special "readfile:replacement.dat" mode
+		if len(to) >= 10 && to[:9] == "readfile:" {
+			fn := to[9:]
+			if ctx.Debug > 0 {
+				lib.Printf("Reading file: %s\n", fn)
 			}
-			replaces[paramName] = param
-			paramName = ""
+			bytes, err := lib.ReadFile(ctx, fn)
+			lib.FatalOnError(err)
+			to = string(bytes)
 		}
-	}
-
-	// Read and eventually transform SQL file.
-	bytes, err := lib.ReadFile(&ctx, sqlFile)
-	lib.FatalOnError(err)
-	sqlQuery := string(bytes)
-	qrPeriod := ""
-	qrFrom := ""
-	qrTo := ""
-	qr := false
-	for from, to := range replaces {
-		// Special replace 'qr' 'period,from,to' is used for {{period.alias.name}} replacements
+		// Special replace 'qr' 'period,from,to' is used for {{period:alias.name}} replacements
 		if from == "qr" {
 			qrAry := strings.Split(to, ",")
-			qr = true
-			qrPeriod, qrFrom, qrTo = qrAry[0], qrAry[1], qrAry[2]
+			if len(qrAry) != 3 {
+				lib.Fatalf("'qr' parameter must be in 'period,from,to' format, got: '%s'", to)
+			}
+			tmpl = tmpl.WithQuickRange(qrAry[0], qrAry[1], qrAry[2])
 			continue
 		}
-		sqlQuery = strings.Replace(sqlQuery, from, to, -1)
-	}
-	if qr {
-		sqlQuery = lib.PrepareQuickRangeQuery(sqlQuery, qrPeriod, qrFrom, qrTo)
+		if name, ok := lib.IsSQLPlaceholder(from); ok {
+			tmpl.Params[name] = to
+			continue
+		}
+		replaces = append(replaces, []string{from, to})
 	}
+
+	// Read and eventually transform SQL file.
+	bytes, err := lib.ReadFile(ctx, sqlFile)
+	lib.FatalOnError(err)
+	sqlQuery, err := lib.ApplySQLReplaces(string(bytes), replaces)
+	lib.FatalOnError(err)
+	sqlQuery, err = tmpl.Render(sqlQuery)
+	lib.FatalOnError(err)
 	if ctx.Explain {
 		sqlQuery = strings.Replace(sqlQuery, "select\n", "explain select\n", -1)
 	}
+	return sqlQuery
+}
 
-	// Connect to Postgres DB
-	c := lib.PgConn(&ctx)
-	defer func() { lib.FatalOnError(c.Close()) }()
+// execute - runs SQL and returns its result, optionally displays timing and `explain (analyze, buffers)` summary
+// With analyze the query and its `explain analyze` are executed in a single read only transaction which is rolled back
+func execute(c *sql.DB, ctx *lib.Ctx, opts *runqOptions, name, sqlQuery string) lib.MetricRows {
+	if !opts.analyze {
+		dtStart := time.Now()
+		res := lib.QueryMetricRows(c, ctx, sqlQuery)
+		if opts.timing {
+			lib.Printf("%s: query time: %v, rows: %d\n", name, time.Now().Sub(dtStart), len(res.Rows))
+		}
+		return res
+	}
+	if lib.SQLModifiesData(sqlQuery) {
+		lib.Fatalf("%s: --analyze is only supported for read only queries, SQL modifies data", name)
+	}
+	tx, err := c.Begin()
+	lib.FatalOnError(err)
+	defer func() { lib.FatalOnError(tx.Rollback()) }()
+	lib.ExecSQLTxWithErr(tx, ctx, "set transaction read only")
+	dtStart := time.Now()
+	res, err := lib.ScanMetricRows(lib.QuerySQLTxWithErr(tx, ctx, sqlQuery))
+	lib.FatalOnError(err)
+	if opts.timing {
+		lib.Printf("%s: query time: %v, rows: %d\n", name, time.Now().Sub(dtStart), len(res.Rows))
+	}
+	plan := ""
+	lib.FatalOnError(
+		lib.QueryRowSQLTx(tx, ctx, "explain (analyze, buffers, format json) "+strings.TrimSpace(sqlQuery)).Scan(&plan),
+	)
+	summary, err := lib.ExplainSummary([]byte(plan))
+	lib.FatalOnError(err)
+	lib.Printf("%s: explain (analyze, buffers):\n%s", name, summary)
+	return res
+}
 
-	// Execute SQL
-	rows := lib.QuerySQLWithErr(c, &ctx, sqlQuery)
-	defer func() { lib.FatalOnError(rows.Close()) }()
+func runq(sqlFile string, params []string, opts *runqOptions) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
 
-	// Now unknown rows, with unknown types
-	columns, err := rows.Columns()
-	lib.FatalOnError(err)
-	// Make columns unique
-	for i := range columns {
-		columns[i] += strconv.Itoa(i)
-	}
-
-	// Vals to hold any type as []interface{}
-	vals := make([]interface{}, len(columns))
-	for i := range columns {
-		vals[i] = new([]byte)
-	}
-
-	// Get results into `results` array of maps
-	var results []map[string]string
-	rowCount := 0
-	for rows.Next() {
-		rowMap := make(map[string]string)
-		lib.FatalOnError(rows.Scan(vals...))
-		for index, val := range vals {
-			value := ""
-			if val != nil {
-				value = string(*val.(*[]byte))
-			}
-			rowMap[columns[index]] = value
-		}
-		results = append(results, rowMap)
-		rowCount++
+	// Parameters from YAML file go first, so command line parameters can override them
+	if opts.params != "" {
+		data, err := lib.ReadFile(&ctx, opts.params)
+		lib.FatalOnError(err)
+		fileParams, err := lib.LoadQueryParams(data)
+		lib.FatalOnError(err)
+		params = append(fileParams, params...)
 	}
-	lib.FatalOnError(rows.Err())
 
-	if len(results) < 1 {
-		lib.Printf("Metric returned no data\n")
-		return
+	// `explain analyze` is used instead of GHA2DB_EXPLAIN's `explain`
+	if opts.analyze && ctx.Explain {
+		lib.Printf("--analyze given, ignoring GHA2DB_EXPLAIN\n")
+		ctx.Explain = false
 	}
 
-	// Compute column Lengths
-	columnLengths := make(map[string]int)
-	indexLen := 1
-	for index, column := range columns {
-		if index == 10 {
-			indexLen++
+	// SQL arguments number
+	if len(params)%2 > 0 {
+		lib.Printf("Must provide correct parameter value pairs: %+v\n", params)
+		os.Exit(1)
+	}
+	sqlQuery := renderSQL(&ctx, sqlFile, params)
+
+	// Connect to Postgres DB
+	c := lib.PgConn(&ctx)
+	defer func() { lib.FatalOnError(c.Close()) }()
+
+	// Execute SQL
+	res := execute(c, &ctx, opts, ctx.PgDB, sqlQuery)
+
+	// Compare mode: the same SQL on another database or another SQL on the same database
+	if opts.compareDB != "" || opts.compareSQL != "" {
+		name := ctx.PgDB + ": " + opts.compareSQL
+		c2, sqlQuery2 := c, sqlQuery
+		if opts.compareSQL != "" {
+			sqlQuery2 = renderSQL(&ctx, opts.compareSQL, params)
 		}
-		maxLen := len(column) - indexLen
-		for _, row := range results {
-			valLen := len(row[column])
-			if valLen > maxLen {
-				maxLen = valLen
-			}
+		if opts.compareDB != "" {
+			name = opts.compareDB
+			c2 = lib.PgConnDB(&ctx, opts.compareDB)
+			defer func() { lib.FatalOnError(c2.Close()) }()
+		}
+		res2 := execute(c2, &ctx, opts, name, sqlQuery2)
+		diff := lib.DiffRows(res, res2)
+		lib.Printf("Rows: %d -> %d\n", len(res.Rows), len(res2.Rows))
+		if diff.Empty() {
+			lib.Printf("Results are identical\n")
+			return
 		}
-		columnLengths[column] = maxLen
+		lib.Printf("%s", diff.String())
+		lib.Printf("Results differ: %d rows removed, %d rows added\n", len(diff.Removed), len(diff.Added))
+		os.Exit(1)
 	}
 
-	var writer *csv.Writer
 	if ctx.CSVFile != "" {
 		// Write output CSV
 		oFile, err := os.Create(ctx.CSVFile)
 		lib.FatalOnError(err)
 		defer func() { _ = oFile.Close() }()
-		writer = csv.NewWriter(oFile)
-		defer writer.Flush()
-	}
-
-	// Upper frame of the header row
-	output := "/"
-	for _, column := range columns {
-		strFormat := fmt.Sprintf("%%-%ds", columnLengths[column])
-		value := strings.Repeat("-", columnLengths[column])
-		output += fmt.Sprintf(strFormat, value) + "+"
-	}
-	output = output[:len(output)-1] + "\\\n"
-	lib.Printf(output)
-
-	// Header row
-	output = "|"
-	indexLen = 1
-	hdr := []string{}
-	for index, column := range columns {
-		if index == 10 {
-			indexLen++
-		}
-		strFormat := fmt.Sprintf("%%-%ds", columnLengths[column])
-		output += fmt.Sprintf(strFormat, column[:len(column)-indexLen]) + "|"
-		hdr = append(hdr, column[:len(column)-indexLen])
-	}
-	output += "\n"
-	lib.Printf(output)
-	if writer != nil {
-		err = writer.Write(hdr)
-	}
-
-	// Frame between header row and data rows
-	output = "+"
-	for _, column := range columns {
-		strFormat := fmt.Sprintf("%%-%ds", columnLengths[column])
-		value := strings.Repeat("-", columnLengths[column])
-		output += fmt.Sprintf(strFormat, value) + "+"
-	}
-	output = output[:len(output)-1] + "+\n"
-	lib.Printf(output)
-
-	// Data rows loop
-	for _, row := range results {
-		// data row
-		output = "|"
-		vals := []string{}
-		for _, column := range columns {
-			value := row[column]
-			strFormat := fmt.Sprintf("%%-%ds", columnLengths[column])
-			output += fmt.Sprintf(strFormat, value) + "|"
-			vals = append(vals, value)
-		}
-		if writer != nil {
-			err = writer.Write(vals)
+		writer := csv.NewWriter(oFile)
+		lib.FatalOnError(writer.Write(res.Columns))
+		for _, row := range res.Rows {
+			vals := []string{}
+			for _, pValue := range row {
+				value := ""
+				if pValue != nil {
+					value = *pValue
+				}
+				vals = append(vals, value)
+			}
+			lib.FatalOnError(writer.Write(vals))
 		}
-		output = strings.Replace(output[:len(output)-1]+"|\n", "%", "%%", -1)
-		lib.Printf(output)
+		writer.Flush()
+		lib.FatalOnError(writer.Error())
 	}
 
-	// Frame below data rows
-	output = "\\"
-	for _, column := range columns {
-		strFormat := fmt.Sprintf("%%-%ds", columnLengths[column])
-		value := strings.Repeat("-", columnLengths[column])
-		output += fmt.Sprintf(strFormat, value) + "+"
+	if len(res.Rows) < 1 && (opts.format == "" || opts.format == lib.FormatTable) {
+		lib.Printf("Metric returned no data\n")
+		return
 	}
-	output = output[:len(output)-1] + "/\n"
-	lib.Printf(output)
-
-	lib.Printf("Rows: %v\n", rowCount)
-	if writer != nil {
+	output, err := lib.FormatRows(opts.format, res)
+	lib.FatalOnError(err)
+	if opts.format == "" || opts.format == lib.FormatTable {
+		lib.Printf("%s", output)
+		lib.Printf("Rows: %v\n", len(res.Rows))
+	} else {
+		// Machine readable formats are written as is: without log time prefixes and without logging to DB
+		fmt.Print(output)
+	}
+	if ctx.CSVFile != "" {
 		lib.Printf("%s written\n", ctx.CSVFile)
 	}
 }
 
+// parseOptions - parses `--name=value` options preceding SQL file name, returns remaining arguments
+func parseOptions(args []string) ([]string, *runqOptions) {
+	opts := &runqOptions{}
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		ary := strings.SplitN(args[0][2:], "=", 2)
+		value := ""
+		if len(ary) > 1 {
+			value = ary[1]
+		}
+		switch ary[0] {
+		case "format":
+			opts.format = value
+		case "params":
+			opts.params = value
+		case "compare":
+			opts.compareDB = value
+		case "compare-sql":
+			opts.compareSQL = value
+		case "timing":
+			opts.timing = true
+		case "analyze":
+			opts.analyze = true
+		default:
+			lib.Fatalf("unknown option: %s", args[0])
+		}
+		args = args[1:]
+	}
+	return args, opts
+}
+
 func main() {
 	dtStart := time.Now()
-	if len(os.Args) < 2 {
-		lib.Printf("Required SQL file name [param1 value1 [param2 value2 ...]]\n")
+	args, opts := parseOptions(os.Args[1:])
+	if len(args) < 1 {
+		lib.Printf("Required [--format=table|csv|tsv|json|md] [--params=params.yaml] [--compare=db|--compare-sql=file.sql] [--timing] [--analyze] ")
+		lib.Printf("SQL file name [param1 value1 [param2 value2 ...]]\n")
 		lib.Printf("Special replace 'qr' 'period,from,to' is used for {{period.alias.name}} replacements\n")
 		os.Exit(1)
 	}
-	runq(os.Args[1], os.Args[2:])
+	runq(args[0], args[1:], opts)
 	dtEnd := time.Now()
-	lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+	if opts.format == "" || opts.format == lib.FormatTable {
+		lib.Printf("Time: %v\n", dtEnd.Sub(dtStart))
+	}
 }
@@ -1,8 +1,8 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
-	"math"
 	"os"
 	"sort"
 	"strings"
@@ -14,12 +14,223 @@ import (
 	"github.com/google/go-github/github"
 )
 
+// Last artificial event ID generated, guarded by eventIDMutex
+var (
+	lastEventID  int64
+	eventIDMutex sync.Mutex
+)
+
+// issueConfig - returns issue config for a given issue with an artificial "sync" event
+// Event IDs are based on the current time and are unique within the process
+func issueConfig(orgRepo string, issue *github.Issue) lib.IssueConfig {
+	artificialUID := int64(-1)
+	artificialLogin := "devstats-sync"
+	artificialEvent := &github.IssueEvent{Actor: &github.User{ID: &artificialUID, Login: &artificialLogin}}
+	cfg := lib.IssueConfig{Repo: orgRepo}
+	if issue.Milestone != nil {
+		cfg.MilestoneID = issue.Milestone.ID
+	}
+	if issue.Assignee != nil {
+		cfg.AssigneeID = issue.Assignee.ID
+	}
+	cfg.EventType = "sync"
+	cfg.CreatedAt = time.Now()
+	cfg.GhIssue = issue
+	cfg.GhEvent = artificialEvent
+	cfg.Number = *issue.Number
+	cfg.IssueID = *issue.ID
+	eventIDMutex.Lock()
+	cfg.EventID = time.Now().UnixNano() / 31622
+	if cfg.EventID <= lastEventID {
+		cfg.EventID = lastEventID + 1
+	}
+	lastEventID = cfg.EventID
+	eventIDMutex.Unlock()
+	cfg.GhEvent.ID = &cfg.EventID
+	cfg.Pr = issue.IsPullRequest()
+	// Labels
+	cfg.LabelsMap = make(map[int64]string)
+	for _, label := range issue.Labels {
+		cfg.LabelsMap[*label.ID] = *label.Name
+	}
+	labelsAry := lib.Int64Ary{}
+	for label := range cfg.LabelsMap {
+		labelsAry = append(labelsAry, label)
+	}
+	sort.Sort(labelsAry)
+	l := len(labelsAry)
+	for i, label := range labelsAry {
+		if i == l-1 {
+			cfg.Labels += fmt.Sprintf("%d", label)
+		} else {
+			cfg.Labels += fmt.Sprintf("%d,", label)
+		}
+	}
+	// Assignees
+	cfg.AssigneesMap = make(map[int64]string)
+	for _, assignee := range issue.Assignees {
+		cfg.AssigneesMap[*assignee.ID] = *assignee.Login
+	}
+	assigneesAry := lib.Int64Ary{}
+	for assignee := range cfg.AssigneesMap {
+		assigneesAry = append(assigneesAry, assignee)
+	}
+	sort.Sort(assigneesAry)
+	l = len(assigneesAry)
+	for i, assignee := range assigneesAry {
+		if i == l-1 {
+			cfg.Assignees += fmt.Sprintf("%d", assignee)
+		} else {
+			cfg.Assignees += fmt.Sprintf("%d,", assignee)
+		}
+	}
+	return cfg
+}
+
+// graphQLIssues - gets issues and PRs using GitHub GraphQL API, up to lib.GHGraphQLMaxIssues per query
+// Adds them to issues and PRs maps, returns repos and numbers that should be fetched using REST API
+// (not found, PRs with issue ID not yet known in the database or queries that failed)
+func graphQLIssues(
+	ctx *lib.Ctx, pool *lib.GHPool, c *sql.DB, repos []string, numbers []int,
+	issues map[int64]lib.IssueConfigAry, prs map[int64]github.PullRequest,
+) (restRepos []string, restNumbers []int) {
+	// Group numbers by repo, then split into batches
+	repoNumbers := make(map[string][]int)
+	repoNames := []string{}
+	for idx, repo := range repos {
+		if _, ok := repoNumbers[repo]; !ok {
+			repoNames = append(repoNames, repo)
+		}
+		repoNumbers[repo] = append(repoNumbers[repo], numbers[idx])
+	}
+	type batch struct {
+		repo    string
+		numbers []int
+	}
+	batches := []batch{}
+	for _, repo := range repoNames {
+		nums := repoNumbers[repo]
+		for from := 0; from < len(nums); from += lib.GHGraphQLMaxIssues {
+			to := from + lib.GHGraphQLMaxIssues
+			if to > len(nums) {
+				to = len(nums)
+			}
+			batches = append(batches, batch{repo: repo, numbers: nums[from:to]})
+		}
+	}
+	nBatches := len(batches)
+	lib.Printf("sync_issues.go: Processing %d issues in %d GraphQL queries - GHAPI part\n", len(numbers), nBatches)
+	ids := lib.GHGraphQLDBIDs(c, ctx)
+	thrN := lib.GetThreadsNum(ctx)
+	maxThreads := pool.MaxThreads()
+	if maxThreads > thrN {
+		maxThreads = thrN
+	}
+	var mtx = &sync.Mutex{}
+	ch := make(chan bool)
+	nThreads := 0
+	dtStart := time.Now()
+	lastTime := dtStart
+	checked := 0
+	for _, b := range batches {
+		go func(ch chan bool, b batch) {
+			var (
+				err             error
+				ghIssues        map[int]*github.Issue
+				ghPRs           map[int]*github.PullRequest
+				reviewDecisions map[int]string
+			)
+			gcfg := lib.IssueConfig{Repo: b.repo}
+			got := false
+			for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
+				gctx, gc, rem, waitPeriod := pool.Get()
+				if rem <= ctx.MinGHAPIPoints {
+					if waitPeriod.Seconds() <= float64(ctx.MaxGHAPIWaitSeconds) {
+						lib.Printf("API limit reached while getting issues data, waiting %v (%d)\n", waitPeriod, tr)
+						time.Sleep(time.Duration(1) * time.Second)
+						time.Sleep(waitPeriod)
+						continue
+					} else {
+						lib.Fatalf("API limit reached while getting issues data, aborting, don't want to wait %v", waitPeriod)
+						os.Exit(1)
+					}
+				}
+				if ctx.Debug > 1 {
+					lib.Printf("GraphQL call for %d issues from %s, remaining GHAPI points %d\n", len(b.numbers), b.repo, rem)
+				}
+				ghIssues, ghPRs, reviewDecisions, err = lib.GHGraphQLIssues(gctx, gc, b.repo, b.numbers, ids)
+				if _, ok := err.(*lib.GHGraphQLError); ok {
+					lib.Printf("Warning: %v, using REST API\n", err)
+					break
+				}
+				res := lib.HandlePossibleError(err, &gcfg, "GraphQL")
+				if res != "" {
+					if res == lib.Abuse {
+						wait := pool.Abuse(gc)
+						if ctx.Debug > 0 {
+							lib.Printf("GitHub API abuse detected (GraphQL), token backoff %v\n", wait)
+						}
+					}
+					// Not retryable errors: issues are fetched using REST API
+					if res == lib.NotFound || res == lib.Unprocessable || res == lib.OtherError {
+						break
+					}
+					continue
+				}
+				got = true
+				break
+			}
+			mtx.Lock()
+			defer func() {
+				mtx.Unlock()
+				ch <- true
+			}()
+			for _, number := range b.numbers {
+				issue, ok := ghIssues[number]
+				if !got || !ok {
+					restRepos = append(restRepos, b.repo)
+					restNumbers = append(restNumbers, number)
+					continue
+				}
+				cfg := issueConfig(b.repo, issue)
+				cfg.ReviewDecision = reviewDecisions[number]
+				issues[cfg.IssueID] = append(issues[cfg.IssueID], cfg)
+				if ctx.Debug > 0 {
+					lib.Printf("Processing %v\n", cfg)
+				}
+				if pr, ok := ghPRs[number]; ok {
+					if _, found := prs[cfg.IssueID]; !found {
+						prs[cfg.IssueID] = *pr
+					}
+				}
+			}
+		}(ch, b)
+		nThreads++
+		for nThreads >= maxThreads {
+			<-ch
+			nThreads--
+			checked++
+			rem, wait := pool.RateLimits()
+			lib.ProgressInfo(checked, nBatches, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
+		}
+	}
+	for nThreads > 0 {
+		<-ch
+		nThreads--
+		checked++
+		rem, wait := pool.RateLimits()
+		lib.ProgressInfo(checked, nBatches, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
+	}
+	return
+}
+
 // Sync issues state given by query from GHA2DB_ISSUES_SYNC_SQL env
 // Possible dynamic replacements inside the query via
 // FROM1=var1 TO1=val1, FROM2=..., TO2=..., ...
 func syncIssues(ctx *lib.Ctx) {
 	// Connect to GitHub API
-	gctx, gc := lib.GHClient(ctx)
+	pool := lib.GHClientPool(ctx)
+	defer pool.Close()
 
 	// Connect to Postgres DB
 	c := lib.PgConn(ctx)
@@ -34,17 +245,25 @@ func syncIssues(ctx *lib.Ctx) {
 		lib.Fatalf("no sync issues sql query provided")
 	}
 
-	i := 1
-	for {
+	// `{{name}}` FROMn values are SQL template parameters, other values are raw string replacements
+	tmpl := lib.NewSQLTemplate(ctx)
+	replaces := [][]string{}
+	for i := 1; ; i++ {
 		from := os.Getenv(fmt.Sprintf("FROM%d", i))
+		if from == "" {
+			break
+		}
 		to := os.Getenv(fmt.Sprintf("TO%d", i))
-		if from != "" {
-			sql = strings.Replace(sql, from, to, -1)
-			i++
+		if name, ok := lib.IsSQLPlaceholder(from); ok {
+			tmpl.Params[name] = to
 		} else {
-			break
+			replaces = append(replaces, []string{from, to})
 		}
 	}
+	sql, err := lib.ApplySQLReplaces(sql, replaces)
+	lib.FatalOnError(err)
+	sql, err = tmpl.Render(sql)
+	lib.FatalOnError(err)
 
 	// Execute SQL
 	rows := lib.QuerySQLWithErr(c, ctx, sql)
@@ -69,6 +288,15 @@ func syncIssues(ctx *lib.Ctx) {
 		}
 	}
 	lib.FatalOnError(rows.Err())
+	issues := make(map[int64]lib.IssueConfigAry)
+	var issuesMutex = &sync.Mutex{}
+	prs := make(map[int64]github.PullRequest)
+	var prsMutex = &sync.Mutex{}
+
+	// Get issues in batches using GraphQL API, only remaining ones are fetched one by one using REST API
+	if ctx.GHAPIGraphQL {
+		repos, numbers = graphQLIssues(ctx, pool, c, repos, numbers, issues, prs)
+	}
 	nNumbers := len(numbers)
 	lib.Printf("sync_issues.go: Processing %d issues - GHAPI part\n", nNumbers)
 
@@ -78,8 +306,9 @@ func syncIssues(ctx *lib.Ctx) {
 	// 403 You have triggered an abuse detection mechanism. Please wait a few minutes before you try again
 	// So let's get all GitHub stuff one-after-another (ugly and slow) and then spawn threads to speedup
 	// Damn GitHub! - this could be working Number of CPU times faster! We're trying some hardcoded value: maxThreads
-	// Seems like GitHub is not detecting abuse when using 16 threads, but it detects when using 32.
-	maxThreads := 16
+	// Seems like GitHub is not detecting abuse when using 16 threads per token, but it detects when using 32.
+	// See GHA2DB_MAX_GHAPI_THREADS
+	maxThreads := pool.MaxThreads()
 	if maxThreads > thrN {
 		maxThreads = thrN
 	}
@@ -90,17 +319,10 @@ func syncIssues(ctx *lib.Ctx) {
 	dtStart := time.Now()
 	lastTime := dtStart
 	checked := 0
-	issues := make(map[int64]lib.IssueConfigAry)
-	var issuesMutex = &sync.Mutex{}
-	prs := make(map[int64]github.PullRequest)
-	var prsMutex = &sync.Mutex{}
 
 	// Process issues
 	for idx := range numbers {
 		go func(ch chan bool, orgRepo string, number int) {
-			artificialUID := int64(-1)
-			artificialLogin := "devstats-sync"
-			artificialEvent := &github.IssueEvent{Actor: &github.User{ID: &artificialUID, Login: &artificialLogin}}
 			ary := strings.Split(orgRepo, "/")
 			if len(ary) < 2 {
 				ch <- false
@@ -122,7 +344,7 @@ func syncIssues(ctx *lib.Ctx) {
 			)
 			got := false
 			for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
-				_, rem, waitPeriod := lib.GetRateLimits(gctx, gc, true)
+				gctx, gc, rem, waitPeriod := pool.Get()
 				if ctx.Debug > 1 {
 					lib.Printf("Get Issue Try: %d, rem: %v, waitPeriod: %v\n", tr, rem, waitPeriod)
 				}
@@ -144,10 +366,10 @@ func syncIssues(ctx *lib.Ctx) {
 				res := lib.HandlePossibleError(err, &gcfg, "Issues.Get")
 				if res != "" {
 					if res == lib.Abuse {
-						wait := time.Duration(int(math.Pow(2.0, float64(tr+3)))) * time.Second
+						wait := pool.Abuse(gc)
 						thrMutex.Lock()
 						if ctx.Debug > 0 {
-							lib.Printf("GitHub API abuse detected (issue), wait %v\n", wait)
+							lib.Printf("GitHub API abuse detected (issue), token backoff %v\n", wait)
 						}
 						if allowedThrN > 1 {
 							allowedThrN--
@@ -156,13 +378,15 @@ func syncIssues(ctx *lib.Ctx) {
 							}
 						}
 						thrMutex.Unlock()
-						time.Sleep(wait)
 					}
-					if res == lib.NotFound {
+					if res == lib.NotFound || res == lib.Unprocessable {
 						lib.Printf("Warning: not found: %s/%s %d", org, repo, number)
 						ch <- false
 						return
 					}
+					if res == lib.OtherError {
+						lib.FatalOnError(err)
+					}
 					continue
 				} else {
 					thrMutex.Lock()
@@ -181,58 +405,7 @@ func syncIssues(ctx *lib.Ctx) {
 				lib.Fatalf("GetRateLimit call failed %d times while getting issue, aborting", ctx.MaxGHAPIRetry)
 				os.Exit(2)
 			}
-			cfg := lib.IssueConfig{Repo: orgRepo}
-			if issue.Milestone != nil {
-				cfg.MilestoneID = issue.Milestone.ID
-			}
-			if issue.Assignee != nil {
-				cfg.AssigneeID = issue.Assignee.ID
-			}
-			cfg.EventType = "sync"
-			cfg.CreatedAt = time.Now()
-			cfg.GhIssue = issue
-			cfg.GhEvent = artificialEvent
-			cfg.Number = *issue.Number
-			cfg.IssueID = *issue.ID
-			cfg.EventID = time.Now().UnixNano() / 31622
-			cfg.GhEvent.ID = &cfg.EventID
-			cfg.Pr = issue.IsPullRequest()
-			// Labels
-			cfg.LabelsMap = make(map[int64]string)
-			for _, label := range issue.Labels {
-				cfg.LabelsMap[*label.ID] = *label.Name
-			}
-			labelsAry := lib.Int64Ary{}
-			for label := range cfg.LabelsMap {
-				labelsAry = append(labelsAry, label)
-			}
-			sort.Sort(labelsAry)
-			l := len(labelsAry)
-			for i, label := range labelsAry {
-				if i == l-1 {
-					cfg.Labels += fmt.Sprintf("%d", label)
-				} else {
-					cfg.Labels += fmt.Sprintf("%d,", label)
-				}
-			}
-			// Assignees
-			cfg.AssigneesMap = make(map[int64]string)
-			for _, assignee := range issue.Assignees {
-				cfg.AssigneesMap[*assignee.ID] = *assignee.Login
-			}
-			assigneesAry := lib.Int64Ary{}
-			for assignee := range cfg.AssigneesMap {
-				assigneesAry = append(assigneesAry, assignee)
-			}
-			sort.Sort(assigneesAry)
-			l = len(assigneesAry)
-			for i, assignee := range assigneesAry {
-				if i == l-1 {
-					cfg.Assignees += fmt.Sprintf("%d", assignee)
-				} else {
-					cfg.Assignees += fmt.Sprintf("%d,", assignee)
-				}
-			}
+			cfg := issueConfig(orgRepo, issue)
 			issuesMutex.Lock()
 			_, ok := issues[cfg.IssueID]
 			if ok {
@@ -256,7 +429,7 @@ func syncIssues(ctx *lib.Ctx) {
 					prNum := *issue.Number
 					got = false
 					for tr := 0; tr < ctx.MaxGHAPIRetry; tr++ {
-						_, rem, waitPeriod := lib.GetRateLimits(gctx, gc, true)
+						gctx, gc, rem, waitPeriod := pool.Get()
 						if ctx.Debug > 1 {
 							lib.Printf("Get PR Try: %d, rem: %v, waitPeriod: %v\n", tr, rem, waitPeriod)
 						}
@@ -278,10 +451,10 @@ func syncIssues(ctx *lib.Ctx) {
 						res := lib.HandlePossibleError(err, &gcfg, "PullRequests.Get")
 						if res != "" {
 							if res == lib.Abuse {
-								wait := time.Duration(int(math.Pow(2.0, float64(tr+3)))) * time.Second
+								wait := pool.Abuse(gc)
 								thrMutex.Lock()
 								if ctx.Debug > 0 {
-									lib.Printf("GitHub API abuse detected (get PR), wait %v\n", wait)
+									lib.Printf("GitHub API abuse detected (get PR), token backoff %v\n", wait)
 								}
 								if allowedThrN > 1 {
 									allowedThrN--
@@ -290,7 +463,15 @@ func syncIssues(ctx *lib.Ctx) {
 									}
 								}
 								thrMutex.Unlock()
-								time.Sleep(wait)
+							}
+							// PR is gone, skip it
+							if res == lib.NotFound || res == lib.Unprocessable {
+								pr = nil
+								got = true
+								break
+							}
+							if res == lib.OtherError {
+								lib.FatalOnError(err)
 							}
 							continue
 						} else {
@@ -327,7 +508,7 @@ func syncIssues(ctx *lib.Ctx) {
 			nThreads--
 			checked++
 			// Get RateLimits info
-			_, rem, wait := lib.GetRateLimits(gctx, gc, true)
+			rem, wait := pool.RateLimits()
 			lib.ProgressInfo(checked, nNumbers, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
 		}
 	}
@@ -340,13 +521,14 @@ func syncIssues(ctx *lib.Ctx) {
 		nThreads--
 		checked++
 		// Get RateLimits info
-		_, rem, wait := lib.GetRateLimits(gctx, gc, true)
+		rem, wait := pool.RateLimits()
 		lib.ProgressInfo(checked, nNumbers, dtStart, &lastTime, time.Duration(10)*time.Second, fmt.Sprintf("API points: %d, resets in: %v", rem, wait))
 	}
 
 	// Do final corrections
 	// manual sync: true
-	lib.SyncIssuesState(gctx, gc, ctx, c, issues, prs, true)
+	lib.SyncIssuesState(pool, ctx, c, issues, prs, true)
+	lib.Printf("%s\n", pool.CacheSummary())
 }
 
 func main() {
@@ -65,3 +65,12 @@ const Abuse string = "abuse"
 
 // NotFound - common constant string
 const NotFound string = "not_found"
+
+// Unprocessable - common constant string
+const Unprocessable string = "unprocessable"
+
+// ServerError - common constant string
+const ServerError string = "server_error"
+
+// OtherError - common constant string
+const OtherError string = "other_error"
@@ -37,8 +37,10 @@ type Ctx struct {
 	SkipPDB             bool            // From GHA2DB_SKIPPDB gha2db_sync tool, skip Postgres DB processing? default false
 	ResetTSDB           bool            // From GHA2DB_RESETTSDB sync tool, regenerate all TS points? default false
 	ResetRanges         bool            // From GHA2DB_RESETRANGES sync tool, regenerate all past quick ranges? default false
+	Shadow              bool            // From GHA2DB_SHADOW calc_metric tool, write recomputed series into a shadow schema and swap them into live tables in a single transaction when done, default false (tags and quick ranges are always swapped from a shadow schema)
 	Explain             bool            // From GHA2DB_EXPLAIN runq tool, prefix query with "explain " - it will display query plan instead of executing real query, default false
 	OldFormat           bool            // From GHA2DB_OLDFMT gha2db tool, if set then use pre 2015 GHA JSONs format
+	RawEvents           bool            // From GHA2DB_RAW_EVENTS gha2db tool, if set then also store full events JSONs in `gha_raw_events` table, so they can be re-parsed later
 	Exact               bool            // From GHA2DB_EXACT gha2db tool, if set then orgs list provided from commandline is used as a list of exact repository full names, like "a/b,c/d,e", if not only full names "a/b,x/y" can be treated like this, names without "/" are either orgs or repos.
 	LogToDB             bool            // From GHA2DB_SKIPLOG all tools, if set, DB logging into Postgres table `gha_logs` in `devstats` database will be disabled
 	Local               bool            // From GHA2DB_LOCAL gha2db_sync tool, if set, gha2_db will call other tools prefixed with "./" to use local compile ones. Otherwise it will call binaries without prefix (so it will use thos ein /usr/bin/).
@@ -46,6 +48,7 @@ type Ctx struct {
 	TagsYaml            string          // From GHA2DB_TAGS_YAML tags tool, set other tags.yaml file, default is "metrics/{{project}}/tags.yaml"
 	ColumnsYaml         string          // From GHA2DB_COLUMNS_YAML tags tool, set other columns.yaml file, default is "metrics/{{project}}/columns.yaml"
 	VarsYaml            string          // From GHA2DB_VARS_YAML db_vars tool, set other vars.yaml file, default is "metrics/{{project}}/vars.yaml"
+	AnnotationsYaml     string          // From GHA2DB_ANNOTATIONS_YAML annotations tool, set other annotations.yaml file (optional), default is "metrics/{{project}}/annotations.yaml"
 	GitHubOAuth         string          // From GHA2DB_GITHUB_OAUTH ghapi2db tool, if not set reads from /etc/github/oauth file, set to "-" to force public access.
 	ClearDBPeriod       string          // From GHA2DB_MAXLOGAGE gha2db_sync tool, maximum age of devstats.gha_logs entries, default "1 week"
 	Trials              []int           // From GHA2DB_TRIALS, all Postgres related tools, retry periods for "too many connections open" error
@@ -67,13 +70,18 @@ type Ctx struct {
 	ReposDir            string          // From GHA2DB_REPOS_DIR get_repos tool, default "~/devstats_repos/"
 	ProcessRepos        bool            // From GHA2DB_PROCESS_REPOS get_repos tool, enable processing (cloning/pulling) all devstats repos, default false
 	ProcessCommits      bool            // From GHA2DB_PROCESS_COMMITS get_repos tool, enable update/create mapping table: commit - list of file that commit refers to, default false
+	ProcessOwners       bool            // From GHA2DB_PROCESS_OWNERS get_repos tool, enable importing OWNERS, OWNERS_ALIASES and CODEOWNERS files data at HEAD and at annotation tags, default false
+	ProcessLOC          bool            // From GHA2DB_PROCESS_LOC get_repos tool, enable computing lines of code per language at HEAD and at annotation tags, default false
+	ImportGitCommits    bool            // From GHA2DB_IMPORT_GIT_COMMITS get_repos tool, enable importing commits from cloned repositories history (not only from GitHub archives), default false
+	BackfillCommits     bool            // From GHA2DB_BACKFILL_COMMITS get_repos tool, one-off: set languages and lines stats of commits files saved before they were stored, default false
 	ExternalInfo        bool            // From GHA2DB_EXTERNAL_INFO get_repos tool, enable outputing data needed by external tools (cncf/gitdm), default false
 	ProjectsCommits     string          // From GHA2DB_PROJECTS_COMMITS get_repos tool, set list of projects for commits analysis instead of analysing all, default "" - means all
 	ProjectsYaml        string          // From GHA2DB_PROJECTS_YAML, many tools - set main projects file, default "projects.yaml"
 	ProjectsOverride    map[string]bool // From GHA2DB_PROJECTS_OVERRIDE, get_repos and ./devstats tools - for example "-pro1,+pro2" means never sync pro1 and always sync pro2 (even if disabled in `projects.yaml`).
 	ExcludeRepos        map[string]bool // From GHA2DB_EXCLUDE_REPOS, gha2db tool, default "" - comma separated list of repos to exclude, example: "theupdateframework/notary,theupdateframework/other"
-	InputDBs            []string        // From GHA2DB_INPUT_DBS, merge_dbs tool - list of input databases to merge, order matters - first one will insert on a clean DB, next will do insert ignore (to avoid constraints failure due to common data)
+	InputDBs            []string        // From GHA2DB_INPUT_DBS, merge_dbs tool - list of input databases to merge, order matters - rows from earlier databases win when the same primary key has different content (such conflicts are reported)
 	OutputDB            string          // From GHA2DB_OUTPUT_DB, merge_dbs tool - output database to merge into
+	MergeFull           bool            // From GHA2DB_MERGE_FULL, merge_dbs tool - fingerprint all source buckets (full verify), by default only buckets at or above the last merged bucket are fingerprinted
 	TmOffset            int             // From GHA2DB_TMOFFSET, gha2db_sync tool - uses time offset to decide when to calculate various metrics, default offset is 0 which means UTC, good offset for USA is -6, and for Poland is 1 or 2
 	DefaultHostname     string          // "devstats.cncf.io"
 	RecentRange         string          // From GHA2DB_RECENT_RANGE, ghapi2db tool, default '2 hours'. This is a recent period to check open issues/PR to fix their labels and milestones.
@@ -81,8 +89,16 @@ type Ctx struct {
 	MinGHAPIPoints      int             // From GHA2DB_MIN_GHAPI_POINTS, ghapi2db tool, minimum GitHub API points, before waiting for reset.
 	MaxGHAPIWaitSeconds int             // From GHA2DB_MAX_GHAPI_WAIT, ghapi2db tool, maximum wait time for GitHub API points reset (in seconds).
 	MaxGHAPIRetry       int             // From GHA2DB_MAX_GHAPI_RETRY, ghapi2db tool, maximum wait retries
+	MaxGHAPIThreads     int             // From GHA2DB_MAX_GHAPI_THREADS, ghapi2db and sync_issues tools, maximum number of threads per GitHub OAuth token, default 16
+	GHAPICacheDir       string          // From GHA2DB_GHAPI_CACHE_DIR, ghapi2db and sync_issues tools, directory to cache GitHub API responses for conditional requests, default "" - cache disabled ("-" also disables cache)
+	GHAPICacheMaxSize   int             // From GHA2DB_GHAPI_CACHE_MAX_MB, ghapi2db and sync_issues tools, maximum GitHub API cache size in MB, least recently used responses are evicted, default 256, 0 means unlimited
+	GHAPIGraphQL        bool            // From GHA2DB_GHAPI_GRAPHQL, sync_issues and ghapi2db tools, get issues and PRs using GitHub GraphQL API, up to 100 per query, default false
+	SkipGHAPIBudget     bool            // From GHA2DB_SKIP_GHAPI_BUDGET, ghapi2db and sync_issues tools, do not share GitHub API points budget with other processes via `devstats` database, default false
 	GHAPIErrorIsFatal   bool            // From GHA2DB_GHAPI_ERROR_FATAL, ghapi2db tool, make any GH API error fatal, default false
 	SkipGHAPI           bool            // From GHA2DB_GHAPISKIP, ghapi2db tool, if set then tool is not creating artificial events using GitHub API
+	GHAPIReviews        bool            // From GHA2DB_GHAPI_REVIEWS, ghapi2db tool, if set then tool also gets PR reviews, statuses and check runs of recently updated PRs
+	GHAPIReviewsFrom    time.Time       // From GHA2DB_GHAPI_REVIEWS_FROM, ghapi2db tool, back-fill PR reviews, statuses and check runs of PRs updated since this date (instead of GHA2DB_RECENT_RANGE)
+	GHAPIReviewsTo      time.Time       // From GHA2DB_GHAPI_REVIEWS_TO, ghapi2db tool, back-fill PR reviews, statuses and check runs of PRs updated before this date, default now
 	SkipGetRepos        bool            // From GHA2DB_GETREPOSSKIP, get_repos tool, if set then tool does nothing
 	CSVFile             string          // From GHA2DB_CSVOUT, runq tool, if set, saves result in this file
 	ComputeAll          bool            // From GHA2DB_COMPUTE_ALL, all tools, if set then no period decisions are taken based on time, but all possible periods are recalculated
@@ -94,6 +110,10 @@ type Ctx struct {
 	JSONsDir            string          // From GHA2DB_JSONS_DIR, website_data tool, default "./jsons/"
 	WebsiteData         bool            // From GHA2DB_WEBSITEDATA, devstats tool, run website_data just after sync is complete, default false.
 	SkipUpdateEvents    bool            // FROM GHA2DB_SKIP_UPDATE_EVENTS, ghapi2db tool, drop and recreate artificial events if their state differs, default false
+	GrafanaURL          string          // From GHA2DB_GRAFANA_URL, grafana_sync tool, Grafana HTTP API URL, can contain basic auth user info, default "http://127.0.0.1:3000"
+	GrafanaKey          string          // From GHA2DB_GRAFANA_KEY, grafana_sync tool, Grafana API key (admin role), default "" - use basic auth from GHA2DB_GRAFANA_URL
+	GrafanaFolder       string          // From GHA2DB_GRAFANA_FOLDER, grafana_sync tool, put dashboards in this folder, default "" - General folder
+	GrafanaDryRun       bool            // From GHA2DB_GRAFANA_DRY_RUN, grafana_sync tool, only display changes (with differing dashboards JSON paths), don't write anything, default false
 }
 
 // Init - get context from environment variables
@@ -131,6 +151,28 @@ func (ctx *Ctx) Init() {
 			ctx.MaxGHAPIRetry = tr
 		}
 	}
+	ctx.MaxGHAPIThreads = 16
+	if os.Getenv("GHA2DB_MAX_GHAPI_THREADS") != "" {
+		thr, err := strconv.Atoi(os.Getenv("GHA2DB_MAX_GHAPI_THREADS"))
+		FatalNoLog(err)
+		if thr >= 1 {
+			ctx.MaxGHAPIThreads = thr
+		}
+	}
+	ctx.SkipGHAPIBudget = os.Getenv("GHA2DB_SKIP_GHAPI_BUDGET") != ""
+	ctx.GHAPIGraphQL = os.Getenv("GHA2DB_GHAPI_GRAPHQL") != ""
+	ctx.GHAPICacheDir = os.Getenv("GHA2DB_GHAPI_CACHE_DIR")
+	if ctx.GHAPICacheDir == "-" {
+		ctx.GHAPICacheDir = ""
+	}
+	ctx.GHAPICacheMaxSize = 256 << 20
+	if os.Getenv("GHA2DB_GHAPI_CACHE_MAX_MB") != "" {
+		mb, err := strconv.Atoi(os.Getenv("GHA2DB_GHAPI_CACHE_MAX_MB"))
+		FatalNoLog(err)
+		if mb >= 0 {
+			ctx.GHAPICacheMaxSize = mb << 20
+		}
+	}
 
 	// Debug
 	if os.Getenv("GHA2DB_DEBUG") == "" {
@@ -229,6 +271,15 @@ func (ctx *Ctx) Init() {
 	ctx.SkipGHAPI = os.Getenv("GHA2DB_GHAPISKIP") != ""
 	ctx.GHAPIErrorIsFatal = os.Getenv("GHA2DB_GHAPI_ERROR_FATAL") != ""
 
+	// PR reviews, statuses and check runs (ghapi2db)
+	ctx.GHAPIReviews = os.Getenv("GHA2DB_GHAPI_REVIEWS") != ""
+	if os.Getenv("GHA2DB_GHAPI_REVIEWS_FROM") != "" {
+		ctx.GHAPIReviewsFrom = TimeParseAny(os.Getenv("GHA2DB_GHAPI_REVIEWS_FROM"))
+	}
+	if os.Getenv("GHA2DB_GHAPI_REVIEWS_TO") != "" {
+		ctx.GHAPIReviewsTo = TimeParseAny(os.Getenv("GHA2DB_GHAPI_REVIEWS_TO"))
+	}
+
 	// Last TS series
 	ctx.LastSeries = os.Getenv("GHA2DB_LASTSERIES")
 	if ctx.LastSeries == "" {
@@ -239,6 +290,7 @@ func (ctx *Ctx) Init() {
 	ctx.SkipTSDB = os.Getenv("GHA2DB_SKIPTSDB") != ""
 	ctx.ResetTSDB = os.Getenv("GHA2DB_RESETTSDB") != ""
 	ctx.ResetRanges = os.Getenv("GHA2DB_RESETRANGES") != ""
+	ctx.Shadow = os.Getenv("GHA2DB_SHADOW") != ""
 
 	// Allow broken JSON
 	ctx.AllowBrokenJSON = os.Getenv("GHA2DB_ALLOW_BROKEN_JSON") != ""
@@ -258,6 +310,9 @@ func (ctx *Ctx) Init() {
 	// Old (pre 2015) GHA JSONs format
 	ctx.OldFormat = os.Getenv("GHA2DB_OLDFMT") != ""
 
+	// Store full events JSONs
+	ctx.RawEvents = os.Getenv("GHA2DB_RAW_EVENTS") != ""
+
 	// Exact repository full names to match
 	ctx.Exact = os.Getenv("GHA2DB_EXACT") != ""
 
@@ -279,6 +334,7 @@ func (ctx *Ctx) Init() {
 	ctx.TagsYaml = os.Getenv("GHA2DB_TAGS_YAML")
 	ctx.ColumnsYaml = os.Getenv("GHA2DB_COLUMNS_YAML")
 	ctx.VarsYaml = os.Getenv("GHA2DB_VARS_YAML")
+	ctx.AnnotationsYaml = os.Getenv("GHA2DB_ANNOTATIONS_YAML")
 	if ctx.MetricsYaml == "" {
 		ctx.MetricsYaml = "metrics/" + proj + "metrics.yaml"
 	}
@@ -291,6 +347,9 @@ func (ctx *Ctx) Init() {
 	if ctx.VarsYaml == "" {
 		ctx.VarsYaml = "metrics/" + proj + "vars.yaml"
 	}
+	if ctx.AnnotationsYaml == "" {
+		ctx.AnnotationsYaml = "metrics/" + proj + "annotations.yaml"
+	}
 
 	// GitHub OAuth
 	ctx.GitHubOAuth = os.Getenv("GHA2DB_GITHUB_OAUTH")
@@ -435,9 +494,13 @@ func (ctx *Ctx) Init() {
 	if ctx.ReposDir[len(ctx.ReposDir)-1:] != "/" {
 		ctx.ReposDir += "/"
 	}
-	// `get_repos`: process repos, process commits, external info
+	// `get_repos`: process repos, process commits, process owners, external info
 	ctx.ProcessRepos = os.Getenv("GHA2DB_PROCESS_REPOS") != ""
 	ctx.ProcessCommits = os.Getenv("GHA2DB_PROCESS_COMMITS") != ""
+	ctx.ProcessOwners = os.Getenv("GHA2DB_PROCESS_OWNERS") != ""
+	ctx.ProcessLOC = os.Getenv("GHA2DB_PROCESS_LOC") != ""
+	ctx.ImportGitCommits = os.Getenv("GHA2DB_IMPORT_GIT_COMMITS") != ""
+	ctx.BackfillCommits = os.Getenv("GHA2DB_BACKFILL_COMMITS") != ""
 	ctx.ExternalInfo = os.Getenv("GHA2DB_EXTERNAL_INFO") != ""
 	ctx.ProjectsCommits = os.Getenv("GHA2DB_PROJECTS_COMMITS")
 
@@ -450,6 +513,15 @@ func (ctx *Ctx) Init() {
 		ctx.JSONsDir += "/"
 	}
 
+	// Grafana HTTP API
+	ctx.GrafanaURL = os.Getenv("GHA2DB_GRAFANA_URL")
+	if ctx.GrafanaURL == "" {
+		ctx.GrafanaURL = "http://127.0.0.1:3000"
+	}
+	ctx.GrafanaKey = os.Getenv("GHA2DB_GRAFANA_KEY")
+	ctx.GrafanaFolder = os.Getenv("GHA2DB_GRAFANA_FOLDER")
+	ctx.GrafanaDryRun = os.Getenv("GHA2DB_GRAFANA_DRY_RUN") != ""
+
 	// Calculate all periods?
 	ctx.ComputeAll = os.Getenv("GHA2DB_COMPUTE_ALL") != ""
 
@@ -472,6 +544,7 @@ func (ctx *Ctx) Init() {
 		ctx.InputDBs = strings.Split(dbs, ",")
 	}
 	ctx.OutputDB = os.Getenv("GHA2DB_OUTPUT_DB")
+	ctx.MergeFull = os.Getenv("GHA2DB_MERGE_FULL") != ""
 
 	// RecentRange - ghapi2db will check issues/PRs from now() - this range to now()
 	ctx.RecentRange = os.Getenv("GHA2DB_RECENT_RANGE")
@@ -0,0 +1,657 @@
+package devstats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DashboardQuery - SQL query found in Grafana dashboard JSON
+// Kind is one of: target (panel's `rawSql`), variable (templating `query`), annotation (`rawQuery`)
+type DashboardQuery struct {
+	Path string
+	Kind string
+	SQL  string
+}
+
+// DashboardIssue - problem found by dashboards linter
+type DashboardIssue struct {
+	File    string
+	Path    string
+	Message string
+}
+
+// String - one line issue description
+func (i DashboardIssue) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%s: %s", i.File, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.File, i.Path, i.Message)
+}
+
+// TSSchema - time series tables and their columns produced by metrics.yaml, tags.yaml, columns.yaml and annotations
+// Tables maps table name to its columns, nil means that columns are only known at runtime
+// Prefixes contains tables names prefixes for series named by metrics SQLs results
+type TSSchema struct {
+	Tables   map[string]map[string]struct{}
+	Prefixes []string
+	Columns  []Column
+}
+
+// Series tables names generated from SQL results, see calc_metric
+var dashboardSeriesFuncs = map[string]struct{}{
+	"single_row_multi_column": {},
+	"multi_row_single_column": {},
+	"multi_row_multi_column":  {},
+}
+
+// Grafana built-in variables (SQL macros start with `__`)
+var dashboardBuiltinVars = map[string]struct{}{"timeFilter": {}, "interval": {}, "interval_ms": {}, "timeFrom": {}, "timeTo": {}}
+
+var (
+	dashboardTableRe   = regexp.MustCompile(`(?i)\b(?:from|join)\s+"?([a-z0-9_.\[\]\$\{\}:]+)"?(\s*\()?`)
+	dashboardCTERe     = regexp.MustCompile(`(?i)\b([a-z_][a-z0-9_]*)\s+as\s*\(`)
+	dashboardVarRe     = regexp.MustCompile(`\[\[([A-Za-z0-9_]+)(?::[a-z]+)?\]\]|\$\{([A-Za-z0-9_]+)(?::[a-z]+)?\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+	dashboardStringRe  = regexp.MustCompile(`'(?:[^']|'')*'`)
+	dashboardIdentRe   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	dashboardLiteralRe = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	dashboardTagColRe  = regexp.MustCompile(`_(name|value|suffix|data)(_with_all)?$`)
+)
+
+// NewTSSchema - returns schema with tables that are always present: annotations and quick ranges
+// lastSeries is the series used to detect last computed TS data (GHA2DB_LASTSERIES, "events_h" by default)
+func NewTSSchema(lastSeries string) *TSSchema {
+	return &TSSchema{
+		Tables: map[string]map[string]struct{}{
+			"sannotations":   {"time": {}, "title": {}, "description": {}, "period": {}},
+			"tquick_ranges":  {"time": {}, "quick_ranges_suffix": {}, "quick_ranges_name": {}, "quick_ranges_data": {}},
+			"s" + lastSeries: nil,
+		},
+	}
+}
+
+// AddMetrics - adds series tables of metrics, sqls maps metric SQL file name (without .sql) to its contents
+// Metrics whose series are named by SQL results get table name prefixes from SQL string literals
+func (s *TSSchema) AddMetrics(metrics *AllMetrics, sqls map[string]string) {
+	for _, metric := range metrics.Metrics {
+		if metric.MergeSeries != "" {
+			s.Tables["s"+metric.MergeSeries] = nil
+			continue
+		}
+		if _, ok := dashboardSeriesFuncs[metric.SeriesNameOrFunc]; !ok {
+			if metric.AddPeriodToName {
+				s.Prefixes = append(s.Prefixes, "s"+metric.SeriesNameOrFunc+"_")
+			} else {
+				s.Tables["s"+metric.SeriesNameOrFunc] = nil
+			}
+			continue
+		}
+		for _, literal := range dashboardStringRe.FindAllString(sqls[metric.MetricSQL], -1) {
+			for _, name := range strings.FieldsFunc(strings.Trim(literal, "'"), func(r rune) bool { return r == ',' || r == ';' }) {
+				if dashboardLiteralRe.MatchString(name) {
+					s.Prefixes = append(s.Prefixes, "s"+name)
+				}
+			}
+		}
+	}
+	sort.Strings(s.Prefixes)
+}
+
+// AddTags - adds tags tables with their name, value and other columns
+func (s *TSSchema) AddTags(tags *Tags) {
+	for _, tag := range tags.Tags {
+		cols := map[string]struct{}{"time": {}, tag.NameTag: {}, tag.ValueTag: {}}
+		for col := range tag.OtherTags {
+			cols[col] = struct{}{}
+		}
+		s.Tables["t"+tag.SeriesName] = cols
+	}
+}
+
+// AddColumns - adds columns.yaml configuration, columns are named by tags values, so they're only known at runtime
+func (s *TSSchema) AddColumns(columns *AllColumns) {
+	s.Columns = append(s.Columns, columns.Columns...)
+}
+
+// Table - checks if time series table (or table name pattern with dashboard variables) can be produced
+// Returns table columns (nil if unknown) and true if table is known
+func (s *TSSchema) Table(name string) (map[string]struct{}, bool) {
+	if cols, ok := s.Tables[name]; ok {
+		return cols, true
+	}
+	// Table name with dashboard variables: `s[[period]]`, `spr_auth[[repogroup]]`
+	literal := name
+	vars := false
+	if loc := dashboardVarRe.FindStringIndex(name); loc != nil {
+		literal = name[:loc[0]]
+		vars = true
+	}
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(literal, prefix) || (vars && strings.HasPrefix(prefix, literal)) {
+			return nil, true
+		}
+	}
+	if vars {
+		for table := range s.Tables {
+			if strings.HasPrefix(table, literal) {
+				return nil, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// CheckColumns - returns columns.yaml problems: unknown tag tables or columns and tables regexps matching nothing
+func (s *TSSchema) CheckColumns(file string) []DashboardIssue {
+	issues := []DashboardIssue{}
+	for i, col := range s.Columns {
+		path := fmt.Sprintf("columns[%d]", i)
+		cols, ok := s.Tables[col.Tag]
+		if !ok {
+			issues = append(issues, DashboardIssue{File: file, Path: path, Message: fmt.Sprintf("tag table '%s' is not produced by tags.yaml", col.Tag)})
+		} else if _, ok := cols[col.Column]; cols != nil && !ok {
+			issues = append(issues, DashboardIssue{File: file, Path: path, Message: fmt.Sprintf("tag table '%s' has no column '%s'", col.Tag, col.Column)})
+		}
+		re, err := regexp.Compile(col.TableRegexp)
+		if err != nil {
+			issues = append(issues, DashboardIssue{File: file, Path: path, Message: fmt.Sprintf("invalid table regexp '%s': %v", col.TableRegexp, err)})
+			continue
+		}
+		hit := false
+		for table, cols := range s.Tables {
+			if cols == nil && re.MatchString(table) {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			for _, prefix := range s.Prefixes {
+				if re.MatchString(prefix) || strings.HasPrefix(col.TableRegexp, "^"+prefix) {
+					hit = true
+					break
+				}
+			}
+		}
+		if !hit {
+			issues = append(issues, DashboardIssue{File: file, Path: path, Message: fmt.Sprintf("table regexp '%s' matches no series produced by metrics.yaml", col.TableRegexp)})
+		}
+	}
+	return issues
+}
+
+// DashboardQueries - returns all SQL queries from dashboard: panels targets (also nested in rows), templating variables and annotations
+func DashboardQueries(dash map[string]interface{}) []DashboardQuery {
+	queries := []DashboardQuery{}
+	var panels func(path string, list interface{})
+	panels = func(path string, list interface{}) {
+		items, _ := list.([]interface{})
+		for i, item := range items {
+			panel, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			panelPath := fmt.Sprintf("%s[%d]", path, i)
+			if title, ok := panel["title"].(string); ok && title != "" {
+				panelPath += "(" + title + ")"
+			}
+			targets, _ := panel["targets"].([]interface{})
+			for j, t := range targets {
+				target, _ := t.(map[string]interface{})
+				if sql, ok := target["rawSql"].(string); ok && sql != "" {
+					queries = append(queries, DashboardQuery{Path: fmt.Sprintf("%s.targets[%d]", panelPath, j), Kind: "target", SQL: sql})
+				}
+			}
+			panels(panelPath+".panels", panel["panels"])
+		}
+	}
+	panels("panels", dash["panels"])
+	rows, _ := dash["rows"].([]interface{})
+	for i, r := range rows {
+		row, _ := r.(map[string]interface{})
+		panels(fmt.Sprintf("rows[%d].panels", i), row["panels"])
+	}
+	if templating, ok := dash["templating"].(map[string]interface{}); ok {
+		list, _ := templating["list"].([]interface{})
+		for i, v := range list {
+			variable, _ := v.(map[string]interface{})
+			query, ok := variable["query"].(string)
+			if variable["type"] == "query" && ok && query != "" {
+				queries = append(queries, DashboardQuery{Path: fmt.Sprintf("templating[%d](%v)", i, variable["name"]), Kind: "variable", SQL: query})
+			}
+		}
+	}
+	if annotations, ok := dash["annotations"].(map[string]interface{}); ok {
+		list, _ := annotations["list"].([]interface{})
+		for i, a := range list {
+			annotation, _ := a.(map[string]interface{})
+			if sql, ok := annotation["rawQuery"].(string); ok && sql != "" {
+				queries = append(queries, DashboardQuery{Path: fmt.Sprintf("annotations[%d](%v)", i, annotation["name"]), Kind: "annotation", SQL: sql})
+			}
+		}
+	}
+	return queries
+}
+
+// DashboardVariables - returns names of variables defined in dashboard's templating
+func DashboardVariables(dash map[string]interface{}) map[string]struct{} {
+	vars := make(map[string]struct{})
+	if templating, ok := dash["templating"].(map[string]interface{}); ok {
+		list, _ := templating["list"].([]interface{})
+		for _, v := range list {
+			variable, _ := v.(map[string]interface{})
+			if name, ok := variable["name"].(string); ok {
+				vars[name] = struct{}{}
+			}
+		}
+	}
+	return vars
+}
+
+// SQLVariables - returns dashboard variables used in SQL: [[var]], ${var} or $var (Grafana built-ins are skipped)
+func SQLVariables(sql string) []string {
+	vars := []string{}
+	seen := make(map[string]struct{})
+	for _, m := range dashboardVarRe.FindAllStringSubmatch(sql, -1) {
+		name := m[1] + m[2] + m[3]
+		if _, ok := dashboardBuiltinVars[name]; ok || strings.HasPrefix(name, "__") {
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			seen[name] = struct{}{}
+			vars = append(vars, name)
+		}
+	}
+	return vars
+}
+
+// SQLTimeSeriesTables - returns time series tables (starting with "s" or "t") used in SQL
+// Tables used as functions, CTEs and columns (like `extract(epoch from time)`) are skipped
+func SQLTimeSeriesTables(sql string) []string {
+	sql = dashboardStringRe.ReplaceAllString(sql, "''")
+	ctes := make(map[string]struct{})
+	for _, m := range dashboardCTERe.FindAllStringSubmatch(sql, -1) {
+		ctes[strings.ToLower(m[1])] = struct{}{}
+	}
+	tables := []string{}
+	seen := make(map[string]struct{})
+	for _, m := range dashboardTableRe.FindAllStringSubmatch(sql, -1) {
+		table := m[1]
+		if m[2] != "" {
+			continue
+		}
+		if i := strings.LastIndex(table, "."); i >= 0 {
+			table = table[i+1:]
+		}
+		lower := strings.ToLower(table)
+		if _, ok := ctes[lower]; ok {
+			continue
+		}
+		if lower == "time" || lower == "timestamp" || lower == "series" || lower == "sub" || lower == "" {
+			continue
+		}
+		if lower[0] != 's' && lower[0] != 't' {
+			continue
+		}
+		if _, ok := seen[table]; !ok {
+			seen[table] = struct{}{}
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+// sqlIdentifiers - returns identifiers used in SQL (string literals skipped)
+func sqlIdentifiers(sql string) map[string]struct{} {
+	sql = dashboardStringRe.ReplaceAllString(sql, "''")
+	idents := make(map[string]struct{})
+	for _, ident := range dashboardIdentRe.FindAllString(dashboardVarRe.ReplaceAllString(sql, ""), -1) {
+		idents[ident] = struct{}{}
+	}
+	return idents
+}
+
+// LintDashboard - checks dashboard JSON: variables used by queries must be defined,
+// time series tables must be produced by metrics/tags and tag columns must exist in tags tables
+func LintDashboard(file string, data []byte, schema *TSSchema) []DashboardIssue {
+	dash := make(map[string]interface{})
+	if err := json.Unmarshal(data, &dash); err != nil {
+		return []DashboardIssue{{File: file, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	issues := []DashboardIssue{}
+	if uid, _ := dash["uid"].(string); uid == "" {
+		issues = append(issues, DashboardIssue{File: file, Message: "missing dashboard uid"})
+	}
+	vars := DashboardVariables(dash)
+	tagColumns := make(map[string]struct{})
+	for _, cols := range schema.Tables {
+		for col := range cols {
+			tagColumns[col] = struct{}{}
+		}
+	}
+	for _, q := range DashboardQueries(dash) {
+		for _, v := range SQLVariables(q.SQL) {
+			if _, ok := vars[v]; !ok {
+				issues = append(issues, DashboardIssue{File: file, Path: q.Path, Message: fmt.Sprintf("undefined variable '%s'", v)})
+			}
+		}
+		known := make(map[string]struct{})
+		check := true
+		for _, table := range SQLTimeSeriesTables(q.SQL) {
+			cols, ok := schema.Table(table)
+			if !ok {
+				issues = append(issues, DashboardIssue{File: file, Path: q.Path, Message: fmt.Sprintf("table '%s' is not produced by metrics.yaml or tags.yaml", table)})
+				check = false
+				continue
+			}
+			if cols == nil {
+				check = false
+				continue
+			}
+			for col := range cols {
+				known[col] = struct{}{}
+			}
+		}
+		if !check || len(known) == 0 {
+			continue
+		}
+		for ident := range sqlIdentifiers(q.SQL) {
+			_, isTagColumn := tagColumns[ident]
+			if !isTagColumn && !dashboardTagColRe.MatchString(ident) {
+				continue
+			}
+			if _, ok := known[ident]; !ok {
+				issues = append(issues, DashboardIssue{File: file, Path: q.Path, Message: fmt.Sprintf("unknown tag column '%s'", ident)})
+			}
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Path < issues[j].Path })
+	return issues
+}
+
+// DashboardTemplateReplaces - returns placeholders used in shared dashboard templates and their values for a project
+// Placeholders are used inside JSON strings, so values are JSON escaped (without HTML escaping)
+func DashboardTemplateReplaces(name string, proj *Project) [][]string {
+	fullName := proj.FullName
+	if fullName == "" {
+		fullName = name
+	}
+	return [][]string{
+		{"{{project}}", dashboardJSONString(name)},
+		{"{{full_name}}", dashboardJSONString(fullName)},
+		{"{{main_repo}}", dashboardJSONString(proj.MainRepo)},
+		{"{{psql_db}}", dashboardJSONString(proj.PDB)},
+	}
+}
+
+// SharedDashboard - returns true when project's dashboard JSON file is generated from a shared template (it is not customized)
+func SharedDashboard(proj *Project, file string) bool {
+	for _, custom := range proj.CustomDashboards {
+		if custom == file {
+			return false
+		}
+	}
+	return true
+}
+
+// dashboardJSON - encodes value as JSON without HTML escaping (dashboards contain HTML and SQL with `<`, `>` and `&`)
+func dashboardJSON(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// dashboardJSONString - returns string escaped for use inside JSON string (without quotes)
+func dashboardJSONString(str string) string {
+	data, err := dashboardJSON(str)
+	FatalOnError(err)
+	return string(data[1 : len(data)-1])
+}
+
+// Per project dashboard state kept from the current dashboard when it is regenerated from a template:
+// identity (Grafana IDs and uid used by grafana_sync), tags, time range and Grafana versioning
+var dashboardStateKeys = []string{"id", "uid", "tags", "time", "version", "iteration"}
+
+// Per project templating variables state kept by variable name: selected and cached values (like documentation HTML)
+var dashboardVariableStateKeys = []string{"current", "options"}
+
+// dashboardObject - JSON object with keys order kept and values as raw JSON
+type dashboardObject struct {
+	keys   []string
+	values map[string]json.RawMessage
+}
+
+// parseDashboardObject - decodes JSON object keeping its keys order
+func parseDashboardObject(data []byte) (*dashboardObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("JSON object expected: %v", err)
+	}
+	obj := &dashboardObject{values: make(map[string]json.RawMessage)}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		if _, ok := obj.values[key]; !ok {
+			obj.keys = append(obj.keys, key)
+		}
+		obj.values[key] = value
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON object")
+	}
+	return obj, nil
+}
+
+// keep - sets key's value from `from` object (if it has the key), new keys are placed after the keys preceding them in `from`
+func (o *dashboardObject) keep(from *dashboardObject, key string) {
+	value, ok := from.values[key]
+	if !ok {
+		return
+	}
+	if _, ok := o.values[key]; !ok {
+		pos := 0
+		for _, prev := range from.keys {
+			if prev == key {
+				break
+			}
+			for i, k := range o.keys {
+				if k == prev {
+					pos = i + 1
+				}
+			}
+		}
+		o.keys = append(o.keys[:pos], append([]string{key}, o.keys[pos:]...)...)
+	}
+	o.values[key] = value
+}
+
+// encode - returns JSON object with keys in order
+func (o *dashboardObject) encode() (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for k, key := range o.keys {
+		if k > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := dashboardJSON(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(o.values[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// dashboardObjects - decodes JSON array of objects (missing value is an empty array)
+func dashboardObjects(data json.RawMessage) ([]*dashboardObject, error) {
+	var items []json.RawMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+	}
+	objs := []*dashboardObject{}
+	for _, item := range items {
+		obj, err := parseDashboardObject(item)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+	return objs, nil
+}
+
+// encodeDashboardObjects - returns JSON array of objects
+func encodeDashboardObjects(objs []*dashboardObject) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, obj := range objs {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		item, err := obj.encode()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(item)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// keepDashboardVariables - keeps current templating variables state and order, variables are matched by name
+// Variables only defined in the template are added after them, variables not in the template are removed
+func keepDashboardVariables(dash, current *dashboardObject) error {
+	if _, ok := dash.values["templating"]; !ok {
+		return nil
+	}
+	curTemplating, ok := current.values["templating"]
+	if !ok {
+		return nil
+	}
+	templating, err := parseDashboardObject(dash.values["templating"])
+	if err != nil {
+		return fmt.Errorf("templating: %v", err)
+	}
+	cur, err := parseDashboardObject(curTemplating)
+	if err != nil {
+		return fmt.Errorf("current templating: %v", err)
+	}
+	vars, err := dashboardObjects(templating.values["list"])
+	if err != nil {
+		return fmt.Errorf("templating: %v", err)
+	}
+	curVars, err := dashboardObjects(cur.values["list"])
+	if err != nil {
+		return fmt.Errorf("current templating: %v", err)
+	}
+	byName := make(map[string]*dashboardObject)
+	for _, v := range vars {
+		byName[string(v.values["name"])] = v
+	}
+	list := []*dashboardObject{}
+	for _, curVar := range curVars {
+		name := string(curVar.values["name"])
+		v, ok := byName[name]
+		if !ok {
+			continue
+		}
+		for _, key := range dashboardVariableStateKeys {
+			v.keep(curVar, key)
+		}
+		list = append(list, v)
+		delete(byName, name)
+	}
+	for _, v := range vars {
+		if _, ok := byName[string(v.values["name"])]; ok {
+			list = append(list, v)
+		}
+	}
+	if templating.values["list"], err = encodeDashboardObjects(list); err != nil {
+		return err
+	}
+	dash.values["templating"], err = templating.encode()
+	return err
+}
+
+// keepDashboardPanelsIDs - keeps current panels IDs (matched by position), so links to panels keep working
+func keepDashboardPanelsIDs(dash, current *dashboardObject) error {
+	if _, ok := dash.values["panels"]; !ok {
+		return nil
+	}
+	panels, err := dashboardObjects(dash.values["panels"])
+	if err != nil {
+		return fmt.Errorf("panels: %v", err)
+	}
+	curPanels, err := dashboardObjects(current.values["panels"])
+	if err != nil {
+		return fmt.Errorf("current panels: %v", err)
+	}
+	for i, panel := range panels {
+		if i < len(curPanels) {
+			panel.keep(curPanels[i], "id")
+		}
+	}
+	dash.values["panels"], err = encodeDashboardObjects(panels)
+	return err
+}
+
+// GenerateDashboard - generates project dashboard from a shared template
+// Per project state of the current project dashboard (if any) is kept, so regenerating doesn't create needless changes:
+// dashboard id, uid, tags, time range and version, templating variables order and values, panels IDs
+// Keys order and all other values are kept as in the template, output is indented with 2 spaces and
+// has no new line at the end, like Grafana exported dashboards
+func GenerateDashboard(template []byte, replaces [][]string, current []byte) ([]byte, error) {
+	s := string(template)
+	for _, replace := range replaces {
+		s = strings.Replace(s, replace[0], replace[1], -1)
+	}
+	dash, err := parseDashboardObject([]byte(s))
+	if err != nil {
+		return nil, fmt.Errorf("dashboard template must be a JSON object: %v", err)
+	}
+	if len(current) > 0 {
+		cur, err := parseDashboardObject(current)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range dashboardStateKeys {
+			dash.keep(cur, key)
+		}
+		if err := keepDashboardVariables(dash, cur); err != nil {
+			return nil, err
+		}
+		if err := keepDashboardPanelsIDs(dash, cur); err != nil {
+			return nil, err
+		}
+	}
+	data, err := dash.encode()
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
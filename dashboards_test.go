@@ -0,0 +1,294 @@
+package devstats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "devstats"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// testTSSchema - schema of a small project with a merged series, dynamic series and a tag table
+func testTSSchema() *lib.TSSchema {
+	schema := lib.NewTSSchema("events_h")
+	schema.AddMetrics(
+		&lib.AllMetrics{
+			Metrics: []lib.Metric{
+				{SeriesNameOrFunc: "multi_row_single_column", MetricSQL: "prs_age", MergeSeries: "prs_age"},
+				{SeriesNameOrFunc: "multi_row_single_column", MetricSQL: "pr_authors"},
+				{SeriesNameOrFunc: "events_h", MetricSQL: "events"},
+				{SeriesNameOrFunc: "commits", MetricSQL: "commits", AddPeriodToName: true},
+			},
+		},
+		map[string]string{"pr_authors": "select 'pr_auth,' || repo_group, count(*) from gha_prs group by 1"},
+	)
+	schema.AddTags(
+		&lib.Tags{
+			Tags: []lib.Tag{
+				{SeriesName: "repo_groups", NameTag: "repo_group_name", ValueTag: "repo_group_value"},
+			},
+		},
+	)
+	return schema
+}
+
+func TestTSSchemaTable(t *testing.T) {
+	schema := testTSSchema()
+	var testCases = []struct {
+		table string
+		found bool
+		cols  bool
+	}{
+		{table: "sprs_age", found: true},
+		{table: "sevents_h", found: true},
+		{table: "spr_authkubectl", found: true},
+		{table: "spr_auth[[repogroup]]", found: true},
+		{table: "scommits_d", found: true},
+		{table: "s[[period]]", found: true},
+		{table: "trepo_groups", found: true, cols: true},
+		{table: "tquick_ranges", found: true, cols: true},
+		{table: "sprs_opened", found: false},
+		{table: "scommits", found: false},
+		{table: "tcompanies", found: false},
+	}
+	for _, test := range testCases {
+		cols, found := schema.Table(test.table)
+		if found != test.found || (cols != nil) != test.cols {
+			t.Errorf("%s: expected found: %v, columns: %v, got %v, %+v", test.table, test.found, test.cols, found, cols)
+		}
+	}
+}
+
+func TestCheckColumns(t *testing.T) {
+	schema := testTSSchema()
+	schema.AddColumns(
+		&lib.AllColumns{
+			Columns: []lib.Column{
+				{TableRegexp: "^sprs_age$", Tag: "trepo_groups", Column: "repo_group_name"},
+				{TableRegexp: "^spr_auth", Tag: "trepo_groups", Column: "repo_group_value"},
+				{TableRegexp: "^scompany_activity$", Tag: "tcompanies", Column: "companies_name"},
+				{TableRegexp: "^sprs_age$", Tag: "trepo_groups", Column: "name"},
+				{TableRegexp: "(", Tag: "trepo_groups", Column: "repo_group_name"},
+			},
+		},
+	)
+	var got []string
+	for _, issue := range schema.CheckColumns("columns.yaml") {
+		got = append(got, issue.String())
+	}
+	expected := []string{
+		"columns.yaml: columns[2]: tag table 'tcompanies' is not produced by tags.yaml",
+		"columns.yaml: columns[2]: table regexp '^scompany_activity$' matches no series produced by metrics.yaml",
+		"columns.yaml: columns[3]: tag table 'trepo_groups' has no column 'name'",
+		"columns.yaml: columns[4]: invalid table regexp '(': error parsing regexp: missing closing ): `(`",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestSQLTimeSeriesTables(t *testing.T) {
+	var testCases = []struct {
+		sql      string
+		expected []string
+	}{
+		{sql: "select time, value from sprs_age where series = 'from sx'", expected: []string{"sprs_age"}},
+		{sql: `select * from "spr_auth[[repogroup]]" s join trepo_groups r on true`, expected: []string{"spr_auth[[repogroup]]", "trepo_groups"}},
+		{sql: "with sub as (select 1 from gha_events) select * from sub", expected: []string{}},
+		{sql: "select extract(epoch from time) from public.scommits_d", expected: []string{"scommits_d"}},
+		{sql: "select * from series_generate(1, 2) join tquick_ranges on true", expected: []string{"tquick_ranges"}},
+	}
+	for _, test := range testCases {
+		if got := lib.SQLTimeSeriesTables(test.sql); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.sql, test.expected, got)
+		}
+	}
+}
+
+func TestSQLVariables(t *testing.T) {
+	got := lib.SQLVariables("select * from s[[period]] where $__timeFilter(time) and a = '${repo:csv}' and b = $company and c = '[[period]]' and $timeFilter")
+	expected := []string{"period", "repo", "company"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestLintDashboard(t *testing.T) {
+	dash := `{
+  "uid": "7",
+  "rows": [{"panels": [{"title": "Age", "targets": [{"rawSql": "select time, value from sprs_age where period = '[[period]]' and series = '[[repo]]'"}]}]}],
+  "panels": [{"title": "Auth", "targets": [{"rawSql": "select * from spr_auth[[repogroup]]", "query": "select * from old_influx"}]}, {"title": "Bad", "targets": [{"rawSql": "select * from sprs_opened"}]}],
+  "templating": {"list": [
+    {"name": "period", "type": "custom", "query": "d,w,m"},
+    {"name": "repogroup", "type": "query", "query": "select repo_group_value from trepo_groups where repo_group_name = '[[repogroup_name]]'"},
+    {"name": "repogroup_name", "type": "query", "query": "select repo_groupx_name from trepo_groups"}
+  ]},
+  "annotations": {"list": [{"name": "Releases", "rawQuery": "select title, description from sannotations where $__timeFilter(time)"}]}
+}`
+	var got []string
+	for _, issue := range lib.LintDashboard("d.json", []byte(dash), testTSSchema()) {
+		got = append(got, issue.String())
+	}
+	expected := []string{
+		"d.json: panels[1](Bad).targets[0]: table 'sprs_opened' is not produced by metrics.yaml or tags.yaml",
+		"d.json: rows[0].panels[0](Age).targets[0]: undefined variable 'repo'",
+		"d.json: templating[2](repogroup_name): unknown tag column 'repo_groupx_name'",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if issues := lib.LintDashboard("e.json", []byte("{"), testTSSchema()); len(issues) != 1 || !strings.Contains(issues[0].Message, "invalid JSON") {
+		t.Errorf("expected invalid JSON issue, got %+v", issues)
+	}
+}
+
+func TestGenerateDashboard(t *testing.T) {
+	proj := lib.Project{FullName: "Kubernetes", MainRepo: "kubernetes/kubernetes", PDB: "gha"}
+	replaces := lib.DashboardTemplateReplaces("kubernetes", &proj)
+	template := []byte(`{"id": null, "title": "{{full_name}} PRs", "tags": ["{{project}}"], "links": [{"url": "https://github.com/{{main_repo}}"}]}`)
+	got, err := lib.GenerateDashboard(template, replaces, []byte(`{"id": 17, "title": "Old"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "id": 17,
+  "title": "Kubernetes PRs",
+  "tags": [
+    "kubernetes"
+  ],
+  "links": [
+    {
+      "url": "https://github.com/kubernetes/kubernetes"
+    }
+  ]
+}`
+	if string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	// Values are JSON escaped, HTML is not escaped, id is added when template has none
+	proj = lib.Project{FullName: `A "B" <C> & D\E`}
+	replaces = lib.DashboardTemplateReplaces("x", &proj)
+	got, err = lib.GenerateDashboard([]byte(`{"title": "{{full_name}}", "panels": [{"content": "<b>{{project}}</b> & more"}]}`), replaces, []byte(`{"id": 3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = `{
+  "id": 3,
+  "title": "A \"B\" <C> & D\\E",
+  "panels": [
+    {
+      "content": "<b>x</b> & more"
+    }
+  ]
+}`
+	if string(got) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	for _, template := range []string{`{"title": "{{project}}`, `["{{project}}"]`, `{"title": "a"} {}`} {
+		if _, err = lib.GenerateDashboard([]byte(template), replaces, nil); err == nil {
+			t.Errorf("expected error for invalid template %s", template)
+		}
+	}
+}
+
+func TestGenerateDashboardKeepsState(t *testing.T) {
+	template := []byte(`{"id": null, "uid": "17", "panels": [{"id": 1, "title": "{{project}}"}, {"id": 2}], ` +
+		`"tags": ["shared"], "templating": {"list": [{"name": "period", "current": {"text": "Week"}, "options": []}, {"name": "new"}]}, ` +
+		`"time": {"from": "now-1y", "to": "now"}, "title": "{{full_name}}"}`)
+	current := []byte(`{"id": 5, "uid": "abc", "version": 3, "panels": [{"id": 7, "title": "Old"}, {"id": 8}], "tags": ["x", "y"], ` +
+		`"templating": {"list": [{"name": "removed"}, {"name": "period", "current": {"text": "Month"}, "options": [{"text": "Month"}]}]}, ` +
+		`"time": {"from": "now-2y", "to": "now"}, "title": "Old"}`)
+	proj := lib.Project{FullName: "Kubernetes"}
+	got, err := lib.GenerateDashboard(template, lib.DashboardTemplateReplaces("kubernetes", &proj), current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dash struct {
+		ID      int      `json:"id"`
+		UID     string   `json:"uid"`
+		Version int      `json:"version"`
+		Tags    []string `json:"tags"`
+		Title   string   `json:"title"`
+		Time    struct{ From string }
+		Panels  []struct {
+			ID    int
+			Title string
+		}
+		Templating struct {
+			List []struct {
+				Name    string
+				Current struct{ Text string }
+				Options []struct{ Text string }
+			}
+		}
+	}
+	if err = json.Unmarshal(got, &dash); err != nil {
+		t.Fatal(err)
+	}
+	if dash.ID != 5 || dash.UID != "abc" || dash.Version != 3 || dash.Title != "Kubernetes" || dash.Time.From != "now-2y" ||
+		!reflect.DeepEqual(dash.Tags, []string{"x", "y"}) {
+		t.Errorf("dashboard state not kept:\n%s", got)
+	}
+	if len(dash.Panels) != 2 || dash.Panels[0].ID != 7 || dash.Panels[1].ID != 8 || dash.Panels[0].Title != "kubernetes" {
+		t.Errorf("panels ids not kept:\n%s", got)
+	}
+	vars := dash.Templating.List
+	if len(vars) != 2 || vars[0].Name != "period" || vars[0].Current.Text != "Month" || len(vars[0].Options) != 1 || vars[1].Name != "new" {
+		t.Errorf("variables state not kept:\n%s", got)
+	}
+}
+
+// TestGenerateCommittedDashboards - generating dashboards from shared templates must not change committed dashboards
+// of enabled projects
+func TestGenerateCommittedDashboards(t *testing.T) {
+	var projects lib.AllProjects
+	data, err := ioutil.ReadFile("projects.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = yaml.Unmarshal(data, &projects); err != nil {
+		t.Fatal(err)
+	}
+	dir := "grafana/dashboards/shared/"
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for name, proj := range projects.Projects {
+		// Disabled projects have no dashboards
+		if proj.Disabled {
+			continue
+		}
+		replaces := lib.DashboardTemplateReplaces(name, &proj)
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), ".json") || !lib.SharedDashboard(&proj, file.Name()) {
+				continue
+			}
+			template, err := ioutil.ReadFile(dir + file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			current, err := ioutil.ReadFile("grafana/dashboards/" + name + "/" + file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := lib.GenerateDashboard(template, replaces, current)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(current) {
+				t.Errorf("%s/%s: generated dashboard differs from the committed one", name, file.Name())
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("no shared dashboards checked")
+	}
+}
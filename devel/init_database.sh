@@ -53,6 +53,7 @@ then
   sudo -u postgres psql -c "grant all privileges on database \"devstats\" to gha_admin" || exit 9
   sudo -u postgres psql -c "alter user gha_admin createdb" || exit 10
   sudo -u postgres psql devstats < ./util_sql/devstats_log_table.sql
+  sudo -u postgres psql devstats < ./util_sql/devstats_ghapi_budget_table.sql
   ./devel/ro_user_grants.sh devstats || exit 11
   ./devel/psql_user_grants.sh "devstats_team" "devstats" || exit 12
 else
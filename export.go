@@ -0,0 +1,369 @@
+package devstats
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Export column actions
+const (
+	ExportKeep         = "keep"         // Value is exported as is
+	ExportPseudonymize = "pseudonymize" // Value is replaced with a stable keyed hash
+	ExportNull         = "null"         // Value is exported as NULL
+	ExportDrop         = "drop"         // Column is not exported at all
+)
+
+// ExportNullValue - NULL representation in exported COPY data (Postgres text format)
+const ExportNullValue = `\N`
+
+// ExportPolicy - export policy from export.yaml
+// Tables - regexp of tables to export (default `^gha_`), Exclude - tables that are never exported
+// Columns - explicit column actions, columns not listed use default action
+// (emails are pseudonymized, free texts are exported as NULL, other columns are kept)
+type ExportPolicy struct {
+	Tables   string               `yaml:"tables"`
+	Exclude  []string             `yaml:"exclude"`
+	Columns  []ExportColumnPolicy `yaml:"columns"`
+	tablesRe *regexp.Regexp
+}
+
+// ExportColumnPolicy - action for table's column, table "*" matches all tables
+type ExportColumnPolicy struct {
+	Table  string `yaml:"table"`
+	Column string `yaml:"column"`
+	Action string `yaml:"action"`
+}
+
+// ExportManifest - describes exported dump, written to manifest.json
+type ExportManifest struct {
+	Database       string              `json:"database"`
+	File           string              `json:"file"`
+	Snapshot       string              `json:"snapshot"`
+	GeneratedAt    time.Time           `json:"generated_at"`
+	KeyFingerprint string              `json:"key_fingerprint"`
+	HiddenSHAs     int                 `json:"hidden_shas"`
+	Tables         []ExportTableResult `json:"tables"`
+}
+
+// ExportTableResult - single exported table in manifest
+// HiddenValues is the number of values replaced because they refer to hidden identifiers (from hide/hide.csv)
+type ExportTableResult struct {
+	Table        string               `json:"table"`
+	Rows         int64                `json:"rows"`
+	HiddenValues int64                `json:"hidden_values"`
+	Columns      []ExportColumnResult `json:"columns"`
+}
+
+// ExportColumnResult - single column in manifest
+type ExportColumnResult struct {
+	Column string `json:"column"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+}
+
+// ExportTableSchema - table definition used to write exported table, see ExportSchemas
+// Types holds full column types (like `character varying(160)`), Constraints primary key and unique constraints
+// (`constraint name primary key (id)`) and Indexes other indexes definitions (`create index ...`)
+type ExportTableSchema struct {
+	Types       map[string]string
+	NotNull     map[string]bool
+	Constraints []string
+	Indexes     []string
+}
+
+// Validate - checks policy regexp and actions
+func (p *ExportPolicy) Validate() error {
+	re, err := regexp.Compile(p.TablesRegexp())
+	if err != nil {
+		return err
+	}
+	p.tablesRe = re
+	for _, c := range p.Columns {
+		switch c.Action {
+		case ExportKeep, ExportPseudonymize, ExportNull, ExportDrop:
+		default:
+			return fmt.Errorf("invalid export action '%s' for %s.%s", c.Action, c.Table, c.Column)
+		}
+	}
+	return nil
+}
+
+// TablesRegexp - returns regexp of tables to export
+func (p *ExportPolicy) TablesRegexp() string {
+	if p.Tables == "" {
+		return "^gha_"
+	}
+	return p.Tables
+}
+
+// ExportTable - checks if table should be exported, GDPR requests and audit tables are never exported
+// Tables regexp is compiled once (by Validate or on first call)
+func (p *ExportPolicy) ExportTable(table string) bool {
+	if strings.HasPrefix(table, "gha_gdpr_") {
+		return false
+	}
+	for _, ex := range p.Exclude {
+		if ex == table {
+			return false
+		}
+	}
+	if p.tablesRe == nil {
+		p.tablesRe = regexp.MustCompile(p.TablesRegexp())
+	}
+	return p.tablesRe.MatchString(table)
+}
+
+// ColumnAction - returns action for a given column: table specific policy, then "*" policy, then default
+// Default: emails are pseudonymized, free text columns (bodies, titles, messages) are exported as NULL
+func (p *ExportPolicy) ColumnAction(col GDPRColumn) string {
+	action := ""
+	for _, c := range p.Columns {
+		if c.Column != col.Column {
+			continue
+		}
+		if c.Table == col.Table {
+			return c.Action
+		}
+		if c.Table == "*" && action == "" {
+			action = c.Action
+		}
+	}
+	if action != "" {
+		return action
+	}
+	if col.Kind == GDPRExact && strings.HasSuffix(col.Column, "email") {
+		return ExportPseudonymize
+	}
+	if col.Kind == GDPRPattern {
+		return ExportNull
+	}
+	return ExportKeep
+}
+
+// Pseudonymize - returns stable keyed hash (HMAC-SHA256) of a value, the same value and key always give the same result
+func Pseudonymize(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	_, err := mac.Write([]byte(value))
+	FatalOnError(err)
+	return "pseudo-" + hex.EncodeToString(mac.Sum(nil))[:40]
+}
+
+// ExportKeyFingerprint - returns key fingerprint for the manifest, it allows checking which key was used without revealing it
+func ExportKeyFingerprint(key []byte) string {
+	hash := sha256.Sum256(key)
+	return hex.EncodeToString(hash[:])[:16]
+}
+
+// exportCopyReplacer - escapes value for Postgres COPY text format
+var exportCopyReplacer = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+// ExportRow - transforms a single row according to column actions, returns COPY text format fields
+// Identifiers hidden in hide/hide.csv are replaced with their anonymized value (like `hide_data` does), rows are never removed,
+// so references between tables stay valid; kept identifiers that look like emails (email used as login) are pseudonymized
+// Returns number of replaced hidden values
+func ExportRow(cols []GDPRColumn, actions []string, values []sql.NullString, key []byte, hidden map[string]string) ([]string, int) {
+	row := []string{}
+	nHidden := 0
+	for i, col := range cols {
+		switch actions[i] {
+		case ExportDrop:
+			continue
+		case ExportNull:
+			row = append(row, ExportNullValue)
+			continue
+		}
+		if !values[i].Valid {
+			row = append(row, ExportNullValue)
+			continue
+		}
+		value := values[i].String
+		if col.Kind == GDPRExact && len(hidden) > 0 {
+			if anon, ok := hidden[SHA1(value)]; ok {
+				value = anon
+				nHidden++
+			}
+		}
+		if actions[i] == ExportPseudonymize || (col.Kind == GDPRExact && strings.Contains(value, "@")) {
+			value = Pseudonymize(key, value)
+		}
+		row = append(row, exportCopyReplacer.Replace(value))
+	}
+	return row, nHidden
+}
+
+// ExportSchemas - returns definitions of all public tables: full column types, not null flags, constraints and indexes
+func ExportSchemas(tx *sql.Tx, ctx *Ctx) map[string]*ExportTableSchema {
+	schemas := make(map[string]*ExportTableSchema)
+	schema := func(table string) *ExportTableSchema {
+		s, ok := schemas[table]
+		if !ok {
+			s = &ExportTableSchema{Types: make(map[string]string), NotNull: make(map[string]bool)}
+			schemas[table] = s
+		}
+		return s
+	}
+	var table, name, def string
+	var notNull bool
+	rows := QuerySQLTxWithErr(
+		tx,
+		ctx,
+		"select c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull "+
+			"from pg_attribute a, pg_class c, pg_namespace n where a.attrelid = c.oid and c.relnamespace = n.oid "+
+			"and n.nspname = 'public' and c.relkind = 'r' and a.attnum > 0 and not a.attisdropped",
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&table, &name, &def, &notNull))
+		s := schema(table)
+		s.Types[name] = def
+		s.NotNull[name] = notNull
+	}
+	FatalOnError(rows.Err())
+	FatalOnError(rows.Close())
+	rows = QuerySQLTxWithErr(
+		tx,
+		ctx,
+		"select c.relname, co.conname, pg_get_constraintdef(co.oid) from pg_constraint co, pg_class c, pg_namespace n "+
+			"where co.conrelid = c.oid and c.relnamespace = n.oid and n.nspname = 'public' and co.contype in ('p', 'u') "+
+			"order by c.relname, co.conname",
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&table, &name, &def))
+		s := schema(table)
+		s.Constraints = append(s.Constraints, "CONSTRAINT "+pq.QuoteIdentifier(name)+" "+def)
+	}
+	FatalOnError(rows.Err())
+	FatalOnError(rows.Close())
+	rows = QuerySQLTxWithErr(
+		tx,
+		ctx,
+		"select i.tablename, i.indexdef from pg_indexes i where i.schemaname = 'public' "+
+			"and not exists (select 1 from pg_constraint co where co.conname = i.indexname) order by i.tablename, i.indexname",
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&table, &def))
+		s := schema(table)
+		s.Indexes = append(s.Indexes, def)
+	}
+	FatalOnError(rows.Err())
+	FatalOnError(rows.Close())
+	return schemas
+}
+
+// exportIdentRe - identifiers used in constraints and indexes definitions
+var exportIdentRe = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// exportUsesDropped - checks if constraint or index definition uses any of dropped columns
+func exportUsesDropped(def string, res *ExportTableResult) bool {
+	dropped := make(map[string]struct{})
+	for _, col := range res.Columns {
+		if col.Action == ExportDrop {
+			dropped[col.Column] = struct{}{}
+		}
+	}
+	if len(dropped) == 0 {
+		return false
+	}
+	for _, ident := range exportIdentRe.FindAllString(def, -1) {
+		if _, ok := dropped[ident]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportTableSQL - returns `create table` and `copy ... from stdin` header for exported table (pg_dump plain format)
+// Exported data lines and `\.` must follow, primary keys and indexes are created after loading data, see ExportPostDataSQL
+func ExportTableSQL(res *ExportTableResult, schema *ExportTableSchema) string {
+	defs := []string{}
+	names := []string{}
+	for _, col := range res.Columns {
+		if col.Action == ExportDrop {
+			continue
+		}
+		def := "    " + pq.QuoteIdentifier(col.Column) + " " + col.Type
+		if schema != nil && schema.NotNull[col.Column] && col.Action != ExportNull {
+			def += " NOT NULL"
+		}
+		defs = append(defs, def)
+		names = append(names, pq.QuoteIdentifier(col.Column))
+	}
+	table := "public." + pq.QuoteIdentifier(res.Table)
+	return fmt.Sprintf(
+		"\n--\n-- Name: %s; Type: TABLE DATA\n--\n\nCREATE TABLE %s (\n%s\n);\n\nCOPY %s (%s) FROM stdin;\n",
+		res.Table, table, strings.Join(defs, ",\n"), table, strings.Join(names, ", "),
+	)
+}
+
+// ExportPostDataSQL - returns SQL creating primary keys, unique constraints and indexes of exported table
+// Constraints and indexes using dropped columns are skipped
+func ExportPostDataSQL(res *ExportTableResult, schema *ExportTableSchema) string {
+	if schema == nil {
+		return ""
+	}
+	s := ""
+	for _, def := range schema.Constraints {
+		if !exportUsesDropped(def, res) {
+			s += fmt.Sprintf("ALTER TABLE ONLY public.%s ADD %s;\n", pq.QuoteIdentifier(res.Table), def)
+		}
+	}
+	for _, def := range schema.Indexes {
+		if !exportUsesDropped(def, res) {
+			s += def + ";\n"
+		}
+	}
+	return s
+}
+
+// ExportTableData - exports table rows in COPY text format (terminated with `\.`) using a given (snapshot) transaction
+// Returns manifest entry, cols are table columns from SchemaColumns, types are full columns types from ExportSchemas
+func ExportTableData(tx *sql.Tx, ctx *Ctx, cols []GDPRColumn, schema *ExportTableSchema, policy *ExportPolicy, key []byte, hidden map[string]string, w io.Writer) (res ExportTableResult) {
+	if len(cols) == 0 {
+		return
+	}
+	res.Table = cols[0].Table
+	actions := []string{}
+	names := []string{}
+	for _, col := range cols {
+		action := policy.ColumnAction(col)
+		actions = append(actions, action)
+		names = append(names, pq.QuoteIdentifier(col.Column))
+		typ := col.Type
+		if schema != nil && schema.Types[col.Column] != "" {
+			typ = schema.Types[col.Column]
+		}
+		res.Columns = append(res.Columns, ExportColumnResult{Column: col.Column, Type: typ, Action: action})
+	}
+	writer := bufio.NewWriter(w)
+	_, err := writer.WriteString(ExportTableSQL(&res, schema))
+	FatalOnError(err)
+	rows := QuerySQLTxWithErr(tx, ctx, fmt.Sprintf("select %s from %s", strings.Join(names, ", "), pq.QuoteIdentifier(res.Table)))
+	defer func() { FatalOnError(rows.Close()) }()
+	values := make([]sql.NullString, len(cols))
+	pointers := make([]interface{}, len(cols))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		FatalOnError(rows.Scan(pointers...))
+		row, nHidden := ExportRow(cols, actions, values, key, hidden)
+		_, err = writer.WriteString(strings.Join(row, "\t") + "\n")
+		FatalOnError(err)
+		res.Rows++
+		res.HiddenValues += int64(nHidden)
+	}
+	FatalOnError(rows.Err())
+	_, err = writer.WriteString("\\.\n")
+	FatalOnError(err)
+	FatalOnError(writer.Flush())
+	return
+}
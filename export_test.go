@@ -0,0 +1,115 @@
+package devstats
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "devstats"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestExportPolicy(t *testing.T) {
+	var policy lib.ExportPolicy
+	data, err := lib.ReadFile(&lib.Ctx{}, "export.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = yaml.Unmarshal(data, &policy); err != nil {
+		t.Fatal(err)
+	}
+	if err = policy.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for table, expected := range map[string]bool{"gha_events": true, "gha_logs": false, "gha_gdpr_audit": false, "sdevs": false} {
+		if got := policy.ExportTable(table); got != expected {
+			t.Errorf("table %s: expected %v, got %v", table, expected, got)
+		}
+	}
+	var testCases = []struct {
+		col      lib.GDPRColumn
+		expected string
+	}{
+		{lib.GDPRColumn{Table: "gha_actors_emails", Column: "email", Kind: lib.GDPRExact}, lib.ExportPseudonymize},
+		{lib.GDPRColumn{Table: "gha_commits", Column: "author_email", Kind: lib.GDPRExact}, lib.ExportPseudonymize},
+		{lib.GDPRColumn{Table: "gha_other", Column: "committer_email", Kind: lib.GDPRExact}, lib.ExportPseudonymize},
+		{lib.GDPRColumn{Table: "gha_texts", Column: "body", Kind: lib.GDPRPattern}, lib.ExportDrop},
+		{lib.GDPRColumn{Table: "gha_comments", Column: "body", Kind: lib.GDPRPattern}, lib.ExportNull},
+		{lib.GDPRColumn{Table: "gha_issues", Column: "body", Kind: lib.GDPRPattern}, lib.ExportNull},
+		{lib.GDPRColumn{Table: "gha_commits", Column: "message", Kind: lib.GDPRPattern}, lib.ExportNull},
+		{lib.GDPRColumn{Table: "gha_issues", Column: "number"}, lib.ExportKeep},
+		{lib.GDPRColumn{Table: "gha_actors", Column: "login", Kind: lib.GDPRExact}, lib.ExportKeep},
+	}
+	for _, test := range testCases {
+		if got := policy.ColumnAction(test.col); got != test.expected {
+			t.Errorf("%s.%s: expected %s, got %s", test.col.Table, test.col.Column, test.expected, got)
+		}
+	}
+	bad := lib.ExportPolicy{Columns: []lib.ExportColumnPolicy{{Table: "gha_actors", Column: "login", Action: ""}}}
+	if err = bad.Validate(); err == nil {
+		t.Errorf("expected error for empty action")
+	}
+}
+
+func TestExportRow(t *testing.T) {
+	key := []byte("secret")
+	p := lib.Pseudonymize(key, "john@example.com")
+	if p != lib.Pseudonymize(key, "john@example.com") || p == lib.Pseudonymize([]byte("other"), "john@example.com") || !strings.HasPrefix(p, "pseudo-") {
+		t.Errorf("pseudonymization must be stable and keyed, got %s", p)
+	}
+	cols := []lib.GDPRColumn{
+		{Table: "gha_commits", Column: "sha", Type: "character varying"},
+		{Table: "gha_commits", Column: "dup_actor_login", Type: "character varying", Kind: lib.GDPRExact},
+		{Table: "gha_commits", Column: "author_email", Type: "character varying", Kind: lib.GDPRExact},
+		{Table: "gha_commits", Column: "message", Type: "text", Kind: lib.GDPRPattern},
+		{Table: "gha_commits", Column: "body", Type: "text", Kind: lib.GDPRPattern},
+	}
+	actions := []string{lib.ExportKeep, lib.ExportKeep, lib.ExportPseudonymize, lib.ExportNull, lib.ExportDrop}
+	hidden := lib.GetHidden("hide/none.csv")
+	hidden[lib.SHA1("hidden")] = lib.GDPRAnon(lib.SHA1("hidden"))
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+	row, n := lib.ExportRow(cols, actions, []sql.NullString{str("a\tb\\c\n"), str("john"), str("john@example.com"), str("msg"), str("body")}, key, hidden)
+	expected := []string{"a\\tb\\\\c\\n", "john", p, lib.ExportNullValue}
+	if n != 0 || !reflect.DeepEqual(row, expected) {
+		t.Errorf("expected %+v, got %+v (%d)", expected, row, n)
+	}
+	row, n = lib.ExportRow(cols, actions, []sql.NullString{str(""), str("john@example.com"), {}, str("msg"), {}}, key, hidden)
+	expected = []string{"", p, lib.ExportNullValue, lib.ExportNullValue}
+	if n != 0 || !reflect.DeepEqual(row, expected) {
+		t.Errorf("email used as login should be pseudonymized: expected %+v, got %+v (%d)", expected, row, n)
+	}
+	row, n = lib.ExportRow(cols, actions, []sql.NullString{str("abc"), str("hidden"), {}, {}, {}}, key, hidden)
+	expected = []string{"abc", lib.GDPRAnon(lib.SHA1("hidden")), lib.ExportNullValue, lib.ExportNullValue}
+	if n != 1 || !reflect.DeepEqual(row, expected) {
+		t.Errorf("hidden login should be anonymized and row kept: expected %+v, got %+v (%d)", expected, row, n)
+	}
+
+	res := lib.ExportTableResult{
+		Table: "gha_commits",
+		Columns: []lib.ExportColumnResult{
+			{Column: "sha", Type: "character varying(40)", Action: lib.ExportKeep},
+			{Column: "message", Type: "text", Action: lib.ExportNull},
+			{Column: "body", Type: "text", Action: lib.ExportDrop},
+		},
+	}
+	schema := &lib.ExportTableSchema{
+		NotNull:     map[string]bool{"sha": true, "message": true},
+		Constraints: []string{`CONSTRAINT "gha_commits_pkey" PRIMARY KEY (sha)`},
+		Indexes:     []string{"CREATE INDEX commits_sha_idx ON public.gha_commits USING btree (sha)", "CREATE INDEX commits_body_idx ON public.gha_commits USING btree (body)"},
+	}
+	gotSQL := lib.ExportTableSQL(&res, schema)
+	expectedSQL := "\n--\n-- Name: gha_commits; Type: TABLE DATA\n--\n\nCREATE TABLE public.\"gha_commits\" (\n    \"sha\" character varying(40) NOT NULL,\n    \"message\" text\n);\n\n" +
+		"COPY public.\"gha_commits\" (\"sha\", \"message\") FROM stdin;\n"
+	if gotSQL != expectedSQL {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedSQL, gotSQL)
+	}
+	gotSQL = lib.ExportPostDataSQL(&res, schema)
+	expectedSQL = "ALTER TABLE ONLY public.\"gha_commits\" ADD CONSTRAINT \"gha_commits_pkey\" PRIMARY KEY (sha);\n" +
+		"CREATE INDEX commits_sha_idx ON public.gha_commits USING btree (sha);\n"
+	if gotSQL != expectedSQL {
+		t.Errorf("expected:\n%s\ngot:\n%s", expectedSQL, gotSQL)
+	}
+}
@@ -0,0 +1,201 @@
+package devstats
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FilesGroups contain list of file path based repository groups rules
+type FilesGroups struct {
+	FilesGroups []FilesGroup `yaml:"files_groups"`
+}
+
+// FilesGroup contain single file path based repository group rule
+// Repo is an optional exact repository name like "org/repo", when set paths are relative to this repo's root
+// When Repo is not set, paths are matched against full paths that include repository name: "org/repo/dir/file.ext"
+// Paths can be:
+// "dir/" - directory prefix: matches all files in "dir" and its subdirectories
+// "dir/*.go" - glob: "*" matches any characters except "/", "?" matches single character except "/"
+// "dir/**/*.go" - glob: "**" matches any characters including "/"
+// "dir/file.ext" - exact file path
+type FilesGroup struct {
+	Group string   `yaml:"group"`
+	Repo  string   `yaml:"repo"`
+	Paths []string `yaml:"paths"`
+	re    *regexp.Regexp
+}
+
+// FilesGroupsHashVar - name of `gha_vars` variable that holds hash of the last applied files groups rules
+const FilesGroupsHashVar string = "files_groups_hash"
+
+// FilesGroupsYaml - returns path to given project's files groups rules YAML file
+func FilesGroupsYaml(ctx *Ctx, project string) string {
+	// Local or cron mode?
+	dataPrefix := DataDir
+	if ctx.Local {
+		dataPrefix = "./"
+	}
+	return dataPrefix + Metrics + project + "/files_groups.yaml"
+}
+
+// ReadFilesGroups - reads files groups rules from given YAML file and compiles their regexps
+// Missing file means no rules
+func ReadFilesGroups(fn string) (groups FilesGroups) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return
+		}
+		FatalOnError(err)
+	}
+	FatalOnError(yaml.Unmarshal(data, &groups))
+	for i, group := range groups.FilesGroups {
+		if group.Group == "" || len(group.Paths) == 0 {
+			Fatalf("%s: files group rule #%d must have non-empty 'group' and 'paths'", fn, i+1)
+		}
+		re, err := regexp.Compile(group.Regexp())
+		if err != nil {
+			Fatalf("%s: files group rule #%d: %v", fn, i+1, err)
+		}
+		groups.FilesGroups[i].re = re
+	}
+	return
+}
+
+// Hash - returns hash of files groups rules, empty string when there are no rules
+// It only depends on rules data (not on YAML formatting or comments)
+func (groups *FilesGroups) Hash() string {
+	if len(groups.FilesGroups) == 0 {
+		return ""
+	}
+	data, err := yaml.Marshal(groups)
+	FatalOnError(err)
+	hash := sha1.Sum(data)
+	return hex.EncodeToString(hash[:])
+}
+
+// FilesGlobToRegexp - converts file path pattern into a regexp string
+// Generated regexp can be used both in Go and in Postgres `~` operator
+func FilesGlobToRegexp(pattern string) string {
+	if strings.HasSuffix(pattern, "/") {
+		return regexp.QuoteMeta(pattern) + ".*"
+	}
+	re := ""
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" also matches no directories at all
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					re += "(.*/)?"
+				} else {
+					re += ".*"
+				}
+			} else {
+				re += "[^/]*"
+			}
+		case '?':
+			re += "[^/]"
+		default:
+			re += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+	return re
+}
+
+// Regexp - returns regexp matching full files paths (including repo name) for given rule
+func (group *FilesGroup) Regexp() string {
+	prefix := ""
+	if group.Repo != "" {
+		prefix = regexp.QuoteMeta(group.Repo + "/")
+	}
+	res := []string{}
+	for _, path := range group.Paths {
+		res = append(res, FilesGlobToRegexp(strings.TrimPrefix(path, "/")))
+	}
+	return "^" + prefix + "(" + strings.Join(res, "|") + ")$"
+}
+
+// Match - returns first matching group for a full file path (including repo name), or empty string
+// Rules not read by ReadFilesGroups are compiled on the first call
+func (groups *FilesGroups) Match(path string) string {
+	for i := range groups.FilesGroups {
+		group := &groups.FilesGroups[i]
+		if group.re == nil {
+			group.re = regexp.MustCompile(group.Regexp())
+		}
+		if group.re.MatchString(path) {
+			return group.Group
+		}
+	}
+	return ""
+}
+
+// ProcessFilesGroups - sets `gha_events_commits_files` repo groups using file path based rules
+// Rules are applied in order, first matching rule wins, only files without repo group yet are updated
+// When rules have changed since last run (detected via hash stored in `gha_vars`), all files repo groups are reset
+// and computed again. Remaining files get their repo groups from postprocess scripts run by `structure`.
+func ProcessFilesGroups(con *sql.DB, ctx *Ctx, groups *FilesGroups) {
+	dtStart := time.Now()
+	hash := groups.Hash()
+	var prevHash *string
+	rows := QuerySQLWithErr(con, ctx, "select value_s from gha_vars where name = $1", FilesGroupsHashVar)
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		FatalOnError(rows.Scan(&prevHash))
+	}
+	FatalOnError(rows.Err())
+	prev := ""
+	if prevHash != nil {
+		prev = *prevHash
+	}
+	if hash == "" && prev == "" {
+		return
+	}
+
+	// Update all in transaction: all or none
+	tx, err := con.Begin()
+	FatalOnError(err)
+	if hash != prev {
+		Printf("Files groups rules changed (%s -> %s), recomputing all files repo groups\n", prev, hash)
+		ExecSQLTxWithErr(tx, ctx, "update gha_events_commits_files set repo_group = null where repo_group is not null")
+	}
+	updated := int64(0)
+	for _, group := range groups.FilesGroups {
+		query := "update gha_events_commits_files set repo_group = $1 where repo_group is null and path ~ $2"
+		args := []interface{}{group.Group, group.Regexp()}
+		if group.Repo != "" {
+			query += " and dup_repo_name = $3"
+			args = append(args, group.Repo)
+		}
+		res := ExecSQLTxWithErr(tx, ctx, query, args...)
+		n, err := res.RowsAffected()
+		FatalOnError(err)
+		if ctx.Debug > 0 {
+			Printf("Files group '%s' (%s): %d files\n", group.Group, group.Regexp(), n)
+		}
+		updated += n
+	}
+	if hash != prev {
+		ExecSQLTxWithErr(
+			tx,
+			ctx,
+			"insert into gha_vars(name, value_s) "+NValues(2)+" on conflict(name) do update set value_s = excluded.value_s",
+			FilesGroupsHashVar,
+			hash,
+		)
+	}
+	FatalOnError(tx.Commit())
+	dtEnd := time.Now()
+	Printf("Files groups: %d rules, %d files updated, took %v\n", len(groups.FilesGroups), updated, dtEnd.Sub(dtStart))
+}
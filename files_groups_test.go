@@ -0,0 +1,126 @@
+package devstats
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestFilesGlobToRegexp(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		pattern  string
+		expected string
+	}{
+		{pattern: "cmd/kubeadm/", expected: `cmd/kubeadm/.*`},
+		{pattern: "README.md", expected: `README\.md`},
+		{pattern: "pkg/*.go", expected: `pkg/[^/]*\.go`},
+		{pattern: "pkg/**", expected: `pkg/.*`},
+		{pattern: "pkg/**/*_test.go", expected: `pkg/(.*/)?[^/]*_test\.go`},
+		{pattern: "v?.txt", expected: `v[^/]\.txt`},
+		{pattern: "a+b(c)/", expected: `a\+b\(c\)/.*`},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.FilesGlobToRegexp(test.pattern)
+		if got != test.expected {
+			t.Errorf(
+				"test number %d, expected '%v', got '%v'",
+				index+1, test.expected, got,
+			)
+		}
+	}
+}
+
+func TestFilesGroupsMatch(t *testing.T) {
+	// Example rules
+	groups := lib.FilesGroups{
+		FilesGroups: []lib.FilesGroup{
+			{
+				Group: "Cluster lifecycle",
+				Repo:  "kubernetes/kubernetes",
+				Paths: []string{"cmd/kubeadm/", "cluster/**"},
+			},
+			{
+				Group: "Docs",
+				Repo:  "kubernetes/kubernetes",
+				Paths: []string{"**/*.md"},
+			},
+			{
+				Group: "Tests",
+				Paths: []string{"*/*/test/**"},
+			},
+		},
+	}
+
+	// Test cases
+	var testCases = []struct {
+		path  string
+		group string
+	}{
+		{path: "kubernetes/kubernetes/cmd/kubeadm/app/main.go", group: "Cluster lifecycle"},
+		{path: "kubernetes/kubernetes/cmd/kubeadm/README.md", group: "Cluster lifecycle"},
+		{path: "kubernetes/kubernetes/cmd/kubectl/main.go", group: ""},
+		{path: "kubernetes/kubernetes/cluster/gce/util.sh", group: "Cluster lifecycle"},
+		{path: "kubernetes/kubernetes/clusterx/util.sh", group: ""},
+		{path: "kubernetes/kubernetes/README.md", group: "Docs"},
+		{path: "kubernetes/kubernetes/docs/api/README.md", group: "Docs"},
+		{path: "kubernetes/kubernetes/test/e2e/README.md", group: "Docs"},
+		{path: "kubernetes/kubernetes/test/e2e/e2e.go", group: "Tests"},
+		{path: "kubernetes/test-infra/test/a.go", group: "Tests"},
+		{path: "kubernetes/test-infra/README.md", group: ""},
+		{path: "kubernetes/kubernetes.md", group: ""},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := groups.Match(test.path)
+		if got != test.group {
+			t.Errorf(
+				"test number %d, path '%s', expected '%v', got '%v'",
+				index+1, test.path, test.group, got,
+			)
+		}
+	}
+}
+
+func TestReadFilesGroups(t *testing.T) {
+	// Missing file means no rules and empty hash
+	missing := lib.ReadFilesGroups("/this/file/does/not/exist.yaml")
+	if len(missing.FilesGroups) != 0 || missing.Hash() != "" {
+		t.Errorf("expected no rules and empty hash for missing file, got %+v", missing)
+	}
+
+	// Write two YAML files with the same rules, but different formatting
+	data := []string{
+		"---\nfiles_groups:\n  - group: A\n    repo: org/repo\n    paths: [a/, 'b/*.go']\n",
+		"# comment\nfiles_groups:\n- group: A\n  repo: org/repo\n  paths:\n    - a/\n    - b/*.go\n",
+		"files_groups:\n- group: A\n  repo: org/repo\n  paths:\n    - a/\n",
+	}
+	var hashes []string
+	for _, content := range data {
+		f, err := ioutil.TempFile("", "files_groups")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := f.Name()
+		defer func() { _ = os.Remove(fn) }()
+		_, err = f.WriteString(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		groups := lib.ReadFilesGroups(fn)
+		if len(groups.FilesGroups) != 1 || groups.FilesGroups[0].Group != "A" {
+			t.Errorf("unexpected rules read from '%s': %+v", content, groups)
+		}
+		hashes = append(hashes, groups.Hash())
+	}
+	if hashes[0] != hashes[1] {
+		t.Errorf("expected the same hash for the same rules, got '%s' and '%s'", hashes[0], hashes[1])
+	}
+	if hashes[0] == hashes[2] {
+		t.Errorf("expected different hashes for different rules, got '%s'", hashes[0])
+	}
+}
@@ -0,0 +1,385 @@
+package devstats
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GDPR requests statuses
+const (
+	GDPRReceived   = "received"   // Request registered, nothing anonymized yet
+	GDPRAnonymized = "anonymized" // All databases processed, waiting for verification
+	GDPRResidual   = "residual"   // Verification found remaining matches, request will be processed again
+	GDPRVerified   = "verified"   // Verification found no matches, subject identifiers were purged
+)
+
+// GDPR column kinds
+const (
+	GDPRExact   = "exact"   // Column holds identifier, values are compared using SHA1 (like hide/hide.csv)
+	GDPRPattern = "pattern" // Free text column, `@login` mentions and emails are searched for
+)
+
+// GDPRColumn - table column that can hold personal data
+type GDPRColumn struct {
+	Table  string
+	Column string
+	Type   string // Postgres data type from information_schema
+	Kind   string // GDPRExact or GDPRPattern
+}
+
+// GDPRRequest - right to be forgotten request
+// Subjects holds identifiers (logins, emails, names) until the request is verified, SHAs are kept forever
+type GDPRRequest struct {
+	ID         int64
+	Subjects   []string
+	SHAs       []string
+	ReceivedAt time.Time
+	Status     string
+}
+
+// GDPRAudit - number of rows changed (or found when verifying) in a single column
+type GDPRAudit struct {
+	Column GDPRColumn
+	Rows   int64
+}
+
+var (
+	gdprExactRe       = regexp.MustCompile(`(^|_)(login|email|author_name|committer_name|company_name|forkee_name)$`)
+	gdprPersonTableRe = regexp.MustCompile(`(actor|compan|author|user)`)
+	gdprPatternRe     = regexp.MustCompile(`^(body|message|msg|title|description|summary|payload)$`)
+	gdprLoginRe       = regexp.MustCompile(`^[[:alnum:]][[:alnum:]-]*$`)
+)
+
+// SHA1 - returns hex encoded SHA1 of a string, the same as `encode(digest(s, 'sha1'), 'hex')` in Postgres
+func SHA1(s string) string {
+	hash := sha1.New()
+	_, err := hash.Write([]byte(s))
+	FatalOnError(err)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// GDPRAnon - returns anonymized value for identifier's SHA1
+func GDPRAnon(sha string) string {
+	return "anon-" + sha
+}
+
+// GDPRColumnKind - classifies table column by its name and data type, returns "" for columns without personal data
+// Exact: `*login`, `*email`, `*author_name`, `*company_name`, ... and `name` in actors/companies tables
+// Pattern: free text columns like `body`, `message`, `title` (text or jsonb data type)
+func GDPRColumnKind(table, column, dataType string) string {
+	if !strings.HasPrefix(table, "gha_") || strings.HasPrefix(table, "gha_gdpr_") {
+		return ""
+	}
+	switch dataType {
+	case "character varying", "text":
+		if gdprExactRe.MatchString(column) || (column == "name" && gdprPersonTableRe.MatchString(table)) {
+			return GDPRExact
+		}
+		if dataType == "text" && gdprPatternRe.MatchString(column) {
+			return GDPRPattern
+		}
+	case "jsonb":
+		if gdprPatternRe.MatchString(column) {
+			return GDPRPattern
+		}
+	}
+	return ""
+}
+
+// SchemaColumns - returns all `gha_*` tables columns from the current database schema (kind is set for columns that can hold personal data)
+func SchemaColumns(con *sql.DB, ctx *Ctx) (columns []GDPRColumn) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select c.table_name, c.column_name, c.data_type from information_schema.columns c, "+
+			"information_schema.tables t where c.table_schema = 'public' and t.table_schema = c.table_schema "+
+			"and t.table_name = c.table_name and t.table_type = 'BASE TABLE' and c.table_name like 'gha\\_%' "+
+			"order by c.table_name, c.ordinal_position",
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	var col GDPRColumn
+	for rows.Next() {
+		FatalOnError(rows.Scan(&col.Table, &col.Column, &col.Type))
+		col.Kind = GDPRColumnKind(col.Table, col.Column, col.Type)
+		columns = append(columns, col)
+	}
+	FatalOnError(rows.Err())
+	return
+}
+
+// GDPRRegistry - returns all columns that can hold personal data, derived from the current database schema
+func GDPRRegistry(con *sql.DB, ctx *Ctx) (registry []GDPRColumn) {
+	for _, col := range SchemaColumns(con, ctx) {
+		if col.Kind != "" {
+			registry = append(registry, col)
+		}
+	}
+	return
+}
+
+// GDPRTextPattern - returns regular expression matching identifier in a free text, group 1 and 2 hold surrounding characters
+// Emails are matched exactly, logins only as `@login` mentions (group 1 keeps `@`), other identifiers (like names) return ""
+// Common words used as logins or names are not redacted in texts, expression is valid for both Postgres (`~*`, `regexp_replace`) and Go
+func GDPRTextPattern(identifier string) string {
+	if strings.Contains(identifier, "@") {
+		return `(^|[^[:alnum:]_.+-])` + regexp.QuoteMeta(identifier) + `($|[^[:alnum:]_-])`
+	}
+	if !gdprLoginRe.MatchString(identifier) {
+		return ""
+	}
+	return `(^@|[^[:alnum:]_.-]@)` + regexp.QuoteMeta(identifier) + `($|[^[:alnum:]_-])`
+}
+
+// GDPRJSONPattern - returns regular expression matching identifier as a whole JSON string value (like `"login": "<identifier>"`),
+// group 1 and 2 hold surrounding quotes, it is used for JSON columns (raw events payloads) where any identifier (including names) is matched
+func GDPRJSONPattern(identifier string) string {
+	if identifier == "" {
+		return ""
+	}
+	return `([^\\]")` + regexp.QuoteMeta(dashboardJSONString(identifier)) + `(")`
+}
+
+// GDPRPatterns - returns patterns matching identifier in a given pattern column: text pattern and JSON string values pattern for jsonb columns
+func GDPRPatterns(col GDPRColumn, identifier string) (patterns []string) {
+	if pattern := GDPRTextPattern(identifier); pattern != "" {
+		patterns = append(patterns, pattern)
+	}
+	if col.Type == "jsonb" {
+		if pattern := GDPRJSONPattern(identifier); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return
+}
+
+// gdprColumnExpr - returns column as a text expression
+func gdprColumnExpr(col GDPRColumn) string {
+	if col.Type == "jsonb" {
+		return col.Column + "::text"
+	}
+	return col.Column
+}
+
+// GDPRUpdateSQL - returns SQL anonymizing column values, parameters: anonymized value and SHA1 (exact) or pattern (pattern)
+func GDPRUpdateSQL(col GDPRColumn) string {
+	if col.Kind == GDPRExact {
+		return fmt.Sprintf(
+			"update %s set %s = %s where encode(digest(%s, 'sha1'), 'hex') = %s",
+			col.Table, col.Column, NValue(1), col.Column, NValue(2),
+		)
+	}
+	replace := fmt.Sprintf("regexp_replace(%s, %s, '\\1' || %s || '\\2', 'gi')", gdprColumnExpr(col), NValue(2), NValue(1))
+	if col.Type == "jsonb" {
+		replace = "(" + replace + ")::jsonb"
+	}
+	return fmt.Sprintf("update %s set %s = %s where %s ~* %s", col.Table, col.Column, replace, gdprColumnExpr(col), NValue(2))
+}
+
+// GDPRCountSQL - returns SQL counting rows still matching, parameter: array of SHA1s (exact) or pattern (pattern)
+func GDPRCountSQL(col GDPRColumn) string {
+	if col.Kind == GDPRExact {
+		return fmt.Sprintf(
+			"select count(*) from %s where encode(digest(%s, 'sha1'), 'hex') = any(%s)",
+			col.Table, col.Column, NValue(1),
+		)
+	}
+	return fmt.Sprintf("select count(*) from %s where %s ~* %s", col.Table, gdprColumnExpr(col), NValue(1))
+}
+
+// GDPRRequestsStructure - creates GDPR requests table if it doesn't exist, requests are only stored in `devstats` database
+// It is never dropped, requests must survive databases (re)initialization
+func GDPRRequestsStructure(con *sql.DB, ctx *Ctx) {
+	if !TableExists(con, ctx, "gha_gdpr_requests") {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			CreateTable(
+				"gha_gdpr_requests("+
+					"id {{pkauto}}, "+
+					"received_at {{ts}} not null, "+
+					"status varchar(16) not null, "+
+					"subjects text, "+
+					"shas text not null, "+
+					"updated_at {{tsnow}}, "+
+					"primary key(id)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(con, ctx, "create index gdpr_requests_status_idx on gha_gdpr_requests(status)")
+	}
+}
+
+// GDPRAuditStructure - creates per database GDPR anonymization audit log table if it doesn't exist
+// It is never dropped, audit log must survive database (re)initialization
+func GDPRAuditStructure(con *sql.DB, ctx *Ctx) {
+	if !TableExists(con, ctx, "gha_gdpr_audit") {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			CreateTable(
+				"gha_gdpr_audit("+
+					"id {{pkauto}}, "+
+					"dt {{tsnow}}, "+
+					"request_id bigint not null, "+
+					"action varchar(16) not null, "+
+					"table_name varchar(100) not null, "+
+					"column_name varchar(100) not null, "+
+					"kind varchar(16) not null, "+
+					"rows bigint not null, "+
+					"primary key(id)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(con, ctx, "create index gdpr_audit_request_id_idx on gha_gdpr_audit(request_id)")
+		ExecSQLWithErr(con, ctx, "create index gdpr_audit_dt_idx on gha_gdpr_audit(dt)")
+	}
+}
+
+// AddGDPRRequest - registers a new request for given subject identifiers, returns request ID
+func AddGDPRRequest(con *sql.DB, ctx *Ctx, subjects []string, receivedAt time.Time) (id int64) {
+	shas := []string{}
+	for _, subject := range subjects {
+		shas = append(shas, SHA1(subject))
+	}
+	FatalOnError(
+		QueryRowSQL(
+			con,
+			ctx,
+			"insert into gha_gdpr_requests(received_at, status, subjects, shas) "+NValues(4)+" returning id",
+			receivedAt,
+			GDPRReceived,
+			strings.Join(subjects, "\n"),
+			strings.Join(shas, ","),
+		).Scan(&id),
+	)
+	return
+}
+
+// GDPRRequests - returns requests with given statuses (all requests when no statuses given) ordered by ID
+func GDPRRequests(con *sql.DB, ctx *Ctx, statuses ...string) (requests []GDPRRequest) {
+	query := "select id, received_at, status, coalesce(subjects, ''), shas from gha_gdpr_requests"
+	args := []interface{}{}
+	if len(statuses) > 0 {
+		query += " where status = any(" + NValue(1) + ")"
+		args = append(args, "{"+strings.Join(statuses, ",")+"}")
+	}
+	rows := QuerySQLWithErr(con, ctx, query+" order by id", args...)
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var (
+			req      GDPRRequest
+			subjects string
+			shas     string
+		)
+		FatalOnError(rows.Scan(&req.ID, &req.ReceivedAt, &req.Status, &subjects, &shas))
+		if subjects != "" {
+			req.Subjects = strings.Split(subjects, "\n")
+		}
+		if shas != "" {
+			req.SHAs = strings.Split(shas, ",")
+		}
+		requests = append(requests, req)
+	}
+	FatalOnError(rows.Err())
+	return
+}
+
+// SetGDPRRequestStatus - updates request status, verified requests have their subject identifiers purged
+func SetGDPRRequestStatus(con *sql.DB, ctx *Ctx, id int64, status string) {
+	query := "update gha_gdpr_requests set status = " + NValue(1) + ", updated_at = now()"
+	if status == GDPRVerified {
+		query += ", subjects = null"
+	}
+	ExecSQLWithErr(con, ctx, query+" where id = "+NValue(2), status, id)
+}
+
+// addGDPRAudit - writes audit log entries
+func addGDPRAudit(con *sql.DB, ctx *Ctx, requestID int64, action string, audit []GDPRAudit) {
+	for _, a := range audit {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			"insert into gha_gdpr_audit(request_id, action, table_name, column_name, kind, rows) "+NValues(6),
+			requestID,
+			action,
+			a.Column.Table,
+			a.Column.Column,
+			a.Column.Kind,
+			a.Rows,
+		)
+	}
+}
+
+// GDPRAnonymize - anonymizes request subjects in all registry columns, writes audit log and returns changed rows per column
+// Exact columns are matched by SHA1 (so requests without subjects, like hide/hide.csv entries, can be processed too)
+// Pattern columns need subject identifiers and are skipped when they are already purged, in JSON columns (raw events payloads)
+// subjects are also replaced when they are whole JSON string values (like `"login"` or `"name"` values)
+func GDPRAnonymize(con *sql.DB, ctx *Ctx, req *GDPRRequest, registry []GDPRColumn) (audit []GDPRAudit) {
+	for _, col := range registry {
+		a := GDPRAudit{Column: col}
+		if col.Kind == GDPRExact {
+			for _, sha := range req.SHAs {
+				a.Rows += gdprRowsAffected(ExecSQLWithErr(con, ctx, GDPRUpdateSQL(col), GDPRAnon(sha), sha))
+			}
+		} else {
+			for _, subject := range req.Subjects {
+				for _, pattern := range GDPRPatterns(col, subject) {
+					a.Rows += gdprRowsAffected(
+						ExecSQLWithErr(con, ctx, GDPRUpdateSQL(col), GDPRAnon(SHA1(subject)), pattern),
+					)
+				}
+			}
+		}
+		audit = append(audit, a)
+	}
+	addGDPRAudit(con, ctx, req.ID, "anonymize", audit)
+	return
+}
+
+// GDPRVerify - counts rows still matching request subjects in all registry columns, writes audit log
+// Returns counts per column, request is fully anonymized in this database when all counts are zero
+func GDPRVerify(con *sql.DB, ctx *Ctx, req *GDPRRequest, registry []GDPRColumn) (audit []GDPRAudit) {
+	for _, col := range registry {
+		a := GDPRAudit{Column: col}
+		if col.Kind == GDPRExact {
+			FatalOnError(QueryRowSQL(con, ctx, GDPRCountSQL(col), "{"+strings.Join(req.SHAs, ",")+"}").Scan(&a.Rows))
+		} else {
+			for _, subject := range req.Subjects {
+				for _, pattern := range GDPRPatterns(col, subject) {
+					var rows int64
+					FatalOnError(QueryRowSQL(con, ctx, GDPRCountSQL(col), pattern).Scan(&rows))
+					a.Rows += rows
+				}
+			}
+		}
+		audit = append(audit, a)
+	}
+	addGDPRAudit(con, ctx, req.ID, "verify", audit)
+	return
+}
+
+// GDPRAuditRows - returns total number of rows from audit entries and descriptions of non-zero entries
+func GDPRAuditRows(audit []GDPRAudit) (total int64, nonZero []string) {
+	for _, a := range audit {
+		if a.Rows == 0 {
+			continue
+		}
+		total += a.Rows
+		nonZero = append(nonZero, fmt.Sprintf("%s.%s (%s): %d", a.Column.Table, a.Column.Column, a.Column.Kind, a.Rows))
+	}
+	sort.Strings(nonZero)
+	return
+}
+
+// gdprRowsAffected - returns number of rows affected by update
+func gdprRowsAffected(res sql.Result) int64 {
+	rows, err := res.RowsAffected()
+	FatalOnError(err)
+	return rows
+}
@@ -0,0 +1,156 @@
+package devstats
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestGDPRColumnKind(t *testing.T) {
+	var testCases = []struct {
+		table, column, dataType string
+		expected                string
+	}{
+		{"gha_actors", "login", "character varying", lib.GDPRExact},
+		{"gha_actors", "name", "character varying", lib.GDPRExact},
+		{"gha_actors_emails", "email", "character varying", lib.GDPRExact},
+		{"gha_actors_affiliations", "company_name", "character varying", lib.GDPRExact},
+		{"gha_companies", "name", "character varying", lib.GDPRExact},
+		{"gha_commits", "author_name", "character varying", lib.GDPRExact},
+		{"gha_commits", "author_email", "character varying", lib.GDPRExact},
+		{"gha_milestones", "dupn_creator_login", "character varying", lib.GDPRExact},
+		{"gha_branches", "dupn_forkee_name", "character varying", lib.GDPRExact},
+		{"gha_texts", "actor_login", "character varying", lib.GDPRExact},
+		{"gha_texts", "body", "text", lib.GDPRPattern},
+		{"gha_commits", "message", "text", lib.GDPRPattern},
+		{"gha_issues", "title", "text", lib.GDPRPattern},
+		{"gha_raw_events", "payload", "jsonb", lib.GDPRPattern},
+		{"gha_pages", "title", "character varying", ""},
+		{"gha_repos", "name", "character varying", ""},
+		{"gha_labels", "name", "character varying", ""},
+		{"gha_events", "dup_repo_name", "character varying", ""},
+		{"gha_events", "dup_actor_id", "bigint", ""},
+		{"gha_gdpr_requests", "subjects", "text", ""},
+		{"sdevs", "login", "character varying", ""},
+	}
+	for _, test := range testCases {
+		got := lib.GDPRColumnKind(test.table, test.column, test.dataType)
+		if got != test.expected {
+			t.Errorf("%s.%s (%s): expected '%s', got '%s'", test.table, test.column, test.dataType, test.expected, got)
+		}
+	}
+}
+
+func TestGDPRTextPattern(t *testing.T) {
+	anon := lib.GDPRAnon(lib.SHA1("john-doe"))
+	var testCases = []struct {
+		identifier, text, expected string
+	}{
+		{"john-doe", "LGTM @john-doe, thanks", "LGTM @" + anon + ", thanks"},
+		{"john-doe", "@John-Doe.", "@" + anon + "."},
+		{"john-doe", "/assign @john-doe\ncc @john-doe", "/assign @" + anon + "\ncc @" + anon},
+		{"john-doe", "John-Doe. /assign john-doe", "John-Doe. /assign john-doe"},
+		{"john-doe", "@john-doe2 and @big-john-doe and @john-doe_x and me@john-doe", "@john-doe2 and @big-john-doe and @john-doe_x and me@john-doe"},
+		{"john.doe+k8s@example.com", "Signed-off-by: John <john.doe+k8s@example.com>", "Signed-off-by: John <" + anon + ">"},
+		{"john.doe+k8s@example.com", "johnXdoe+k8s@exampleYcom", "johnXdoe+k8s@exampleYcom"},
+		{"doe@example.com", "john.doe@example.com", "john.doe@example.com"},
+	}
+	for _, test := range testCases {
+		re := regexp.MustCompile("(?i)" + lib.GDPRTextPattern(test.identifier))
+		got := re.ReplaceAllString(test.text, "${1}"+anon+"${2}")
+		if got != test.expected {
+			t.Errorf("'%s' in '%s': expected '%s', got '%s'", test.identifier, test.text, test.expected, got)
+		}
+	}
+	// Names and other identifiers are not searched for in texts
+	for _, identifier := range []string{"John Doe", "", "john_doe"} {
+		if pattern := lib.GDPRTextPattern(identifier); pattern != "" {
+			t.Errorf("'%s': expected no text pattern, got '%s'", identifier, pattern)
+		}
+	}
+	if lib.SHA1("hide_me") != "f6f9480eb4f34372a4860c829cc5bc5fc1549a1c" {
+		t.Errorf("unexpected SHA1: %s", lib.SHA1("hide_me"))
+	}
+}
+
+func TestGDPRJSONPattern(t *testing.T) {
+	// Raw event payload as returned by Postgres `payload::text`
+	payload := `{"id": "1", "actor": {"id": 7, "login": "John-Doe", "avatar_url": "https://x/john-doe"}, ` +
+		`"payload": {"commits": [{"author": {"name": "John Doe", "email": "john.doe@example.com"}}], ` +
+		`"comment": {"body": "LGTM @john-doe, John Doe is not a login", "user": {"login": "john-doe"}}, "ref": "john-doe2"}}`
+	expected := `{"id": "1", "actor": {"id": 7, "login": "%[1]s", "avatar_url": "https://x/john-doe"}, ` +
+		`"payload": {"commits": [{"author": {"name": "%[2]s", "email": "%[3]s"}}], ` +
+		`"comment": {"body": "LGTM @%[1]s, John Doe is not a login", "user": {"login": "%[1]s"}}, "ref": "john-doe2"}}`
+	col := lib.GDPRColumn{Table: "gha_raw_events", Column: "payload", Type: "jsonb", Kind: lib.GDPRPattern}
+	subjects := []string{"john-doe", "John Doe", "john.doe@example.com"}
+	anons := []interface{}{}
+	got := payload
+	for _, subject := range subjects {
+		anon := lib.GDPRAnon(lib.SHA1(subject))
+		anons = append(anons, anon)
+		for _, pattern := range lib.GDPRPatterns(col, subject) {
+			got = regexp.MustCompile("(?i)"+pattern).ReplaceAllString(got, "${1}"+anon+"${2}")
+		}
+	}
+	if exp := fmt.Sprintf(expected, anons...); got != exp {
+		t.Errorf("expected:\n%s\ngot:\n%s", exp, got)
+	}
+	// Verify finds nothing after anonymization
+	for _, subject := range subjects {
+		for _, pattern := range lib.GDPRPatterns(col, subject) {
+			if regexp.MustCompile("(?i)" + pattern).MatchString(got) {
+				t.Errorf("'%s' still matches '%s'", subject, pattern)
+			}
+		}
+	}
+	// Text columns only use text patterns
+	if patterns := lib.GDPRPatterns(lib.GDPRColumn{Table: "gha_texts", Column: "body", Type: "text"}, "John Doe"); len(patterns) != 0 {
+		t.Errorf("expected no patterns for a name in text column, got %+v", patterns)
+	}
+	if pattern := lib.GDPRJSONPattern(`a"b\c`); pattern != `([^\\]")a\\"b\\\\c(")` {
+		t.Errorf("unexpected JSON pattern: %s", pattern)
+	}
+}
+
+func TestGDPRSQL(t *testing.T) {
+	var testCases = []struct {
+		col           lib.GDPRColumn
+		update, count string
+	}{
+		{
+			col:    lib.GDPRColumn{Table: "gha_actors", Column: "login", Type: "character varying", Kind: lib.GDPRExact},
+			update: "update gha_actors set login = $1 where encode(digest(login, 'sha1'), 'hex') = $2",
+			count:  "select count(*) from gha_actors where encode(digest(login, 'sha1'), 'hex') = any($1)",
+		},
+		{
+			col:    lib.GDPRColumn{Table: "gha_texts", Column: "body", Type: "text", Kind: lib.GDPRPattern},
+			update: `update gha_texts set body = regexp_replace(body, $2, '\1' || $1 || '\2', 'gi') where body ~* $2`,
+			count:  "select count(*) from gha_texts where body ~* $1",
+		},
+		{
+			col:    lib.GDPRColumn{Table: "gha_raw_events", Column: "payload", Type: "jsonb", Kind: lib.GDPRPattern},
+			update: `update gha_raw_events set payload = (regexp_replace(payload::text, $2, '\1' || $1 || '\2', 'gi'))::jsonb where payload::text ~* $2`,
+			count:  "select count(*) from gha_raw_events where payload::text ~* $1",
+		},
+	}
+	for _, test := range testCases {
+		if got := lib.GDPRUpdateSQL(test.col); got != test.update {
+			t.Errorf("expected:\n%s\ngot:\n%s", test.update, got)
+		}
+		if got := lib.GDPRCountSQL(test.col); got != test.count {
+			t.Errorf("expected:\n%s\ngot:\n%s", test.count, got)
+		}
+	}
+	total, nonZero := lib.GDPRAuditRows(
+		[]lib.GDPRAudit{
+			{Column: lib.GDPRColumn{Table: "gha_texts", Column: "body", Kind: lib.GDPRPattern}, Rows: 3},
+			{Column: lib.GDPRColumn{Table: "gha_actors", Column: "login", Kind: lib.GDPRExact}, Rows: 0},
+			{Column: lib.GDPRColumn{Table: "gha_actors", Column: "name", Kind: lib.GDPRExact}, Rows: 1},
+		},
+	)
+	if total != 4 || len(nonZero) != 2 || nonZero[0] != "gha_actors.name (exact): 1" {
+		t.Errorf("unexpected audit rows: %d, %+v", total, nonZero)
+	}
+}
@@ -21,19 +21,27 @@ type AllProjects struct {
 }
 
 // Project contain mapping from project name to its command line used to sync it
+// AnnotationRepos - additional repos (besides main repo) that annotations are taken from
+// AnnotationSources - annotation sources: tags (default), releases and milestones, see GetProjectAnnotations
+// QuickRangesCategories - annotation categories used to create quick ranges, default is tag and project
+// CustomDashboards - project's dashboards JSONs that are customized, `dashboards generate` doesn't overwrite them with shared templates
 type Project struct {
-	CommandLine      []string          `yaml:"command_line"`
-	StartDate        *time.Time        `yaml:"start_date"`
-	PDB              string            `yaml:"psql_db"`
-	Disabled         bool              `yaml:"disabled"`
-	MainRepo         string            `yaml:"main_repo"`
-	AnnotationRegexp string            `yaml:"annotation_regexp"`
-	Order            int               `yaml:"order"`
-	JoinDate         *time.Time        `yaml:"join_date"`
-	FilesSkipPattern string            `yaml:"files_skip_pattern"`
-	Env              map[string]string `yaml:"env"`
-	FullName         string            `yaml:"name"`
-	Status           string            `yaml:"status"`
+	CommandLine           []string          `yaml:"command_line"`
+	StartDate             *time.Time        `yaml:"start_date"`
+	PDB                   string            `yaml:"psql_db"`
+	Disabled              bool              `yaml:"disabled"`
+	MainRepo              string            `yaml:"main_repo"`
+	AnnotationRegexp      string            `yaml:"annotation_regexp"`
+	AnnotationRepos       []string          `yaml:"annotation_repos,omitempty"`
+	AnnotationSources     []string          `yaml:"annotation_sources,omitempty"`
+	QuickRangesCategories []string          `yaml:"quick_ranges_categories,omitempty"`
+	CustomDashboards      []string          `yaml:"custom_dashboards,omitempty"`
+	Order                 int               `yaml:"order"`
+	JoinDate              *time.Time        `yaml:"join_date"`
+	FilesSkipPattern      string            `yaml:"files_skip_pattern"`
+	Env                   map[string]string `yaml:"env"`
+	FullName              string            `yaml:"name"`
+	Status                string            `yaml:"status"`
 }
 
 // AnyArray - holds array of interface{} - just a shortcut
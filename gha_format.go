@@ -0,0 +1,166 @@
+package devstats
+
+import (
+	"fmt"
+	"time"
+)
+
+// GHAFormatChangeDate - GHA archives switched format on 2015-01-01, new format uses `repo` and `actor` objects
+var GHAFormatChangeDate = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IsOldFormatDate - returns true when GHA hour file (or stored raw events hour) starting at `dt` uses pre 2015 format
+// Format is detected once per hour, not for every JSON in it
+func IsOldFormatDate(dt time.Time) bool {
+	return dt.Before(GHAFormatChangeDate)
+}
+
+// OldEventID - pre 2015 GHA events have no IDs, so we synthesize them from event's type, actor, repo and date
+func OldEventID(ev *EventOld) string {
+	return fmt.Sprintf("%v", HashStrings([]string{ev.Type, ev.Actor, ev.Repository.Name, ToYMDHMSDate(ev.CreatedAt)}))
+}
+
+// OldIssue - returns issue for pre 2015 IssuesEvent and IssueCommentEvent, nil for other events
+// Old payloads only give issue's ID (and number for IssuesEvent), so other fields are copied from the last known
+// state of the issue returned by `lookup` (nil when unknown) or taken from the event: `actor` opened the issue at event's date
+func (ev *EventOld) OldIssue(actor Actor, lookup func(int) *Issue) *Issue {
+	pl := ev.Payload
+	if pl == nil || (ev.Type != "IssuesEvent" && ev.Type != "IssueCommentEvent") {
+		return nil
+	}
+	iid := pl.Issue
+	if iid == nil {
+		iid = pl.IssueID
+	}
+	if iid == nil {
+		return nil
+	}
+	issue := Issue{State: "open", User: actor, CreatedAt: ev.CreatedAt}
+	if known := lookup(*iid); known != nil {
+		issue = *known
+	}
+	issue.ID = *iid
+	if pl.Number != nil {
+		issue.Number = *pl.Number
+	}
+	issue.UpdatedAt = ev.CreatedAt
+	if ev.Type == "IssueCommentEvent" {
+		issue.Comments++
+	} else if pl.Action != nil {
+		switch *pl.Action {
+		case "closed":
+			closedAt := ev.CreatedAt
+			issue.State = "closed"
+			issue.ClosedAt = &closedAt
+		case "opened", "reopened":
+			issue.State = "open"
+			issue.ClosedAt = nil
+		}
+	}
+	return &issue
+}
+
+// OldComment - returns payload's comment, pre 2015 IssueCommentEvent only gives comment's ID
+// Its body is not available, `actor` wrote it at event's date
+func (ev *EventOld) OldComment(actor Actor) *Comment {
+	pl := ev.Payload
+	if pl == nil {
+		return nil
+	}
+	if pl.Comment != nil || pl.CommentID == nil {
+		return pl.Comment
+	}
+	return &Comment{ID: *pl.CommentID, CreatedAt: ev.CreatedAt, UpdatedAt: ev.CreatedAt, User: actor}
+}
+
+// Row - returns `gha_payloads` columns from `push_id` to `member_id`
+func (pl *Payload) Row() AnyArray {
+	return AnyArray{
+		IntOrNil(pl.PushID),
+		IntOrNil(pl.Size),
+		TruncStringOrNil(pl.Ref, 200),
+		StringOrNil(pl.Head),
+		StringOrNil(pl.Before),
+		StringOrNil(pl.Action),
+		IssueIDOrNil(pl.Issue),
+		PullRequestIDOrNil(pl.PullRequest),
+		CommentIDOrNil(pl.Comment),
+		StringOrNil(pl.RefType),
+		TruncStringOrNil(pl.MasterBranch, 200),
+		nil,
+		TruncStringOrNil(pl.Description, 0xffff),
+		IntOrNil(pl.Number),
+		ForkeeIDOrNil(pl.Forkee),
+		ReleaseIDOrNil(pl.Release),
+		ActorIDOrNil(pl.Member),
+	}
+}
+
+// Row - returns `gha_payloads` columns from `push_id` to `member_id` for pre 2015 payload
+// Old payloads have no `push_id` and `before`, issue and comment can be given as IDs only
+func (pl *PayloadOld) Row() AnyArray {
+	iid := FirstIntOrNil([]*int{pl.Issue, pl.IssueID})
+	cid := CommentIDOrNil(pl.Comment)
+	if cid == nil {
+		cid = IntOrNil(pl.CommentID)
+	}
+	return AnyArray{
+		nil,
+		IntOrNil(pl.Size),
+		TruncStringOrNil(pl.Ref, 200),
+		StringOrNil(pl.Head),
+		nil,
+		StringOrNil(pl.Action),
+		iid,
+		PullRequestIDOrNil(pl.PullRequest),
+		cid,
+		StringOrNil(pl.RefType),
+		TruncStringOrNil(pl.MasterBranch, 200),
+		StringOrNil(pl.Commit),
+		TruncStringOrNil(pl.Description, 0xffff),
+		IntOrNil(pl.Number),
+		ForkeeIDOrNil(pl.Repository),
+		ReleaseIDOrNil(pl.Release),
+		ActorIDOrNil(pl.Member),
+	}
+}
+
+// GitCommits - returns payload's commits
+func (pl *Payload) GitCommits() []Commit {
+	if pl.Commits == nil {
+		return []Commit{}
+	}
+	return *pl.Commits
+}
+
+// GitCommits - returns pre 2015 payload's commits, they're given as `shas` arrays:
+// [sha, author email, message, author name, distinct]
+func (pl *PayloadOld) GitCommits() []Commit {
+	commits := []Commit{}
+	if pl.SHAs == nil {
+		return commits
+	}
+	for _, comm := range *pl.SHAs {
+		commit, ok := comm.([]interface{})
+		if !ok || len(commit) < 5 {
+			Fatalf("comm is not []interface{} with 5 items: %+v", comm)
+		}
+		sha, ok := commit[0].(string)
+		if !ok {
+			Fatalf("commit[0] is not string: %+v", commit[0])
+		}
+		email, _ := commit[1].(string)
+		message, _ := commit[2].(string)
+		name, _ := commit[3].(string)
+		distinct, _ := commit[4].(bool)
+		commits = append(
+			commits,
+			Commit{
+				SHA:      sha,
+				Author:   Author{Name: name, Email: email},
+				Message:  message,
+				Distinct: distinct,
+			},
+		)
+	}
+	return commits
+}
@@ -0,0 +1,158 @@
+package devstats
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+// Pre 2015 IssuesEvent that opens the issue commented in `testlib.GHAFormatEvents`, it only gives issue's ID and number
+const testOldIssueOpened = `{"created_at":"2014-12-31T14:00:00-08:00","payload":{"action":"opened","issue":800,"number":8},` +
+	`"public":true,"type":"IssuesEvent","actor":"bob","repository":{"id":10,"name":"repo","owner":"org","organization":"org"}}`
+
+// TestOldFormatReparse - stores the same events in old and new GHA formats as raw events, reparses them with
+// `gha2db reparse` (it must be installed) and compares typed tables rows written for both formats
+func TestOldFormatReparse(t *testing.T) {
+	// Environment context parse
+	var ctx lib.Ctx
+	ctx.Init()
+
+	// Do not allow to run tests in "gha" database
+	if ctx.PgDB != "dbtest" {
+		t.Errorf("tests can only be run on \"dbtest\" database")
+		return
+	}
+
+	// Drop database if exists
+	lib.DropDatabaseIfExists(&ctx)
+
+	// Create database if needed
+	createdDatabase := lib.CreateDatabaseIfNeeded(&ctx)
+	if !createdDatabase {
+		t.Errorf("failed to create database \"%s\"", ctx.PgDB)
+	}
+
+	// Drop database after tests
+	defer func() {
+		// Drop database after tests
+		lib.DropDatabaseIfExists(&ctx)
+	}()
+
+	// Connect to Postgres DB
+	c := lib.PgConn(&ctx)
+	defer func() { lib.FatalOnError(c.Close()) }()
+
+	// Create DB structure
+	lib.Structure(&ctx)
+
+	// Store raw events, old issue is opened before all other events
+	ids := make(map[string][2]string)
+	writeTestRawEvent(c, &ctx, "-1", testOldIssueOpened, true)
+	for _, test := range testlib.GHAFormatEvents {
+		var ev lib.Event
+		lib.FatalOnError(json.Unmarshal([]byte(test.New), &ev))
+		ids[test.Name] = [2]string{
+			writeTestRawEvent(c, &ctx, ev.ID, test.New, false),
+			writeTestRawEvent(c, &ctx, "", test.Old, true),
+		}
+	}
+
+	// Rebuild typed tables from raw events, hours are processed one by one, so the opened issue is known later
+	_, err := lib.ExecCommand(&ctx, []string{"gha2db", "reparse"}, map[string]string{"GHA2DB_ST": "1"})
+	if err != nil {
+		t.Fatalf("gha2db reparse failed: %v", err)
+	}
+
+	// Columns that differ between formats are skipped: IDs, dates, columns only one format has and
+	// old repository names (they have no organization) and issue titles (old payloads only give issue IDs)
+	queries := map[string]string{
+		"gha_events":        "select type, dup_actor_login, public from gha_events where id = %s",
+		"gha_payloads":      "select size, ref, head, action, issue_id, pull_request_id, comment_id, number from gha_payloads where event_id = %s",
+		"gha_commits":       "select sha, author_name, message, is_distinct from gha_commits where event_id = %s order by sha",
+		"gha_pull_requests": "select id, number, state, title, dup_user_login from gha_pull_requests where event_id = %s",
+		"gha_issues":        "select id, number, state, dup_user_login, comments from gha_issues where event_id = %s and id > 0",
+		"gha_comments":      "select id, body, dup_user_login from gha_comments where event_id = %s",
+	}
+	for _, test := range testlib.GHAFormatEvents {
+		for table, query := range queries {
+			rows := getTestEventRows(c, &ctx, query, ids[test.Name][0])
+			rowsOld := getTestEventRows(c, &ctx, query, ids[test.Name][1])
+			// Old IssueCommentEvent has no comment's body
+			if table == "gha_comments" {
+				for _, row := range rows {
+					row[1] = ""
+				}
+			}
+			if !reflect.DeepEqual(rows, rowsOld) {
+				t.Errorf("%s: different %s rows:\n%+v\n%+v", test.Name, table, rows, rowsOld)
+			}
+		}
+	}
+
+	// Old IssuesEvent only gives issue's ID and number
+	expected := [][]string{{"800", "8", "open", "bob", "0"}}
+	if got := getTestEventRows(c, &ctx, queries["gha_issues"], "-1"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("opened issue: expected %+v, got %+v", expected, got)
+	}
+}
+
+// writeTestRawEvent - stores a single test event in `gha_raw_events` and returns its ID
+// Old format events get artificial IDs unless `eid` is given
+func writeTestRawEvent(c *sql.DB, ctx *lib.Ctx, eid, jsonStr string, oldFmt bool) string {
+	var (
+		dt    time.Time
+		repo  string
+		eType string
+		ev    lib.Event
+		evOld lib.EventOld
+	)
+	if oldFmt {
+		lib.FatalOnError(json.Unmarshal([]byte(jsonStr), &evOld))
+		if eid == "" {
+			eid = lib.OldEventID(&evOld)
+		}
+		dt, repo, eType = evOld.CreatedAt, lib.MakeOldRepoName(&evOld.Repository), evOld.Type
+	} else {
+		lib.FatalOnError(json.Unmarshal([]byte(jsonStr), &ev))
+		dt, repo, eType = ev.CreatedAt, ev.Repo.Name, ev.Type
+	}
+	lib.ExecSQLWithErr(
+		c,
+		ctx,
+		"insert into gha_raw_events(id, dt, repo, type, payload) "+lib.NValues(5),
+		lib.AnyArray{eid, dt, repo, eType, lib.RawEventJSON([]byte(jsonStr))}...,
+	)
+	return eid
+}
+
+// getTestEventRows - returns given event's rows as strings, null values are returned as "<nil>"
+func getTestEventRows(c *sql.DB, ctx *lib.Ctx, query, eid string) (ret [][]string) {
+	rows := lib.QuerySQLWithErr(c, ctx, fmt.Sprintf(query, lib.NValue(1)), eid)
+	defer func() { lib.FatalOnError(rows.Close()) }()
+	columns, err := rows.Columns()
+	lib.FatalOnError(err)
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		lib.FatalOnError(rows.Scan(pointers...))
+		row := make([]string, len(columns))
+		for i, value := range values {
+			row[i] = "<nil>"
+			if value.Valid {
+				row[i] = value.String
+			}
+		}
+		ret = append(ret, row)
+	}
+	lib.FatalOnError(rows.Err())
+	return
+}
@@ -0,0 +1,168 @@
+package devstats
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+	testlib "devstats/test"
+)
+
+func TestIsOldFormatDate(t *testing.T) {
+	var testCases = []struct {
+		dt       time.Time
+		expected bool
+	}{
+		{dt: time.Date(2012, 7, 1, 0, 0, 0, 0, time.UTC), expected: true},
+		{dt: time.Date(2014, 12, 31, 23, 0, 0, 0, time.UTC), expected: true},
+		{dt: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), expected: false},
+		{dt: time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC), expected: false},
+	}
+	for index, test := range testCases {
+		if got := lib.IsOldFormatDate(test.dt); got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+	for _, test := range testlib.GHAFormatEvents {
+		var (
+			ev    lib.Event
+			evOld lib.EventOld
+		)
+		if err := json.Unmarshal([]byte(test.New), &ev); err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if err := json.Unmarshal([]byte(test.Old), &evOld); err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if lib.IsOldFormatDate(lib.HourStart(ev.CreatedAt)) {
+			t.Errorf("%s: new format event's hour detected as old", test.Name)
+		}
+		if !lib.IsOldFormatDate(lib.HourStart(evOld.CreatedAt)) {
+			t.Errorf("%s: old format event's hour not detected", test.Name)
+		}
+	}
+}
+
+func TestOldFormatParity(t *testing.T) {
+	// Columns new format only has: push_id, befor and old format only has: commit
+	formatOnly := []int{0, 4, 11}
+	for _, test := range testlib.GHAFormatEvents {
+		var (
+			ev    lib.Event
+			evOld lib.EventOld
+		)
+		if err := json.Unmarshal([]byte(test.New), &ev); err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if err := json.Unmarshal([]byte(test.Old), &evOld); err != nil {
+			t.Fatalf("%s: %v", test.Name, err)
+		}
+		if ev.Type != evOld.Type || ev.Repo.Name != lib.MakeOldRepoName(&evOld.Repository) || ev.Actor.Login != evOld.Actor {
+			t.Errorf("%s: different events: %+v, %+v", test.Name, ev, evOld)
+		}
+		if ev.CreatedAt.Sub(evOld.CreatedAt) != time.Hour {
+			t.Errorf("%s: different creation dates: %v, %v", test.Name, ev.CreatedAt, evOld.CreatedAt)
+		}
+
+		// gha_payloads
+		row, rowOld := ev.Payload.Row(), evOld.Payload.Row()
+		if len(row) != 17 || len(rowOld) != 17 {
+			t.Fatalf("%s: expected 17 payload columns, got %d, %d", test.Name, len(row), len(rowOld))
+		}
+		for _, i := range formatOnly {
+			row[i], rowOld[i] = nil, nil
+		}
+		if !reflect.DeepEqual(row, rowOld) {
+			t.Errorf("%s: different payloads:\n%+v\n%+v", test.Name, row, rowOld)
+		}
+
+		// gha_commits
+		if commits, commitsOld := ev.Payload.GitCommits(), evOld.Payload.GitCommits(); !reflect.DeepEqual(commits, commitsOld) {
+			t.Errorf("%s: different commits:\n%+v\n%+v", test.Name, commits, commitsOld)
+		}
+
+		// gha_pull_requests
+		pr, prOld := ev.Payload.PullRequest, evOld.Payload.PullRequest
+		if (pr == nil) != (prOld == nil) || (pr != nil && (pr.ID != prOld.ID || pr.Number != prOld.Number || pr.State != prOld.State)) {
+			t.Errorf("%s: different pull requests: %+v, %+v", test.Name, pr, prOld)
+		}
+
+		// gha_issues, old payloads only give IDs, other data comes from the last known issue state (before this event)
+		known := func(iid int) *lib.Issue {
+			if ev.Payload.Issue == nil || ev.Payload.Issue.ID != iid {
+				return nil
+			}
+			issue := *ev.Payload.Issue
+			issue.Comments--
+			return &issue
+		}
+		actorOld := lib.Actor{ID: ev.Actor.ID, Login: evOld.Actor}
+		issue, issueOld := ev.Payload.Issue, evOld.OldIssue(actorOld, known)
+		if (issue == nil) != (issueOld == nil) ||
+			(issue != nil && (issue.ID != issueOld.ID || issue.Number != issueOld.Number || issue.Title != issueOld.Title ||
+				issue.User != issueOld.User || issue.Comments != issueOld.Comments || !issueOld.UpdatedAt.Equal(evOld.CreatedAt))) {
+			t.Errorf("%s: different issues: %+v, %+v", test.Name, issue, issueOld)
+		}
+
+		// gha_comments, old payloads only give IDs
+		comment, commentOld := ev.Payload.Comment, evOld.OldComment(actorOld)
+		if (comment == nil) != (commentOld == nil) ||
+			(comment != nil && (comment.ID != commentOld.ID || comment.User != commentOld.User || !commentOld.CreatedAt.Equal(evOld.CreatedAt))) {
+			t.Errorf("%s: different comments: %+v, %+v", test.Name, comment, commentOld)
+		}
+	}
+}
+
+func TestOldIssue(t *testing.T) {
+	dt := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+	actor := lib.Actor{ID: 1, Login: "alice"}
+	var testCases = []struct {
+		json     string
+		expected *lib.Issue
+	}{
+		{
+			json:     `{"type":"IssuesEvent","payload":{"action":"opened","issue":800,"number":8}}`,
+			expected: &lib.Issue{ID: 800, Number: 8, State: "open", User: actor, CreatedAt: dt, UpdatedAt: dt},
+		},
+		{
+			json:     `{"type":"IssuesEvent","payload":{"action":"closed","issue":800,"number":8}}`,
+			expected: &lib.Issue{ID: 800, Number: 8, State: "closed", User: actor, CreatedAt: dt, UpdatedAt: dt, ClosedAt: &dt},
+		},
+		{
+			json:     `{"type":"IssueCommentEvent","payload":{"action":"created","issue_id":800,"comment_id":900}}`,
+			expected: &lib.Issue{ID: 800, Comments: 1, State: "open", User: actor, CreatedAt: dt, UpdatedAt: dt},
+		},
+		{json: `{"type":"IssuesEvent","payload":{"action":"opened"}}`},
+		{json: `{"type":"PullRequestEvent","payload":{"action":"opened","number":8}}`},
+		{json: `{"type":"IssuesEvent"}`},
+	}
+	unknown := func(int) *lib.Issue { return nil }
+	for index, test := range testCases {
+		var ev lib.EventOld
+		if err := json.Unmarshal([]byte(test.json), &ev); err != nil {
+			t.Fatal(err)
+		}
+		ev.CreatedAt = dt
+		got := ev.OldIssue(actor, unknown)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestOldEventID(t *testing.T) {
+	var ev1, ev2 lib.EventOld
+	if err := json.Unmarshal([]byte(testlib.GHAFormatEvents[0].Old), &ev1); err != nil {
+		t.Fatal(err)
+	}
+	ev2 = ev1
+	if lib.OldEventID(&ev1) != lib.OldEventID(&ev2) {
+		t.Errorf("expected the same IDs for the same events")
+	}
+	ev2.Type = "CreateEvent"
+	if lib.OldEventID(&ev1) == lib.OldEventID(&ev2) {
+		t.Errorf("expected different IDs for different events")
+	}
+}
@@ -4,14 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 // IssueConfig - holds issue data
@@ -31,6 +29,9 @@ type IssueConfig struct {
 	AssigneeID   *int64
 	Assignees    string
 	AssigneesMap map[int64]string
+	// PR review decision (APPROVED, CHANGES_REQUESTED, REVIEW_REQUIRED), only available from GraphQL API
+	// Saved in gha_pull_requests.review_decision by ArtificialPREvent
+	ReviewDecision string
 }
 
 func (ic IssueConfig) String() string {
@@ -204,58 +205,64 @@ func GetRateLimits(gctx context.Context, gc *github.Client, core bool) (int, int
 	return rl.Search.Limit, rl.Search.Remaining, rl.Search.Reset.Time.Sub(time.Now()) + time.Duration(1)*time.Second
 }
 
-// GHClient - get GitHub client
+// GHClient - get GitHub client using the first configured OAuth token
+// Use `GHClientPool` to use all configured tokens
 func GHClient(ctx *Ctx) (ghCtx context.Context, client *github.Client) {
-	// Get GitHub OAuth from env or from file
-	oAuth := ctx.GitHubOAuth
-	if strings.Contains(ctx.GitHubOAuth, "/") {
-		bytes, err := ReadFile(ctx, ctx.GitHubOAuth)
-		FatalOnError(err)
-		oAuth = strings.TrimSpace(string(bytes))
-	}
-
-	// GitHub authentication or use public access
 	ghCtx = context.Background()
-	if oAuth == "-" {
-		client = github.NewClient(nil)
-	} else {
-		ts := oauth2.StaticTokenSource(
-			&oauth2.Token{AccessToken: oAuth},
-		)
-		tc := oauth2.NewClient(ghCtx, ts)
-		client = github.NewClient(tc)
-	}
+	client = ghTokenClient(ghCtx, GHTokens(ctx)[0], nil)
 	return
 }
 
+// ClassifyGHAPIError - returns GitHub API error class without exiting:
+// "" (no error), "rate", Abuse, NotFound, Unprocessable, ServerError or OtherError
+func ClassifyGHAPIError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if _, rate := err.(*github.RateLimitError); rate {
+		return "rate"
+	}
+	if _, abuse := err.(*github.AbuseRateLimitError); abuse {
+		return Abuse
+	}
+	// Secondary rate limits are not always reported as abuse errors
+	errStr := strings.ToLower(err.Error())
+	if strings.Contains(errStr, "secondary rate limit") || strings.Contains(errStr, "abuse detection") {
+		return Abuse
+	}
+	status := 0
+	if resp, ok := err.(*github.ErrorResponse); ok && resp.Response != nil {
+		status = resp.Response.StatusCode
+	}
+	switch {
+	case status == 404 || strings.Contains(errStr, "404 not found"):
+		return NotFound
+	case status == 422 || strings.Contains(errStr, "422 "):
+		return Unprocessable
+	case status >= 500 || strings.Contains(errStr, "502 server error") || strings.Contains(errStr, "503 service unavailable"):
+		return ServerError
+	}
+	return OtherError
+}
+
 // HandlePossibleError - display error specific message, detect rate limit and abuse
+// Returns error class from `ClassifyGHAPIError`, callers retry or abort depending on it
 func HandlePossibleError(err error, cfg *IssueConfig, info string) string {
-	if err != nil {
-		_, rate := err.(*github.RateLimitError)
-		_, abuse := err.(*github.AbuseRateLimitError)
-		if abuse || rate {
-			if rate {
-				Printf("Rate limit (%s) for %v\n", info, cfg)
-				return "rate"
-			}
-			if abuse {
-				Printf("Abuse detected (%s) for %v\n", info, cfg)
-				return Abuse
-			}
-		}
-		if strings.Contains(err.Error(), "404 Not Found") {
-			Printf("Not found (%s) for %v: %v\n", info, cfg, err)
-			return NotFound
-		}
-		if strings.Contains(err.Error(), "502 Server Error") {
-			Printf("Server Error (%s) for %v: %v\n", info, cfg, err)
-			return "server_error"
-		}
-		//FatalOnError(err)
-		Printf("%s error: %v, non fatal, exiting 0 status\n", os.Args[0], err)
-		os.Exit(0)
+	res := ClassifyGHAPIError(err)
+	switch res {
+	case "":
+	case "rate":
+		Printf("Rate limit (%s) for %v\n", info, cfg)
+	case Abuse:
+		Printf("Abuse detected (%s) for %v: %v\n", info, cfg, err)
+	case NotFound:
+		Printf("Not found (%s) for %v: %v\n", info, cfg, err)
+	case ServerError:
+		Printf("Server Error (%s) for %v: %v\n", info, cfg, err)
+	default:
+		Printf("Error (%s) for %v: %v\n", info, cfg, err)
 	}
-	return ""
+	return res
 }
 
 func ghActorIDOrNil(actPtr *github.User) interface{} {
@@ -463,6 +470,12 @@ func ArtificialPREvent(c *sql.DB, ctx *Ctx, cfg *IssueConfig, pr *github.PullReq
 		ghMilestone(tc, ctx, eventID, cfg, maybeHide)
 	}
 
+	// Review decision is only known when PR was fetched using GraphQL API
+	var reviewDecision interface{}
+	if cfg.ReviewDecision != "" {
+		reviewDecision = cfg.ReviewDecision
+	}
+
 	prid := *pr.ID
 	ExecSQLTxWithErr(
 		tc,
@@ -474,13 +487,13 @@ func ArtificialPREvent(c *sql.DB, ctx *Ctx, cfg *IssueConfig, pr *github.PullReq
 				"merge_commit_sha, merged, mergeable, mergeable_state, comments, "+
 				"maintainer_can_modify, commits, additions, deletions, changed_files, "+
 				"dup_actor_id, dup_actor_login, dup_repo_id, dup_repo_name, dup_type, dup_created_at, "+
-				"dup_user_login, dupn_assignee_login, dupn_merged_by_login) values("+
+				"dup_user_login, dupn_assignee_login, dupn_merged_by_login, review_decision) values("+
 				"%s, %s, %s, %s, %s, %s, %s, %s, "+
 				"%s, %s, %s, %s, %s, %s, %s, %s, "+
 				"%s, %s, %s, %s, %s, "+
 				"%s, %s, %s, %s, %s, "+
 				"%s, %s, (select max(id) from gha_repos where name = %s), %s, %s, %s, "+
-				"%s, %s, %s)",
+				"%s, %s, %s, %s)",
 			NValue(1),
 			NValue(2),
 			NValue(3),
@@ -516,6 +529,7 @@ func ArtificialPREvent(c *sql.DB, ctx *Ctx, cfg *IssueConfig, pr *github.PullReq
 			NValue(33),
 			NValue(34),
 			NValue(35),
+			NValue(36),
 		),
 		AnyArray{
 			prid,
@@ -553,6 +567,7 @@ func ArtificialPREvent(c *sql.DB, ctx *Ctx, cfg *IssueConfig, pr *github.PullReq
 			ghActorLoginOrNil(pr.User, maybeHide),
 			ghActorLoginOrNil(pr.Assignee, maybeHide),
 			ghActorLoginOrNil(pr.MergedBy, maybeHide),
+			reviewDecision,
 		}...,
 	)
 
@@ -972,7 +987,7 @@ func ArtificialEvent(c *sql.DB, ctx *Ctx, cfg *IssueConfig) (err error) {
 // manual:
 //  false: normal devstats sync cron mode using 'ghapi2db' tool
 //  true: manual sync using'sync_issues' tool
-func SyncIssuesState(gctx context.Context, gc *github.Client, ctx *Ctx, c *sql.DB, issues map[int64]IssueConfigAry, prs map[int64]github.PullRequest, manual bool) {
+func SyncIssuesState(pool *GHPool, ctx *Ctx, c *sql.DB, issues map[int64]IssueConfigAry, prs map[int64]github.PullRequest, manual bool) {
 	nIssuesBefore := 0
 	for _, issueConfig := range issues {
 		nIssuesBefore += len(issueConfig)
@@ -1444,7 +1459,7 @@ func SyncIssuesState(gctx context.Context, gc *github.Client, ctx *Ctx, c *sql.D
 		ProgressInfo(checked, nIssues, dtStart, &lastTime, time.Duration(10)*time.Second, "")
 	}
 	// Get RateLimits info
-	_, rem, wait := GetRateLimits(gctx, gc, true)
+	rem, wait := pool.RateLimits()
 	if manual {
 		Printf(
 			"ghapi2db.go: Manually processed %d issues/PRs (%d new issues, existing: %d not needed, %d added): %d API points remain, resets in %v\n",
@@ -2021,7 +2036,7 @@ func SyncIssuesState(gctx context.Context, gc *github.Client, ctx *Ctx, c *sql.D
 		ProgressInfo(checked, nIssues, dtStart, &lastTime, time.Duration(10)*time.Second, "")
 	}
 	// Get RateLimits info
-	_, rem, wait = GetRateLimits(gctx, gc, true)
+	rem, wait = pool.RateLimits()
 	if manual {
 		Printf(
 			"ghapi2db.go: Manually processed %d PRs (%d new PRs, existing: %d not needed, %d added): %d API points remain, resets in %v\n",
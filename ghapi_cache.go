@@ -0,0 +1,269 @@
+package devstats
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GHCache - HTTP transport caching GitHub API GET responses on disk
+// It stores ETag and Last-Modified headers with response bodies and sends conditional requests
+// GitHub answers with "304 Not Modified" when data didn't change, such responses don't use API points
+// Cache key is a request method, URL, Accept header and token fingerprint, so responses are never shared between tokens
+// Tokens are not saved, cache file names are SHA1 hashes of cache keys
+// When MaxSize is set, least recently used responses are evicted when cache grows over it
+// It is safe for concurrent use
+type GHCache struct {
+	requests  int64
+	hits      int64
+	Dir       string
+	MaxSize   int64
+	Transport http.RoundTripper
+	mtx       sync.Mutex
+	size      int64
+}
+
+// ghCacheEntry - single cached response saved as a JSON file
+type ghCacheEntry struct {
+	URL    string      `json:"url"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// ghCacheEvictRatio - eviction removes least recently used responses until cache size is below this percent of MaxSize
+const ghCacheEvictRatio = 90
+
+// ghCacheFile - cache file name, size and last use time
+type ghCacheFile struct {
+	name string
+	size int64
+	used time.Time
+}
+
+// NewGHCache - creates caching transport using a given directory and maximum size in bytes (0 means unlimited)
+// Returns nil when directory is empty (cache disabled)
+func NewGHCache(dir string, maxSize int64) *GHCache {
+	if dir == "" {
+		return nil
+	}
+	FatalOnError(os.MkdirAll(dir, 0700))
+	c := &GHCache{Dir: dir, MaxSize: maxSize, Transport: http.DefaultTransport}
+	files, err := c.files()
+	FatalOnError(err)
+	for _, file := range files {
+		c.size += file.size
+	}
+	if c.MaxSize > 0 && c.size > c.MaxSize {
+		c.evict()
+	}
+	return c
+}
+
+// ghCacheTokenFingerprint - returns token fingerprint (hash of Authorization header), empty for public access
+func ghCacheTokenFingerprint(req *http.Request) string {
+	auth := req.Header.Get("Authorization")
+	if auth == "" {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha1.Sum([]byte(auth)))
+}
+
+// fileName - returns cache file name for a given request
+func (c *GHCache) fileName(req *http.Request) string {
+	key := req.Method + " " + req.URL.String() + " " + req.Header.Get("Accept") + " " + ghCacheTokenFingerprint(req)
+	return filepath.Join(c.Dir, fmt.Sprintf("%x.json", sha1.Sum([]byte(key))))
+}
+
+// files - returns all cache files
+func (c *GHCache) files() (files []ghCacheFile, err error) {
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		files = append(files, ghCacheFile{name: filepath.Join(c.Dir, info.Name()), size: info.Size(), used: info.ModTime()})
+	}
+	return
+}
+
+// evict - removes least recently used responses until cache size is below ghCacheEvictRatio percent of MaxSize
+// Errors are not fatal, cache size is recomputed from files present
+func (c *GHCache) evict() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	files, err := c.files()
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	size := int64(0)
+	for _, file := range files {
+		size += file.size
+	}
+	limit := c.MaxSize * ghCacheEvictRatio / 100
+	for _, file := range files {
+		if size <= limit {
+			break
+		}
+		if os.Remove(file.name) == nil {
+			size -= file.size
+		}
+	}
+	c.size = size
+}
+
+// used - marks cache file as recently used (file modification time is the last use time)
+func (c *GHCache) used(fn string) {
+	now := time.Now()
+	_ = os.Chtimes(fn, now, now)
+}
+
+// read - reads cached entry, returns nil when not found or invalid
+func (c *GHCache) read(fn string) *ghCacheEntry {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil
+	}
+	var entry ghCacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil
+	}
+	return &entry
+}
+
+// write - saves entry atomically (via a temporary file), errors are not fatal, entry is just not cached
+func (c *GHCache) write(fn string, entry *ghCacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	oldSize := int64(0)
+	if info, err := os.Stat(fn); err == nil {
+		oldSize = info.Size()
+	}
+	tmp, err := ioutil.TempFile(c.Dir, "tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return
+	}
+	c.mtx.Lock()
+	c.size += int64(len(data)) - oldSize
+	over := c.MaxSize > 0 && c.size > c.MaxSize
+	c.mtx.Unlock()
+	if over {
+		c.evict()
+	}
+}
+
+// RoundTrip - implements http.RoundTripper
+func (c *GHCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Rate limits must always be fresh
+	if req.Method != "GET" || strings.HasSuffix(req.URL.Path, "/rate_limit") {
+		return c.Transport.RoundTrip(req)
+	}
+	atomic.AddInt64(&c.requests, 1)
+	fn := c.fileName(req)
+	entry := c.read(fn)
+	if entry != nil && entry.URL == req.URL.String() {
+		// Request can be reused by the caller, so modify a copy
+		creq := req.WithContext(req.Context())
+		creq.Header = make(http.Header)
+		for k, v := range req.Header {
+			creq.Header[k] = v
+		}
+		if etag := entry.Header.Get("Etag"); etag != "" {
+			creq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			creq.Header.Set("If-Modified-Since", lastModified)
+		}
+		req = creq
+	} else {
+		entry = nil
+	}
+	resp, err := c.Transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		atomic.AddInt64(&c.hits, 1)
+		_ = resp.Body.Close()
+		c.used(fn)
+		// Use cached data with current rate limits headers
+		header := make(http.Header)
+		for k, v := range entry.Header {
+			header[k] = v
+		}
+		for k, v := range resp.Header {
+			if strings.HasPrefix(k, "X-Ratelimit-") {
+				header[k] = v
+			}
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+			ContentLength: int64(len(entry.Body)),
+			Request:       req,
+		}, nil
+	}
+	if resp.StatusCode != http.StatusOK || (resp.Header.Get("Etag") == "" && resp.Header.Get("Last-Modified") == "") {
+		return resp, nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	c.write(fn, &ghCacheEntry{URL: req.URL.String(), Header: resp.Header, Body: body})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// Stats - returns number of GET requests and number of requests served from cache (not modified)
+func (c *GHCache) Stats() (requests, hits int64) {
+	if c == nil {
+		return
+	}
+	return atomic.LoadInt64(&c.requests), atomic.LoadInt64(&c.hits)
+}
+
+// Summary - returns cache statistics summary
+func (c *GHCache) Summary() string {
+	if c == nil {
+		return "GitHub API cache disabled"
+	}
+	requests, hits := c.Stats()
+	ratio := 0.0
+	if requests > 0 {
+		ratio = float64(hits) * 100.0 / float64(requests)
+	}
+	return fmt.Sprintf("GitHub API cache: %d requests, %d not modified (%.1f%% hit ratio)", requests, hits, ratio)
+}
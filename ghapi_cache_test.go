@@ -0,0 +1,193 @@
+package devstats
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestGHCache(t *testing.T) {
+	// Stub GitHub API, issue events have ETag that changes when data changes
+	var mtx sync.Mutex
+	etag := `"v1"`
+	statuses := make(map[int]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "4000")
+		switch r.URL.Path {
+		case "/rate_limit":
+			fmt.Fprintf(w, `{"resources":{"core":{"limit":5000,"remaining":4000,"reset":2000000000}}}`)
+		case "/repos/org/repo/issues/events":
+			if r.Header.Get("If-None-Match") == etag {
+				statuses[http.StatusNotModified]++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			statuses[http.StatusOK]++
+			w.Header().Set("ETag", etag)
+			fmt.Fprintf(w, `[{"id":1,"event":"labeled"},{"id":2,"event":%s}]`, etag)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "devstats_ghapi_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	var ctx lib.Ctx
+	ctx.Init()
+	ctx.GitHubOAuth = "token"
+	ctx.SkipGHAPIBudget = true
+	ctx.GHAPICacheDir = dir
+	pool := lib.GHClientPool(&ctx)
+	defer pool.Close()
+	if err = pool.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expected event type of the 2nd event and API responses statuses counts after each call
+	var testCases = []struct {
+		etag     string
+		expected string
+		statuses map[int]int
+		summary  string
+	}{
+		{
+			etag:     `"v1"`,
+			expected: "v1",
+			statuses: map[int]int{200: 1},
+			summary:  "GitHub API cache: 1 requests, 0 not modified (0.0% hit ratio)",
+		},
+		{
+			etag:     `"v1"`,
+			expected: "v1",
+			statuses: map[int]int{200: 1, 304: 1},
+			summary:  "GitHub API cache: 2 requests, 1 not modified (50.0% hit ratio)",
+		},
+		{
+			etag:     `"v2"`,
+			expected: "v2",
+			statuses: map[int]int{200: 2, 304: 1},
+			summary:  "GitHub API cache: 3 requests, 1 not modified (33.3% hit ratio)",
+		},
+		{
+			etag:     `"v2"`,
+			expected: "v2",
+			statuses: map[int]int{200: 2, 304: 2},
+			summary:  "GitHub API cache: 4 requests, 2 not modified (50.0% hit ratio)",
+		},
+	}
+	for index, test := range testCases {
+		mtx.Lock()
+		etag = test.etag
+		mtx.Unlock()
+		gctx, gc, _, _ := pool.Get()
+		events, response, err := gc.Issues.ListRepositoryEvents(gctx, "org", "repo", nil)
+		if err != nil {
+			t.Fatalf("test number %d: %v", index+1, err)
+		}
+		if len(events) != 2 || events[1].Event == nil || *events[1].Event != test.expected {
+			t.Errorf("test number %d, expected 2 events, 2nd '%s', got %+v", index+1, test.expected, events)
+		}
+		if response.Rate.Remaining != 4000 {
+			t.Errorf("test number %d, expected rate limits from response, got %+v", index+1, response.Rate)
+		}
+		mtx.Lock()
+		if fmt.Sprintf("%v", statuses) != fmt.Sprintf("%v", test.statuses) {
+			t.Errorf("test number %d, expected statuses %v, got %v", index+1, test.statuses, statuses)
+		}
+		mtx.Unlock()
+		if summary := pool.CacheSummary(); summary != test.summary {
+			t.Errorf("test number %d, expected summary '%s', got '%s'", index+1, test.summary, summary)
+		}
+	}
+}
+
+func TestGHCacheTokensAndEviction(t *testing.T) {
+	// Stub API, every response has a 1000 bytes body and ETag
+	var mtx sync.Mutex
+	notModified := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, strings.Repeat("x", 1000))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "devstats_ghapi_cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	cache := lib.NewGHCache(dir, 5000)
+	client := &http.Client{Transport: cache}
+	get := func(path, token string) {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil || len(body) != 1000 {
+			t.Fatalf("%s: expected 1000 bytes body, got %d, %v", path, len(body), err)
+		}
+	}
+	files := func() int {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(infos)
+	}
+
+	// Responses are not shared between tokens
+	get("/a", "token1")
+	get("/a", "token2")
+	get("/a", "token1")
+	if notModified != 1 || files() != 2 {
+		t.Errorf("expected 1 not modified response and 2 cache files, got %d and %d", notModified, files())
+	}
+
+	// Cache grows up to its maximum size, then least recently used responses are evicted
+	// File modification times are used as last use times, their resolution can be coarse
+	for i := 0; i < 10; i++ {
+		get(fmt.Sprintf("/b%d", i), "token1")
+		time.Sleep(time.Duration(20) * time.Millisecond)
+	}
+	if n := files(); n < 2 || n > 4 {
+		t.Errorf("expected cache files to be evicted down to 90%% of 5000 bytes, got %d files", n)
+	}
+	notModified = 0
+	get("/b9", "token1")
+	get("/b0", "token1")
+	if notModified != 1 {
+		t.Errorf("expected only the most recent response to be cached, got %d not modified", notModified)
+	}
+}
@@ -0,0 +1,423 @@
+package devstats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// GHGraphQLMaxIssues - maximum number of issues/PRs fetched by a single GraphQL query
+const GHGraphQLMaxIssues = 100
+
+// ghGraphQLFragments - fields of issues and PRs needed to create artificial events
+// The same data as returned by `Issues.Get` and `PullRequests.Get` REST API calls
+// plus PR review decision
+const ghGraphQLFragments = `
+fragment actor on Actor { login ... on User { databaseId } ... on Bot { databaseId } }
+fragment milestone on Milestone {
+  number title description state createdAt updatedAt closedAt dueOn creator { ...actor }
+  openIssues: issues(states: OPEN) { totalCount } closedIssues: issues(states: CLOSED) { totalCount }
+}
+fragment issue on Issue {
+  __typename databaseId number title body state locked createdAt updatedAt closedAt author { ...actor }
+  assignees(first: 100) { nodes { login databaseId } } labels(first: 100) { nodes { name color } }
+  milestone { ...milestone } comments { totalCount }
+}
+fragment pr on PullRequest {
+  __typename databaseId number title body state locked createdAt updatedAt closedAt author { ...actor }
+  assignees(first: 100) { nodes { login databaseId } } labels(first: 100) { nodes { name color } }
+  milestone { ...milestone } comments { totalCount }
+  merged mergedAt mergedBy { ...actor } mergeCommit { oid } mergeable maintainerCanModify
+  additions deletions changedFiles commits { totalCount } baseRefOid headRefOid reviewDecision
+  reviewRequests(first: 100) { nodes { requestedReviewer { ... on User { login databaseId } } } }
+}
+`
+
+// ghGraphQLActor - GraphQL user or bot
+type ghGraphQLActor struct {
+	Login      string `json:"login"`
+	DatabaseID *int64 `json:"databaseId"`
+}
+
+// ghGraphQLCount - GraphQL connection total count
+type ghGraphQLCount struct {
+	TotalCount int `json:"totalCount"`
+}
+
+// ghGraphQLMilestone - GraphQL milestone
+type ghGraphQLMilestone struct {
+	Number       int             `json:"number"`
+	Title        string          `json:"title"`
+	Description  *string         `json:"description"`
+	State        string          `json:"state"`
+	CreatedAt    time.Time       `json:"createdAt"`
+	UpdatedAt    time.Time       `json:"updatedAt"`
+	ClosedAt     *time.Time      `json:"closedAt"`
+	DueOn        *time.Time      `json:"dueOn"`
+	Creator      *ghGraphQLActor `json:"creator"`
+	OpenIssues   ghGraphQLCount  `json:"openIssues"`
+	ClosedIssues ghGraphQLCount  `json:"closedIssues"`
+}
+
+// ghGraphQLIssue - GraphQL issue or PR (PR only fields are empty for issues)
+type ghGraphQLIssue struct {
+	Typename   string          `json:"__typename"`
+	DatabaseID int64           `json:"databaseId"`
+	Number     int             `json:"number"`
+	Title      string          `json:"title"`
+	Body       string          `json:"body"`
+	State      string          `json:"state"`
+	Locked     bool            `json:"locked"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	ClosedAt   *time.Time      `json:"closedAt"`
+	Author     *ghGraphQLActor `json:"author"`
+	Assignees  struct {
+		Nodes []ghGraphQLActor `json:"nodes"`
+	} `json:"assignees"`
+	Labels struct {
+		Nodes []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Milestone           *ghGraphQLMilestone   `json:"milestone"`
+	Comments            ghGraphQLCount        `json:"comments"`
+	Merged              bool                  `json:"merged"`
+	MergedAt            *time.Time            `json:"mergedAt"`
+	MergedBy            *ghGraphQLActor       `json:"mergedBy"`
+	MergeCommit         *struct{ Oid string } `json:"mergeCommit"`
+	Mergeable           string                `json:"mergeable"`
+	MaintainerCanModify bool                  `json:"maintainerCanModify"`
+	Additions           int                   `json:"additions"`
+	Deletions           int                   `json:"deletions"`
+	ChangedFiles        int                   `json:"changedFiles"`
+	Commits             ghGraphQLCount        `json:"commits"`
+	BaseRefOid          string                `json:"baseRefOid"`
+	HeadRefOid          string                `json:"headRefOid"`
+	ReviewDecision      *string               `json:"reviewDecision"`
+	ReviewRequests      struct {
+		Nodes []struct {
+			RequestedReviewer *ghGraphQLActor `json:"requestedReviewer"`
+		} `json:"nodes"`
+	} `json:"reviewRequests"`
+}
+
+// ghGraphQLResponse - GraphQL response with issues/PRs keyed by "n<number>" aliases
+type ghGraphQLResponse struct {
+	Data struct {
+		Repository map[string]*ghGraphQLIssue `json:"repository"`
+	} `json:"data"`
+	Errors []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GHGraphQLError - GraphQL query returned errors (other than not found issues), HTTP request itself succeeded
+type GHGraphQLError struct {
+	Repo     string
+	Messages []string
+}
+
+// Error - implements error interface
+func (e *GHGraphQLError) Error() string {
+	return fmt.Sprintf("GraphQL query for %s failed: %s", e.Repo, strings.Join(e.Messages, ", "))
+}
+
+// GHGraphQLIDs - resolves REST API IDs that GraphQL API doesn't return
+// IssueID - ID of the issue of a given PR (GraphQL only returns PR ID), false when not known
+// LabelID - label ID for a given name and color
+// MilestoneID - milestone ID for a given repo and milestone number
+type GHGraphQLIDs struct {
+	IssueID     func(repo string, number int) (int64, bool)
+	LabelID     func(name, color string) int64
+	MilestoneID func(repo string, number int) int64
+}
+
+// GHGraphQLDBIDs - resolves REST API IDs using data already in the database
+// Unknown labels and milestones get artificial (hash) IDs, PRs with unknown issue ID should use REST API
+// Results are cached, it is safe for concurrent use
+func GHGraphQLDBIDs(con *sql.DB, ctx *Ctx) GHGraphQLIDs {
+	var mtx sync.Mutex
+	cache := make(map[string]int64)
+	lookup := func(key string, query string, args ...interface{}) (int64, bool) {
+		mtx.Lock()
+		id, ok := cache[key]
+		mtx.Unlock()
+		if ok {
+			return id, id != 0
+		}
+		rows := QuerySQLWithErr(con, ctx, query, args...)
+		defer func() { FatalOnError(rows.Close()) }()
+		for rows.Next() {
+			FatalOnError(rows.Scan(&id))
+		}
+		FatalOnError(rows.Err())
+		mtx.Lock()
+		cache[key] = id
+		mtx.Unlock()
+		return id, id != 0
+	}
+	return GHGraphQLIDs{
+		IssueID: func(repo string, number int) (int64, bool) {
+			return lookup(
+				fmt.Sprintf("i:%s:%d", repo, number),
+				"select id from gha_issues where dup_repo_name = $1 and number = $2 "+
+					"order by updated_at desc, event_id desc limit 1",
+				repo,
+				number,
+			)
+		},
+		LabelID: func(name, color string) int64 {
+			id, ok := lookup(
+				fmt.Sprintf("l:%s:%s", name, color),
+				"select id from gha_labels where name = $1 and color = $2 order by id desc limit 1",
+				name,
+				color,
+			)
+			if !ok {
+				id = int64(HashStrings([]string{name, color}))
+			}
+			return id
+		},
+		MilestoneID: func(repo string, number int) int64 {
+			id, ok := lookup(
+				fmt.Sprintf("m:%s:%d", repo, number),
+				"select id from gha_milestones where dup_repo_name = $1 and number = $2 "+
+					"order by updated_at desc, event_id desc limit 1",
+				repo,
+				number,
+			)
+			if !ok {
+				id = int64(HashStrings([]string{repo, strconv.Itoa(number)}))
+			}
+			return id
+		},
+	}
+}
+
+// GHGraphQLQuery - returns GraphQL query getting given issues/PRs numbers from a single repo
+func GHGraphQLQuery(numbers []int) string {
+	var sb strings.Builder
+	sb.WriteString("query($owner: String!, $name: String!) {\n  repository(owner: $owner, name: $name) {\n")
+	for _, number := range numbers {
+		sb.WriteString(fmt.Sprintf("    n%d: issueOrPullRequest(number: %d) { ...issue ...pr }\n", number, number))
+	}
+	sb.WriteString("  }\n}\n")
+	sb.WriteString(ghGraphQLFragments)
+	return sb.String()
+}
+
+// ghGraphQLUser - converts GraphQL actor to GitHub user, actors without database ID get artificial (hash) IDs
+// Deleted users are returned as "ghost", the same way as REST API does
+func ghGraphQLUser(actor *ghGraphQLActor) *github.User {
+	if actor == nil {
+		actor = &ghGraphQLActor{Login: "ghost"}
+		id := int64(10137)
+		actor.DatabaseID = &id
+	}
+	login := actor.Login
+	var id int64
+	if actor.DatabaseID != nil {
+		id = *actor.DatabaseID
+	} else {
+		id = int64(HashStrings([]string{login}))
+	}
+	return &github.User{ID: &id, Login: &login}
+}
+
+// ghGraphQLToMilestone - converts GraphQL milestone to GitHub milestone
+func ghGraphQLToMilestone(repo string, m *ghGraphQLMilestone, ids GHGraphQLIDs) *github.Milestone {
+	if m == nil {
+		return nil
+	}
+	id := ids.MilestoneID(repo, m.Number)
+	state := strings.ToLower(m.State)
+	milestone := &github.Milestone{
+		ID:           &id,
+		Number:       &m.Number,
+		Title:        &m.Title,
+		Description:  m.Description,
+		State:        &state,
+		CreatedAt:    &m.CreatedAt,
+		UpdatedAt:    &m.UpdatedAt,
+		ClosedAt:     m.ClosedAt,
+		DueOn:        m.DueOn,
+		OpenIssues:   &m.OpenIssues.TotalCount,
+		ClosedIssues: &m.ClosedIssues.TotalCount,
+	}
+	if m.Creator != nil {
+		milestone.Creator = ghGraphQLUser(m.Creator)
+	}
+	return milestone
+}
+
+// ghGraphQLToIssue - converts GraphQL issue/PR to GitHub issue (and PR), returns nil issue when issue ID is not known
+func ghGraphQLToIssue(repo string, node *ghGraphQLIssue, ids GHGraphQLIDs) (issue *github.Issue, pr *github.PullRequest) {
+	isPR := node.Typename == "PullRequest"
+	iid := node.DatabaseID
+	if isPR {
+		var ok bool
+		iid, ok = ids.IssueID(repo, node.Number)
+		if !ok {
+			return
+		}
+	}
+	state := strings.ToLower(node.State)
+	if state == "merged" {
+		state = "closed"
+	}
+	comments := node.Comments.TotalCount
+	issue = &github.Issue{
+		ID:        &iid,
+		Number:    &node.Number,
+		Title:     &node.Title,
+		Body:      &node.Body,
+		State:     &state,
+		Locked:    &node.Locked,
+		Comments:  &comments,
+		CreatedAt: &node.CreatedAt,
+		UpdatedAt: &node.UpdatedAt,
+		ClosedAt:  node.ClosedAt,
+		User:      ghGraphQLUser(node.Author),
+		Milestone: ghGraphQLToMilestone(repo, node.Milestone, ids),
+	}
+	for _, assignee := range node.Assignees.Nodes {
+		issue.Assignees = append(issue.Assignees, ghGraphQLUser(&assignee))
+	}
+	if len(issue.Assignees) > 0 {
+		issue.Assignee = issue.Assignees[0]
+	}
+	for _, label := range node.Labels.Nodes {
+		id := ids.LabelID(label.Name, label.Color)
+		name, color := label.Name, label.Color
+		issue.Labels = append(issue.Labels, github.Label{ID: &id, Name: &name, Color: &color})
+	}
+	if !isPR {
+		return
+	}
+	issue.PullRequestLinks = &github.PullRequestLinks{}
+	prid := node.DatabaseID
+	commits := node.Commits.TotalCount
+	baseSHA, headSHA := node.BaseRefOid, node.HeadRefOid
+	pr = &github.PullRequest{
+		ID:                  &prid,
+		Number:              issue.Number,
+		State:               issue.State,
+		Title:               issue.Title,
+		Body:                issue.Body,
+		CreatedAt:           issue.CreatedAt,
+		UpdatedAt:           issue.UpdatedAt,
+		ClosedAt:            issue.ClosedAt,
+		MergedAt:            node.MergedAt,
+		Merged:              &node.Merged,
+		MaintainerCanModify: &node.MaintainerCanModify,
+		Comments:            issue.Comments,
+		Commits:             &commits,
+		Additions:           &node.Additions,
+		Deletions:           &node.Deletions,
+		ChangedFiles:        &node.ChangedFiles,
+		User:                issue.User,
+		Assignee:            issue.Assignee,
+		Assignees:           issue.Assignees,
+		Milestone:           issue.Milestone,
+		Base:                &github.PullRequestBranch{SHA: &baseSHA},
+		Head:                &github.PullRequestBranch{SHA: &headSHA},
+	}
+	if node.MergedBy != nil {
+		pr.MergedBy = ghGraphQLUser(node.MergedBy)
+	}
+	if node.MergeCommit != nil {
+		pr.MergeCommitSHA = &node.MergeCommit.Oid
+	}
+	switch node.Mergeable {
+	case "MERGEABLE":
+		mergeable := true
+		pr.Mergeable = &mergeable
+	case "CONFLICTING":
+		mergeable := false
+		pr.Mergeable = &mergeable
+	}
+	for _, request := range node.ReviewRequests.Nodes {
+		// Teams are not users and are not stored as requested reviewers
+		if request.RequestedReviewer == nil || request.RequestedReviewer.Login == "" {
+			continue
+		}
+		pr.RequestedReviewers = append(pr.RequestedReviewers, ghGraphQLUser(request.RequestedReviewer))
+	}
+	return
+}
+
+// GHGraphQLIssues - gets up to GHGraphQLMaxIssues issues/PRs from a single repo using one GitHub GraphQL API v4 query
+// Returns issues and PRs keyed by number, PRs also have issue returned. Numbers that were not found (or PRs with
+// unknown issue ID) are not returned, so caller can use REST API for them. Review decisions are keyed by PR number
+// It uses API base URL of a given client, GitHub enterprise "/api/v3/" base URL uses "/api/graphql" endpoint
+func GHGraphQLIssues(
+	gctx context.Context, gc *github.Client, repo string, numbers []int, ids GHGraphQLIDs,
+) (issues map[int]*github.Issue, prs map[int]*github.PullRequest, reviewDecisions map[int]string, err error) {
+	if len(numbers) > GHGraphQLMaxIssues {
+		err = &GHGraphQLError{Repo: repo, Messages: []string{fmt.Sprintf("too many issues: %d > %d", len(numbers), GHGraphQLMaxIssues)}}
+		return
+	}
+	ary := strings.Split(repo, "/")
+	if len(ary) < 2 || ary[0] == "" || ary[1] == "" {
+		err = &GHGraphQLError{Repo: repo, Messages: []string{"invalid repo name"}}
+		return
+	}
+	endpoint := "graphql"
+	if strings.HasSuffix(gc.BaseURL.Path, "/v3/") {
+		endpoint = "../graphql"
+	}
+	body := map[string]interface{}{
+		"query":     GHGraphQLQuery(numbers),
+		"variables": map[string]string{"owner": ary[0], "name": ary[1]},
+	}
+	req, err := gc.NewRequest("POST", endpoint, body)
+	if err != nil {
+		return
+	}
+	var resp ghGraphQLResponse
+	_, err = gc.Do(gctx, req, &resp)
+	if err != nil {
+		return
+	}
+	// Not found issues are reported as errors with null data for their aliases
+	msgs := []string{}
+	for _, e := range resp.Errors {
+		if e.Type != "NOT_FOUND" {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	if len(msgs) > 0 {
+		err = &GHGraphQLError{Repo: repo, Messages: msgs}
+		return
+	}
+	issues = make(map[int]*github.Issue)
+	prs = make(map[int]*github.PullRequest)
+	reviewDecisions = make(map[int]string)
+	for _, number := range numbers {
+		node, ok := resp.Data.Repository[fmt.Sprintf("n%d", number)]
+		if !ok || node == nil {
+			continue
+		}
+		issue, pr := ghGraphQLToIssue(repo, node, ids)
+		if issue == nil {
+			continue
+		}
+		issues[number] = issue
+		if pr != nil {
+			prs[number] = pr
+			if node.ReviewDecision != nil {
+				reviewDecisions[number] = *node.ReviewDecision
+			}
+		}
+	}
+	return
+}
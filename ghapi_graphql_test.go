@@ -0,0 +1,157 @@
+package devstats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	lib "devstats"
+
+	"github.com/google/go-github/github"
+)
+
+// Stub GraphQL response: issue 1, PR 2, issue 3 not found, PR 4 with unknown issue ID
+const testGraphQLResponse = `{
+  "data": {
+    "repository": {
+      "n1": {
+        "__typename": "Issue", "databaseId": 1001, "number": 1, "title": "Issue", "body": "Body",
+        "state": "OPEN", "locked": false, "createdAt": "2018-01-02T10:00:00Z", "updatedAt": "2018-01-03T10:00:00Z",
+        "closedAt": null, "author": {"login": "alice", "databaseId": 11},
+        "assignees": {"nodes": [{"login": "bob", "databaseId": 12}, {"login": "alice", "databaseId": 11}]},
+        "labels": {"nodes": [{"name": "kind/bug", "color": "ff0000"}, {"name": "lgtm", "color": "00ff00"}]},
+        "milestone": {
+          "number": 3, "title": "v1.0", "description": null, "state": "OPEN",
+          "createdAt": "2018-01-01T10:00:00Z", "updatedAt": "2018-01-01T10:00:00Z", "closedAt": null, "dueOn": null,
+          "creator": {"login": "bob", "databaseId": 12}, "openIssues": {"totalCount": 5}, "closedIssues": {"totalCount": 7}
+        },
+        "comments": {"totalCount": 4}
+      },
+      "n2": {
+        "__typename": "PullRequest", "databaseId": 2002, "number": 2, "title": "PR", "body": "",
+        "state": "MERGED", "locked": false, "createdAt": "2018-01-02T10:00:00Z", "updatedAt": "2018-01-04T10:00:00Z",
+        "closedAt": "2018-01-04T10:00:00Z", "author": null,
+        "assignees": {"nodes": []}, "labels": {"nodes": []}, "milestone": null, "comments": {"totalCount": 0},
+        "merged": true, "mergedAt": "2018-01-04T10:00:00Z", "mergedBy": {"login": "k8s-ci-robot", "databaseId": 13},
+        "mergeCommit": {"oid": "abc"}, "mergeable": "UNKNOWN", "maintainerCanModify": false,
+        "additions": 10, "deletions": 2, "changedFiles": 3, "commits": {"totalCount": 1},
+        "baseRefOid": "base", "headRefOid": "head", "reviewDecision": "APPROVED",
+        "reviewRequests": {"nodes": [{"requestedReviewer": {"login": "carol", "databaseId": 14}}, {"requestedReviewer": {}}]}
+      },
+      "n3": null,
+      "n4": {
+        "__typename": "PullRequest", "databaseId": 4004, "number": 4, "title": "New PR", "body": "",
+        "state": "OPEN", "locked": false, "createdAt": "2018-01-02T10:00:00Z", "updatedAt": "2018-01-02T10:00:00Z",
+        "assignees": {"nodes": []}, "labels": {"nodes": []}, "comments": {"totalCount": 0}
+      }
+    }
+  },
+  "errors": [{"type": "NOT_FOUND", "path": ["repository", "n3"], "message": "Could not resolve to an issue or pull request with the number of 3."}]
+}`
+
+func TestGHGraphQLIssues(t *testing.T) {
+	// Stub GitHub GraphQL API
+	paths := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		var req struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "POST" || json.Unmarshal(body, &req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Variables["owner"] != "org" || req.Variables["name"] != "repo" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"errors":[{"type":"NOT_FOUND","message":"no repo"},{"type":"FORBIDDEN","message":"forbidden"}]}`)
+			return
+		}
+		for _, alias := range []string{"n1: issueOrPullRequest(number: 1)", "n4: issueOrPullRequest(number: 4)", "fragment pr on PullRequest"} {
+			if !strings.Contains(req.Query, alias) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, testGraphQLResponse)
+	}))
+	defer server.Close()
+
+	// REST API IDs that GraphQL doesn't return
+	ids := lib.GHGraphQLIDs{
+		IssueID: func(repo string, number int) (int64, bool) {
+			if repo == "org/repo" && number == 2 {
+				return 1002, true
+			}
+			return 0, false
+		},
+		LabelID:     func(name, color string) int64 { return int64(len(name)) },
+		MilestoneID: func(repo string, number int) int64 { return int64(100 + number) },
+	}
+
+	gc := github.NewClient(nil)
+	gc.BaseURL, _ = url.Parse(server.URL + "/")
+	issues, prs, decisions, err := lib.GHGraphQLIssues(context.Background(), gc, "org/repo", []int{1, 2, 3, 4}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 2 || len(prs) != 1 || len(decisions) != 1 {
+		t.Fatalf("expected 2 issues, 1 PR and 1 review decision, got %d, %d, %d", len(issues), len(prs), len(decisions))
+	}
+
+	// Issue
+	issue := issues[1]
+	if issue == nil || *issue.ID != 1001 || *issue.State != "open" || *issue.Comments != 4 || issue.IsPullRequest() {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+	if *issue.User.Login != "alice" || *issue.Assignee.ID != 12 || len(issue.Assignees) != 2 {
+		t.Errorf("unexpected issue author or assignees: %+v", issue)
+	}
+	if len(issue.Labels) != 2 || *issue.Labels[0].ID != 8 || *issue.Labels[1].Name != "lgtm" {
+		t.Errorf("unexpected issue labels: %+v", issue.Labels)
+	}
+	m := issue.Milestone
+	if m == nil || *m.ID != 103 || *m.State != "open" || *m.OpenIssues != 5 || *m.ClosedIssues != 7 || *m.Creator.ID != 12 {
+		t.Errorf("unexpected issue milestone: %+v", m)
+	}
+
+	// PR, deleted author is a ghost
+	issue = issues[2]
+	pr := prs[2]
+	if issue == nil || *issue.ID != 1002 || *issue.State != "closed" || !issue.IsPullRequest() || *issue.User.Login != "ghost" {
+		t.Errorf("unexpected PR issue: %+v", issue)
+	}
+	if pr == nil || *pr.ID != 2002 || !*pr.Merged || *pr.MergedBy.ID != 13 || *pr.MergeCommitSHA != "abc" || pr.Mergeable != nil {
+		t.Errorf("unexpected PR: %+v", pr)
+	}
+	if *pr.Base.SHA != "base" || *pr.Head.SHA != "head" || *pr.Commits != 1 || *pr.ChangedFiles != 3 {
+		t.Errorf("unexpected PR details: %+v", pr)
+	}
+	if len(pr.RequestedReviewers) != 1 || *pr.RequestedReviewers[0].Login != "carol" || decisions[2] != "APPROVED" {
+		t.Errorf("unexpected PR reviews: %+v, %v", pr.RequestedReviewers, decisions)
+	}
+
+	// GraphQL errors other than not found
+	_, _, _, err = lib.GHGraphQLIssues(context.Background(), gc, "org/other", []int{1}, ids)
+	if e, ok := err.(*lib.GHGraphQLError); !ok || len(e.Messages) != 1 || e.Messages[0] != "forbidden" {
+		t.Errorf("expected GraphQL error, got %v", err)
+	}
+
+	// GitHub enterprise API endpoint
+	gc.BaseURL, _ = url.Parse(server.URL + "/api/v3/")
+	_, _, _, err = lib.GHGraphQLIssues(context.Background(), gc, "org/repo", []int{1, 4}, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := paths[len(paths)-1]; last != "/api/graphql" {
+		t.Errorf("expected /api/graphql endpoint, got %s", last)
+	}
+}
@@ -0,0 +1,404 @@
+package devstats
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// ghPoolRefresh - how often rate limits of each token are refreshed from GitHub API
+const ghPoolRefresh = time.Duration(60) * time.Second
+
+// ghPoolFlush - how often points spent are saved to and read from the shared budget table
+const ghPoolFlush = time.Duration(10) * time.Second
+
+// ghPoolMaxAbuseWait - maximum backoff after GitHub abuse (secondary rate limit) detection
+const ghPoolMaxAbuseWait = time.Duration(15) * time.Minute
+
+// ghPoolAbuseReset - abuse backoff counter is reset when there was no abuse detected for this time
+const ghPoolAbuseReset = time.Duration(10) * time.Minute
+
+// ghToken - single GitHub OAuth token with its client and known rate limits
+// key is a SHA1 of the token, only this value is saved in the database
+// spent is the number of points used since the last shared budget flush
+type ghToken struct {
+	key        string
+	client     *github.Client
+	remaining  int
+	spent      int
+	reset      time.Time
+	checked    time.Time
+	abuses     int
+	abuseUntil time.Time
+}
+
+// GHPool - pool of GitHub API clients, one per OAuth token
+// It always gives a client that has the most API points remaining and is not backing off after abuse detection
+// When `devstats` database has `gha_ghapi_budget` table, points spent and abuse backoffs are shared
+// between all processes using the same tokens (unless GHA2DB_SKIP_GHAPI_BUDGET is set)
+// Budgets are kept in memory and flushed to the database every ghPoolFlush by a background goroutine,
+// the pool mutex is never held during database or GitHub API calls
+// It is safe for concurrent use
+type GHPool struct {
+	ctx    *Ctx
+	gctx   context.Context
+	tokens []*ghToken
+	con    *sql.DB
+	cache  *GHCache
+	mtx    sync.Mutex
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// GHTokens - returns GitHub OAuth tokens from GHA2DB_GITHUB_OAUTH
+// It can be a token or a file name (when it contains "/"), file can contain multiple tokens, one per line
+// Empty lines and lines starting with "#" are skipped, "-" means public access
+func GHTokens(ctx *Ctx) (tokens []string) {
+	if !strings.Contains(ctx.GitHubOAuth, "/") {
+		return []string{ctx.GitHubOAuth}
+	}
+	bytes, err := ReadFile(ctx, ctx.GitHubOAuth)
+	FatalOnError(err)
+	for _, line := range strings.Split(string(bytes), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tokens = append(tokens, line)
+	}
+	if len(tokens) == 0 {
+		Fatalf("no GitHub OAuth tokens found in %s", ctx.GitHubOAuth)
+	}
+	return
+}
+
+// ghTokenClient - returns GitHub client for a given OAuth token ("-" means public access)
+// When cache is not nil, client sends conditional requests using cached responses
+func ghTokenClient(gctx context.Context, oAuth string, cache *GHCache) *github.Client {
+	var hc *http.Client
+	if cache != nil {
+		hc = &http.Client{Transport: cache}
+	}
+	if oAuth == "-" {
+		return github.NewClient(hc)
+	}
+	if hc != nil {
+		gctx = context.WithValue(gctx, oauth2.HTTPClient, hc)
+	}
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: oAuth},
+	)
+	tc := oauth2.NewClient(gctx, ts)
+	return github.NewClient(tc)
+}
+
+// GHClientPool - get GitHub clients pool for all configured OAuth tokens
+func GHClientPool(ctx *Ctx) *GHPool {
+	pool := &GHPool{ctx: ctx, gctx: context.Background(), cache: NewGHCache(ctx.GHAPICacheDir, int64(ctx.GHAPICacheMaxSize))}
+	seen := make(map[string]struct{})
+	for _, oAuth := range GHTokens(ctx) {
+		key := fmt.Sprintf("%x", sha1.Sum([]byte(oAuth)))
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		pool.tokens = append(pool.tokens, &ghToken{key: key, client: ghTokenClient(pool.gctx, oAuth, pool.cache)})
+	}
+	if !ctx.SkipGHAPIBudget {
+		dbCtx := *ctx
+		dbCtx.PgDB = Devstats
+		// Shared budget is optional: skip it when database or table is not available
+		con := PgConn(&dbCtx)
+		var table *string
+		err := QueryRowSQL(con, &dbCtx, "select to_regclass($1)", "gha_ghapi_budget").Scan(&table)
+		if err == nil && table != nil {
+			pool.con = con
+		} else {
+			_ = con.Close()
+		}
+	}
+	if pool.con != nil {
+		pool.flush()
+		pool.done = make(chan struct{})
+		pool.wg.Add(1)
+		go pool.flusher()
+	}
+	if ctx.Debug > 0 {
+		Printf("GitHub API clients pool: %d tokens, shared budget: %v\n", len(pool.tokens), pool.con != nil)
+	}
+	return pool
+}
+
+// Close - stops shared budget flushing (flushing points spent for the last time) and closes its database connection
+func (p *GHPool) Close() {
+	if p.done != nil {
+		close(p.done)
+		p.wg.Wait()
+		p.done = nil
+	}
+	if p.con != nil {
+		FatalOnError(p.con.Close())
+		p.con = nil
+	}
+}
+
+// CacheSummary - returns GitHub API responses cache statistics summary
+func (p *GHPool) CacheSummary() string {
+	return p.cache.Summary()
+}
+
+// Len - returns number of tokens in the pool
+func (p *GHPool) Len() int {
+	return len(p.tokens)
+}
+
+// MaxThreads - returns maximum number of threads that can query GitHub API using this pool
+func (p *GHPool) MaxThreads() int {
+	return p.ctx.MaxGHAPIThreads * len(p.tokens)
+}
+
+// SetBaseURL - sets API base URL of all pool's clients (GitHub enterprise or tests)
+func (p *GHPool) SetBaseURL(baseURL string) error {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	for _, t := range p.tokens {
+		t.client.BaseURL = u
+	}
+	return nil
+}
+
+// refresh - refreshes tokens rate limits from GitHub API when they're not known, old or after reset time
+// GitHub API and shared budget are queried without holding the pool mutex
+func (p *GHPool) refresh() {
+	now := time.Now()
+	stale := []*ghToken{}
+	p.mtx.Lock()
+	for _, t := range p.tokens {
+		if now.Sub(t.checked) < ghPoolRefresh && (t.remaining > p.ctx.MinGHAPIPoints || now.Before(t.reset)) {
+			continue
+		}
+		// Mark as checked, so other threads don't refresh the same token
+		t.checked = now
+		stale = append(stale, t)
+	}
+	p.mtx.Unlock()
+	for _, t := range stale {
+		_, rem, wait := GetRateLimits(p.gctx, t.client, true)
+		if rem < 0 {
+			continue
+		}
+		p.mtx.Lock()
+		// Points spent so far are already counted by GitHub
+		t.remaining = rem
+		t.reset = now.Add(wait)
+		t.spent = 0
+		p.mtx.Unlock()
+		if p.con != nil {
+			ExecSQLWithErr(
+				p.con,
+				p.ctx,
+				"insert into gha_ghapi_budget(token, remaining, reset_at, dt) "+
+					"values($1, $2, now() + $3 * interval '1 second', now()) "+
+					"on conflict(token) do update set "+
+					"remaining = excluded.remaining, reset_at = excluded.reset_at, dt = excluded.dt",
+				t.key,
+				rem,
+				int(wait.Seconds()),
+			)
+		}
+	}
+}
+
+// flusher - flushes shared budget every ghPoolFlush until pool is closed
+func (p *GHPool) flusher() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(ghPoolFlush)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			p.flush()
+			return
+		case <-ticker.C:
+			p.flush()
+		}
+	}
+}
+
+// flush - saves points spent since the last flush to the shared budget
+// Then merges budget spent and abuse backoffs from other processes into in-memory budgets
+func (p *GHPool) flush() {
+	p.mtx.Lock()
+	spent := make(map[string]int)
+	for _, t := range p.tokens {
+		if t.spent > 0 {
+			spent[t.key] = t.spent
+			t.spent = 0
+		}
+	}
+	p.mtx.Unlock()
+	for key, n := range spent {
+		ExecSQLWithErr(p.con, p.ctx, "update gha_ghapi_budget set remaining = remaining - $2 where token = $1", key, n)
+	}
+	rows := QuerySQLWithErr(
+		p.con,
+		p.ctx,
+		"select token, remaining, extract(epoch from reset_at - now()), "+
+			"coalesce(extract(epoch from abuse_until - now()), 0) from gha_ghapi_budget",
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	var (
+		key       string
+		rem       int
+		resetSecs float64
+		abuseSecs float64
+	)
+	type budget struct {
+		remaining int
+		resetSecs float64
+		abuseSecs float64
+	}
+	budgets := make(map[string]budget)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&key, &rem, &resetSecs, &abuseSecs))
+		budgets[key] = budget{remaining: rem, resetSecs: resetSecs, abuseSecs: abuseSecs}
+	}
+	FatalOnError(rows.Err())
+	now := time.Now()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	for _, t := range p.tokens {
+		b, ok := budgets[t.key]
+		if !ok {
+			continue
+		}
+		// Other processes spent points in the same reset window
+		reset := now.Add(time.Duration(b.resetSecs) * time.Second)
+		if b.resetSecs > 0 && math.Abs(reset.Sub(t.reset).Seconds()) < 30 && b.remaining < t.remaining {
+			t.remaining = b.remaining
+		}
+		if b.abuseSecs > 0 {
+			abuseUntil := now.Add(time.Duration(b.abuseSecs) * time.Second)
+			if abuseUntil.After(t.abuseUntil) {
+				t.abuseUntil = abuseUntil
+			}
+		}
+	}
+}
+
+// Get - returns client with the most API points remaining, its points remaining and time to reset
+// When all clients are backing off after abuse detection it waits for the first one to be available
+// When returned points are not greater than GHA2DB_MIN_GHAPI_POINTS, wait is the time to the nearest reset
+// Each call reserves one API point of the returned client
+func (p *GHPool) Get() (gctx context.Context, gc *github.Client, rem int, wait time.Duration) {
+	for {
+		p.refresh()
+		p.mtx.Lock()
+		now := time.Now()
+		var best *ghToken
+		abuseWait := time.Duration(-1)
+		for _, t := range p.tokens {
+			if t.abuseUntil.After(now) {
+				if abuseWait < 0 || t.abuseUntil.Sub(now) < abuseWait {
+					abuseWait = t.abuseUntil.Sub(now)
+				}
+				continue
+			}
+			if best == nil || t.remaining > best.remaining {
+				best = t
+			}
+		}
+		if best == nil {
+			p.mtx.Unlock()
+			if p.ctx.Debug > 0 {
+				Printf("All %d GitHub API tokens are backing off after abuse detection, waiting %v\n", len(p.tokens), abuseWait)
+			}
+			time.Sleep(abuseWait)
+			continue
+		}
+		rem = best.remaining
+		wait = best.reset.Sub(now)
+		if rem <= p.ctx.MinGHAPIPoints {
+			for _, t := range p.tokens {
+				if !t.abuseUntil.After(now) && t.reset.Sub(now) < wait {
+					wait = t.reset.Sub(now)
+				}
+			}
+		}
+		if wait < 0 {
+			wait = 0
+		}
+		best.remaining--
+		best.spent++
+		p.mtx.Unlock()
+		return p.gctx, best.client, rem, wait
+	}
+}
+
+// Abuse - marks given client as backing off after GitHub abuse (secondary rate limit) detection
+// Backoff time grows exponentially with subsequent abuses, returns backoff time
+func (p *GHPool) Abuse(gc *github.Client) time.Duration {
+	now := time.Now()
+	for _, t := range p.tokens {
+		if t.client != gc {
+			continue
+		}
+		p.mtx.Lock()
+		if now.Sub(t.abuseUntil) > ghPoolAbuseReset {
+			t.abuses = 0
+		}
+		wait := time.Duration(math.Pow(2.0, float64(t.abuses+3))) * time.Second
+		if wait > ghPoolMaxAbuseWait {
+			wait = ghPoolMaxAbuseWait
+		}
+		t.abuses++
+		t.abuseUntil = now.Add(wait)
+		p.mtx.Unlock()
+		// Other processes should back off too, save it immediately
+		if p.con != nil {
+			ExecSQLWithErr(
+				p.con,
+				p.ctx,
+				"update gha_ghapi_budget set abuse_until = greatest(abuse_until, now() + $2 * interval '1 second') where token = $1",
+				t.key,
+				int(wait.Seconds()),
+			)
+		}
+		return wait
+	}
+	return 0
+}
+
+// RateLimits - returns total API points remaining for all clients and time to the nearest reset
+func (p *GHPool) RateLimits() (rem int, wait time.Duration) {
+	p.refresh()
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	now := time.Now()
+	wait = time.Duration(-1)
+	for _, t := range p.tokens {
+		rem += t.remaining
+		if wait < 0 || t.reset.Sub(now) < wait {
+			wait = t.reset.Sub(now)
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package devstats
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+
+	"github.com/google/go-github/github"
+)
+
+func TestGHClientPool(t *testing.T) {
+	// Stub GitHub API, rate limits depend on the token used
+	remaining := map[string]int{"Bearer token1": 100, "Bearer token2": 500}
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rem, ok := remaining[r.Header.Get("Authorization")]
+		if r.URL.Path != "/rate_limit" || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(
+			w,
+			`{"resources":{"core":{"limit":5000,"remaining":%d,"reset":%d},"search":{"limit":30,"remaining":30,"reset":%d}}}`,
+			rem, reset, reset,
+		)
+	}))
+	defer server.Close()
+
+	// Tokens file with comments, empty lines and duplicates
+	dir, err := ioutil.TempDir("", "devstats_ghapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	fn := filepath.Join(dir, "oauth")
+	err = ioutil.WriteFile(fn, []byte("# GitHub tokens\ntoken1\n\n  token2  \ntoken1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ctx lib.Ctx
+	ctx.Init()
+	ctx.GitHubOAuth = fn
+	ctx.SkipGHAPIBudget = true
+	ctx.GHAPICacheDir = ""
+	ctx.MinGHAPIPoints = 1
+	ctx.MaxGHAPIThreads = 16
+
+	expectedTokens := []string{"token1", "token2", "token1"}
+	if tokens := lib.GHTokens(&ctx); !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("expected tokens %v, got %v", expectedTokens, tokens)
+	}
+	pool := lib.GHClientPool(&ctx)
+	defer pool.Close()
+	if err = pool.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if pool.Len() != 2 || pool.MaxThreads() != 32 {
+		t.Errorf("expected 2 tokens and 32 threads, got %d and %d", pool.Len(), pool.MaxThreads())
+	}
+
+	// Token with the most points is used first
+	_, gc2, rem, wait := pool.Get()
+	if rem != 500 || wait <= 0 || wait > time.Hour+time.Duration(2)*time.Second {
+		t.Errorf("expected 500 points and reset in about an hour, got %d, %v", rem, wait)
+	}
+	_, gc, rem, _ := pool.Get()
+	if rem != 499 || gc != gc2 {
+		t.Errorf("expected 499 points from the same client, got %d", rem)
+	}
+
+	// Token backing off after abuse detection is not used
+	backoff := pool.Abuse(gc2)
+	if backoff != time.Duration(8)*time.Second {
+		t.Errorf("expected 8s backoff, got %v", backoff)
+	}
+	if backoff = pool.Abuse(gc2); backoff != time.Duration(16)*time.Second {
+		t.Errorf("expected 16s backoff, got %v", backoff)
+	}
+	_, gc, rem, _ = pool.Get()
+	if rem != 100 || gc == gc2 {
+		t.Errorf("expected 100 points from the other client, got %d", rem)
+	}
+
+	// Total points of all tokens
+	rem, wait = pool.RateLimits()
+	if rem != 99+498 || wait <= 0 {
+		t.Errorf("expected %d total points, got %d, %v", 99+498, rem, wait)
+	}
+}
+
+func TestHandlePossibleError(t *testing.T) {
+	var testCases = []struct {
+		err      error
+		expected string
+	}{
+		{err: nil, expected: ""},
+		{err: errors.New("GET https://api.github.com/repos/a/b: 404 Not Found []"), expected: lib.NotFound},
+		{err: errors.New("GET https://api.github.com/repos/a/b: 403 You have exceeded a secondary rate limit"), expected: lib.Abuse},
+		{err: errors.New("403 You have triggered an abuse detection mechanism"), expected: lib.Abuse},
+		{err: errors.New("GET https://api.github.com/repos/a/b: 401 Bad credentials []"), expected: lib.OtherError},
+	}
+	for index, test := range testCases {
+		got := lib.HandlePossibleError(test.err, &lib.IssueConfig{Repo: "a/b"}, "test")
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestClassifyGHAPIError(t *testing.T) {
+	response := func(status int) error {
+		return &github.ErrorResponse{Response: &http.Response{StatusCode: status, Request: &http.Request{Method: "GET", URL: &url.URL{}}}}
+	}
+	var testCases = []struct {
+		err      error
+		expected string
+	}{
+		{err: nil, expected: ""},
+		{err: &github.RateLimitError{}, expected: "rate"},
+		{err: &github.AbuseRateLimitError{}, expected: lib.Abuse},
+		{err: errors.New("403 You have exceeded a secondary rate limit"), expected: lib.Abuse},
+		{err: response(404), expected: lib.NotFound},
+		{err: errors.New("GET https://api.github.com/repos/a/b: 404 Not Found []"), expected: lib.NotFound},
+		{err: response(422), expected: lib.Unprocessable},
+		{err: errors.New("GET https://api.github.com/repos/a/b/commits/x/statuses: 422 No commit found for SHA: x []"), expected: lib.Unprocessable},
+		{err: response(500), expected: lib.ServerError},
+		{err: response(503), expected: lib.ServerError},
+		{err: errors.New("GET https://api.github.com/repos/a/b: 502 Server Error []"), expected: lib.ServerError},
+		{err: response(403), expected: lib.OtherError},
+		{err: errors.New("connection reset by peer"), expected: lib.OtherError},
+	}
+	for index, test := range testCases {
+		got := lib.ClassifyGHAPIError(test.err)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
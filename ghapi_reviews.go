@@ -0,0 +1,213 @@
+package devstats
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// GHCheckRun - GitHub check run (GitHub client library version used doesn't support checks API)
+type GHCheckRun struct {
+	ID          *int64     `json:"id,omitempty"`
+	HeadSHA     *string    `json:"head_sha,omitempty"`
+	Name        *string    `json:"name,omitempty"`
+	Status      *string    `json:"status,omitempty"`
+	Conclusion  *string    `json:"conclusion,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	App         *struct {
+		Slug *string `json:"slug,omitempty"`
+	} `json:"app,omitempty"`
+}
+
+// GHListCheckRuns - lists check runs for a given ref (commit SHA, branch or tag name)
+func GHListCheckRuns(gctx context.Context, gc *github.Client, owner, repo, ref string, opt *github.ListOptions) ([]*GHCheckRun, *github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/commits/%v/check-runs", owner, repo, ref)
+	if opt != nil {
+		u += fmt.Sprintf("?per_page=%d&page=%d", opt.PerPage, opt.Page)
+	}
+	req, err := gc.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.antiope-preview+json")
+	var runs struct {
+		TotalCount int           `json:"total_count"`
+		CheckRuns  []*GHCheckRun `json:"check_runs"`
+	}
+	resp, err := gc.Do(gctx, req, &runs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return runs.CheckRuns, resp, nil
+}
+
+// GHPRReviews - PR reviews, review comments and head commit statuses and check runs from GitHub API
+type GHPRReviews struct {
+	Repo      string
+	Number    int
+	PRID      int64
+	HeadSHA   string
+	Reviews   []*github.PullRequestReview
+	Comments  []*github.PullRequestComment
+	Statuses  []*github.RepoStatus
+	CheckRuns []*GHCheckRun
+}
+
+// ReviewsComments - returns number of review comments per review ID
+func (r *GHPRReviews) ReviewsComments() map[int64]int {
+	comments := make(map[int64]int)
+	for _, comment := range r.Comments {
+		if comment.PullRequestReviewID != nil {
+			comments[*comment.PullRequestReviewID]++
+		}
+	}
+	return comments
+}
+
+// WritePRReviews - saves PR reviews in `gha_reviews`, review comments in `gha_review_comments`
+// and statuses/check runs in `gha_checks` tables
+// Existing rows are updated (review can be dismissed, comment edited, check run completed), pending (not submitted) reviews are skipped
+func WritePRReviews(con *sql.DB, ctx *Ctx, r *GHPRReviews) {
+	if ctx.SkipPDB {
+		if ctx.Debug > 0 {
+			Printf("No DB write: PR %s %d reviews\n", r.Repo, r.Number)
+		}
+		return
+	}
+	// To handle GDPR
+	maybeHide := MaybeHideFunc(GetHidden(HideCfgFile))
+	now := time.Now()
+	comments := r.ReviewsComments()
+
+	tc, err := con.Begin()
+	FatalOnError(err)
+	for _, review := range r.Reviews {
+		if review.ID == nil || review.State == nil || review.SubmittedAt == nil {
+			continue
+		}
+		ExecSQLTxWithErr(
+			tc,
+			ctx,
+			"insert into gha_reviews(id, pull_request_id, repo_name, number, user_id, user_login, "+
+				"state, body, commit_id, submitted_at, comments, dt) "+NValues(12)+
+				" on conflict(id) do update set state = excluded.state, body = excluded.body, "+
+				"comments = excluded.comments, dt = excluded.dt",
+			AnyArray{
+				*review.ID,
+				r.PRID,
+				r.Repo,
+				r.Number,
+				ghActorIDOrNil(review.User),
+				ghActorLoginOrNil(review.User, maybeHide),
+				*review.State,
+				TruncStringOrNil(review.Body, 0xffff),
+				StringOrNil(review.CommitID),
+				*review.SubmittedAt,
+				comments[*review.ID],
+				now,
+			}...,
+		)
+	}
+	for _, comment := range r.Comments {
+		if comment.ID == nil || comment.CreatedAt == nil {
+			continue
+		}
+		ExecSQLTxWithErr(
+			tc,
+			ctx,
+			"insert into gha_review_comments(id, review_id, in_reply_to, pull_request_id, repo_name, number, "+
+				"user_id, user_login, path, commit_id, body, created_at, updated_at, dt) "+NValues(14)+
+				" on conflict(id) do update set review_id = excluded.review_id, body = excluded.body, "+
+				"updated_at = excluded.updated_at, dt = excluded.dt",
+			AnyArray{
+				*comment.ID,
+				Int64OrNil(comment.PullRequestReviewID),
+				Int64OrNil(comment.InReplyTo),
+				r.PRID,
+				r.Repo,
+				r.Number,
+				ghActorIDOrNil(comment.User),
+				ghActorLoginOrNil(comment.User, maybeHide),
+				StringOrNil(comment.Path),
+				StringOrNil(comment.CommitID),
+				TruncStringOrNil(comment.Body, 0xffff),
+				*comment.CreatedAt,
+				TimeOrNil(comment.UpdatedAt),
+				now,
+			}...,
+		)
+	}
+	insertCheck := func(id int64, checkType, name, state string, conclusion, creator interface{}, startedAt, completedAt *time.Time) {
+		ExecSQLTxWithErr(
+			tc,
+			ctx,
+			"insert into gha_checks(id, type, pull_request_id, repo_name, number, sha, name, "+
+				"state, conclusion, creator_login, started_at, completed_at, dt) "+NValues(13)+
+				" on conflict(id, type) do update set state = excluded.state, conclusion = excluded.conclusion, "+
+				"completed_at = excluded.completed_at, dt = excluded.dt",
+			AnyArray{
+				id,
+				checkType,
+				r.PRID,
+				r.Repo,
+				r.Number,
+				r.HeadSHA,
+				TruncToBytes(name, 200),
+				state,
+				conclusion,
+				creator,
+				TimeOrNil(startedAt),
+				TimeOrNil(completedAt),
+				now,
+			}...,
+		)
+	}
+	for _, status := range r.Statuses {
+		if status.ID == nil || status.Context == nil || status.State == nil {
+			continue
+		}
+		// Status is a single state change, final states are also conclusions
+		var (
+			conclusion  interface{}
+			completedAt *time.Time
+		)
+		if *status.State != "pending" {
+			conclusion = *status.State
+			completedAt = status.UpdatedAt
+		}
+		insertCheck(
+			*status.ID,
+			"status",
+			*status.Context,
+			*status.State,
+			conclusion,
+			ghActorLoginOrNil(status.Creator, maybeHide),
+			status.CreatedAt,
+			completedAt,
+		)
+	}
+	for _, run := range r.CheckRuns {
+		if run.ID == nil || run.Name == nil || run.Status == nil {
+			continue
+		}
+		var app interface{}
+		if run.App != nil {
+			app = StringOrNil(run.App.Slug)
+		}
+		insertCheck(
+			*run.ID,
+			"check_run",
+			*run.Name,
+			*run.Status,
+			StringOrNil(run.Conclusion),
+			app,
+			run.StartedAt,
+			run.CompletedAt,
+		)
+	}
+	FatalOnError(tc.Commit())
+}
@@ -0,0 +1,76 @@
+package devstats
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	lib "devstats"
+
+	"github.com/google/go-github/github"
+)
+
+func TestGHListCheckRuns(t *testing.T) {
+	// Stub GitHub checks API with two pages
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/commits/abc/check-runs" || r.Header.Get("Accept") != "application/vnd.github.antiope-preview+json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/repos/org/repo/commits/abc/check-runs?per_page=1&page=2>; rel="next"`, server.URL))
+			fmt.Fprint(w, `{"total_count":2,"check_runs":[{"id":1,"head_sha":"abc","name":"build","status":"completed","conclusion":"success","app":{"slug":"ci"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_count":2,"check_runs":[{"id":2,"head_sha":"abc","name":"test","status":"in_progress","conclusion":null}]}`)
+	}))
+	defer server.Close()
+
+	gc := github.NewClient(nil)
+	gc.BaseURL, _ = url.Parse(server.URL + "/")
+	opt := &github.ListOptions{PerPage: 1, Page: 1}
+	runs, resp, err := lib.GHListCheckRuns(context.Background(), gc, "org", "repo", "abc", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || *runs[0].Name != "build" || *runs[0].Conclusion != "success" || *runs[0].App.Slug != "ci" {
+		t.Errorf("unexpected first page: %+v", runs)
+	}
+	if resp.NextPage != 2 {
+		t.Fatalf("expected next page 2, got %d", resp.NextPage)
+	}
+	opt.Page = resp.NextPage
+	runs, resp, err = lib.GHListCheckRuns(context.Background(), gc, "org", "repo", "abc", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || *runs[0].Status != "in_progress" || runs[0].Conclusion != nil || resp.NextPage != 0 {
+		t.Errorf("unexpected last page: %+v, next page %d", runs, resp.NextPage)
+	}
+	_, _, err = lib.GHListCheckRuns(context.Background(), gc, "org", "other", "abc", nil)
+	if err == nil {
+		t.Errorf("expected not found error")
+	}
+}
+
+func TestReviewsComments(t *testing.T) {
+	id := func(i int64) *int64 { return &i }
+	r := lib.GHPRReviews{
+		Comments: []*github.PullRequestComment{
+			{ID: id(1), PullRequestReviewID: id(10)},
+			{ID: id(2), PullRequestReviewID: id(10)},
+			{ID: id(3), PullRequestReviewID: id(11)},
+			{ID: id(4)},
+		},
+	}
+	expected := map[int64]int{10: 2, 11: 1}
+	if got := r.ReviewsComments(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
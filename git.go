@@ -0,0 +1,660 @@
+package devstats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/cache"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/filesystem"
+)
+
+// GitRepo - read only, in-process access to git repository commits, tags and files (using go-git), `git` binary is not needed
+// Shallow is set for shallow clones, commits at the shallow boundary have unknown parents, so their files are not reported
+// GitRepo is not safe for concurrent use, each thread should open its own instance
+type GitRepo struct {
+	Path      string
+	Shallow   bool
+	storage   *filesystem.Storage
+	shallow   map[plumbing.Hash]struct{}
+	blobStats map[plumbing.Hash][2]int64
+}
+
+// GitFile - single file changed by a commit
+// Size can be:
+// > 0 - normal file size
+// 0 - file created - no contents
+// -1 - file deleted in this commit
+// -2 - special file (submodule)
+// Additions and Deletions are numbers of lines added and removed, both are -1 for binary files
+// OldPath is set for renamed files
+type GitFile struct {
+	Path      string
+	OldPath   string
+	Size      int64
+	Additions int64
+	Deletions int64
+}
+
+// GitCommit - commit data with list of files changed (compared to its parent)
+// Like `git diff-tree` merge and root commits have no files
+// Date is a committer date
+type GitCommit struct {
+	SHA         string
+	Date        time.Time
+	AuthorName  string
+	AuthorEmail string
+	Message     string
+	Parents     []string
+	Files       []GitFile
+}
+
+// GitTag - tag data: name, creation date and subject
+// Date and subject come from annotated tag object or from tagged commit for lightweight tags
+// Annotated tags without a tagger use tagged commit's date
+type GitTag struct {
+	Name    string
+	Date    time.Time
+	Subject string
+}
+
+// gitRenameScore - minimum similarity (in percent) for a delete/add pair to be reported as a rename, like `git diff -M70%`
+const gitRenameScore = 70
+
+// gitRenameLimit - similar renames are not searched when number of delete/add pairs is above this limit squared (like git's diff.renameLimit)
+const gitRenameLimit = 1000
+
+// gitSpanSize - maximum size of a chunk used to compute files similarity, chunks also end at new lines (like in git)
+const gitSpanSize = 64
+
+// gitDiffTimeout - line diff of a single file gives up looking for the minimal diff after this time
+const gitDiffTimeout = 2 * time.Second
+
+// OpenGitRepo - opens git repository at a given path
+// Path can be a working tree root (.git directory or .git file pointing to the git directory) or a bare repository
+func OpenGitRepo(path string) (r *GitRepo, err error) {
+	gitDir, err := gitDirectory(path)
+	if err != nil {
+		return
+	}
+	r = &GitRepo{
+		Path:      path,
+		storage:   filesystem.NewStorage(osfs.New(gitDir), cache.NewObjectLRUDefault()),
+		shallow:   make(map[plumbing.Hash]struct{}),
+		blobStats: make(map[plumbing.Hash][2]int64),
+	}
+	shallow, err := r.storage.Shallow()
+	if err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+		return
+	}
+	for _, hash := range shallow {
+		r.shallow[hash] = struct{}{}
+	}
+	r.Shallow = len(shallow) > 0
+	return
+}
+
+// gitDirectory - returns git directory of a working tree root or a bare repository
+func gitDirectory(path string) (string, error) {
+	dotGit := filepath.Join(path, ".git")
+	info, err := os.Stat(dotGit)
+	if err == nil {
+		if info.IsDir() {
+			return dotGit, nil
+		}
+		// Worktrees and submodules have a .git file: "gitdir: path"
+		data, err := ioutil.ReadFile(dotGit)
+		if err != nil {
+			return "", err
+		}
+		line := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(line, "gitdir: ") {
+			return "", fmt.Errorf("%s: invalid .git file: '%s'", path, line)
+		}
+		dir := strings.TrimPrefix(line, "gitdir: ")
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(path, dir)
+		}
+		return dir, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	// Bare repository
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return "", fmt.Errorf("%s: not a git repository", path)
+		}
+	}
+	return path, nil
+}
+
+// Close - releases repository resources
+func (r *GitRepo) Close() error {
+	r.blobStats = make(map[plumbing.Hash][2]int64)
+	return r.storage.Close()
+}
+
+// gitHash - parses full hex SHA, returns false for invalid SHAs
+func gitHash(sha string) (plumbing.Hash, bool) {
+	if len(sha) != 40 || strings.Trim(strings.ToLower(sha), "0123456789abcdef") != "" {
+		return plumbing.ZeroHash, false
+	}
+	return plumbing.NewHash(sha), true
+}
+
+// gitSubject - returns subject of a commit or tag message: first paragraph with lines joined by spaces
+func gitSubject(message string) string {
+	paragraph := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)[0]
+	return strings.Join(strings.Fields(strings.Replace(paragraph, "\n", " ", -1)), " ")
+}
+
+// newGitCommit - returns commit data without files
+func newGitCommit(commit *object.Commit) *GitCommit {
+	parents := []string{}
+	for _, parent := range commit.ParentHashes {
+		parents = append(parents, parent.String())
+	}
+	return &GitCommit{
+		SHA:         commit.Hash.String(),
+		Date:        time.Unix(commit.Committer.When.Unix(), 0),
+		AuthorName:  commit.Author.Name,
+		AuthorEmail: commit.Author.Email,
+		Message:     strings.TrimSuffix(commit.Message, "\n"),
+		Parents:     parents,
+	}
+}
+
+// Log - returns all commits reachable from a given ref (following all parents), without files
+// Commits are sorted by date (oldest first) and then by SHA
+// In shallow clones only commits above the shallow boundary are returned
+func (r *GitRepo) Log(ref string) (commits []GitCommit, err error) {
+	head, err := r.resolveCommit(ref)
+	if err != nil {
+		return
+	}
+	seen := map[plumbing.Hash]struct{}{head.Hash: {}}
+	queue := []*object.Commit{head}
+	for len(queue) > 0 {
+		commit := queue[0]
+		queue = queue[1:]
+		commits = append(commits, *newGitCommit(commit))
+		if _, ok := r.shallow[commit.Hash]; ok {
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			if _, ok := seen[parent]; ok {
+				continue
+			}
+			seen[parent] = struct{}{}
+			var parentCommit *object.Commit
+			parentCommit, err = object.GetCommit(r.storage, parent)
+			if err != nil {
+				err = fmt.Errorf("%s: commit %s: parent %s: %v", r.Path, commit.Hash, parent, err)
+				return
+			}
+			queue = append(queue, parentCommit)
+		}
+	}
+	sort.Slice(commits, func(i, j int) bool {
+		if commits[i].Date.Equal(commits[j].Date) {
+			return commits[i].SHA < commits[j].SHA
+		}
+		return commits[i].Date.Before(commits[j].Date)
+	})
+	return
+}
+
+// CommitsFiles - returns given commits' data and files changed compared to their parents
+// It detects renames like `git diff-tree -M70%` and computes line stats like `git diff-tree --numstat`
+// Only two versions of a single file are held in memory at a time
+// Commits that don't exist in the repository (or are at the shallow boundary) are not included in the result
+func (r *GitRepo) CommitsFiles(shas []string) (commits map[string]*GitCommit, err error) {
+	commits = make(map[string]*GitCommit)
+	for _, sha := range shas {
+		if _, ok := commits[sha]; ok {
+			continue
+		}
+		hash, ok := gitHash(sha)
+		if !ok {
+			continue
+		}
+		if _, shallow := r.shallow[hash]; shallow {
+			continue
+		}
+		commit, e := object.GetCommit(r.storage, hash)
+		if e == plumbing.ErrObjectNotFound {
+			continue
+		}
+		if e != nil {
+			err = fmt.Errorf("%s: commit %s: %v", r.Path, sha, e)
+			return
+		}
+		data := newGitCommit(commit)
+		// Like `git diff-tree` merge and root commits have no files
+		if len(commit.ParentHashes) == 1 {
+			data.Files, err = r.commitFiles(commit)
+			if err != nil {
+				err = fmt.Errorf("%s: commit %s: %v", r.Path, sha, err)
+				return
+			}
+		}
+		commits[sha] = data
+	}
+	return
+}
+
+// CommitFiles - returns given commit's data and files changed compared to its parent
+// Use CommitsFiles to get many commits at once
+func (r *GitRepo) CommitFiles(sha string) (commit *GitCommit, err error) {
+	commits, err := r.CommitsFiles([]string{sha})
+	if err != nil {
+		return
+	}
+	commit, ok := commits[sha]
+	if !ok {
+		hash, _ := gitHash(sha)
+		if _, shallow := r.shallow[hash]; shallow {
+			err = fmt.Errorf("%s: commit '%s' is at the shallow clone boundary", r.Path, sha)
+		} else {
+			err = fmt.Errorf("%s: commit '%s' not found", r.Path, sha)
+		}
+	}
+	return
+}
+
+// gitChange - single entry of a tree diff, zero hash means that file doesn't exist on that side
+type gitChange struct {
+	from, to         string
+	fromHash, toHash plumbing.Hash
+	fromMode, toMode filemode.FileMode
+}
+
+// commitFiles - returns files changed by a commit with a single parent, sorted by path
+func (r *GitRepo) commitFiles(commit *object.Commit) (files []GitFile, err error) {
+	parent, err := object.GetCommit(r.storage, commit.ParentHashes[0])
+	if err != nil {
+		return
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return
+	}
+	items := []gitChange{}
+	for _, change := range changes {
+		item := gitChange{from: change.From.Name, to: change.To.Name}
+		if change.From.Name != "" {
+			item.fromHash, item.fromMode = change.From.TreeEntry.Hash, change.From.TreeEntry.Mode
+		}
+		if change.To.Name != "" {
+			item.toHash, item.toMode = change.To.TreeEntry.Hash, change.To.TreeEntry.Mode
+		}
+		items = append(items, item)
+	}
+	items, err = r.detectRenames(items)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		var file GitFile
+		file, err = r.changedFile(item)
+		if err != nil {
+			return
+		}
+		files = append(files, file)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return
+}
+
+// changedFile - returns path, size and line stats of a single change
+func (r *GitRepo) changedFile(item gitChange) (file GitFile, err error) {
+	file.Path = item.to
+	if item.from != "" && item.to != "" && item.from != item.to {
+		file.OldPath = item.from
+	}
+	switch {
+	case item.to == "":
+		file.Path = item.from
+		file.Size = -1
+	case item.toMode == filemode.Submodule:
+		file.Size = -2
+	default:
+		file.Size, err = r.storage.EncodedObjectSize(item.toHash)
+		if err != nil {
+			return
+		}
+	}
+	// Like `git diff --numstat` submodules are compared as single "Subproject commit" lines
+	if item.fromMode == filemode.Submodule || item.toMode == filemode.Submodule {
+		if item.from != "" {
+			file.Deletions = 1
+		}
+		if item.to != "" {
+			file.Additions = 1
+		}
+		return
+	}
+	from, err := r.blobContents(item.fromHash)
+	if err != nil {
+		return
+	}
+	to, err := r.blobContents(item.toHash)
+	if err != nil {
+		return
+	}
+	if gitIsBinary(from) || gitIsBinary(to) {
+		file.Additions, file.Deletions = -1, -1
+		return
+	}
+	file.Additions, file.Deletions = gitLineStats(from, to)
+	return
+}
+
+// blobContents - returns blob contents, zero hash means an empty (not existing) file
+func (r *GitRepo) blobContents(hash plumbing.Hash) (data []byte, err error) {
+	if hash.IsZero() {
+		return
+	}
+	blob, err := object.GetBlob(r.storage, hash)
+	if err != nil {
+		return
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return
+	}
+	data, err = ioutil.ReadAll(reader)
+	if e := reader.Close(); err == nil {
+		err = e
+	}
+	return
+}
+
+// gitIsBinary - file is considered binary when its first bytes contain a zero byte, like in git
+func gitIsBinary(data []byte) bool {
+	if len(data) > gitBinaryCheckSize {
+		data = data[:gitBinaryCheckSize]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// gitLineStats - returns numbers of lines added and removed between two file versions
+func gitLineStats(from, to []byte) (additions, deletions int64) {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = gitDiffTimeout
+	src, dst, _ := dmp.DiffLinesToRunes(string(from), string(to))
+	for _, diff := range dmp.DiffMainRunes(src, dst, false) {
+		// In lines mode each rune represents a single line
+		n := int64(len([]rune(diff.Text)))
+		switch diff.Type {
+		case diffmatchpatch.DiffInsert:
+			additions += n
+		case diffmatchpatch.DiffDelete:
+			deletions += n
+		}
+	}
+	return
+}
+
+// gitRename - candidate rename: similarity score and indices of deleted and added changes
+type gitRename struct {
+	score    int
+	from, to int
+}
+
+// detectRenames - joins deleted and added files into renames, like `git diff -M70%`
+// Exact renames (same contents) are found first, then similar files are paired by the best similarity score
+func (r *GitRepo) detectRenames(items []gitChange) (result []gitChange, err error) {
+	deleted, added := []int{}, []int{}
+	for i, item := range items {
+		if item.to == "" && item.fromMode != filemode.Submodule {
+			deleted = append(deleted, i)
+		} else if item.from == "" && item.toMode != filemode.Submodule {
+			added = append(added, i)
+		}
+	}
+	if len(deleted) == 0 || len(added) == 0 {
+		return items, nil
+	}
+	paired := make(map[int]int)
+	used := make(map[int]struct{})
+	// Exact renames
+	for _, to := range added {
+		for _, from := range deleted {
+			if _, ok := used[from]; ok {
+				continue
+			}
+			if items[from].fromHash == items[to].toHash {
+				paired[to] = from
+				used[from] = struct{}{}
+				break
+			}
+		}
+	}
+	// Similar files
+	if (len(deleted)-len(used))*(len(added)-len(paired)) <= gitRenameLimit*gitRenameLimit {
+		signatures := make(map[plumbing.Hash]gitSignature)
+		signature := func(hash plumbing.Hash) (gitSignature, error) {
+			if sig, ok := signatures[hash]; ok {
+				return sig, nil
+			}
+			sig, e := r.blobSignature(hash)
+			if e == nil {
+				signatures[hash] = sig
+			}
+			return sig, e
+		}
+		candidates := []gitRename{}
+		for _, to := range added {
+			if _, ok := paired[to]; ok {
+				continue
+			}
+			var dst gitSignature
+			dst, err = signature(items[to].toHash)
+			if err != nil {
+				return
+			}
+			for _, from := range deleted {
+				if _, ok := used[from]; ok {
+					continue
+				}
+				var src gitSignature
+				src, err = signature(items[from].fromHash)
+				if err != nil {
+					return
+				}
+				score := gitSimilarity(src, dst)
+				if score >= gitRenameScore {
+					candidates = append(candidates, gitRename{score: score, from: from, to: to})
+				}
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+		for _, candidate := range candidates {
+			if _, ok := paired[candidate.to]; ok {
+				continue
+			}
+			if _, ok := used[candidate.from]; ok {
+				continue
+			}
+			paired[candidate.to] = candidate.from
+			used[candidate.from] = struct{}{}
+		}
+	}
+	for i, item := range items {
+		if _, ok := used[i]; ok {
+			continue
+		}
+		if from, ok := paired[i]; ok {
+			item.from, item.fromHash, item.fromMode = items[from].from, items[from].fromHash, items[from].fromMode
+		}
+		result = append(result, item)
+	}
+	return
+}
+
+// gitSignature - file size and number of bytes per chunk hash, used to compute files similarity
+type gitSignature struct {
+	size   int64
+	chunks map[uint32]int64
+}
+
+// blobSignature - computes blob's similarity signature, blob is streamed so its contents are not held in memory
+// Chunks end at new lines or after gitSpanSize bytes, like in git's diffcore-delta
+func (r *GitRepo) blobSignature(hash plumbing.Hash) (sig gitSignature, err error) {
+	sig.chunks = make(map[uint32]int64)
+	blob, err := object.GetBlob(r.storage, hash)
+	if err != nil {
+		return
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return
+	}
+	defer func() { _ = reader.Close() }()
+	buffered := bufio.NewReaderSize(reader, 64*1024)
+	h := fnv.New32a()
+	n := int64(0)
+	for {
+		b, e := buffered.ReadByte()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+		_, _ = h.Write([]byte{b})
+		n++
+		sig.size++
+		if b == '\n' || n == gitSpanSize {
+			sig.chunks[h.Sum32()] += n
+			h.Reset()
+			n = 0
+		}
+	}
+	if n > 0 {
+		sig.chunks[h.Sum32()] += n
+	}
+	return
+}
+
+// gitSimilarity - returns similarity of two files in percent: bytes in common chunks divided by the bigger size
+func gitSimilarity(src, dst gitSignature) int {
+	max, min := src.size, dst.size
+	if min > max {
+		max, min = min, max
+	}
+	if max == 0 {
+		return 100
+	}
+	// Files with too different sizes cannot be similar enough
+	if min*100 < max*gitRenameScore {
+		return 0
+	}
+	common := int64(0)
+	for chunk, n := range src.chunks {
+		m := dst.chunks[chunk]
+		if m < n {
+			n = m
+		}
+		common += n
+	}
+	return int(common * 100 / max)
+}
+
+// Tags - returns all repository tags sorted by name
+// Tags pointing to objects other than commits (directly or via annotated tags) are skipped
+func (r *GitRepo) Tags() (tags []GitTag, err error) {
+	refs, err := r.storage.IterReferences()
+	if err != nil {
+		return
+	}
+	defer refs.Close()
+	for {
+		ref, e := refs.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+		if !ref.Name().IsTag() || ref.Type() != plumbing.HashReference {
+			continue
+		}
+		name := ref.Name().Short()
+		var (
+			tag    *GitTag
+			commit *object.Commit
+		)
+		commit, tag, err = r.peel(ref.Hash())
+		if err != nil {
+			err = fmt.Errorf("%s: tag %s: %v", r.Path, name, err)
+			return
+		}
+		if commit == nil {
+			continue
+		}
+		if tag == nil {
+			tag = &GitTag{Subject: gitSubject(commit.Message)}
+		}
+		// Lightweight tags and annotated tags without a tagger use tagged commit's date
+		if tag.Date.IsZero() {
+			tag.Date = time.Unix(commit.Committer.When.Unix(), 0)
+		}
+		tag.Name = name
+		tags = append(tags, *tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return
+}
+
+// peel - follows annotated tags starting at a given object, returns the commit (nil for other objects) and the first annotated tag data
+func (r *GitRepo) peel(hash plumbing.Hash) (commit *object.Commit, tag *GitTag, err error) {
+	for {
+		obj, e := object.GetObject(r.storage, hash)
+		if e != nil {
+			err = e
+			return
+		}
+		switch o := obj.(type) {
+		case *object.Commit:
+			commit = o
+			return
+		case *object.Tag:
+			if tag == nil {
+				tag = &GitTag{Subject: gitSubject(o.Message)}
+				if !o.Tagger.When.IsZero() {
+					tag.Date = time.Unix(o.Tagger.When.Unix(), 0)
+				}
+			}
+			hash = o.Target
+		default:
+			return
+		}
+	}
+}
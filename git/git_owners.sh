@@ -0,0 +1,22 @@
+#!/bin/bash
+if [ -z "$1" ]
+then
+  echo "Arguments required: path rev, none given"
+  exit 1
+fi
+if [ -z "$2" ]
+then
+  echo "Arguments required: path rev, only path given"
+  exit 2
+fi
+
+cd "$1" || exit 3
+git show -s --format=%ct "$2^{commit}" || exit 4
+# NUL separated file names, so paths with spaces are handled
+# Each file is preceded by a newline and '♂♀file' line, so the delimiter is always on its own line
+# even when the previous file has no trailing newline (reader removes that extra newline)
+git ls-tree -r -z --name-only "$2" | grep -zE '(^|/)(OWNERS|OWNERS_ALIASES|CODEOWNERS)$' | while IFS= read -r -d '' file
+do
+  printf '\n♂♀%s\n' "$file"
+  git show "$2:$file" || exit 5
+done || exit 5
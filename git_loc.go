@@ -0,0 +1,208 @@
+package devstats
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+)
+
+// gitBinaryCheckSize - file is considered binary when its first bytes contain a zero byte, like in git
+const gitBinaryCheckSize = 8000
+
+// GitLOC - lines of code statistics for a single language at a given commit
+// Binary files and submodules are not counted
+type GitLOC struct {
+	Language string
+	Files    int64
+	Lines    int64
+	Size     int64
+}
+
+// ResolveRef - returns commit SHA for a given ref: "HEAD", tag, branch, full ref name or commit SHA
+// Annotated tags are peeled to the commit they point to
+func (r *GitRepo) ResolveRef(ref string) (sha string, err error) {
+	commit, err := r.resolveCommit(ref)
+	if err != nil {
+		return
+	}
+	sha = commit.Hash.String()
+	return
+}
+
+// resolveCommit - returns commit pointed to by a given ref, short names are searched like in git:
+// refs/<ref>, refs/tags/<ref>, refs/heads/<ref>, refs/remotes/<ref>, refs/remotes/<ref>/HEAD
+func (r *GitRepo) resolveCommit(ref string) (commit *object.Commit, err error) {
+	hash, ok := gitHash(ref)
+	if !ok {
+		names := []string{ref}
+		if ref != "HEAD" && !strings.HasPrefix(ref, "refs/") {
+			names = []string{"refs/" + ref, "refs/tags/" + ref, "refs/heads/" + ref, "refs/remotes/" + ref, "refs/remotes/" + ref + "/HEAD"}
+		}
+		for _, name := range names {
+			resolved, e := storer.ResolveReference(r.storage, plumbing.ReferenceName(name))
+			if e == nil {
+				hash, ok = resolved.Hash(), true
+				break
+			}
+		}
+	}
+	if ok {
+		commit, _, err = r.peel(hash)
+	}
+	if !ok || err != nil || commit == nil {
+		err = fmt.Errorf("%s: ref '%s' not found or does not point to a commit", r.Path, ref)
+		commit = nil
+	}
+	return
+}
+
+// CommitDate - returns committer date of the commit pointed to by a given ref
+func (r *GitRepo) CommitDate(ref string) (dt time.Time, err error) {
+	commit, err := r.resolveCommit(ref)
+	if err != nil {
+		return
+	}
+	dt = time.Unix(commit.Committer.When.Unix(), 0)
+	return
+}
+
+// CommitAt - returns the newest commit not newer than `dt`, following first parents from a given ref
+// Returns an empty SHA when all commits are newer than `dt` (or only reachable via the shallow boundary)
+func (r *GitRepo) CommitAt(ref string, dt time.Time) (sha string, err error) {
+	commit, err := r.resolveCommit(ref)
+	if err != nil {
+		return
+	}
+	for {
+		if !commit.Committer.When.After(dt) {
+			sha = commit.Hash.String()
+			return
+		}
+		if _, shallow := r.shallow[commit.Hash]; shallow || len(commit.ParentHashes) == 0 {
+			return
+		}
+		commit, err = object.GetCommit(r.storage, commit.ParentHashes[0])
+		if err != nil {
+			return
+		}
+	}
+}
+
+// LinesOfCode - returns lines of code statistics per language for all files at a given commit
+// Files matching `filesSkipPattern` are skipped (pattern is matched against path in repository)
+// Line counts are cached per blob, so computing statistics for many commits of the same repository is fast
+func (r *GitRepo) LinesOfCode(sha string, filesSkipPattern *regexp.Regexp) (locs []GitLOC, err error) {
+	commit, err := r.resolveCommit(sha)
+	if err != nil {
+		return
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	stats := make(map[string]*GitLOC)
+	for {
+		path, entry, e := walker.Next()
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+		// Directories and submodules are skipped
+		if entry.Mode == filemode.Dir || entry.Mode == filemode.Submodule {
+			continue
+		}
+		if filesSkipPattern != nil && filesSkipPattern.MatchString(path) {
+			continue
+		}
+		var cached [2]int64
+		cached, err = r.blobLines(entry.Hash)
+		if err != nil {
+			err = fmt.Errorf("%s: %s: %v", r.Path, path, err)
+			return
+		}
+		if cached[0] < 0 {
+			continue
+		}
+		lang := FileLanguage(path)
+		loc, ok := stats[lang]
+		if !ok {
+			loc = &GitLOC{Language: lang}
+			stats[lang] = loc
+		}
+		loc.Files++
+		loc.Lines += cached[0]
+		loc.Size += cached[1]
+	}
+	for _, loc := range stats {
+		locs = append(locs, *loc)
+	}
+	sort.Slice(locs, func(i, j int) bool { return locs[i].Language < locs[j].Language })
+	return
+}
+
+// blobLines - returns (and caches) number of lines and size of a given blob, lines is -1 for binary blobs
+// Blob is streamed, so only one buffer is held in memory at a time
+func (r *GitRepo) blobLines(hash plumbing.Hash) (stats [2]int64, err error) {
+	stats, ok := r.blobStats[hash]
+	if ok {
+		return
+	}
+	blob, err := object.GetBlob(r.storage, hash)
+	if err != nil {
+		return
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return
+	}
+	defer func() { _ = reader.Close() }()
+	buf := make([]byte, 64*1024)
+	lines, size, binary, last := int64(0), int64(0), false, byte('\n')
+	for {
+		n, e := reader.Read(buf)
+		if n > 0 {
+			// File is considered binary when its first bytes contain a zero byte, like in git
+			if size < gitBinaryCheckSize {
+				check := buf[:n]
+				if int64(len(check)) > gitBinaryCheckSize-size {
+					check = check[:gitBinaryCheckSize-size]
+				}
+				binary = binary || bytes.IndexByte(check, 0) >= 0
+			}
+			lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+			last = buf[n-1]
+			size += int64(n)
+		}
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+	}
+	// Last line doesn't need to end with a new line
+	if last != '\n' {
+		lines++
+	}
+	if binary {
+		lines = -1
+	}
+	stats = [2]int64{lines, size}
+	r.blobStats[hash] = stats
+	return
+}
@@ -0,0 +1,422 @@
+package devstats
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+// gitFixture - test git repository created in a temporary directory
+type gitFixture struct {
+	t    *testing.T
+	dir  string
+	env  []string
+	shas map[string]string
+}
+
+// git - runs git command in fixture repository, returns trimmed output
+func (f *gitFixture) git(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = f.dir
+	cmd.Env = f.env
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %v: %v: %s", args, err, string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitInput - runs git command in fixture repository with a given standard input, returns trimmed output
+func (f *gitFixture) gitInput(input string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = f.dir
+	cmd.Env = f.env
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %v: %v: %s", args, err, string(out))
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// write - writes file in fixture repository
+func (f *gitFixture) write(path, contents string) {
+	fn := filepath.Join(f.dir, path)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fn, []byte(contents), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// commit - commits all changes at a given unix time and remembers commit SHA under a given name
+func (f *gitFixture) commit(name string, unix int64) {
+	date := time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	f.env = append(f.env, "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+	f.git("add", "-A")
+	f.git("commit", "-q", "--allow-empty", "-m", name)
+	f.env = f.env[:len(f.env)-2]
+	f.shas[name] = f.git("rev-parse", "HEAD")
+}
+
+// newGitFixture - creates fixture repository with:
+// c1: root commit
+// c2: modifications, binary file removal, additions, file with no trailing newline
+// c3: exact rename, similar rename with modifications, and a new file
+// c4: empty commit
+// c5: merge commit
+// lightweight tag "v0.1" on c1, annotated tag "v0.2" on c3 and annotated tag without a tagger "v0.1.1" on c2
+func newGitFixture(t *testing.T) *gitFixture {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	dir, err := ioutil.TempDir("", "devstats_git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &gitFixture{
+		t:   t,
+		dir: dir,
+		env: []string{
+			"HOME=" + dir,
+			"PATH=" + os.Getenv("PATH"),
+			"GIT_CONFIG_NOSYSTEM=1",
+			"GIT_AUTHOR_NAME=Author",
+			"GIT_AUTHOR_EMAIL=author@example.com",
+			"GIT_COMMITTER_NAME=Committer",
+			"GIT_COMMITTER_EMAIL=committer@example.com",
+		},
+		shas: make(map[string]string),
+	}
+	f.git("init", "-q", ".")
+	f.git("config", "commit.gpgsign", "false")
+	f.git("config", "tag.gpgsign", "false")
+
+	long := ""
+	for i := 0; i < 40; i++ {
+		long += strings.Repeat("x", i) + "\n"
+	}
+	f.write("a.txt", "1\n2\n3\n")
+	f.write("bin.dat", "binary\x00data")
+	f.write("dir/b.go", "package dir\n\n"+long)
+	f.write("gone.txt", "one\ntwo\n")
+	f.commit("c1", 1500000000)
+	f.git("tag", "v0.1")
+
+	f.write("a.txt", "1\nTwo\n3\n4\n")
+	if err := os.Remove(filepath.Join(dir, "bin.dat")); err != nil {
+		t.Fatal(err)
+	}
+	f.write("dir/sub/c.txt", "c")
+	f.write("vendor/x.go", "package x\n")
+	f.write("gone.txt", "one\ntwo")
+	f.commit("c2", 1500003600)
+	tag := f.gitInput(
+		"object "+f.shas["c2"]+"\ntype commit\ntag v0.1.1\n\nNo tagger\n",
+		"hash-object", "-t", "tag", "-w", "--stdin", "--literally",
+	)
+	f.git("update-ref", "refs/tags/v0.1.1", tag)
+
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f.git("mv", "a.txt", "docs/a.txt")
+	f.git("mv", "dir/b.go", "dir/b2.go")
+	f.write("dir/b2.go", "package dir\n\n// Added\n"+long)
+	f.write("new.txt", "new\n")
+	f.commit("c3", 1500007200)
+	f.env = append(f.env, "GIT_COMMITTER_DATE=2017-07-14T09:00:00Z")
+	f.git("tag", "-a", "v0.2", "-m", "Release 0.2\nsecond line\n\nDetails")
+	f.env = f.env[:len(f.env)-1]
+
+	f.commit("c4", 1500010800)
+
+	f.git("checkout", "-q", "-b", "side", f.shas["c3"])
+	f.write("side.txt", "side\n")
+	f.commit("side", 1500012600)
+	f.git("checkout", "-q", "-")
+	f.env = append(f.env, "GIT_AUTHOR_DATE=2017-07-14T07:00:00Z", "GIT_COMMITTER_DATE=2017-07-14T07:00:00Z")
+	f.git("merge", "-q", "--no-ff", "-m", "c5", "side")
+	f.env = f.env[:len(f.env)-2]
+	f.shas["c5"] = f.git("rev-parse", "HEAD")
+	return f
+}
+
+func TestGitRepo(t *testing.T) {
+	f := newGitFixture(t)
+	defer func() { _ = os.RemoveAll(f.dir) }()
+
+	// Expected files per commit
+	var testCases = []struct {
+		commit  string
+		date    int64
+		parents int
+		files   []lib.GitFile
+	}{
+		{commit: "c1", date: 1500000000, parents: 0, files: nil},
+		{
+			commit:  "c2",
+			date:    1500003600,
+			parents: 1,
+			files: []lib.GitFile{
+				{Path: "a.txt", Size: 10, Additions: 2, Deletions: 1},
+				{Path: "bin.dat", Size: -1, Additions: -1, Deletions: -1},
+				{Path: "dir/sub/c.txt", Size: 1, Additions: 1, Deletions: 0},
+				{Path: "gone.txt", Size: 7, Additions: 1, Deletions: 1},
+				{Path: "vendor/x.go", Size: 10, Additions: 1, Deletions: 0},
+			},
+		},
+		{
+			commit:  "c3",
+			date:    1500007200,
+			parents: 1,
+			files: []lib.GitFile{
+				{Path: "dir/b2.go", OldPath: "dir/b.go", Size: 842, Additions: 1, Deletions: 0},
+				{Path: "docs/a.txt", OldPath: "a.txt", Size: 10, Additions: 0, Deletions: 0},
+				{Path: "new.txt", Size: 4, Additions: 1, Deletions: 0},
+			},
+		},
+		{commit: "c4", date: 1500010800, parents: 1, files: nil},
+		{commit: "c5", date: 1500015600, parents: 2, files: nil},
+	}
+
+	// Expected tags
+	expectedTags := []lib.GitTag{
+		{Name: "v0.1", Date: time.Unix(1500000000, 0), Subject: "c1"},
+		{Name: "v0.1.1", Date: time.Unix(1500003600, 0), Subject: "No tagger"},
+		{Name: "v0.2", Date: time.Unix(1500022800, 0), Subject: "Release 0.2 second line"},
+	}
+
+	// Check loose objects first, then the same data after packing with deltas
+	for _, stage := range []string{"loose", "packed"} {
+		if stage == "packed" {
+			f.git("repack", "-q", "-a", "-d", "-f", "--depth=50", "--window=250")
+			f.git("pack-refs", "--all")
+			f.git("prune")
+		}
+		repo, err := lib.OpenGitRepo(f.dir)
+		if err != nil {
+			t.Fatalf("%s: %v", stage, err)
+		}
+		for index, test := range testCases {
+			commit, err := repo.CommitFiles(f.shas[test.commit])
+			if err != nil {
+				t.Errorf("%s: test number %d: %v", stage, index+1, err)
+				continue
+			}
+			if commit.SHA != f.shas[test.commit] || commit.Date.Unix() != test.date || len(commit.Parents) != test.parents {
+				t.Errorf(
+					"%s: test number %d, expected date %d and %d parents, got %+v",
+					stage, index+1, test.date, test.parents, commit,
+				)
+			}
+			if !reflect.DeepEqual(commit.Files, test.files) {
+				t.Errorf(
+					"%s: test number %d, expected files:\n%+v\ngot:\n%+v",
+					stage, index+1, test.files, commit.Files,
+				)
+			}
+		}
+		tags, err := repo.Tags()
+		if err != nil {
+			t.Errorf("%s: %v", stage, err)
+		}
+		if !reflect.DeepEqual(tags, expectedTags) {
+			t.Errorf("%s: expected tags:\n%+v\ngot:\n%+v", stage, expectedTags, tags)
+		}
+		_, err = repo.CommitFiles("0123456789012345678901234567890123456789")
+		if err == nil {
+			t.Errorf("%s: expected error for missing commit", stage)
+		}
+		_, err = repo.CommitFiles("invalid")
+		if err == nil {
+			t.Errorf("%s: expected error for invalid SHA", stage)
+		}
+		if err = repo.Close(); err != nil {
+			t.Errorf("%s: %v", stage, err)
+		}
+	}
+
+	// Not a git repository
+	_, err := lib.OpenGitRepo(filepath.Join(f.dir, "dir"))
+	if err == nil {
+		t.Errorf("expected error when opening directory that is not a repository")
+	}
+}
+
+func TestGitLinesOfCode(t *testing.T) {
+	f := newGitFixture(t)
+	defer func() { _ = os.RemoveAll(f.dir) }()
+	repo, err := lib.OpenGitRepo(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	// Refs resolution
+	var refsTestCases = []struct {
+		ref      string
+		expected string
+	}{
+		{ref: "HEAD", expected: f.shas["c5"]},
+		{ref: "v0.1", expected: f.shas["c1"]},
+		{ref: "v0.2", expected: f.shas["c3"]},
+		{ref: "refs/tags/v0.2", expected: f.shas["c3"]},
+		{ref: "side", expected: f.shas["side"]},
+		{ref: f.shas["c2"], expected: f.shas["c2"]},
+		{ref: "missing", expected: ""},
+	}
+	for index, test := range refsTestCases {
+		got, err := repo.ResolveRef(test.ref)
+		if test.expected == "" && err == nil {
+			t.Errorf("test number %d, ref '%s', expected error, got '%s'", index+1, test.ref, got)
+		}
+		if got != test.expected {
+			t.Errorf("test number %d, ref '%s', expected '%s', got '%s' (%v)", index+1, test.ref, test.expected, got, err)
+		}
+	}
+
+	// Commits at dates, following first parents
+	var datesTestCases = []struct {
+		unix     int64
+		expected string
+	}{
+		{unix: 1499999999, expected: ""},
+		{unix: 1500000000, expected: f.shas["c1"]},
+		{unix: 1500007201, expected: f.shas["c3"]},
+		{unix: 1500013000, expected: f.shas["c4"]},
+		{unix: 1600000000, expected: f.shas["c5"]},
+	}
+	for index, test := range datesTestCases {
+		got, err := repo.CommitAt("HEAD", time.Unix(test.unix, 0))
+		if err != nil {
+			t.Errorf("test number %d: %v", index+1, err)
+		}
+		if got != test.expected {
+			t.Errorf("test number %d, date %d, expected '%s', got '%s'", index+1, test.unix, test.expected, got)
+		}
+	}
+
+	// Lines of code per language, skipping vendor and binary files
+	skip := regexp.MustCompile(`(^|/)vendor/`)
+	var locTestCases = []struct {
+		ref      string
+		expected []lib.GitLOC
+	}{
+		{
+			ref: "v0.1",
+			expected: []lib.GitLOC{
+				{Language: "Go", Files: 1, Lines: 42, Size: 833},
+				{Language: "Text", Files: 2, Lines: 5, Size: 14},
+			},
+		},
+		{
+			ref: "HEAD",
+			expected: []lib.GitLOC{
+				{Language: "Go", Files: 1, Lines: 43, Size: 842},
+				{Language: "Text", Files: 5, Lines: 9, Size: 27},
+			},
+		},
+	}
+	for index, test := range locTestCases {
+		got, err := repo.LinesOfCode(test.ref, skip)
+		if err != nil {
+			t.Errorf("test number %d: %v", index+1, err)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, ref '%s', expected:\n%+v\ngot:\n%+v", index+1, test.ref, test.expected, got)
+		}
+	}
+}
+
+func TestGitLog(t *testing.T) {
+	f := newGitFixture(t)
+	defer func() { _ = os.RemoveAll(f.dir) }()
+
+	// Repository is read in-process, so `git` binary is not needed
+	path := os.Getenv("PATH")
+	defer func() { _ = os.Setenv("PATH", path) }()
+	if err := os.Setenv("PATH", ""); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := lib.OpenGitRepo(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = repo.Close() }()
+
+	// All commits reachable from a given ref, oldest first
+	var testCases = []struct {
+		ref      string
+		expected []string
+	}{
+		{ref: "HEAD", expected: []string{"c1", "c2", "c3", "c4", "side", "c5"}},
+		{ref: "side", expected: []string{"c1", "c2", "c3", "side"}},
+		{ref: "v0.1", expected: []string{"c1"}},
+	}
+	for index, test := range testCases {
+		commits, err := repo.Log(test.ref)
+		if err != nil {
+			t.Errorf("test number %d: %v", index+1, err)
+			continue
+		}
+		got := []string{}
+		for _, commit := range commits {
+			if commit.AuthorName != "Author" || commit.AuthorEmail != "author@example.com" || commit.Files != nil {
+				t.Errorf("test number %d, unexpected commit data: %+v", index+1, commit)
+			}
+			name := strings.TrimSpace(commit.Message)
+			if f.shas[name] != commit.SHA {
+				t.Errorf("test number %d, commit '%s' has unexpected SHA %s", index+1, name, commit.SHA)
+			}
+			got = append(got, name)
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, ref '%s', expected %v, got %v", index+1, test.ref, test.expected, got)
+		}
+	}
+}
+
+func TestGitShallow(t *testing.T) {
+	f := newGitFixture(t)
+	defer func() { _ = os.RemoveAll(f.dir) }()
+	dir := f.dir + "_shallow"
+	defer func() { _ = os.RemoveAll(dir) }()
+	f.git("clone", "-q", "--depth", "1", "file://"+f.dir, dir)
+	repo, err := lib.OpenGitRepo(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = repo.Close() }()
+	if !repo.Shallow {
+		t.Errorf("expected shallow repository")
+	}
+
+	// Only commits above the shallow boundary are available
+	commits, err := repo.Log("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 1 || commits[0].SHA != f.shas["c5"] {
+		t.Errorf("expected only c5 commit, got %+v", commits)
+	}
+
+	// Boundary commit's parents are unknown, so its files cannot be computed
+	_, err = repo.CommitFiles(f.shas["c5"])
+	if err == nil {
+		t.Errorf("expected error for shallow boundary commit")
+	}
+	files, err := repo.CommitsFiles([]string{f.shas["c5"], f.shas["c2"]})
+	if err != nil || len(files) != 0 {
+		t.Errorf("expected no commits, got %+v, %v", files, err)
+	}
+}
@@ -0,0 +1,291 @@
+package devstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	lib "devstats"
+)
+
+// fakeGrafana - in memory stand-in of Grafana HTTP API endpoints used by GrafanaSync
+type fakeGrafana struct {
+	mtx         sync.Mutex
+	folders     []lib.GrafanaFolder
+	datasources map[string]lib.GrafanaDatasource
+	dashboards  map[string]map[string]interface{}
+	dashFolders map[string]int
+	prefs       map[string]interface{}
+	writes      int
+}
+
+func newFakeGrafana() *fakeGrafana {
+	return &fakeGrafana{
+		datasources: make(map[string]lib.GrafanaDatasource),
+		dashboards:  make(map[string]map[string]interface{}),
+		dashFolders: make(map[string]int),
+		prefs:       map[string]interface{}{"theme": "dark", "homeDashboardId": 0},
+	}
+}
+
+func (f *fakeGrafana) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if r.Header.Get("Authorization") != "Bearer key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"Unauthorized"}`)
+		return
+	}
+	if r.Method != "GET" {
+		f.writes++
+	}
+	reply := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		lib.FatalOnError(json.NewEncoder(w).Encode(v))
+	}
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message":"Not found"}`)
+	}
+	path := r.URL.Path
+	switch {
+	case r.Method == "GET" && path == "/api/folders":
+		limit, page := 1000, 1
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, _ = strconv.Atoi(v)
+		}
+		if v := r.URL.Query().Get("page"); v != "" {
+			page, _ = strconv.Atoi(v)
+		}
+		from, to := (page-1)*limit, page*limit
+		if from > len(f.folders) {
+			from = len(f.folders)
+		}
+		if to > len(f.folders) {
+			to = len(f.folders)
+		}
+		reply(f.folders[from:to])
+	case r.Method == "POST" && path == "/api/folders":
+		var folder lib.GrafanaFolder
+		lib.FatalOnError(json.NewDecoder(r.Body).Decode(&folder))
+		folder.ID = 100 + len(f.folders)
+		f.folders = append(f.folders, folder)
+		reply(folder)
+	case r.Method == "GET" && strings.HasPrefix(path, "/api/datasources/name/"):
+		ds, ok := f.datasources[strings.TrimPrefix(path, "/api/datasources/name/")]
+		if !ok {
+			notFound()
+			return
+		}
+		reply(ds)
+	case r.Method == "POST" && path == "/api/datasources", r.Method == "PUT" && strings.HasPrefix(path, "/api/datasources/"):
+		var ds lib.GrafanaDatasource
+		lib.FatalOnError(json.NewDecoder(r.Body).Decode(&ds))
+		ds.ID = 1
+		ds.SecureJSONData = nil
+		f.datasources[ds.Name] = ds
+		reply(map[string]interface{}{"id": ds.ID})
+	case r.Method == "GET" && strings.HasPrefix(path, "/api/dashboards/uid/"):
+		uid := strings.TrimPrefix(path, "/api/dashboards/uid/")
+		dash, ok := f.dashboards[uid]
+		if !ok {
+			notFound()
+			return
+		}
+		reply(map[string]interface{}{"dashboard": dash, "meta": map[string]interface{}{"folderId": f.dashFolders[uid]}})
+	case r.Method == "POST" && path == "/api/dashboards/db":
+		var req struct {
+			Dashboard map[string]interface{} `json:"dashboard"`
+			FolderID  int                    `json:"folderId"`
+			Overwrite bool                   `json:"overwrite"`
+		}
+		lib.FatalOnError(json.NewDecoder(r.Body).Decode(&req))
+		uid := req.Dashboard["uid"].(string)
+		if req.Dashboard["id"] != nil || !req.Overwrite {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `{"message":"version-mismatch"}`)
+			return
+		}
+		id, version := float64(len(f.dashboards)+1), float64(1)
+		if old, ok := f.dashboards[uid]; ok {
+			id, version = old["id"].(float64), old["version"].(float64)+1
+		}
+		req.Dashboard["id"], req.Dashboard["version"] = id, version
+		f.dashboards[uid] = req.Dashboard
+		f.dashFolders[uid] = req.FolderID
+		reply(map[string]interface{}{"id": id, "uid": uid, "status": "success", "version": version})
+	case r.Method == "GET" && path == "/api/org/preferences":
+		reply(f.prefs)
+	case r.Method == "PUT" && path == "/api/org/preferences":
+		f.prefs = make(map[string]interface{})
+		lib.FatalOnError(json.NewDecoder(r.Body).Decode(&f.prefs))
+		reply(map[string]string{"message": "Preferences updated"})
+	default:
+		notFound()
+	}
+}
+
+func testGrafanaChanges(changes []lib.GrafanaChange) []string {
+	res := []string{}
+	for _, change := range changes {
+		res = append(res, change.String())
+	}
+	return res
+}
+
+func TestGrafanaSync(t *testing.T) {
+	fake := newFakeGrafana()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	gc := &lib.GrafanaClient{URL: server.URL, Key: "key", HTTP: server.Client()}
+	ds := &lib.GrafanaDatasource{Name: "psql", Type: "postgres", Access: "proxy", URL: "localhost:5432", Database: "gha", User: "ro_user", IsDefault: true}
+	jsons := map[string][]byte{
+		"dashboards.json": []byte(`{"id": 12, "uid": "12", "title": "Dashboards", "tags": ["home", "all"], "version": 45, "panels": []}`),
+		"prs.json":        []byte(`{"id": 7, "uid": "7", "title": "PRs", "tags": ["prs"], "panels": [{"targets": [{"rawSql": "select 1"}]}]}`),
+	}
+
+	// Dry run: nothing written
+	changes, err := lib.GrafanaSync(gc, "Kubernetes", ds, jsons, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"create datasource 'psql'",
+		"create folder 'Kubernetes'",
+		"create dashboard '12 Dashboards'",
+		"create dashboard '7 PRs'",
+		"update home 'Dashboards'",
+	}
+	if got := testGrafanaChanges(changes); !reflect.DeepEqual(got, expected) {
+		t.Errorf("dry run: expected %v, got %v", expected, got)
+	}
+	if fake.writes != 0 {
+		t.Errorf("dry run: expected no writes, got %d", fake.writes)
+	}
+
+	// Provision
+	_, err = lib.GrafanaSync(gc, "Kubernetes", ds, jsons, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.dashboards) != 2 || fake.dashFolders["7"] != 100 || fake.datasources["psql"].Database != "gha" {
+		t.Errorf("unexpected Grafana state: %+v", fake)
+	}
+	homeID := fake.dashboards["12"]["id"]
+	if fake.prefs["homeDashboardId"] != homeID || fake.prefs["theme"] != "dark" {
+		t.Errorf("unexpected preferences: %+v, home dashboard id: %v", fake.prefs, homeID)
+	}
+
+	// Nothing changed, JSON IDs and versions are ignored
+	writes := fake.writes
+	changes, err = lib.GrafanaSync(gc, "Kubernetes", ds, jsons, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range changes {
+		if change.Action != "unchanged" {
+			t.Errorf("expected no changes, got %v", change)
+		}
+	}
+	if fake.writes != writes {
+		t.Errorf("expected no writes, got %d", fake.writes-writes)
+	}
+
+	// Panel SQL, tags and datasource changed
+	jsons["prs.json"] = []byte(`{"id": 7, "uid": "7", "title": "PRs", "tags": ["prs", "new"], "panels": [{"targets": [{"rawSql": "select 2"}]}]}`)
+	ds.Database = "k8s"
+	changes, err = lib.GrafanaSync(gc, "Kubernetes", ds, jsons, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"update datasource 'psql': database",
+		"unchanged folder 'Kubernetes'",
+		"unchanged dashboard '12 Dashboards'",
+		"update dashboard '7 PRs': panels[0].targets[0].rawSql, tags",
+		"unchanged home 'Dashboards'",
+	}
+	if got := testGrafanaChanges(changes); !reflect.DeepEqual(got, expected) {
+		t.Errorf("dry run update: expected %v, got %v", expected, got)
+	}
+	_, err = lib.GrafanaSync(gc, "Kubernetes", ds, jsons, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fake.dashboards["7"]["version"] != float64(2) || fake.datasources["psql"].Database != "k8s" {
+		t.Errorf("expected updated dashboard and datasource: %+v, %+v", fake.dashboards["7"], fake.datasources["psql"])
+	}
+
+	// Dry run into a folder that doesn't exist yet: folder creation is reported once, not for every dashboard
+	changes, err = lib.GrafanaSync(gc, "CNCF", ds, jsons, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"unchanged datasource 'psql'",
+		"create folder 'CNCF'",
+		"unchanged dashboard '12 Dashboards'",
+		"unchanged dashboard '7 PRs'",
+		"unchanged home 'Dashboards'",
+	}
+	if got := testGrafanaChanges(changes); !reflect.DeepEqual(got, expected) {
+		t.Errorf("dry run new folder: expected %v, got %v", expected, got)
+	}
+
+	// Duplicate uids and API errors
+	jsons["copy.json"] = jsons["prs.json"]
+	if _, err = lib.GrafanaSync(gc, "", nil, jsons, true); err == nil || !strings.Contains(err.Error(), "duplicate dashboard uid") {
+		t.Errorf("expected duplicate uid error, got %v", err)
+	}
+	delete(jsons, "copy.json")
+	gc.Key = "wrong"
+	if _, err = lib.GrafanaSync(gc, "", nil, jsons, true); err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+		t.Errorf("expected unauthorized error, got %v", err)
+	}
+}
+
+func TestGrafanaEnsureFolderPages(t *testing.T) {
+	fake := newFakeGrafana()
+	for i := 0; i < 1500; i++ {
+		fake.folders = append(fake.folders, lib.GrafanaFolder{ID: i + 1, Title: fmt.Sprintf("Folder %d", i+1)})
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	gc := &lib.GrafanaClient{URL: server.URL, Key: "key", HTTP: server.Client()}
+	id, change, err := gc.EnsureFolder("Folder 1200", false)
+	if err != nil || id != 1200 || change.Action != "unchanged" {
+		t.Errorf("expected existing folder 1200 from the second page, got %d, %v, %v", id, change, err)
+	}
+	id, change, err = gc.EnsureFolder("Folder 1501", true)
+	if err != nil || id != -1 || change.Action != "create" || fake.writes != 0 {
+		t.Errorf("expected folder to be created, got %d, %v, %v", id, change, err)
+	}
+}
+
+func TestGrafanaDashboardDiff(t *testing.T) {
+	var testCases = []struct {
+		from     string
+		to       string
+		expected []string
+	}{
+		{from: `{"id": 1, "version": 2, "title": "A"}`, to: `{"id": 3, "title": "A"}`, expected: []string{}},
+		{from: `{"title": "A", "tags": ["a"]}`, to: `{"title": "B", "tags": ["a", "b"]}`, expected: []string{"tags", "title"}},
+		{from: `{"panels": [{"id": 1, "targets": [{"rawSql": "a"}]}]}`, to: `{"panels": [{"id": 2, "targets": [{"rawSql": "a"}]}]}`, expected: []string{"panels[0].id"}},
+		{from: `{"templating": {"list": []}}`, to: `{"templating": {"list": [], "enable": true}}`, expected: []string{"templating.enable"}},
+		{from: `{"time": {"from": "now-1y"}}`, to: `{"time": "now"}`, expected: []string{"time"}},
+	}
+	for index, test := range testCases {
+		var from, to map[string]interface{}
+		lib.FatalOnError(json.Unmarshal([]byte(test.from), &from))
+		lib.FatalOnError(json.Unmarshal([]byte(test.to), &to))
+		if got := lib.GrafanaDashboardDiff(from, to); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
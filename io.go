@@ -2,6 +2,7 @@ package devstats
 
 import (
 	"io/ioutil"
+	"os"
 	"strings"
 )
 
@@ -16,3 +17,19 @@ func ReadFile(ctx *Ctx, path string) ([]byte, error) {
 	path = strings.Replace(path, "/"+ctx.Project+"/", "/shared/", -1)
 	return ioutil.ReadFile(path)
 }
+
+// ResolveFile returns path that ReadFile would read: given path if it exists
+// or its shared version (/proj/ -> /shared/) if only that one exists
+func ResolveFile(ctx *Ctx, path string) string {
+	if ctx.Project == "" {
+		return path
+	}
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	shared := strings.Replace(path, "/"+ctx.Project+"/", "/shared/", -1)
+	if _, err := os.Stat(shared); err == nil {
+		return shared
+	}
+	return path
+}
@@ -0,0 +1,135 @@
+package devstats
+
+import (
+	"path"
+	"strings"
+)
+
+// OtherLanguage - language name used for files that cannot be classified
+const OtherLanguage string = "Other"
+
+// languageFileNames - maps special file names (lowercase) to languages
+var languageFileNames = map[string]string{
+	"makefile":       "Makefile",
+	"gnumakefile":    "Makefile",
+	"dockerfile":     "Dockerfile",
+	"build.bazel":    "Starlark",
+	"jenkinsfile":    "Groovy",
+	"cmakelists.txt": "CMake",
+	"gemfile":        "Ruby",
+	"rakefile":       "Ruby",
+	"vagrantfile":    "Ruby",
+	"go.mod":         "Go Module",
+	"go.sum":         "Go Module",
+	"gopkg.toml":     "TOML",
+	"gopkg.lock":     "TOML",
+	"owners":         "YAML",
+	"owners_aliases": "YAML",
+	"codeowners":     "Text",
+	"license":        "Text",
+	"authors":        "Text",
+	"notice":         "Text",
+}
+
+// languageExtensions - maps file extensions (lowercase, including dot) to languages
+var languageExtensions = map[string]string{
+	".go":         "Go",
+	".py":         "Python",
+	".pyx":        "Python",
+	".sh":         "Shell",
+	".bash":       "Shell",
+	".zsh":        "Shell",
+	".js":         "JavaScript",
+	".mjs":        "JavaScript",
+	".jsx":        "JavaScript",
+	".ts":         "TypeScript",
+	".tsx":        "TypeScript",
+	".java":       "Java",
+	".c":          "C",
+	".h":          "C",
+	".cc":         "C++",
+	".cpp":        "C++",
+	".cxx":        "C++",
+	".hh":         "C++",
+	".hpp":        "C++",
+	".rs":         "Rust",
+	".rb":         "Ruby",
+	".php":        "PHP",
+	".cs":         "C#",
+	".scala":      "Scala",
+	".kt":         "Kotlin",
+	".swift":      "Swift",
+	".m":          "Objective-C",
+	".lua":        "Lua",
+	".pl":         "Perl",
+	".pm":         "Perl",
+	".r":          "R",
+	".erl":        "Erlang",
+	".ex":         "Elixir",
+	".exs":        "Elixir",
+	".hs":         "Haskell",
+	".clj":        "Clojure",
+	".groovy":     "Groovy",
+	".gradle":     "Groovy",
+	".vue":        "Vue",
+	".ps1":        "PowerShell",
+	".bat":        "Batchfile",
+	".cmd":        "Batchfile",
+	".proto":      "Protocol Buffer",
+	".thrift":     "Thrift",
+	".bzl":        "Starlark",
+	".tf":         "HCL",
+	".hcl":        "HCL",
+	".jsonnet":    "Jsonnet",
+	".libsonnet":  "Jsonnet",
+	".sql":        "SQL",
+	".yaml":       "YAML",
+	".yml":        "YAML",
+	".json":       "JSON",
+	".toml":       "TOML",
+	".xml":        "XML",
+	".html":       "HTML",
+	".htm":        "HTML",
+	".css":        "CSS",
+	".scss":       "SCSS",
+	".less":       "Less",
+	".md":         "Markdown",
+	".markdown":   "Markdown",
+	".rst":        "reStructuredText",
+	".adoc":       "AsciiDoc",
+	".txt":        "Text",
+	".tpl":        "Template",
+	".tmpl":       "Template",
+	".mk":         "Makefile",
+	".dockerfile": "Dockerfile",
+	".ini":        "INI",
+	".cfg":        "INI",
+	".conf":       "INI",
+	".csv":        "CSV",
+	".svg":        "SVG",
+}
+
+// FileLanguage - returns file's language based on its name or extension
+// It uses simplified GitHub linguist-like rules: special file names first, then extensions
+// Returns `OtherLanguage` when language cannot be determined
+func FileLanguage(filePath string) string {
+	base := path.Base(filePath)
+	// Bazel files are only recognized with their exact names, "build" can be just a shell script
+	if base == "BUILD" || base == "WORKSPACE" {
+		return "Starlark"
+	}
+	base = strings.ToLower(base)
+	if lang, ok := languageFileNames[base]; ok {
+		return lang
+	}
+	// Dockerfile.build, Makefile.common etc.
+	for _, prefix := range []string{"dockerfile.", "makefile."} {
+		if strings.HasPrefix(base, prefix) {
+			return languageFileNames[strings.TrimSuffix(prefix, ".")]
+		}
+	}
+	if lang, ok := languageExtensions[path.Ext(base)]; ok {
+		return lang
+	}
+	return OtherLanguage
+}
@@ -0,0 +1,45 @@
+package devstats
+
+import (
+	"testing"
+
+	lib "devstats"
+)
+
+func TestFileLanguage(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		path     string
+		expected string
+	}{
+		{path: "main.go", expected: "Go"},
+		{path: "pkg/api/types.GO", expected: "Go"},
+		{path: "hack/verify.sh", expected: "Shell"},
+		{path: "docs/README.md", expected: "Markdown"},
+		{path: "build/Dockerfile", expected: "Dockerfile"},
+		{path: "images/Dockerfile.build", expected: "Dockerfile"},
+		{path: "Makefile", expected: "Makefile"},
+		{path: "Makefile.generated_files", expected: "Makefile"},
+		{path: "BUILD", expected: "Starlark"},
+		{path: "hack/build", expected: "Other"},
+		{path: "BUILD.bazel", expected: "Starlark"},
+		{path: "go.mod", expected: "Go Module"},
+		{path: "api/openapi-spec/swagger.json", expected: "JSON"},
+		{path: "cluster/addons/x.yml", expected: "YAML"},
+		{path: "pkg/OWNERS", expected: "YAML"},
+		{path: "LICENSE", expected: "Text"},
+		{path: "bin/binary", expected: "Other"},
+		{path: ".gitignore", expected: "Other"},
+		{path: "", expected: "Other"},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.FileLanguage(test.path)
+		if got != test.expected {
+			t.Errorf(
+				"test number %d, path '%s', expected '%s', got '%s'",
+				index+1, test.path, test.expected, got,
+			)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergeBucket - fingerprint of a part (bucket) of a table merged from a source database
+// Rows is the number of rows in the bucket, Hash is a sum of row hashes, so both new and changed rows are detected
+type MergeBucket struct {
+	Rows int64
+	Hash int64
+}
+
+// MergeStructure - creates merge state and conflicts tables in the output database if they don't exist
+func MergeStructure(con *sql.DB, ctx *Ctx) {
+	if !TableExists(con, ctx, "gha_merge_buckets") {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			CreateTable(
+				"gha_merge_buckets("+
+					"source varchar(100) not null, "+
+					"tbl varchar(100) not null, "+
+					"bucket bigint not null, "+
+					"rows bigint not null, "+
+					"hash bigint not null, "+
+					"updated_at {{tsnow}}, "+
+					"primary key(source, tbl, bucket)"+
+					")",
+			),
+		)
+	}
+	if !TableExists(con, ctx, "gha_merge_conflicts") {
+		ExecSQLWithErr(
+			con,
+			ctx,
+			CreateTable(
+				"gha_merge_conflicts("+
+					"id {{pkauto}}, "+
+					"dt {{tsnow}}, "+
+					"source varchar(100) not null, "+
+					"tbl varchar(100) not null, "+
+					"pk text not null, "+
+					"columns text not null, "+
+					"primary key(id)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(con, ctx, "create index merge_conflicts_dt_idx on gha_merge_conflicts(dt)")
+	}
+	// to_regclass also finds indexes
+	if !TableExists(con, ctx, "merge_conflicts_key_idx") {
+		// Conflicts saved before they were deduplicated, keep the most recent one
+		ExecSQLWithErr(
+			con,
+			ctx,
+			"delete from gha_merge_conflicts a using gha_merge_conflicts b "+
+				"where a.source = b.source and a.tbl = b.tbl and a.pk = b.pk and a.id < b.id",
+		)
+		ExecSQLWithErr(con, ctx, "create unique index merge_conflicts_key_idx on gha_merge_conflicts(source, tbl, pk)")
+	}
+}
+
+// MergeKeyIndex - makes sure that a table without primary key has an unique index on its natural key,
+// so rows can be inserted with "on conflict do nothing", duplicated rows that already exist are removed first
+func MergeKeyIndex(con *sql.DB, ctx *Ctx, table string, key []string) {
+	name := strings.TrimPrefix(table, "gha_") + "_merge_key_idx"
+	if TableExists(con, ctx, name) {
+		return
+	}
+	keys := strings.Join(key, ", ")
+	ExecSQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"delete from %s where ctid in (select ctid from "+
+				"(select ctid, row_number() over (partition by %s order by ctid) as n from %s) sub where n > 1)",
+			table,
+			keys,
+			table,
+		),
+	)
+	ExecSQLWithErr(con, ctx, fmt.Sprintf("create unique index %s on %s(%s)", name, table, keys))
+}
+
+// GetMergeBuckets - returns fingerprints of table buckets merged from a source database, empty when never merged
+func GetMergeBuckets(con *sql.DB, ctx *Ctx, source, table string) map[int64]MergeBucket {
+	buckets := make(map[int64]MergeBucket)
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf("select bucket, rows, hash from gha_merge_buckets where source = %s and tbl = %s", NValue(1), NValue(2)),
+		source,
+		table,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	var (
+		bucket int64
+		b      MergeBucket
+	)
+	for rows.Next() {
+		FatalOnError(rows.Scan(&bucket, &b.Rows, &b.Hash))
+		buckets[bucket] = b
+	}
+	FatalOnError(rows.Err())
+	return buckets
+}
+
+// SetMergeBuckets - replaces fingerprints of table buckets merged from a source database
+// When `from` is given only buckets at or above it are replaced (fingerprints of older buckets are kept)
+func SetMergeBuckets(con *sql.DB, ctx *Ctx, source, table string, buckets map[int64]MergeBucket, from *int64) {
+	tx, err := con.Begin()
+	FatalOnError(err)
+	if from == nil {
+		ExecSQLTxWithErr(tx, ctx, fmt.Sprintf("delete from gha_merge_buckets where source = %s and tbl = %s", NValue(1), NValue(2)), source, table)
+	} else {
+		ExecSQLTxWithErr(
+			tx,
+			ctx,
+			fmt.Sprintf("delete from gha_merge_buckets where source = %s and tbl = %s and bucket >= %s", NValue(1), NValue(2), NValue(3)),
+			source,
+			table,
+			*from,
+		)
+	}
+	for bucket, b := range buckets {
+		ExecSQLTxWithErr(
+			tx,
+			ctx,
+			"insert into gha_merge_buckets(source, tbl, bucket, rows, hash) "+NValues(5),
+			source,
+			table,
+			bucket,
+			b.Rows,
+			b.Hash,
+		)
+	}
+	FatalOnError(tx.Commit())
+}
+
+// MergeHighWaterMark - returns the highest bucket merged from a source database (high-water mark), false when never merged
+// Incremental merge only fingerprints source buckets at or above it, the last merged bucket can still get new rows
+func MergeHighWaterMark(merged map[int64]MergeBucket) (mark int64, ok bool) {
+	for bucket := range merged {
+		if !ok || bucket > mark {
+			mark = bucket
+			ok = true
+		}
+	}
+	return
+}
+
+// MergeChangedRanges - returns ranges of source buckets that are new or changed since the last merge
+// Consecutive (in source buckets order) changed buckets are returned as a single [from, to] range
+func MergeChangedRanges(source, merged map[int64]MergeBucket) (ranges [][2]int64) {
+	buckets := []int64{}
+	for bucket := range source {
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	open := false
+	for _, bucket := range buckets {
+		m, ok := merged[bucket]
+		if ok && m == source[bucket] {
+			open = false
+			continue
+		}
+		if open {
+			ranges[len(ranges)-1][1] = bucket
+			continue
+		}
+		ranges = append(ranges, [2]int64{bucket, bucket})
+		open = true
+	}
+	return
+}
+
+// AddMergeConflict - records a row with the same key but different content in source and output databases
+// Each key is recorded once per source and table, differing columns and date are updated
+func AddMergeConflict(con *sql.DB, ctx *Ctx, source, table, pk string, columns []string) {
+	ExecSQLWithErr(
+		con,
+		ctx,
+		"insert into gha_merge_conflicts(source, tbl, pk, columns) "+NValues(4)+
+			" on conflict(source, tbl, pk) do update set columns = excluded.columns, dt = now()",
+		source,
+		table,
+		pk,
+		strings.Join(columns, ","),
+	)
+}
+
+// TablePrimaryKey - returns table's primary key columns (in key order), empty when table has no primary key
+func TablePrimaryKey(con *sql.DB, ctx *Ctx, table string) (columns []string) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"select a.attname from pg_index i, pg_attribute a where i.indrelid = %s::regclass and i.indisprimary "+
+				"and a.attrelid = i.indrelid and a.attnum = any(i.indkey) order by array_position(i.indkey::int2[], a.attnum)",
+			NValue(1),
+		),
+		table,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	column := ""
+	for rows.Next() {
+		FatalOnError(rows.Scan(&column))
+		columns = append(columns, column)
+	}
+	FatalOnError(rows.Err())
+	return
+}
+
+// mergeValue - normalizes value returned by the driver, so values from different databases can be compared
+func mergeValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []byte:
+		return string(value)
+	case time.Time:
+		return value.UTC()
+	default:
+		return v
+	}
+}
+
+// MergeRowDiff - returns names of columns that have different values in a and b rows
+func MergeRowDiff(columns []string, a, b []interface{}) (diff []string) {
+	for i, column := range columns {
+		va := mergeValue(a[i])
+		vb := mergeValue(b[i])
+		if ta, ok := va.(time.Time); ok {
+			if tb, ok := vb.(time.Time); ok && ta.Equal(tb) {
+				continue
+			}
+			diff = append(diff, column)
+			continue
+		}
+		if va != vb {
+			diff = append(diff, column)
+		}
+	}
+	return
+}
+
+// MergeKeyString - returns primary key values description, like "id=1,event_id=2"
+func MergeKeyString(columns []string, values []interface{}) string {
+	s := []string{}
+	for i, column := range columns {
+		s = append(s, fmt.Sprintf("%s=%v", column, mergeValue(values[i])))
+	}
+	return strings.Join(s, ",")
+}
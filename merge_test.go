@@ -0,0 +1,83 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestMergeRowDiff(t *testing.T) {
+	dt := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+	columns := []string{"id", "event_id", "body", "created_at", "closed_at", "locked"}
+	var testCases = []struct {
+		a, b     []interface{}
+		expected []string
+	}{
+		{
+			a: []interface{}{int64(1), int64(2), "text", dt, nil, false},
+			b: []interface{}{int64(1), int64(2), []byte("text"), dt.In(time.FixedZone("CET", 3600)), nil, false},
+		},
+		{
+			a:        []interface{}{int64(1), int64(2), "text", dt, nil, false},
+			b:        []interface{}{int64(1), int64(2), "other", dt.Add(time.Second), dt, true},
+			expected: []string{"body", "created_at", "closed_at", "locked"},
+		},
+		{
+			a:        []interface{}{int64(1), int64(3), nil, nil, dt, false},
+			b:        []interface{}{int64(1), int64(2), "", nil, dt, false},
+			expected: []string{"event_id", "body"},
+		},
+	}
+	for index, test := range testCases {
+		got := lib.MergeRowDiff(columns, test.a, test.b)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+	got := lib.MergeKeyString([]string{"sha", "event_id"}, []interface{}{[]byte("abc"), int64(-12)})
+	if got != "sha=abc,event_id=-12" {
+		t.Errorf("unexpected key string: %s", got)
+	}
+}
+
+func TestMergeHighWaterMark(t *testing.T) {
+	if _, ok := lib.MergeHighWaterMark(map[int64]lib.MergeBucket{}); ok {
+		t.Errorf("expected no high-water mark for never merged table")
+	}
+	mark, ok := lib.MergeHighWaterMark(map[int64]lib.MergeBucket{-30: {}, 17: {}, 0: {}, 5: {}})
+	if !ok || mark != 17 {
+		t.Errorf("expected high-water mark 17, got %d, %v", mark, ok)
+	}
+	mark, ok = lib.MergeHighWaterMark(map[int64]lib.MergeBucket{-30: {}, -2: {}})
+	if !ok || mark != -2 {
+		t.Errorf("expected high-water mark -2, got %d, %v", mark, ok)
+	}
+}
+
+func TestMergeChangedRanges(t *testing.T) {
+	b := func(rows, hash int64) lib.MergeBucket { return lib.MergeBucket{Rows: rows, Hash: hash} }
+	source := map[int64]lib.MergeBucket{-3: b(1, 1), 0: b(2, 2), 5: b(3, 3), 7: b(4, 4), 100: b(5, 5), 101: b(6, 6)}
+	var testCases = []struct {
+		merged   map[int64]lib.MergeBucket
+		expected [][2]int64
+	}{
+		{merged: map[int64]lib.MergeBucket{}, expected: [][2]int64{{-3, 101}}},
+		{merged: source},
+		{
+			merged:   map[int64]lib.MergeBucket{-3: b(1, 1), 0: b(2, 2), 5: b(3, 2), 7: b(4, 4), 101: b(6, 6), 200: b(1, 1)},
+			expected: [][2]int64{{5, 5}, {100, 100}},
+		},
+		{
+			merged:   map[int64]lib.MergeBucket{-3: b(1, 1), 101: b(6, 6)},
+			expected: [][2]int64{{0, 100}},
+		},
+	}
+	for index, test := range testCases {
+		got := lib.MergeChangedRanges(source, test.merged)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
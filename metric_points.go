@@ -0,0 +1,350 @@
+package devstats
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricValueDescription - return string description for given float value
+// descFunc specifies how to treat value
+// currently supported:
+// `time_diff_as_string`: return string description of value that holds number of hours passed
+// like 30 -> 1 day 6 hours, 100 -> 4 days 4 hours, etc...
+func MetricValueDescription(descFunc string, value float64) (string, error) {
+	switch descFunc {
+	case "time_diff_as_string":
+		return DescriblePeriodInHours(value), nil
+	default:
+		return "", fmt.Errorf("unknown value description function '%v'", descFunc)
+	}
+}
+
+// MetricString - returns metric result value as a string, NULL is an empty string
+func MetricString(pValue *string) string {
+	if pValue == nil {
+		return ""
+	}
+	return *pValue
+}
+
+// MetricFloat - returns metric result value as a float, NULL and non-numeric values are 0
+func MetricFloat(pValue *string) float64 {
+	if pValue == nil {
+		return 0.0
+	}
+	value, _ := strconv.ParseFloat(*pValue, 64)
+	return value
+}
+
+// MetricValue - returns metric result value as a time series field value
+// Untyped values are float64 (see MetricFloat), typed values keep their SQL type (dbType like INT8, BOOL or JSONB):
+// integers are int64, booleans are bool, JSON is TSJSONValue, other values are float64 and NULLs are nil
+func MetricValue(pValue *string, dbType string, typed bool) (interface{}, error) {
+	if !typed {
+		return MetricFloat(pValue), nil
+	}
+	if pValue == nil {
+		return nil, nil
+	}
+	switch dbType {
+	case "INT2", "INT4", "INT8":
+		value, err := strconv.ParseInt(*pValue, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	case "BOOL":
+		value, err := strconv.ParseBool(*pValue)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	case "JSON", "JSONB":
+		return TSJSONValue(*pValue), nil
+	default:
+		value, err := strconv.ParseFloat(*pValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("non-numeric %s value '%s'", dbType, *pValue)
+		}
+		return value, nil
+	}
+}
+
+// Returns multi row and multi column series names array (different for different rows)
+// Each row must be in format: 'prefix;rowName;series1,series2,..,seriesN' serVal1 serVal2 ... serValN
+// if multivalue is true then rowName is not used for generating series name
+// Series name is independent from rowName, and metric returns "series_name;rowName"
+// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
+func multiRowMultiColumn(expr string, multivalue, escapeValueName bool) (result []string, err error) {
+	ary := strings.Split(expr, ";")
+	if len(ary) < 3 {
+		return nil, fmt.Errorf("multi_row_multi_column row '%s' must be in 'prefix;rowName;series1,...,seriesN' format", expr)
+	}
+	pref := ary[0]
+	if pref == "" {
+		Printf("multiRowMultiColumn: Info: prefix '%v' (ary=%+v,expr=%+v,mv=%+v) skipping\n", pref, ary, expr, multivalue)
+		return
+	}
+	splitColumns := strings.Split(ary[2], ",")
+	if multivalue {
+		rowNameAry := strings.Split(ary[1], "`")
+		rowName := rowNameAry[0]
+		if escapeValueName {
+			rowName = NormalizeName(rowName)
+		}
+		if len(rowNameAry) > 1 {
+			rowNameNonMulti := NormalizeName(rowNameAry[1])
+			for _, series := range splitColumns {
+				result = append(result, fmt.Sprintf("%s%s%s;%s", pref, rowNameNonMulti, series, rowName))
+			}
+			return
+		}
+		for _, series := range splitColumns {
+			result = append(result, fmt.Sprintf("%s%s;%s", pref, series, rowName))
+		}
+		return
+	}
+	rowName := NormalizeName(ary[1])
+	if rowName == "" {
+		Printf("multiRowMultiColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
+		return
+	}
+	for _, series := range splitColumns {
+		result = append(result, fmt.Sprintf("%s%s%s", pref, rowName, series))
+	}
+	return
+}
+
+// Return default series names from multi row result single column
+// Each row is "prefix,rowName", value (prefix is hardcoded in metric, so it is assumed safe)
+// and returns array [a_q, b_q, c_q, .., z_q]
+// if multivalue is true then rowName is not used for generating series name
+// Series name is independent from rowName, and metric returns "series_name;rowName"
+// Multivalue series can even have partialy multivalue row: "this_comes_to_multivalues`this_comes_to_series_name", separator is `
+func multiRowSingleColumn(col string, multivalue, escapeValueName bool) (result []string, err error) {
+	ary := strings.Split(col, ",")
+	if len(ary) < 2 {
+		return nil, fmt.Errorf("multi_row_single_column row '%s' must be in 'prefix,rowName' format", col)
+	}
+	pref := ary[0]
+	if pref == "" {
+		Printf("multiRowSingleColumn: Info: prefix '%v' (ary=%+v,col=%+v,mv=%+v) skipping\n", pref, ary, col, multivalue)
+		return
+	}
+	if multivalue {
+		rowNameAry := strings.Split(ary[1], "`")
+		rowName := rowNameAry[0]
+		if escapeValueName {
+			rowName = NormalizeName(rowName)
+		}
+		if len(rowNameAry) > 1 {
+			rowNameNonMulti := NormalizeName(rowNameAry[1])
+			return []string{fmt.Sprintf("%s%s;%s", pref, rowNameNonMulti, rowName)}, nil
+		}
+		return []string{fmt.Sprintf("%s;%s", pref, rowName)}, nil
+	}
+	rowName := NormalizeName(ary[1])
+	if rowName == "" {
+		Printf("multiRowSingleColumn: Info: rowName '%v' (%+v) maps to empty string, skipping\n", ary[1], ary)
+		return
+	}
+	return []string{fmt.Sprintf("%s%s", pref, rowName)}, nil
+}
+
+// MetricRowNames - generates series names for given metric row (first column value)
+// metric is the series name function: single_row_multi_column, multi_row_single_column or multi_row_multi_column
+func MetricRowNames(metric, name string, multivalue, escapeValueName bool) ([]string, error) {
+	switch metric {
+	case "single_row_multi_column":
+		return strings.Split(name, ","), nil
+	case "multi_row_single_column":
+		return multiRowSingleColumn(name, multivalue, escapeValueName)
+	case "multi_row_multi_column":
+		return multiRowMultiColumn(name, multivalue, escapeValueName)
+	default:
+		return nil, fmt.Errorf("unknown metric '%v'", metric)
+	}
+}
+
+// MetricSeriesTables - returns live series tables that a time series metric always writes to:
+// merged series table or the series table when metric doesn't use a series function
+// Series names returned by series functions depend on metric results, so their tables cannot be known in advance
+func MetricSeriesTables(seriesNameOrFunc, mergeSeries string) []string {
+	if mergeSeries != "" {
+		return []string{"s" + mergeSeries}
+	}
+	switch seriesNameOrFunc {
+	case "single_row_multi_column", "multi_row_single_column", "multi_row_multi_column":
+		return nil
+	default:
+		return []string{"s" + seriesNameOrFunc}
+	}
+}
+
+// MetricPoints - returns time series points for a single time series metric result (one interval starting at dt)
+// Metric either returns single row with single numeric value (series name is seriesNameOrFunc),
+// or multiple rows, each containing series name(s) (see MetricRowNames) and its numeric value(s)
+// typed keeps values SQL types and NULLs (see MetricValue), otherwise all values are floats and NULLs are 0
+func MetricPoints(
+	ctx *Ctx,
+	rows MetricRows,
+	seriesNameOrFunc, period, desc string,
+	multivalue, escapeValueName, typed bool,
+	dt time.Time,
+) (pts TSPoints, err error) {
+	// Get Number of columns
+	nColumns := len(rows.Columns)
+
+	// Column database type (unknown for combined results)
+	columnType := func(idx int) string {
+		if idx < len(rows.Types) {
+			return rows.Types[idx]
+		}
+		return ""
+	}
+
+	// Use value descriptions?
+	useDesc := desc != ""
+	valueFields := func(value interface{}, pValue *string) (map[string]interface{}, error) {
+		fields := map[string]interface{}{"value": value}
+		if useDesc {
+			if value == nil {
+				// NULL (typed) value has no description
+				fields["descr"] = (*string)(nil)
+				return fields, nil
+			}
+			descr, err := MetricValueDescription(desc, MetricFloat(pValue))
+			if err != nil {
+				return nil, err
+			}
+			fields["descr"] = descr
+		}
+		return fields, nil
+	}
+
+	// Single row & single column result
+	if nColumns == 1 {
+		rowCount := len(rows.Rows)
+		if rowCount != 1 {
+			Printf(
+				"Error:\nQuery should return either single value or "+
+					"multiple rows, each containing string and numbers\n"+
+					"Got %d rows, each containing single number\nSeries: %s, date: %v\n",
+				rowCount, seriesNameOrFunc, dt,
+			)
+		}
+		// Handle nulls, no rows is NULL too
+		var pValue *string
+		if rowCount > 0 {
+			pValue = rows.Rows[rowCount-1][0]
+		}
+		value, err := MetricValue(pValue, columnType(0), typed)
+		if err != nil {
+			return nil, err
+		}
+		// In this simplest case 1 row, 1 column - series name is taken directly from YAML (metrics.yaml)
+		// It usually uses `add_period_to_name: true` to have _period suffix, period{=h,d,w,m,q,y}
+		if ctx.Debug > 0 {
+			Printf("%v -> %v, %v\n", dt, seriesNameOrFunc, value)
+		}
+		fields, err := valueFields(value, pValue)
+		if err != nil {
+			return nil, err
+		}
+		AddTSPoint(ctx, &pts, NewTSPoint(ctx, seriesNameOrFunc, period, nil, fields, dt))
+		return pts, nil
+	}
+	if nColumns < 2 {
+		return
+	}
+	// Multiple rows, each with (series name, value(s))
+	allFields := make(map[string]map[string]interface{})
+	for _, pValues := range rows.Rows {
+		// Get first column name, and using it all series names
+		// First column should contain nColumns - 1 names separated by ","
+		name := MetricString(pValues[0])
+		names, err := MetricRowNames(seriesNameOrFunc, name, multivalue, escapeValueName)
+		if err != nil {
+			return nil, err
+		}
+		if ctx.Debug > 0 {
+			Printf("MetricRowNames: %s -> %v\n", name, names)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		// Iterate values
+		for idx, pVal := range pValues[1:] {
+			if idx >= len(names) {
+				return nil, fmt.Errorf("row '%s' returned %d values, but only %d series names: %v", name, nColumns-1, len(names), names)
+			}
+			value, err := MetricValue(pVal, columnType(idx+1), typed)
+			if err != nil {
+				return nil, fmt.Errorf("row '%s' column %d: %v", name, idx+2, err)
+			}
+			if multivalue {
+				nameArr := strings.Split(names[idx], ";")
+				if len(nameArr) < 2 {
+					return nil, fmt.Errorf("multivalue series name '%s' must be in 'series;value_name' format", names[idx])
+				}
+				seriesName := nameArr[0]
+				seriesValueName := nameArr[1]
+				if ctx.Debug > 0 {
+					Printf("%v -> %v: %v[%v], %v\n", dt, idx, seriesName, seriesValueName, value)
+				}
+				if _, ok := allFields[seriesName]; !ok {
+					allFields[seriesName] = make(map[string]interface{})
+				}
+				allFields[seriesName][seriesValueName] = value
+				continue
+			}
+			if ctx.Debug > 0 {
+				Printf("%v -> %v: %v, %v\n", dt, idx, names[idx], value)
+			}
+			fields, err := valueFields(value, pVal)
+			if err != nil {
+				return nil, err
+			}
+			AddTSPoint(ctx, &pts, NewTSPoint(ctx, names[idx], period, nil, fields, dt))
+		}
+	}
+	// Multivalue series if any (in series name order)
+	seriesNames := []string{}
+	for seriesName := range allFields {
+		seriesNames = append(seriesNames, seriesName)
+	}
+	sort.Strings(seriesNames)
+	for _, seriesName := range seriesNames {
+		AddTSPoint(ctx, &pts, NewTSPoint(ctx, seriesName, period, nil, allFields[seriesName], dt))
+	}
+	return pts, nil
+}
+
+// MetricInterval - single time series metric evaluation: point time and SQL `{{from}}` - `{{to}}` range
+// From is earlier than Dt for aggregated periods (like `d7`: 7 days moving average)
+type MetricInterval struct {
+	Dt   time.Time
+	From time.Time
+	To   time.Time
+}
+
+// MetricIntervals - returns all intervals of a given period (h, d, w, m, q, y with optional aggregation) between from and to
+// Dates are rounded to period boundaries: from to the start of its period, to to the start of the next period
+// allowUnknown is passed to GetIntervalFunctions (annotations ranges periods)
+func MetricIntervals(intervalAbbr string, allowUnknown bool, from, to time.Time) (intervals []MetricInterval) {
+	_, nIntervals, intervalStart, nextIntervalStart, prevIntervalStart := GetIntervalFunctions(intervalAbbr, allowUnknown)
+	dt := intervalStart(from)
+	dTo := nextIntervalStart(to)
+	for dt.Before(dTo) {
+		interval := MetricInterval{Dt: dt, From: dt, To: nextIntervalStart(dt)}
+		if nIntervals > 1 {
+			interval.From = AddNIntervals(dt, 1-nIntervals, nextIntervalStart, prevIntervalStart)
+		}
+		intervals = append(intervals, interval)
+		dt = interval.To
+	}
+	return
+}
@@ -0,0 +1,256 @@
+package devstats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestMetricRowNames(t *testing.T) {
+	var testCases = []struct {
+		metric          string
+		name            string
+		multivalue      bool
+		escapeValueName bool
+		expected        []string
+		err             bool
+	}{
+		{metric: "single_row_multi_column", name: "a,b,c", expected: []string{"a", "b", "c"}},
+		{metric: "multi_row_single_column", name: "prs,Repo Group", expected: []string{"prsrepogroup"}},
+		{metric: "multi_row_single_column", name: "prs,Repo Group", multivalue: true, expected: []string{"prs;Repo Group"}},
+		{metric: "multi_row_single_column", name: "prs,Repo Group", multivalue: true, escapeValueName: true, expected: []string{"prs;repogroup"}},
+		{metric: "multi_row_single_column", name: "prs,Google`All", multivalue: true, expected: []string{"prsall;Google"}},
+		{metric: "multi_row_single_column", name: ",x"},
+		{metric: "multi_row_single_column", name: "prs,---"},
+		{metric: "multi_row_multi_column", name: "prs_age;SIG Apps;n,age", expected: []string{"prs_agesigappsn", "prs_agesigappsage"}},
+		{metric: "multi_row_multi_column", name: "prs_age;SIG Apps;n,age", multivalue: true, expected: []string{"prs_agen;SIG Apps", "prs_ageage;SIG Apps"}},
+		{metric: "multi_row_multi_column", name: "cs;Google`All;n,m", multivalue: true, expected: []string{"csalln;Google", "csallm;Google"}},
+		{metric: "multi_row_single_column", name: "prs", err: true},
+		{metric: "multi_row_multi_column", name: "prs;x", err: true},
+		{metric: "unknown", name: "x", err: true},
+	}
+	for _, test := range testCases {
+		got, err := lib.MetricRowNames(test.metric, test.name, test.multivalue, test.escapeValueName)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s '%s': expected error, got %+v", test.metric, test.name, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s '%s': expected %+v, got %+v, %v", test.metric, test.name, test.expected, got, err)
+		}
+	}
+}
+
+func TestMetricSeriesTables(t *testing.T) {
+	var testCases = []struct {
+		series, merge string
+		expected      []string
+	}{
+		{series: "prs_opened", expected: []string{"sprs_opened"}},
+		{series: "multi_row_single_column", merge: "prs_stats", expected: []string{"sprs_stats"}},
+		{series: "multi_row_single_column"},
+		{series: "single_row_multi_column"},
+		{series: "multi_row_multi_column"},
+	}
+	for _, test := range testCases {
+		got := lib.MetricSeriesTables(test.series, test.merge)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s/%s: expected %+v, got %+v", test.series, test.merge, test.expected, got)
+		}
+	}
+}
+
+func TestMetricPoints(t *testing.T) {
+	ctx := lib.Ctx{}
+	dt := time.Date(2018, 1, 2, 0, 0, 0, 0, time.UTC)
+	var testCases = []struct {
+		rows       lib.MetricRows
+		series     string
+		desc       string
+		multivalue bool
+		typed      bool
+		types      []string
+		expected   string
+		err        string
+	}{
+		{
+			rows:     metricRows([]string{"value"}, []string{"3.5"}),
+			series:   "events_d",
+			expected: "#1 2018-01-02 0 events_d period: d tags: map[] fields: map[value:3.5]\n",
+		},
+		{
+			rows:     metricRows([]string{"value"}, []string{"NULL"}),
+			series:   "events_d",
+			expected: "#1 2018-01-02 0 events_d period: d tags: map[] fields: map[value:0]\n",
+		},
+		{
+			rows:     metricRows([]string{"name", "value"}, []string{"prs,All", "2"}, []string{"prs,SIG Apps", "1"}),
+			series:   "multi_row_single_column",
+			expected: "#1 2018-01-02 0 prsall period: d tags: map[] fields: map[value:2]\n#2 2018-01-02 0 prssigapps period: d tags: map[] fields: map[value:1]\n",
+		},
+		{
+			rows:     metricRows([]string{"name", "value"}, []string{"age,All", "30"}),
+			series:   "multi_row_single_column",
+			desc:     "time_diff_as_string",
+			expected: "#1 2018-01-02 0 ageall period: d tags: map[] fields: map[descr:1 day 6 hours value:30]\n",
+		},
+		{
+			rows:       metricRows([]string{"name", "n", "m"}, []string{"cs;Google;n,m", "2", "3"}, []string{"cs;Red Hat;n,m", "1", "NULL"}),
+			series:     "multi_row_multi_column",
+			multivalue: true,
+			expected:   "#1 2018-01-02 0 csm period: d tags: map[] fields: map[Google:3 Red Hat:0]\n#2 2018-01-02 0 csn period: d tags: map[] fields: map[Google:2 Red Hat:1]\n",
+		},
+		{
+			rows:   metricRows([]string{"name", "n", "m"}, []string{"cs;Google;n", "2", "3"}),
+			series: "multi_row_multi_column",
+			err:    "only 1 series names",
+		},
+		{
+			rows:   metricRows([]string{"name", "value"}, []string{"a,b", "1"}),
+			series: "multi_row_single_column",
+			desc:   "unknown",
+			err:    "unknown value description function",
+		},
+		{
+			rows:   metricRows([]string{"name", "value"}, []string{"a", "1"}),
+			series: "multi_row_single_column",
+			err:    "must be in 'prefix,rowName' format",
+		},
+		{
+			rows:   metricRows([]string{"name", "value"}, []string{"a,b", "1"}),
+			series: "events_d",
+			err:    "unknown metric",
+		},
+		{
+			rows:     metricRows([]string{"value"}, []string{"NULL"}),
+			series:   "events_d",
+			typed:    true,
+			expected: "#1 2018-01-02 0 events_d period: d tags: map[] fields: map[value:<nil>]\n",
+		},
+		{
+			rows:     metricRows([]string{"value"}),
+			series:   "events_d",
+			typed:    true,
+			expected: "#1 2018-01-02 0 events_d period: d tags: map[] fields: map[value:<nil>]\n",
+		},
+		{
+			rows:     metricRows([]string{"name", "n", "ok"}, []string{"cs;Google;n,ok", "2", "true"}, []string{"cs;Red Hat;n,ok", "NULL", "false"}),
+			series:   "multi_row_multi_column",
+			typed:    true,
+			types:    []string{"TEXT", "INT8", "BOOL"},
+			expected: "#1 2018-01-02 0 csgooglen period: d tags: map[] fields: map[value:2]\n#2 2018-01-02 0 csgoogleok period: d tags: map[] fields: map[value:true]\n#3 2018-01-02 0 csredhatn period: d tags: map[] fields: map[value:<nil>]\n#4 2018-01-02 0 csredhatok period: d tags: map[] fields: map[value:false]\n",
+		},
+		{
+			rows:     metricRows([]string{"name", "value"}, []string{"age,All", "30"}, []string{"age,None", "NULL"}),
+			series:   "multi_row_single_column",
+			desc:     "time_diff_as_string",
+			typed:    true,
+			types:    []string{"TEXT", "NUMERIC"},
+			expected: "#1 2018-01-02 0 ageall period: d tags: map[] fields: map[descr:1 day 6 hours value:30]\n#2 2018-01-02 0 agenone period: d tags: map[] fields: map[descr:<nil> value:<nil>]\n",
+		},
+		{
+			rows:   metricRows([]string{"name", "value"}, []string{"a,b", "x"}),
+			series: "multi_row_single_column",
+			typed:  true,
+			types:  []string{"TEXT", "TEXT"},
+			err:    "non-numeric TEXT value 'x'",
+		},
+	}
+	for index, test := range testCases {
+		test.rows.Types = test.types
+		pts, err := lib.MetricPoints(&ctx, test.rows, test.series, "d", test.desc, test.multivalue, false, test.typed, dt)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+			}
+			continue
+		}
+		if err != nil || pts.Str() != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s\nerror: %v", index+1, test.expected, pts.Str(), err)
+		}
+	}
+}
+
+func TestMetricValue(t *testing.T) {
+	str := func(s string) *string { return &s }
+	var testCases = []struct {
+		value    *string
+		dbType   string
+		typed    bool
+		expected interface{}
+		err      bool
+	}{
+		{value: str("1.5"), dbType: "FLOAT8", expected: 1.5},
+		{value: str("7"), dbType: "INT8", expected: 7.0},
+		{value: str("x"), dbType: "TEXT", expected: 0.0},
+		{value: nil, dbType: "INT8", expected: 0.0},
+		{value: nil, dbType: "INT8", typed: true, expected: nil},
+		{value: str("7"), dbType: "INT8", typed: true, expected: int64(7)},
+		{value: str("-3"), dbType: "INT4", typed: true, expected: int64(-3)},
+		{value: str("true"), dbType: "BOOL", typed: true, expected: true},
+		{value: str(`{"a":1}`), dbType: "JSONB", typed: true, expected: lib.TSJSONValue(`{"a":1}`)},
+		{value: str("2.25"), dbType: "NUMERIC", typed: true, expected: 2.25},
+		{value: str("3"), typed: true, expected: 3.0},
+		{value: str("x"), dbType: "TEXT", typed: true, err: true},
+		{value: str("1.5"), dbType: "INT8", typed: true, err: true},
+	}
+	for index, test := range testCases {
+		got, err := lib.MetricValue(test.value, test.dbType, test.typed)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %v", index+1, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %#v, got %#v, %v", index+1, test.expected, got, err)
+		}
+	}
+}
+
+func TestMetricIntervals(t *testing.T) {
+	ymd := func(y, m, d int) time.Time { return time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC) }
+	var testCases = []struct {
+		period   string
+		from, to time.Time
+		expected []lib.MetricInterval
+	}{
+		{
+			period: "d",
+			from:   time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC),
+			to:     time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC),
+			expected: []lib.MetricInterval{
+				{Dt: ymd(2018, 1, 1), From: ymd(2018, 1, 1), To: ymd(2018, 1, 2)},
+				{Dt: ymd(2018, 1, 2), From: ymd(2018, 1, 2), To: ymd(2018, 1, 3)},
+			},
+		},
+		{
+			period: "d7",
+			from:   ymd(2018, 1, 10),
+			to:     ymd(2018, 1, 10),
+			expected: []lib.MetricInterval{
+				{Dt: ymd(2018, 1, 10), From: ymd(2018, 1, 4), To: ymd(2018, 1, 11)},
+			},
+		},
+		{
+			period: "m",
+			from:   ymd(2018, 1, 15),
+			to:     ymd(2018, 2, 1),
+			expected: []lib.MetricInterval{
+				{Dt: ymd(2018, 1, 1), From: ymd(2018, 1, 1), To: ymd(2018, 2, 1)},
+				{Dt: ymd(2018, 2, 1), From: ymd(2018, 2, 1), To: ymd(2018, 3, 1)},
+			},
+		},
+	}
+	for _, test := range testCases {
+		got := lib.MetricIntervals(test.period, false, test.from, test.to)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s %v - %v: expected %+v, got %+v", test.period, test.from, test.to, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package devstats
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// AllMetrics contain list of metrics to evaluate (metrics.yaml)
+// Extends - base metrics file (path relative to this file), its metrics are inherited and can be overridden by name
+// Include - other metrics files (paths relative to this file) whose metrics are appended
+// Params - `{{param}}` replacements for all metrics SQLs (overrides base file params)
+// Retention - default retention rules for metrics that don't define their own (overrides base file retention)
+type AllMetrics struct {
+	Extends   string            `yaml:"extends,omitempty"`
+	Include   []string          `yaml:"include,omitempty"`
+	Params    map[string]string `yaml:"params,omitempty"`
+	Retention []RetentionRule   `yaml:"retention,omitempty"`
+	Metrics   []Metric          `yaml:"metrics"`
+}
+
+// Metric contain each metric data
+// Sources - cross-project metric: `all` or comma separated projects whose databases metric SQL is executed on
+// Combine - how results from sources are combined: sum (default), max, min or distinct (SQL returns IDs)
+// Retention - how long metric's points are kept per period, see RetentionRule
+// TypedValues - keep SQL types of values (bigint, boolean, jsonb) and store NULLs instead of zeros, see MetricValue
+type Metric struct {
+	Name              string            `yaml:"name"`
+	Periods           string            `yaml:"periods"`
+	SeriesNameOrFunc  string            `yaml:"series_name_or_func"`
+	MetricSQL         string            `yaml:"sql"`
+	AddPeriodToName   bool              `yaml:"add_period_to_name"`
+	Histogram         bool              `yaml:"histogram"`
+	Aggregate         string            `yaml:"aggregate"`
+	Skip              string            `yaml:"skip"`
+	Desc              string            `yaml:"desc"`
+	MultiValue        bool              `yaml:"multi_value"`
+	EscapeValueName   bool              `yaml:"escape_value_name"`
+	AnnotationsRanges bool              `yaml:"annotations_ranges"`
+	MergeSeries       string            `yaml:"merge_series"`
+	Params            map[string]string `yaml:"params,omitempty"`
+	Disabled          bool              `yaml:"disabled,omitempty"`
+	Sources           string            `yaml:"sources,omitempty"`
+	Combine           string            `yaml:"combine,omitempty"`
+	Retention         []RetentionRule   `yaml:"retention,omitempty"`
+	TypedValues       bool              `yaml:"typed_values,omitempty"`
+}
+
+// AllColumns contains list of columns that must be present on a certain series (columns.yaml)
+type AllColumns struct {
+	Columns []Column `yaml:"columns"`
+}
+
+// Column contain configuration of columns needed on a specific series
+// Columns are named by values of `Column` in `Tag` table and added to all tables matching `TableRegexp`
+type Column struct {
+	TableRegexp string `yaml:"table_regexp"`
+	Tag         string `yaml:"tag"`
+	Column      string `yaml:"column"`
+}
+
+// LoadMetrics reads metrics.yaml and returns effective metrics set: with base file (`extends`) metrics
+// overridden by metrics of the same name, included files metrics appended and disabled metrics removed.
+// Each returned metric has all its params resolved: metric params > file params > base file params
+func LoadMetrics(ctx *Ctx, path string) (*AllMetrics, error) {
+	file, included, err := loadMetrics(ctx, path, make(map[string]struct{}))
+	if err != nil {
+		return nil, err
+	}
+	return resolveMetrics(file, included), nil
+}
+
+// resolveMetrics removes disabled metrics, resolves metrics params and default retention rules
+func resolveMetrics(file *AllMetrics, included []Metric) *AllMetrics {
+	metrics := []Metric{}
+	for _, metric := range file.Metrics {
+		if len(metric.Retention) == 0 {
+			metric.Retention = DefaultRetention(&metric, file.Retention)
+		}
+		metrics = append(metrics, metric)
+	}
+	resolved := []Metric{}
+	for _, metric := range append(metrics, included...) {
+		if metric.Disabled {
+			continue
+		}
+		metric.Params = mergeParams(file.Params, metric.Params)
+		resolved = append(resolved, metric)
+	}
+	return &AllMetrics{Params: file.Params, Retention: file.Retention, Metrics: resolved}
+}
+
+// loadMetrics returns file's metrics (with inherited ones) with unresolved params and included metrics with resolved params
+func loadMetrics(ctx *Ctx, path string, visited map[string]struct{}) (*AllMetrics, []Metric, error) {
+	path = ResolveFile(ctx, path)
+	if _, ok := visited[path]; ok {
+		return nil, nil, fmt.Errorf("%s: metrics files extends/include cycle", path)
+	}
+	visited[path] = struct{}{}
+	defer delete(visited, path)
+	data, err := ReadFile(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var file AllMetrics
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	// Keep metrics as given in YAML, to override only fields that are present
+	var raw struct {
+		Metrics []map[string]interface{} `yaml:"metrics"`
+	}
+	if err = yaml.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	result := &AllMetrics{}
+	included := []Metric{}
+	if file.Extends != "" {
+		base, baseIncluded, err := loadMetrics(ctx, filepath.Join(dir, file.Extends), visited)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Params = base.Params
+		result.Retention = base.Retention
+		result.Metrics = base.Metrics
+		included = baseIncluded
+	}
+	result.Params = mergeParams(result.Params, file.Params)
+	if len(file.Retention) > 0 {
+		result.Retention = file.Retention
+	}
+	// Only inherited metrics can be overridden, metrics names are not unique within a single file
+	byName := make(map[string][]int)
+	for i, metric := range result.Metrics {
+		byName[metric.Name] = append(byName[metric.Name], i)
+	}
+	for i, metric := range file.Metrics {
+		idxs, ok := byName[metric.Name]
+		if !ok {
+			result.Metrics = append(result.Metrics, metric)
+			continue
+		}
+		for _, idx := range idxs {
+			if result.Metrics[idx], err = overrideMetric(&result.Metrics[idx], raw.Metrics[i]); err != nil {
+				return nil, nil, fmt.Errorf("%s: metric '%s': %v", path, metric.Name, err)
+			}
+		}
+	}
+	for _, include := range file.Include {
+		inc, incIncluded, err := loadMetrics(ctx, filepath.Join(dir, include), visited)
+		if err != nil {
+			return nil, nil, err
+		}
+		included = append(included, resolveMetrics(inc, incIncluded).Metrics...)
+	}
+	return result, included, nil
+}
+
+// overrideMetric returns base metric with fields given in override replaced, params are merged
+func overrideMetric(base *Metric, override map[string]interface{}) (Metric, error) {
+	var metric Metric
+	data, err := yaml.Marshal(base)
+	if err != nil {
+		return metric, err
+	}
+	fields := make(map[string]interface{})
+	if err = yaml.Unmarshal(data, &fields); err != nil {
+		return metric, err
+	}
+	for k, v := range override {
+		fields[k] = v
+	}
+	data, err = yaml.Marshal(fields)
+	if err != nil {
+		return metric, err
+	}
+	if err = yaml.Unmarshal(data, &metric); err != nil {
+		return metric, err
+	}
+	if _, ok := override["params"]; ok {
+		metric.Params = mergeParams(base.Params, metric.Params)
+	}
+	return metric, nil
+}
+
+// mergeParams returns defaults params overridden by params
+func mergeParams(defaults, params map[string]string) map[string]string {
+	if len(defaults) == 0 && len(params) == 0 {
+		return nil
+	}
+	merged := make(map[string]string)
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range params {
+		merged[k] = v
+	}
+	return merged
+}
+
+// ReplaceMetricParams replaces `{{param}}` with param values in metric SQL
+func ReplaceMetricParams(sql string, params map[string]string) string {
+	for k, v := range params {
+		sql = strings.Replace(sql, "{{"+k+"}}", v, -1)
+	}
+	return sql
+}
+
+// EncodeMetricParams encodes metric params so they can be passed as a single `calc_metric` option
+// Result is URL query encoded, so it contains no `,` and `:` characters that are used to split options
+func EncodeMetricParams(params map[string]string) string {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+// DecodeMetricParams decodes params encoded by EncodeMetricParams
+func DecodeMetricParams(s string) (map[string]string, error) {
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]string)
+	for k := range values {
+		params[k] = values.Get(k)
+	}
+	return params, nil
+}
@@ -1,48 +1,19 @@
-with matching as (
-  select event_id
-  from
-    gha_texts
-  where
-    {{period:created_at}}
-    and substring(body from '(?i)(?:^|\n|\r)\s*/(?:lgtm|approve)\s*(?:\n|\r|$)') is not null
-), reviews as (
-  select id as event_id
-  from
-    gha_events
-  where
-    {{period:created_at}}
-    and type in ('PullRequestReviewCommentEvent')
-)
 select
   sub.repo_group,
   sub.actor,
   count(distinct sub.id) as reviews
 from (
-  select 'hdev_reviews,' || coalesce(ecf.repo_group, r.repo_group) as repo_group,
-    e.dup_actor_login as actor,
-    e.id
+  select 'hdev_reviews,' || r.repo_group as repo_group,
+    rv.user_login as actor,
+    rv.id
   from
-    gha_repos r,
-    gha_events e
-  left join
-    gha_events_commits_files ecf
-  on
-    ecf.event_id = e.id
+    gha_reviews rv,
+    gha_repos r
   where
-    e.repo_id = r.id
-    and (lower(e.dup_actor_login) {{exclude_bots}})
-    and e.id in (
-      select min(event_id)
-      from
-        gha_issues_events_labels
-      where
-        {{period:created_at}}
-        and label_name in ('lgtm', 'approved')
-      group by
-        issue_id
-      union select event_id from matching
-      union select event_id from reviews
-    )
+    rv.repo_name = r.name
+    and {{period:rv.submitted_at}}
+    and rv.user_login is not null
+    and (lower(rv.user_login) {{exclude_bots}})
   ) sub
 where
   sub.repo_group is not null
@@ -52,26 +23,16 @@ group by
 having
   count(distinct sub.id) >= 1
 union select 'hdev_reviews,All' as repo_group,
-  dup_actor_login as actor,
+  user_login as actor,
   count(distinct id) as reviews
 from
-  gha_events
+  gha_reviews
 where
-  id in (
-    select min(event_id)
-    from
-      gha_issues_events_labels
-    where
-      {{period:created_at}}
-      and label_name in ('lgtm', 'approved')
-    group by
-      issue_id
-    union select event_id from matching
-    union select event_id from reviews
-  )
-  and (lower(dup_actor_login) {{exclude_bots}})
+  {{period:submitted_at}}
+  and user_login is not null
+  and (lower(user_login) {{exclude_bots}})
 group by
-  dup_actor_login
+  user_login
 having
   count(distinct id) >= 1
 order by
@@ -0,0 +1,34 @@
+with files as (
+  select distinct ecf.sha,
+    ecf.path,
+    ecf.language,
+    ecf.additions,
+    ecf.deletions
+  from
+    gha_events_commits_files ecf
+  where
+    ecf.dt >= '{{from}}'
+    and ecf.dt < '{{to}}'
+    and ecf.language is not null
+    and ecf.additions >= 0
+    and ecf.deletions >= 0
+)
+select
+  sub.name,
+  round(sum(sub.lines) / {{n}}, 2) as lines
+from (
+  select 'lang_lines_added,' || language as name,
+    additions as lines
+  from
+    files
+  union all select 'lang_lines_removed,' || language as name,
+    deletions as lines
+  from
+    files
+  ) sub
+group by
+  sub.name
+order by
+  lines desc,
+  name asc
+;
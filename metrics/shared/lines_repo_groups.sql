@@ -0,0 +1,47 @@
+with files as (
+  select distinct ecf.sha,
+    ecf.path,
+    coalesce(ecf.repo_group, r.repo_group) as repo_group,
+    ecf.additions,
+    ecf.deletions
+  from
+    gha_events_commits_files ecf,
+    gha_repos r
+  where
+    r.name = ecf.dup_repo_name
+    and ecf.dt >= '{{from}}'
+    and ecf.dt < '{{to}}'
+    and ecf.additions >= 0
+    and ecf.deletions >= 0
+)
+select
+  sub.name,
+  round(sum(sub.lines) / {{n}}, 2) as lines
+from (
+  select 'lines_added,' || repo_group as name,
+    additions as lines
+  from
+    files
+  where
+    repo_group is not null
+  union all select 'lines_removed,' || repo_group as name,
+    deletions as lines
+  from
+    files
+  where
+    repo_group is not null
+  union all select 'lines_added,All' as name,
+    additions as lines
+  from
+    files
+  union all select 'lines_removed,All' as name,
+    deletions as lines
+  from
+    files
+  ) sub
+group by
+  sub.name
+order by
+  lines desc,
+  name asc
+;
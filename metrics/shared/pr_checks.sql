@@ -0,0 +1,15 @@
+select
+  'pr_checks,' || lower(c.conclusion) as name,
+  round(count(distinct (c.id, c.type)) / {{n}}, 2) as checks
+from
+  gha_checks c
+where
+  c.completed_at >= '{{from}}'
+  and c.completed_at < '{{to}}'
+  and c.conclusion is not null
+group by
+  c.conclusion
+order by
+  checks desc,
+  name asc
+;
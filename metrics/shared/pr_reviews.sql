@@ -0,0 +1,27 @@
+select
+  sub.name,
+  round(count(distinct sub.id) / {{n}}, 2) as reviews
+from (
+  select 'pr_reviews,' || lower(r.state) as name,
+    r.id
+  from
+    gha_reviews r
+  where
+    r.submitted_at >= '{{from}}'
+    and r.submitted_at < '{{to}}'
+    and (lower(coalesce(r.user_login, '')) {{exclude_bots}})
+  union select 'pr_reviews,all' as name,
+    r.id
+  from
+    gha_reviews r
+  where
+    r.submitted_at >= '{{from}}'
+    and r.submitted_at < '{{to}}'
+    and (lower(coalesce(r.user_login, '')) {{exclude_bots}})
+  ) sub
+group by
+  sub.name
+order by
+  reviews desc,
+  name asc
+;
@@ -1,41 +1,20 @@
-with lgtm_texts as (
-  select distinct event_id
-  from
-    gha_texts
-  where
-    substring(body from '(?i)(?:^|\n|\r)\s*/(?:lgtm)\s*(?:\n|\r|$)') is not null
-    and (lower(actor_login) {{exclude_bots}})
-    and created_at > now() - '3 months'::interval
-)
 select
-  sub.dup_actor_login
+  sub.user_login
 from (
-  select distinct dup_actor_login,
-    count(id) as events
+  select user_login,
+    count(distinct id) as reviews
   from
-    gha_events
+    gha_reviews
   where
-    (lower(dup_actor_login) {{exclude_bots}})
-    and created_at > now() - '3 months'::interval
-    and (
-      type = 'PullRequestReviewCommentEvent'
-      or id in (
-        select min(event_id)
-        from
-          gha_issues_events_labels
-        where
-          label_name = 'lgtm'
-          and created_at > now() - '3 months'::interval
-        group by
-          issue_id
-        union select event_id from lgtm_texts
-      )
-    )
+    user_login is not null
+    and (lower(user_login) {{exclude_bots}})
+    and submitted_at > now() - '3 months'::interval
   group by
-    dup_actor_login
+    user_login
   union select 'none', 0
 ) sub
 order by
-  sub.events desc
+  sub.reviews desc,
+  sub.user_login asc
 limit {{lim}}
 ;
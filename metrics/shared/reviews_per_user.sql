@@ -1,24 +1,22 @@
 select
-  concat('rev_per_usr,', dup_actor_login, '`All') as repo_user,
-  round(count(id) / {{n}}, 2) as result
+  concat('rev_per_usr,', user_login, '`All') as repo_user,
+  round(count(distinct id) / {{n}}, 2) as result
 from
-  gha_events
+  gha_reviews
 where
-  created_at >= '{{from}}'
-  and created_at < '{{to}}'
-  and type in ('PullRequestReviewCommentEvent')
-  and dup_actor_login in (select reviewers_name from treviewers)
+  submitted_at >= '{{from}}'
+  and submitted_at < '{{to}}'
+  and user_login in (select reviewers_name from treviewers)
 group by
-  dup_actor_login
-union select 'rev_per_usr,' || concat(dup_actor_login, '`', dup_repo_name) as repo_user,
-  round(count(id) / {{n}}, 2) as result
+  user_login
+union select 'rev_per_usr,' || concat(user_login, '`', repo_name) as repo_user,
+  round(count(distinct id) / {{n}}, 2) as result
 from
-  gha_events
+  gha_reviews
 where
-  type in ('PullRequestReviewCommentEvent')
-  and created_at >= '{{from}}'
-  and created_at < '{{to}}'
-  and dup_actor_login in (select reviewers_name from treviewers)
+  submitted_at >= '{{from}}'
+  and submitted_at < '{{to}}'
+  and user_login in (select reviewers_name from treviewers)
 group by
   repo_user
 order by
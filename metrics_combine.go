@@ -0,0 +1,306 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Cross-project metrics combination rules (metrics.yaml `combine`)
+const (
+	CombineSum      = "sum"      // Values for the same key (first column) are summed
+	CombineMax      = "max"      // Maximum value for the same key is taken
+	CombineMin      = "min"      // Minimum value for the same key is taken
+	CombineDistinct = "distinct" // SQL returns IDs (last column), result is number of distinct IDs for the same key
+)
+
+// MetricRows - metric SQL result: column names and rows (nil values are SQL NULLs)
+// Types are columns database types (like INT8, FLOAT8, BOOL, JSONB), nil when unknown (combined results)
+type MetricRows struct {
+	Columns []string
+	Types   []string
+	Rows    [][]*string
+}
+
+// QueryMetricRows - executes metric SQL and returns all its rows
+func QueryMetricRows(con *sql.DB, ctx *Ctx, query string) MetricRows {
+	res, err := ScanMetricRows(QuerySQLWithErr(con, ctx, query))
+	FatalOnError(err)
+	return res
+}
+
+// ScanMetricRows - reads all rows as strings (nil values are SQL NULLs) and closes rows
+func ScanMetricRows(rows *sql.Rows) (res MetricRows, err error) {
+	defer func() {
+		if e := rows.Close(); err == nil {
+			err = e
+		}
+	}()
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	res.Columns = columns
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return
+	}
+	for _, columnType := range columnTypes {
+		res.Types = append(res.Types, columnType.DatabaseTypeName())
+	}
+	pValues := make([]interface{}, len(columns))
+	for i := range columns {
+		pValues[i] = new(sql.NullString)
+	}
+	for rows.Next() {
+		if err = rows.Scan(pValues...); err != nil {
+			return
+		}
+		row := make([]*string, len(columns))
+		for i, pValue := range pValues {
+			if v := pValue.(*sql.NullString); v.Valid {
+				s := v.String
+				row[i] = &s
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	err = rows.Err()
+	return
+}
+
+// MetricSourcesDBs - returns databases of projects given in metric's `sources`: comma separated project names or `all`
+// `all` means all enabled projects (in projects order) except the current one (which usually is the `All` project)
+func MetricSourcesDBs(ctx *Ctx, projects *AllProjects, sources string) ([]string, error) {
+	dbs := []string{}
+	if strings.TrimSpace(sources) == "all" {
+		names := []string{}
+		for name, proj := range projects.Projects {
+			if name == ctx.Project || IsProjectDisabled(ctx, name, proj.Disabled) {
+				continue
+			}
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			return projects.Projects[names[i]].Order < projects.Projects[names[j]].Order
+		})
+		for _, name := range names {
+			dbs = append(dbs, projects.Projects[name].PDB)
+		}
+		return dbs, nil
+	}
+	for _, name := range strings.Split(sources, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		proj, ok := projects.Projects[name]
+		if !ok {
+			return nil, fmt.Errorf("metric source project '%s' not found", name)
+		}
+		dbs = append(dbs, proj.PDB)
+	}
+	if len(dbs) == 0 {
+		return nil, fmt.Errorf("no metric source projects in '%s'", sources)
+	}
+	return dbs, nil
+}
+
+// metricNumericTypes - database types of metric columns that are combined as values
+var metricNumericTypes = map[string]struct{}{
+	"INT2":    {},
+	"INT4":    {},
+	"INT8":    {},
+	"FLOAT4":  {},
+	"FLOAT8":  {},
+	"NUMERIC": {},
+}
+
+// metricKeyColumns - returns which columns are keys: the first column (unless it is the only one) and all
+// columns that have non-numeric database type (like names in `series, name, value` histograms), untyped columns are values
+func metricKeyColumns(columns []string, results []MetricRows) []bool {
+	isKey := make([]bool, len(columns))
+	if len(columns) > 1 {
+		isKey[0] = true
+	}
+	for _, res := range results {
+		if len(res.Types) != len(columns) {
+			continue
+		}
+		for i, typ := range res.Types {
+			if _, ok := metricNumericTypes[typ]; !ok {
+				isKey[i] = true
+			}
+		}
+	}
+	return isKey
+}
+
+// metricRowKey - returns combined key of a row: its key columns values
+func metricRowKey(isKey []bool, row []*string) string {
+	parts := []string{}
+	for i, pValue := range row {
+		if !isKey[i] {
+			continue
+		}
+		if pValue == nil {
+			parts = append(parts, "\x01")
+			continue
+		}
+		parts = append(parts, *pValue)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// CombineMetricRows - combines metric results from multiple databases using a given combination rule
+// Results with a single column are combined into a single row, otherwise the first column and all non-numeric columns
+// (by database type) are a key (series name or histogram names) and the remaining columns are numeric values.
+// Combined rows are ordered by the first value descending.
+// For `distinct` SQL returns one row per ID: `id` or `key, id` and combined result is the number of distinct IDs per key.
+func CombineMetricRows(combine string, results []MetricRows) (MetricRows, error) {
+	if len(results) == 0 {
+		return MetricRows{}, fmt.Errorf("nothing to combine")
+	}
+	columns := results[0].Columns
+	for _, res := range results[1:] {
+		if len(res.Columns) != len(columns) {
+			return MetricRows{}, fmt.Errorf("cannot combine results with different number of columns: %v and %v", columns, res.Columns)
+		}
+	}
+	if combine == CombineDistinct {
+		if len(columns) > 2 {
+			return MetricRows{}, fmt.Errorf("'%s' needs 'id' or 'key, id' columns, got %v", combine, columns)
+		}
+		return combineDistinct(columns, results), nil
+	}
+	var merge func(a, b float64) float64
+	switch combine {
+	case CombineSum, "":
+		merge = func(a, b float64) float64 { return a + b }
+	case CombineMax:
+		merge = func(a, b float64) float64 {
+			if b > a {
+				return b
+			}
+			return a
+		}
+	case CombineMin:
+		merge = func(a, b float64) float64 {
+			if b < a {
+				return b
+			}
+			return a
+		}
+	default:
+		return MetricRows{}, fmt.Errorf("unknown combine rule '%s'", combine)
+	}
+	isKey := metricKeyColumns(columns, results)
+	nValues := 0
+	for _, key := range isKey {
+		if !key {
+			nValues++
+		}
+	}
+	if nValues == 0 {
+		return MetricRows{}, fmt.Errorf("cannot combine results without numeric columns: %v", columns)
+	}
+	keys := []string{}
+	keyRows := make(map[string][]*string)
+	values := make(map[string][]float64)
+	for _, res := range results {
+		for _, row := range res.Rows {
+			key := metricRowKey(isKey, row)
+			rowValues := []float64{}
+			for i, pValue := range row {
+				if isKey[i] {
+					continue
+				}
+				value := 0.0
+				if pValue != nil {
+					var err error
+					value, err = strconv.ParseFloat(*pValue, 64)
+					if err != nil {
+						return MetricRows{}, fmt.Errorf("cannot combine non-numeric value '%s' for key '%s': %v", *pValue, key, err)
+					}
+				}
+				rowValues = append(rowValues, value)
+			}
+			current, ok := values[key]
+			if !ok {
+				keys = append(keys, key)
+				keyRows[key] = row
+				values[key] = rowValues
+				continue
+			}
+			for i := range current {
+				current[i] = merge(current[i], rowValues[i])
+			}
+		}
+	}
+	return combinedRows(columns, isKey, keys, keyRows, values), nil
+}
+
+// combineDistinct - counts distinct IDs per key
+func combineDistinct(columns []string, results []MetricRows) MetricRows {
+	isKey := make([]bool, len(columns))
+	if len(columns) > 1 {
+		isKey[0] = true
+	}
+	keys := []string{}
+	keyRows := make(map[string][]*string)
+	ids := make(map[string]map[string]struct{})
+	for _, res := range results {
+		for _, row := range res.Rows {
+			key := metricRowKey(isKey, row)
+			set, ok := ids[key]
+			if !ok {
+				keys = append(keys, key)
+				keyRows[key] = row
+				set = make(map[string]struct{})
+				ids[key] = set
+			}
+			if id := row[len(row)-1]; id != nil {
+				set[*id] = struct{}{}
+			}
+		}
+	}
+	values := make(map[string][]float64)
+	for key, set := range ids {
+		values[key] = []float64{float64(len(set))}
+	}
+	if len(columns) == 1 && len(keys) == 0 {
+		keys = append(keys, "")
+		values[""] = []float64{0}
+	}
+	return combinedRows(columns, isKey, keys, keyRows, values)
+}
+
+// combinedRows - returns combined rows ordered by the first value descending (and keys)
+// Key columns are taken from the first row with a given key, value columns from combined values
+func combinedRows(columns []string, isKey []bool, keys []string, keyRows map[string][]*string, values map[string][]float64) (res MetricRows) {
+	res.Columns = columns
+	sort.SliceStable(keys, func(i, j int) bool {
+		vi, vj := values[keys[i]][0], values[keys[j]][0]
+		if vi != vj {
+			return vi > vj
+		}
+		return keys[i] < keys[j]
+	})
+	for _, key := range keys {
+		row := []*string{}
+		vi := 0
+		for i := range columns {
+			if isKey[i] {
+				row = append(row, keyRows[key][i])
+				continue
+			}
+			s := strconv.FormatFloat(values[key][vi], 'f', -1, 64)
+			row = append(row, &s)
+			vi++
+		}
+		res.Rows = append(res.Rows, row)
+	}
+	return
+}
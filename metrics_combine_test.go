@@ -0,0 +1,185 @@
+package devstats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "devstats"
+)
+
+// metricRows - creates metric rows from strings, "NULL" is SQL NULL
+func metricRows(columns []string, rows ...[]string) lib.MetricRows {
+	res := lib.MetricRows{Columns: columns}
+	for _, row := range rows {
+		r := []*string{}
+		for _, v := range row {
+			if v == "NULL" {
+				r = append(r, nil)
+				continue
+			}
+			value := v
+			r = append(r, &value)
+		}
+		res.Rows = append(res.Rows, r)
+	}
+	return res
+}
+
+// typedRows - creates metric rows with columns database types
+func typedRows(columns, types []string, rows ...[]string) lib.MetricRows {
+	res := metricRows(columns, rows...)
+	res.Types = types
+	return res
+}
+
+// metricStrings - returns metric rows as strings, SQL NULL is "NULL"
+func metricStrings(res lib.MetricRows) (rows [][]string) {
+	for _, row := range res.Rows {
+		r := []string{}
+		for _, v := range row {
+			if v == nil {
+				r = append(r, "NULL")
+				continue
+			}
+			r = append(r, *v)
+		}
+		rows = append(rows, r)
+	}
+	return
+}
+
+func TestCombineMetricRows(t *testing.T) {
+	single := []string{"value"}
+	keyed := []string{"name", "prs", "issues"}
+	ids := []string{"name", "actor_id"}
+	hist := []string{"series", "name", "value", "repo", "repo_value"}
+	histTypes := []string{"TEXT", "VARCHAR", "INT8", "TEXT", "NUMERIC"}
+	var testCases = []struct {
+		combine  string
+		results  []lib.MetricRows
+		expected [][]string
+		err      string
+	}{
+		{
+			combine:  lib.CombineSum,
+			results:  []lib.MetricRows{metricRows(single, []string{"10"}), metricRows(single, []string{"2.5"}), metricRows(single, []string{"NULL"})},
+			expected: [][]string{{"12.5"}},
+		},
+		{
+			combine:  lib.CombineMax,
+			results:  []lib.MetricRows{metricRows(single, []string{"10"}), metricRows(single, []string{"12"})},
+			expected: [][]string{{"12"}},
+		},
+		{
+			combine: "",
+			results: []lib.MetricRows{
+				metricRows(keyed, []string{"prs,Google", "3", "1"}, []string{"prs,Red Hat", "2", "2"}),
+				metricRows(keyed, []string{"prs,Red Hat", "4", "0"}, []string{"prs,VMware", "1", "NULL"}),
+			},
+			expected: [][]string{{"prs,Red Hat", "6", "2"}, {"prs,Google", "3", "1"}, {"prs,VMware", "1", "0"}},
+		},
+		{
+			combine: lib.CombineMin,
+			results: []lib.MetricRows{
+				metricRows(keyed, []string{"a", "3", "1"}, []string{"b", "2", "2"}),
+				metricRows(keyed, []string{"b", "1", "5"}),
+			},
+			expected: [][]string{{"a", "3", "1"}, {"b", "1", "2"}},
+		},
+		{
+			combine: lib.CombineDistinct,
+			results: []lib.MetricRows{
+				metricRows(ids, []string{"contributors", "1"}, []string{"contributors", "2"}, []string{"committers", "1"}),
+				metricRows(ids, []string{"contributors", "2"}, []string{"contributors", "3"}, []string{"committers", "NULL"}),
+			},
+			expected: [][]string{{"contributors", "3"}, {"committers", "1"}},
+		},
+		{
+			combine:  lib.CombineDistinct,
+			results:  []lib.MetricRows{metricRows([]string{"actor_id"}, []string{"1"}, []string{"2"}), metricRows([]string{"actor_id"}, []string{"2"})},
+			expected: [][]string{{"2"}},
+		},
+		{
+			combine:  lib.CombineDistinct,
+			results:  []lib.MetricRows{metricRows([]string{"actor_id"}), metricRows([]string{"actor_id"})},
+			expected: [][]string{{"0"}},
+		},
+		{
+			combine: lib.CombineSum,
+			results: []lib.MetricRows{
+				typedRows(hist, histTypes, []string{"hist_prs", "Google", "3", "k8s", "1"}, []string{"hist_prs", "Red Hat", "2", "k8s", "2"}),
+				typedRows(hist, histTypes, []string{"hist_prs", "Red Hat", "4", "k8s", "1"}, []string{"hist_prs", "Red Hat", "5", "cncf", "1"}),
+			},
+			expected: [][]string{{"hist_prs", "Red Hat", "6", "k8s", "3"}, {"hist_prs", "Red Hat", "5", "cncf", "1"}, {"hist_prs", "Google", "3", "k8s", "1"}},
+		},
+		{
+			combine: lib.CombineMax,
+			results: []lib.MetricRows{
+				typedRows(hist[:3], histTypes[:3], []string{"hist_prs", "NULL", "3"}, []string{"hist_prs", "Google", "2"}),
+				typedRows(hist[:3], histTypes[:3], []string{"hist_prs", "NULL", "7"}),
+			},
+			expected: [][]string{{"hist_prs", "NULL", "7"}, {"hist_prs", "Google", "2"}},
+		},
+		{combine: lib.CombineSum, results: []lib.MetricRows{typedRows(hist[:2], []string{"TEXT", "VARCHAR"}, []string{"a", "b"})}, err: "without numeric columns"},
+		{combine: "avg", results: []lib.MetricRows{metricRows(single)}, err: "unknown combine rule"},
+		{combine: lib.CombineSum, results: []lib.MetricRows{metricRows(single), metricRows(keyed)}, err: "different number of columns"},
+		{combine: lib.CombineSum, results: []lib.MetricRows{metricRows(ids, []string{"a", "x"})}, err: "non-numeric value"},
+		{combine: lib.CombineDistinct, results: []lib.MetricRows{metricRows(keyed)}, err: "needs 'id' or 'key, id' columns"},
+		{combine: lib.CombineSum, err: "nothing to combine"},
+	}
+	for index, test := range testCases {
+		got, err := lib.CombineMetricRows(test.combine, test.results)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		if !reflect.DeepEqual(metricStrings(got), test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, metricStrings(got))
+		}
+		if !reflect.DeepEqual(got.Columns, test.results[0].Columns) {
+			t.Errorf("test number %d, expected columns %+v, got %+v", index+1, test.results[0].Columns, got.Columns)
+		}
+	}
+}
+
+func TestMetricSourcesDBs(t *testing.T) {
+	projects := lib.AllProjects{
+		Projects: map[string]lib.Project{
+			"kubernetes":  {PDB: "gha", Order: 1},
+			"prometheus":  {PDB: "prometheus", Order: 2},
+			"opentracing": {PDB: "opentracing", Order: 3, Disabled: true},
+			"all":         {PDB: "allprj", Order: 4},
+		},
+	}
+	ctx := lib.Ctx{Project: "all"}
+	var testCases = []struct {
+		sources  string
+		expected []string
+		err      string
+	}{
+		{sources: "all", expected: []string{"gha", "prometheus"}},
+		{sources: "prometheus, kubernetes", expected: []string{"prometheus", "gha"}},
+		{sources: "opentracing", expected: []string{"opentracing"}},
+		{sources: "kubernetes,unknown", err: "'unknown' not found"},
+		{sources: " , ", err: "no metric source projects"},
+	}
+	for _, test := range testCases {
+		got, err := lib.MetricSourcesDBs(&ctx, &projects, test.sources)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("'%s': expected error '%s', got %v", test.sources, test.err, err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("'%s': expected %+v, got %+v, %v", test.sources, test.expected, got, err)
+		}
+	}
+}
@@ -318,6 +318,15 @@ func dataForMetricTestCase(con *sql.DB, ctx *lib.Ctx, testMetric *metricTestCase
 				}
 			}
 		}
+		reviews, ok := data["reviews"]
+		if ok {
+			for _, review := range reviews {
+				err = addReview(con, ctx, review...)
+				if err != nil {
+					return
+				}
+			}
+		}
 	}
 	return
 }
@@ -404,29 +413,14 @@ func executeMetric(c *sql.DB, ctx *lib.Ctx, metric, msql string, from, to time.T
 	if err != nil {
 		return
 	}
-	sqlQuery := string(bytes)
-	if from.Year() >= 1980 {
-		sqlQuery = strings.Replace(sqlQuery, "{{from}}", lib.ToYMDHMSDate(from), -1)
-	}
-	if to.Year() >= 1980 {
-		sqlQuery = strings.Replace(sqlQuery, "{{to}}", lib.ToYMDHMSDate(to), -1)
-	}
-	sqlQuery = strings.Replace(sqlQuery, "{{period}}", period, -1)
-	sqlQuery = strings.Replace(sqlQuery, "{{n}}", strconv.Itoa(n)+".0", -1)
-	sqlQuery = strings.Replace(
-		sqlQuery,
-		"{{exclude_bots}}",
-		"not like all(array['googlebot', 'rktbot', 'coveralls', 'k8s-%', '%-bot', '%-robot', "+
-			"'bot-%', 'robot-%', '%[bot]%', '%-jenkins', '%-ci%bot', '%-testing', 'codecov-%'])",
-		-1,
-	)
-	for _, replace := range replaces {
-		if len(replace) != 2 {
-			err = fmt.Errorf("replace(s) should have length 2, invalid: %+v", replace)
-			return
-		}
-		sqlQuery = strings.Replace(sqlQuery, replace[0], replace[1], -1)
+	sqlQuery, err := lib.ApplySQLReplaces(string(bytes), replaces)
+	if err != nil {
+		return
 	}
+	tmpl := lib.NewSQLTemplate(ctx)
+	tmpl.Params["n"] = strconv.Itoa(n) + ".0"
+	tmpl.Params["exclude_bots"] = "not like all(array['googlebot', 'rktbot', 'coveralls', 'k8s-%', '%-bot', '%-robot', " +
+		"'bot-%', 'robot-%', '%[bot]%', '%-jenkins', '%-ci%bot', '%-testing', 'codecov-%'])"
 	qrFrom := ""
 	qrTo := ""
 	if from.Year() >= 1980 {
@@ -435,7 +429,11 @@ func executeMetric(c *sql.DB, ctx *lib.Ctx, metric, msql string, from, to time.T
 	if to.Year() >= 1980 {
 		qrTo = lib.ToYMDHMSDate(to)
 	}
-	sqlQuery = lib.PrepareQuickRangeQuery(sqlQuery, period, qrFrom, qrTo)
+	tmpl = tmpl.WithQuickRange(period, qrFrom, qrTo)
+	sqlQuery, err = tmpl.Render(sqlQuery)
+	if err != nil {
+		return
+	}
 
 	// Execute SQL
 	rows := lib.QuerySQLWithErr(c, ctx, sqlQuery)
@@ -702,6 +700,26 @@ func addText(con *sql.DB, ctx *lib.Ctx, args ...interface{}) (err error) {
 	return
 }
 
+// Add PR review
+// id, pull_request_id, repo_name, number, user_id, user_login,
+// state, body, commit_id, submitted_at, comments, dt
+func addReview(con *sql.DB, ctx *lib.Ctx, args ...interface{}) (err error) {
+	if len(args) != 12 {
+		err = fmt.Errorf("addReview: expects 12 variadic parameters, got %v", len(args))
+		return
+	}
+	_, err = lib.ExecSQL(
+		con,
+		ctx,
+		"insert into gha_reviews("+
+			"id, pull_request_id, repo_name, number, user_id, user_login, "+
+			"state, body, commit_id, submitted_at, comments, dt"+
+			") "+lib.NValues(12),
+		args...,
+	)
+	return
+}
+
 // Add commit
 // sha, event_id, author_name, message, dup_actor_id, dup_actor_login,
 // dup_repo_id, dup_repo_name, dup_type, dup_created_at
@@ -0,0 +1,146 @@
+package devstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestLoadMetrics(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devstats_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	files := map[string]string{
+		"shared/metrics.yaml": `---
+params:
+  repo_group: 'Other'
+  label: 'kind/bug'
+metrics:
+  - name: Activity
+    series_name_or_func: multi_row_single_column
+    sql: activity
+    periods: d,w,m
+    multi_value: true
+  - name: Bugs
+    series_name_or_func: bugs
+    sql: bugs
+    periods: d
+    params:
+      label: 'bug'
+  - name: Episodic
+    series_name_or_func: multi_row_single_column
+    sql: episodic_prs
+    periods: d
+  - name: Episodic
+    series_name_or_func: multi_row_single_column
+    sql: episodic_issues
+    periods: d
+`,
+		"shared/affs.yaml": `---
+params:
+  lim: '10'
+metrics:
+  - name: Companies
+    series_name_or_func: multi_row_single_column
+    sql: companies
+    periods: y
+`,
+		"proj/metrics.yaml": `---
+extends: ../shared/metrics.yaml
+include:
+  - ../shared/affs.yaml
+params:
+  repo_group: 'Kubernetes'
+metrics:
+  - name: Activity
+    periods: d
+  - name: Bugs
+    params:
+      team: 'sig-node'
+  - name: Episodic
+    disabled: true
+  - name: Local
+    series_name_or_func: local
+    sql: local
+    periods: w
+`,
+		"cycle/a.yaml": "extends: b.yaml\n",
+		"cycle/b.yaml": "include: [a.yaml]\n",
+	}
+	for name, content := range files {
+		lib.FatalOnError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		lib.FatalOnError(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	var ctx lib.Ctx
+	metrics, err := lib.LoadMetrics(&ctx, filepath.Join(dir, "proj/metrics.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lib.Metric{
+		{
+			Name: "Activity", SeriesNameOrFunc: "multi_row_single_column", MetricSQL: "activity", Periods: "d", MultiValue: true,
+			Params: map[string]string{"repo_group": "Kubernetes", "label": "kind/bug"},
+		},
+		{
+			Name: "Bugs", SeriesNameOrFunc: "bugs", MetricSQL: "bugs", Periods: "d",
+			Params: map[string]string{"repo_group": "Kubernetes", "label": "bug", "team": "sig-node"},
+		},
+		{
+			Name: "Local", SeriesNameOrFunc: "local", MetricSQL: "local", Periods: "w",
+			Params: map[string]string{"repo_group": "Kubernetes", "label": "kind/bug"},
+		},
+		{
+			Name: "Companies", SeriesNameOrFunc: "multi_row_single_column", MetricSQL: "companies", Periods: "y",
+			Params: map[string]string{"repo_group": "Kubernetes", "label": "kind/bug", "lim": "10"},
+		},
+	}
+	if !reflect.DeepEqual(metrics.Metrics, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, metrics.Metrics)
+	}
+
+	// Project directory falls back to shared one
+	ctx.Project = "other"
+	metrics, err = lib.LoadMetrics(&ctx, filepath.Join(dir, "other/metrics.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.Metrics) != 4 || metrics.Metrics[3].MetricSQL != "episodic_issues" {
+		t.Errorf("expected shared metrics, got %+v", metrics.Metrics)
+	}
+
+	// Errors
+	if _, err = lib.LoadMetrics(&ctx, filepath.Join(dir, "cycle/a.yaml")); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected cycle error, got %v", err)
+	}
+	if _, err = lib.LoadMetrics(&ctx, filepath.Join(dir, "none/metrics.yaml")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestMetricParams(t *testing.T) {
+	params := map[string]string{"repo_group": "A, B: C", "labels": "'kind/bug', 'kind/flake'", "empty": ""}
+	encoded := lib.EncodeMetricParams(params)
+	if strings.ContainsAny(encoded, ",:") {
+		t.Errorf("encoded params contain option separators: %s", encoded)
+	}
+	decoded, err := lib.DecodeMetricParams(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, params) {
+		t.Errorf("expected %+v, got %+v", params, decoded)
+	}
+	got := lib.ReplaceMetricParams("select 1 where rg = '{{repo_group}}' and l in ({{labels}}) and {{period}}", params)
+	expected := "select 1 where rg = 'A, B: C' and l in ('kind/bug', 'kind/flake') and {{period}}"
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
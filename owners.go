@@ -0,0 +1,204 @@
+package devstats
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// OwnersFile - Kubernetes style `OWNERS` file structure
+// Per file filters are flattened to the OWNERS file's directory level
+type OwnersFile struct {
+	Approvers         []string              `yaml:"approvers"`
+	Reviewers         []string              `yaml:"reviewers"`
+	RequiredReviewers []string              `yaml:"required_reviewers"`
+	Filters           map[string]OwnersFile `yaml:"filters"`
+}
+
+// OwnersAliases - Kubernetes style `OWNERS_ALIASES` file structure
+type OwnersAliases struct {
+	Aliases map[string][]string `yaml:"aliases"`
+}
+
+// Owner - single owners entry
+// File is an owners file path (like "pkg/OWNERS" or ".github/CODEOWNERS")
+// Path is an owned path: directory for OWNERS files ("" for repository root), pattern for CODEOWNERS
+// Role can be: approver, reviewer, required_reviewer, codeowner
+type Owner struct {
+	File  string
+	Path  string
+	Role  string
+	Login string
+}
+
+// OwnerAlias - single alias member
+type OwnerAlias struct {
+	File  string
+	Alias string
+	Login string
+}
+
+// OwnersByPath - owners sort interface
+type OwnersByPath []Owner
+
+func (o OwnersByPath) Len() int      { return len(o) }
+func (o OwnersByPath) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o OwnersByPath) Less(i, j int) bool {
+	if o[i].Path != o[j].Path {
+		return o[i].Path < o[j].Path
+	}
+	if o[i].Role != o[j].Role {
+		return o[i].Role < o[j].Role
+	}
+	if o[i].Login != o[j].Login {
+		return o[i].Login < o[j].Login
+	}
+	return o[i].File < o[j].File
+}
+
+// IsOwnersFile - returns true if given repo path is an owners related file
+func IsOwnersFile(fn string) bool {
+	base := path.Base(fn)
+	return base == "OWNERS" || base == "OWNERS_ALIASES" || base == "CODEOWNERS"
+}
+
+// normalizeOwnerLogin - returns lowercase login without leading "@", or empty string for comments/empty entries
+func normalizeOwnerLogin(login string) string {
+	login = strings.TrimSpace(login)
+	if strings.HasPrefix(login, "#") {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(login, "@"))
+}
+
+// ParseOwnersAliases - parses `OWNERS_ALIASES` file contents
+func ParseOwnersAliases(fn string, data []byte) (aliases []OwnerAlias, err error) {
+	var oa OwnersAliases
+	err = yaml.Unmarshal(data, &oa)
+	if err != nil {
+		return
+	}
+	for alias, logins := range oa.Aliases {
+		for _, login := range logins {
+			login = normalizeOwnerLogin(login)
+			if login == "" {
+				continue
+			}
+			aliases = append(aliases, OwnerAlias{File: fn, Alias: strings.ToLower(alias), Login: login})
+		}
+	}
+	return
+}
+
+// ParseOwners - parses `OWNERS` file contents, expanding aliases using `aliases` map: alias -> logins
+func ParseOwners(fn string, data []byte, aliases map[string][]string) (owners []Owner, err error) {
+	var of OwnersFile
+	err = yaml.Unmarshal(data, &of)
+	if err != nil {
+		return
+	}
+	dir := path.Dir(fn)
+	if dir == "." {
+		dir = ""
+	}
+	add := func(role string, logins []string) {
+		for _, login := range logins {
+			login = normalizeOwnerLogin(login)
+			if login == "" {
+				continue
+			}
+			members, ok := aliases[login]
+			if !ok {
+				members = []string{login}
+			}
+			for _, member := range members {
+				owners = append(owners, Owner{File: fn, Path: dir, Role: role, Login: member})
+			}
+		}
+	}
+	files := []OwnersFile{of}
+	for _, filter := range of.Filters {
+		files = append(files, filter)
+	}
+	for _, f := range files {
+		add("approver", f.Approvers)
+		add("reviewer", f.Reviewers)
+		add("required_reviewer", f.RequiredReviewers)
+	}
+	owners = UniqueOwners(owners)
+	return
+}
+
+// ParseCodeOwners - parses GitHub `CODEOWNERS` file contents
+// Each line is: pattern followed by owners (@login, @org/team or e-mail)
+func ParseCodeOwners(fn string, data []byte) (owners []Owner) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ary := strings.Fields(line)
+		for _, login := range ary[1:] {
+			login = normalizeOwnerLogin(login)
+			if login == "" {
+				break
+			}
+			owners = append(owners, Owner{File: fn, Path: ary[0], Role: "codeowner", Login: login})
+		}
+	}
+	owners = UniqueOwners(owners)
+	return
+}
+
+// ParseAllOwners - parses all owners files given as map: file path -> contents
+// Returns all owners, all aliases and a list of files that failed to parse
+func ParseAllOwners(files map[string][]byte) (owners []Owner, aliases []OwnerAlias, errs map[string]error) {
+	errs = make(map[string]error)
+	aliasesMap := make(map[string][]string)
+	for fn, data := range files {
+		if path.Base(fn) != "OWNERS_ALIASES" {
+			continue
+		}
+		fileAliases, err := ParseOwnersAliases(fn, data)
+		if err != nil {
+			errs[fn] = err
+			continue
+		}
+		for _, alias := range fileAliases {
+			aliasesMap[alias.Alias] = append(aliasesMap[alias.Alias], alias.Login)
+		}
+		aliases = append(aliases, fileAliases...)
+	}
+	for fn, data := range files {
+		switch path.Base(fn) {
+		case "OWNERS":
+			fileOwners, err := ParseOwners(fn, data, aliasesMap)
+			if err != nil {
+				errs[fn] = err
+				continue
+			}
+			owners = append(owners, fileOwners...)
+		case "CODEOWNERS":
+			owners = append(owners, ParseCodeOwners(fn, data)...)
+		}
+	}
+	owners = UniqueOwners(owners)
+	return
+}
+
+// UniqueOwners - returns sorted owners without duplicates
+func UniqueOwners(owners []Owner) (outOwners []Owner) {
+	sort.Sort(OwnersByPath(owners))
+	for i, owner := range owners {
+		if i > 0 && owner == owners[i-1] {
+			continue
+		}
+		outOwners = append(outOwners, owner)
+	}
+	return
+}
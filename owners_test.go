@@ -0,0 +1,146 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestIsOwnersFile(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		path     string
+		expected bool
+	}{
+		{path: "OWNERS", expected: true},
+		{path: "pkg/kubelet/OWNERS", expected: true},
+		{path: "OWNERS_ALIASES", expected: true},
+		{path: ".github/CODEOWNERS", expected: true},
+		{path: "docs/OWNERS.md", expected: false},
+		{path: "pkg/owners/file.go", expected: false},
+		{path: "", expected: false},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got := lib.IsOwnersFile(test.path)
+		if got != test.expected {
+			t.Errorf(
+				"test number %d, path '%s', expected '%v', got '%v'",
+				index+1, test.path, test.expected, got,
+			)
+		}
+	}
+}
+
+func TestParseCodeOwners(t *testing.T) {
+	data := []byte(
+		"# This is a comment\n" +
+			"\n" +
+			"*       @Global-Owner\n" +
+			"*.js    @js-owner @org/js-team # trailing comment\n" +
+			"/docs/  docs@example.com\n" +
+			"/build/ @js-owner @js-owner\n",
+	)
+	expected := []lib.Owner{
+		{File: ".github/CODEOWNERS", Path: "*", Role: "codeowner", Login: "global-owner"},
+		{File: ".github/CODEOWNERS", Path: "*.js", Role: "codeowner", Login: "js-owner"},
+		{File: ".github/CODEOWNERS", Path: "*.js", Role: "codeowner", Login: "org/js-team"},
+		{File: ".github/CODEOWNERS", Path: "/build/", Role: "codeowner", Login: "js-owner"},
+		{File: ".github/CODEOWNERS", Path: "/docs/", Role: "codeowner", Login: "docs@example.com"},
+	}
+	got := lib.ParseCodeOwners(".github/CODEOWNERS", data)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected:\n%+v\ngot:\n%+v", expected, got)
+	}
+}
+
+func TestParseAllOwners(t *testing.T) {
+	// Test cases
+	var testCases = []struct {
+		files           map[string][]byte
+		expectedOwners  []lib.Owner
+		expectedAliases []lib.OwnerAlias
+		expectedErrors  []string
+	}{
+		{
+			files:           map[string][]byte{},
+			expectedOwners:  nil,
+			expectedAliases: nil,
+			expectedErrors:  []string{},
+		},
+		{
+			files: map[string][]byte{
+				"OWNERS": []byte("approvers:\n- Alice\n- bob\nreviewers:\n- carol\n"),
+			},
+			expectedOwners: []lib.Owner{
+				{File: "OWNERS", Path: "", Role: "approver", Login: "alice"},
+				{File: "OWNERS", Path: "", Role: "approver", Login: "bob"},
+				{File: "OWNERS", Path: "", Role: "reviewer", Login: "carol"},
+			},
+			expectedAliases: nil,
+			expectedErrors:  []string{},
+		},
+		{
+			files: map[string][]byte{
+				"OWNERS_ALIASES": []byte("aliases:\n  sig-node-approvers:\n  - Dave\n  - erin\n"),
+				"pkg/kubelet/OWNERS": []byte(
+					"approvers:\n- sig-node-approvers\nreviewers:\n- frank\n" +
+						"required_reviewers:\n- grace\n" +
+						"filters:\n  '\\.go$':\n    reviewers:\n    - heidi\n",
+				),
+				"broken/OWNERS": []byte("approvers: [\n"),
+			},
+			expectedOwners: []lib.Owner{
+				{File: "pkg/kubelet/OWNERS", Path: "pkg/kubelet", Role: "approver", Login: "dave"},
+				{File: "pkg/kubelet/OWNERS", Path: "pkg/kubelet", Role: "approver", Login: "erin"},
+				{File: "pkg/kubelet/OWNERS", Path: "pkg/kubelet", Role: "required_reviewer", Login: "grace"},
+				{File: "pkg/kubelet/OWNERS", Path: "pkg/kubelet", Role: "reviewer", Login: "frank"},
+				{File: "pkg/kubelet/OWNERS", Path: "pkg/kubelet", Role: "reviewer", Login: "heidi"},
+			},
+			expectedAliases: []lib.OwnerAlias{
+				{File: "OWNERS_ALIASES", Alias: "sig-node-approvers", Login: "dave"},
+				{File: "OWNERS_ALIASES", Alias: "sig-node-approvers", Login: "erin"},
+			},
+			expectedErrors: []string{"broken/OWNERS"},
+		},
+		{
+			files: map[string][]byte{
+				"OWNERS":             []byte("approvers:\n- alice\n"),
+				".github/CODEOWNERS": []byte("* @alice\n"),
+			},
+			expectedOwners: []lib.Owner{
+				{File: "OWNERS", Path: "", Role: "approver", Login: "alice"},
+				{File: ".github/CODEOWNERS", Path: "*", Role: "codeowner", Login: "alice"},
+			},
+			expectedAliases: nil,
+			expectedErrors:  []string{},
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		owners, aliases, errs := lib.ParseAllOwners(test.files)
+		if !reflect.DeepEqual(owners, test.expectedOwners) {
+			t.Errorf(
+				"test number %d, expected owners:\n%+v\ngot:\n%+v",
+				index+1, test.expectedOwners, owners,
+			)
+		}
+		if !reflect.DeepEqual(aliases, test.expectedAliases) {
+			t.Errorf(
+				"test number %d, expected aliases:\n%+v\ngot:\n%+v",
+				index+1, test.expectedAliases, aliases,
+			)
+		}
+		gotErrors := []string{}
+		for fn := range errs {
+			gotErrors = append(gotErrors, fn)
+		}
+		if !reflect.DeepEqual(gotErrors, test.expectedErrors) {
+			t.Errorf(
+				"test number %d, expected errors for:\n%+v\ngot:\n%+v",
+				index+1, test.expectedErrors, gotErrors,
+			)
+		}
+	}
+}
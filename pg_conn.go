@@ -93,13 +93,21 @@ func AddTSPoint(ctx *Ctx, pts *TSPoints, pt TSPoint) {
 //   use non-null mut only then.
 // No more giant lock approach here, but it is up to user to spcify call context, especially 2 last parameters!
 func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut *sync.Mutex) {
+	FatalOnError(WriteTSPointsErr(ctx, con, pts, mergeSeries, mut))
+}
+
+// WriteTSPointsErr - the same as WriteTSPoints, but returns error instead of exiting (used by interactive tools)
+func WriteTSPointsErr(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut *sync.Mutex) error {
 	npts := len(*pts)
 	if ctx.Debug > 0 {
 		Printf("WriteTSPoints: writing %d points\n", len(*pts))
 		Printf("Points:\n%+v\n", pts.Str())
 	}
 	if npts == 0 {
-		return
+		return nil
+	}
+	if err := tsPointsNamesErr(pts, mergeSeries); err != nil {
+		return err
 	}
 	merge := false
 	mergeS := ""
@@ -108,7 +116,7 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 		merge = true
 	}
 	tags := make(map[string]map[string]struct{})
-	fields := make(map[string]map[string]int)
+	fields := make(map[string]map[string]tsField)
 	for _, p := range *pts {
 		if p.tags != nil {
 			name := p.name
@@ -131,30 +139,23 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			}
 			_, ok := fields[name]
 			if !ok {
-				fields[name] = make(map[string]int)
+				fields[name] = make(map[string]tsField)
 			}
 			for fieldName, fieldValue := range p.fields {
 				fName := makePsqlName(fieldName, true)
-				t, ok := fields[name][fName]
-				if !ok {
-					t = -1
-				}
-				ty := -1
-				switch fieldValue.(type) {
-				case float64:
-					ty = 0
-				case string:
-					ty = 1
-				default:
-					Fatalf("usupported metric value type: %+v,%T (field %s)", fieldValue, fieldValue, fieldName)
+				ty, null, err := TSValueType(fieldValue)
+				if err != nil {
+					return fmt.Errorf("usupported metric value type: %+v,%T (field %s)", fieldValue, fieldValue, fieldName)
 				}
-				if t >= 0 && t != ty {
-					Fatalf(
-						"Field %s has a value %+v,%T, previous values were different type %d != %d",
-						fieldName, fieldValue, fieldValue, ty, t,
+				f := fields[name][fName]
+				merged, err := MergeTSTypes(f.ty, ty)
+				if err != nil {
+					return fmt.Errorf(
+						"field %s has a value %+v,%T, previous values were different type %s != %s",
+						fieldName, fieldValue, fieldValue, ty, f.ty,
 					)
 				}
-				fields[name][fName] = ty
+				fields[name][fName] = tsField{ty: merged, null: f.null || null}
 			}
 		}
 	}
@@ -168,15 +169,25 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 	if mut != nil {
 		mut.Lock()
 	}
+	unlock := func() {
+		if mut != nil {
+			mut.Unlock()
+		}
+	}
 	var (
 		exists    bool
 		colExists bool
+		err       error
 	)
 	for name, data := range tags {
 		if len(data) == 0 {
 			continue
 		}
-		exists = TableExists(con, ctx, name)
+		exists, err = tableExists(con, ctx, name)
+		if err != nil {
+			unlock()
+			return err
+		}
 		if !exists {
 			sq := "create table if not exists \"" + name + "\"("
 			sq += "time timestamp primary key, "
@@ -194,7 +205,11 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			sqls = append(sqls, "grant select on \""+name+"\" to devstats_team")
 		} else {
 			for col := range data {
-				colExists = TableColumnExists(con, ctx, name, col)
+				colExists, err = tableColumnExists(con, ctx, name, col)
+				if err != nil {
+					unlock()
+					return err
+				}
 				if !colExists {
 					sq := "alter table \"" + name + "\" add column if not exists \"" + col + "\" text"
 					sqls = append(sqls, sq)
@@ -204,53 +219,55 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			}
 		}
 	}
+	// Column types that values are converted to
+	colTypes := make(map[string]map[string]TSType)
 	if merge {
-		bTable := false
-		colMap := make(map[string]struct{})
-		for _, data := range fields {
-			if len(data) == 0 {
-				continue
+		// All series share merged table columns
+		data := make(map[string]tsField)
+		for _, seriesData := range fields {
+			for col, f := range seriesData {
+				current := data[col]
+				merged, err := MergeTSTypes(current.ty, f.ty)
+				if err != nil {
+					unlock()
+					return fmt.Errorf("merged series %s: column %s: %v", mergeSeries, col, err)
+				}
+				data[col] = tsField{ty: merged, null: current.null || f.null}
 			}
-			if !bTable {
-				exists = TableExists(con, ctx, mergeS)
-				if !exists {
-					sq := "create table if not exists \"" + mergeS + "\"("
-					sq += "time timestamp not null, series text not null, period text not null default '', "
-					indices := []string{
-						"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"t", false) + "\" on \"" + mergeS + "\"(time)",
-						"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"s", false) + "\" on \"" + mergeS + "\"(series)",
-						"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"p", false) + "\" on \"" + mergeS + "\"(period)",
-					}
-					for col, ty := range data {
-						if ty == 0 {
-							sq += "\"" + col + "\" double precision not null default 0.0, "
-							//indices = append(indices, "create index if not exists \""+makePsqlName("i"+mergeS[1:]+col, false)+"\" on \""+mergeS+"\"(\""+col+"\")")
-						} else {
-							sq += "\"" + col + "\" text not null default '', "
-						}
-						colMap[col] = struct{}{}
-					}
-					sq += "primary key(time, series, period))"
-					sqls = append(sqls, sq)
-					sqls = append(sqls, indices...)
-					sqls = append(sqls, "grant select on \""+mergeS+"\" to ro_user")
-					sqls = append(sqls, "grant select on \""+mergeS+"\" to devstats_team")
+		}
+		colTypes[mergeS] = make(map[string]TSType)
+		if len(data) > 0 {
+			exists, err = tableExists(con, ctx, mergeS)
+			if err != nil {
+				unlock()
+				return err
+			}
+			if !exists {
+				sq := "create table if not exists \"" + mergeS + "\"("
+				sq += "time timestamp not null, series text not null, period text not null default '', "
+				indices := []string{
+					"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"t", false) + "\" on \"" + mergeS + "\"(time)",
+					"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"s", false) + "\" on \"" + mergeS + "\"(series)",
+					"create index if not exists \"" + makePsqlName("i"+mergeS[1:]+"p", false) + "\" on \"" + mergeS + "\"(period)",
 				}
-				bTable = true
-			}
-			for col, ty := range data {
-				_, ok := colMap[col]
-				if !ok {
-					colExists = TableColumnExists(con, ctx, mergeS, col)
-					colMap[col] = struct{}{}
-					if !colExists {
-						if ty == 0 {
-							sqls = append(sqls, "alter table \""+mergeS+"\" add column if not exists \""+col+"\" double precision not null default 0.0")
-							//sqls = append(sqls, "create index if not exists \""+makePsqlName("i"+mergeS[1:]+col, false)+"\" on \""+mergeS+"\"(\""+col+"\")")
-						} else {
-							sqls = append(sqls, "alter table \""+mergeS+"\" add column if not exists \""+col+"\" text not null default ''")
-						}
+				for col, f := range data {
+					sq += "\"" + col + "\" " + TSColumnDef(f.ty, f.null) + ", "
+					colTypes[mergeS][col] = f.ty
+				}
+				sq += "primary key(time, series, period))"
+				sqls = append(sqls, sq)
+				sqls = append(sqls, indices...)
+				sqls = append(sqls, "grant select on \""+mergeS+"\" to ro_user")
+				sqls = append(sqls, "grant select on \""+mergeS+"\" to devstats_team")
+			} else {
+				for col, f := range data {
+					var colSQLs []string
+					colSQLs, colTypes[mergeS][col], err = tsColumnSQLs(con, ctx, mergeS, col, f)
+					if err != nil {
+						unlock()
+						return err
 					}
+					sqls = append(sqls, colSQLs...)
 				}
 			}
 		}
@@ -259,7 +276,12 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			if len(data) == 0 {
 				continue
 			}
-			exists = TableExists(con, ctx, name)
+			colTypes[name] = make(map[string]TSType)
+			exists, err = tableExists(con, ctx, name)
+			if err != nil {
+				unlock()
+				return err
+			}
 			if !exists {
 				sq := "create table if not exists \"" + name + "\"("
 				sq += "time timestamp not null, period text not null default '', "
@@ -267,13 +289,9 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 					"create index if not exists \"" + makePsqlName("i"+name[1:]+"t", false) + "\" on \"" + name + "\"(time)",
 					"create index if not exists \"" + makePsqlName("i"+name[1:]+"p", false) + "\" on \"" + name + "\"(period)",
 				}
-				for col, ty := range data {
-					if ty == 0 {
-						sq += "\"" + col + "\" double precision not null default 0.0, "
-						//indices = append(indices, "create index if not exists \""+makePsqlName("i"+name[1:]+col, false)+"\" on \""+name+"\"(\""+col+"\")")
-					} else {
-						sq += "\"" + col + "\" text not null default '', "
-					}
+				for col, f := range data {
+					sq += "\"" + col + "\" " + TSColumnDef(f.ty, f.null) + ", "
+					colTypes[name][col] = f.ty
 				}
 				sq += "primary key(time, period))"
 				sqls = append(sqls, sq)
@@ -281,16 +299,14 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 				sqls = append(sqls, "grant select on \""+name+"\" to ro_user")
 				sqls = append(sqls, "grant select on \""+name+"\" to devstats_team")
 			} else {
-				for col, ty := range data {
-					colExists = TableColumnExists(con, ctx, name, col)
-					if !colExists {
-						if ty == 0 {
-							sqls = append(sqls, "alter table \""+name+"\" add column if not exists \""+col+"\" double precision not null default 0.0")
-							//sqls = append(sqls, "create index if not exists \""+makePsqlName("i"+name[1:]+col, false)+"\" on \""+name+"\"(\""+col+"\")")
-						} else {
-							sqls = append(sqls, "alter table \""+name+"\" add column if not exists \""+col+"\" text not null default ''")
-						}
+				for col, f := range data {
+					var colSQLs []string
+					colSQLs, colTypes[name][col], err = tsColumnSQLs(con, ctx, name, col, f)
+					if err != nil {
+						unlock()
+						return err
 					}
+					sqls = append(sqls, colSQLs...)
 				}
 			}
 		}
@@ -299,19 +315,32 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 		Printf("structural sqls:\n%s\n", strings.Join(sqls, "\n"))
 	}
 	for _, q := range sqls {
-		// Notice: This **may** fail, when using multiple processes (not threads) to create structures (tables, columns and indices)
+		// Notice: This **may** fail, when using multiple processes (not threads) to create structures (tables and indices)
 		// But each operation can only fail when some other process already executed it succesfully
-		// So **ALL** those failures are *OK*.
+		// So those failures are *OK*.
 		// We can avoid thenm by using transaction, but it is much slower then, effect is the same and all we want **IS THE SPEED**
 		// So this is done for purpose!
-		_, err := ExecSQL(con, ctx, q)
+		// Schema evolution (`alter table`: adding columns, widening types, dropping not null) is idempotent
+		// and values written next depend on it, so its failures are errors
+		_, err = ExecSQL(con, ctx, q)
 		if err != nil {
+			if strings.HasPrefix(q, "alter table ") {
+				unlock()
+				return fmt.Errorf("schema evolution failed: %s: %v", q, err)
+			}
 			Printf("Ignored %s\n", q)
 		}
 	}
 	// Only used when multiple threads are writing the same series
-	if mut != nil {
-		mut.Unlock()
+	unlock()
+	// Field values are converted to their columns types
+	var convErr error
+	value := func(v interface{}, ty TSType) interface{} {
+		cv, err := TSConvertValue(v, ty)
+		if err != nil && convErr == nil {
+			convErr = err
+		}
+		return cv
 	}
 	ns := 0
 	for _, p := range *pts {
@@ -351,7 +380,12 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 					"where \"%[1]s\".time = "+argT,
 				name,
 			)
-			ExecSQLWithErr(con, ctx, q, vals...)
+			if convErr != nil {
+				return convErr
+			}
+			if _, err = ExecSQL(con, ctx, q, vals...); err != nil {
+				return err
+			}
 			ns++
 		}
 		if p.fields != nil && !merge {
@@ -363,7 +397,7 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			for fieldName, fieldValue := range p.fields {
 				namesI = append(namesI, "\""+makePsqlName(fieldName, true)+"\"")
 				argsI = append(argsI, "$"+strconv.Itoa(i))
-				vals = append(vals, fieldValue)
+				vals = append(vals, value(fieldValue, colTypes[name][makePsqlName(fieldName, true)]))
 				i++
 			}
 			namesIA := strings.Join(namesI, ", ")
@@ -373,7 +407,7 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			for fieldName, fieldValue := range p.fields {
 				namesU = append(namesU, "\""+makePsqlName(fieldName, true)+"\"")
 				argsU = append(argsU, "$"+strconv.Itoa(i))
-				vals = append(vals, fieldValue)
+				vals = append(vals, value(fieldValue, colTypes[name][makePsqlName(fieldName, true)]))
 				i++
 			}
 			namesUA := strings.Join(namesU, ", ")
@@ -392,7 +426,12 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 					"where \"%[1]s\".time = "+argT+" and \"%[1]s\".period = "+argP,
 				name,
 			)
-			ExecSQLWithErr(con, ctx, q, vals...)
+			if convErr != nil {
+				return convErr
+			}
+			if _, err = ExecSQL(con, ctx, q, vals...); err != nil {
+				return err
+			}
 			ns++
 		}
 		if p.fields != nil && merge {
@@ -403,7 +442,7 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			for fieldName, fieldValue := range p.fields {
 				namesI = append(namesI, "\""+makePsqlName(fieldName, true)+"\"")
 				argsI = append(argsI, "$"+strconv.Itoa(i))
-				vals = append(vals, fieldValue)
+				vals = append(vals, value(fieldValue, colTypes[mergeS][makePsqlName(fieldName, true)]))
 				i++
 			}
 			namesIA := strings.Join(namesI, ", ")
@@ -413,7 +452,7 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 			for fieldName, fieldValue := range p.fields {
 				namesU = append(namesU, "\""+makePsqlName(fieldName, true)+"\"")
 				argsU = append(argsU, "$"+strconv.Itoa(i))
-				vals = append(vals, fieldValue)
+				vals = append(vals, value(fieldValue, colTypes[mergeS][makePsqlName(fieldName, true)]))
 				i++
 			}
 			namesUA := strings.Join(namesU, ", ")
@@ -434,13 +473,81 @@ func WriteTSPoints(ctx *Ctx, con *sql.DB, pts *TSPoints, mergeSeries string, mut
 					"where \"%[1]s\".time = "+argT+" and \"%[1]s\".period = "+argP+" and \"%[1]s\".series = "+argS,
 				mergeS,
 			)
-			ExecSQLWithErr(con, ctx, q, vals...)
+			if convErr != nil {
+				return convErr
+			}
+			if _, err = ExecSQL(con, ctx, q, vals...); err != nil {
+				return err
+			}
 			ns++
 		}
 	}
 	if ctx.Debug > 0 {
 		Printf("upserts: %d\n", ns)
 	}
+	return nil
+}
+
+// tsField - type of a field in all points of a batch, null is set when any of them is NULL
+type tsField struct {
+	ty   TSType
+	null bool
+}
+
+// tsColumnSQLs - returns SQLs adding or evolving existing table's column so it can hold field values (see TSColumnAlterations)
+// and column type that values must be converted to
+func tsColumnSQLs(con *sql.DB, ctx *Ctx, table, col string, f tsField) ([]string, TSType, error) {
+	dataType, nullable, err := tableColumnType(con, ctx, table, col)
+	if err != nil {
+		return nil, TSUnknown, err
+	}
+	if dataType == "" {
+		ty := f.ty
+		if ty == TSUnknown {
+			ty = TSFloat
+		}
+		return []string{"alter table \"" + table + "\" add column if not exists \"" + col + "\" " + TSColumnDef(f.ty, f.null)}, ty, nil
+	}
+	clauses, ty, err := TSColumnAlterations(col, TSTypeOfColumn(dataType), nullable, f.ty, f.null)
+	if err != nil {
+		return nil, TSUnknown, fmt.Errorf("table %s: %v", table, err)
+	}
+	if len(clauses) == 0 {
+		return nil, ty, nil
+	}
+	return []string{"alter table \"" + table + "\" " + strings.Join(clauses, ", ")}, ty, nil
+}
+
+// tsPointsNamesErr - returns error when points would create tables or columns with too long names
+func tsPointsNamesErr(pts *TSPoints, mergeSeries string) error {
+	names := []string{}
+	if mergeSeries != "" {
+		names = append(names, "s"+mergeSeries)
+	}
+	for _, p := range *pts {
+		if p.tags != nil {
+			if mergeSeries == "" {
+				names = append(names, "t"+p.name)
+			}
+			for tagName := range p.tags {
+				names = append(names, tagName)
+			}
+		}
+		if p.fields != nil {
+			if mergeSeries == "" {
+				names = append(names, "s"+p.name)
+			}
+			for fieldName := range p.fields {
+				names = append(names, fieldName)
+			}
+		}
+	}
+	for _, name := range names {
+		if l := len(name); l > 63 {
+			return fmt.Errorf("postgresql identifier name too long (%d, %s)", l, name)
+		}
+	}
+	return nil
 }
 
 // makePsqlName makes sure the identifier is shorter than 64
@@ -486,50 +593,101 @@ func GetTagValues(con *sql.DB, ctx *Ctx, name, key string) (ret []string) {
 
 // TableExists - checks if a given table exists
 func TableExists(con *sql.DB, ctx *Ctx, tableName string) bool {
+	exists, err := tableExists(con, ctx, tableName)
+	FatalOnError(err)
+	return exists
+}
+
+// tableExists - checks if a given table exists, returns error
+func tableExists(con *sql.DB, ctx *Ctx, tableName string) (bool, error) {
 	var s *string
-	FatalOnError(QueryRowSQL(con, ctx, fmt.Sprintf("select to_regclass(%s)", NValue(1)), tableName).Scan(&s))
-	return s != nil
+	err := QueryRowSQL(con, ctx, fmt.Sprintf("select to_regclass(%s)", NValue(1)), tableName).Scan(&s)
+	return s != nil, err
 }
 
-// TableColumnExists - checks if a given table's has a given column
+// TableColumnExists - checks if a given table's has a given column (table in the current schema)
 func TableColumnExists(con *sql.DB, ctx *Ctx, tableName, columnName string) bool {
+	exists, err := tableColumnExists(con, ctx, tableName, columnName)
+	FatalOnError(err)
+	return exists
+}
+
+// tableColumnExists - checks if a given table's has a given column (table in the current schema), returns error
+func tableColumnExists(con *sql.DB, ctx *Ctx, tableName, columnName string) (bool, error) {
 	var s *string
-	FatalOnError(
-		QueryRowSQL(
-			con,
-			ctx,
-			fmt.Sprintf(
-				"select column_name from information_schema.columns "+
-					"where table_name=%s and column_name=%s "+
-					"union select null limit 1",
-				NValue(1),
-				NValue(2),
-			),
-			tableName,
-			columnName,
-		).Scan(&s),
+	err := QueryRowSQL(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"select column_name from information_schema.columns "+
+				"where table_schema=current_schema() and table_name=%s and column_name=%s "+
+				"union select null limit 1",
+			NValue(1),
+			NValue(2),
+		),
+		tableName,
+		columnName,
+	).Scan(&s)
+	return s != nil, err
+}
+
+// TableColumnType - returns table's column data type (information_schema data_type) and whether it is nullable
+// Returns empty data type when there is no such column (table in the current schema)
+func TableColumnType(con *sql.DB, ctx *Ctx, tableName, columnName string) (string, bool) {
+	dataType, nullable, err := tableColumnType(con, ctx, tableName, columnName)
+	FatalOnError(err)
+	return dataType, nullable
+}
+
+// tableColumnType - returns table's column data type and whether it is nullable, returns error
+func tableColumnType(con *sql.DB, ctx *Ctx, tableName, columnName string) (dataType string, nullable bool, err error) {
+	var (
+		s *string
+		n *string
 	)
-	return s != nil
+	err = QueryRowSQL(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"select data_type, is_nullable from information_schema.columns "+
+				"where table_schema=current_schema() and table_name=%s and column_name=%s "+
+				"union all select null, null order by 1 nulls last limit 1",
+			NValue(1),
+			NValue(2),
+		),
+		tableName,
+		columnName,
+	).Scan(&s, &n)
+	if err != nil || s == nil {
+		return
+	}
+	return *s, n != nil && *n == "YES", nil
 }
 
 // PgConn Connects to Postgres database
 func PgConn(ctx *Ctx) *sql.DB {
-	connectionString := "client_encoding=UTF8 sslmode='" + ctx.PgSSL + "' host='" + ctx.PgHost + "' port=" + ctx.PgPort + " dbname='" + ctx.PgDB + "' user='" + ctx.PgUser + "' password='" + ctx.PgPass + "'"
-	if ctx.QOut {
-		// Use fmt.Printf (not lib.Printf that logs to DB) here
-		// Avoid trying to log something to DB while connecting
-		fmt.Printf("ConnectString: %s\n", connectionString)
-	}
-
-	con, err := sql.Open("postgres", connectionString)
-	FatalOnError(err)
-	return con
+	return PgConnDB(ctx, ctx.PgDB)
 }
 
 // PgConnDB Connects to Postgres database (with specific DB name)
 // uses database 'dbname' instead of 'PgDB'
 func PgConnDB(ctx *Ctx, dbName string) *sql.DB {
-	connectionString := "client_encoding=UTF8 sslmode='" + ctx.PgSSL + "' host='" + ctx.PgHost + "' port=" + ctx.PgPort + " dbname='" + dbName + "' user='" + ctx.PgUser + "' password='" + ctx.PgPass + "'"
+	return pgOpen(ctx, pgConnectionString(ctx, dbName))
+}
+
+// PgConnDBSchema Connects to Postgres database (with specific DB name)
+// uses `schema` as the only search path, so unqualified table names refer to that schema
+func PgConnDBSchema(ctx *Ctx, dbName, schema string) *sql.DB {
+	return pgOpen(ctx, pgConnectionString(ctx, dbName)+" search_path='"+schema+"'")
+}
+
+// pgConnectionString - returns connection string for a given database
+func pgConnectionString(ctx *Ctx, dbName string) string {
+	return "client_encoding=UTF8 sslmode='" + ctx.PgSSL + "' host='" + ctx.PgHost + "' port=" + ctx.PgPort + " dbname='" + dbName + "' user='" + ctx.PgUser + "' password='" + ctx.PgPass + "'"
+}
+
+// pgOpen - opens Postgres connection using a given connection string
+func pgOpen(ctx *Ctx, connectionString string) *sql.DB {
 	if ctx.QOut {
 		// Use fmt.Printf (not lib.Printf that logs to DB) here
 		// Avoid trying to log something to DB while connecting
@@ -773,6 +931,14 @@ func IntOrNil(intPtr *int) interface{} {
 	return *intPtr
 }
 
+// Int64OrNil - return either nil or value of int64Ptr
+func Int64OrNil(int64Ptr *int64) interface{} {
+	if int64Ptr == nil {
+		return nil
+	}
+	return *int64Ptr
+}
+
 // FirstIntOrNil - return either nil or value of intPtr
 func FirstIntOrNil(intPtrs []*int) interface{} {
 	for _, intPtr := range intPtrs {
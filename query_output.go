@@ -0,0 +1,290 @@
+package devstats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Query output formats (runq tool)
+const (
+	FormatTable    = "table"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSON     = "json"
+	FormatMarkdown = "md"
+)
+
+// RowsDiff - row level differences between two query results
+// Rows are compared as a multiset, so the same row returned twice on one side and once on the other is a difference
+type RowsDiff struct {
+	Columns []string   // Set when results have different columns
+	Removed [][]string // Rows only in the first result
+	Added   [][]string // Rows only in the second result
+}
+
+// Empty - returns true when results are identical (up to rows order)
+func (d *RowsDiff) Empty() bool {
+	return len(d.Columns) == 0 && len(d.Removed) == 0 && len(d.Added) == 0
+}
+
+// rowValues - returns row values as strings, NULL is an empty string
+func rowValues(row []*string) []string {
+	values := []string{}
+	for _, pValue := range row {
+		if pValue == nil {
+			values = append(values, "")
+			continue
+		}
+		values = append(values, *pValue)
+	}
+	return values
+}
+
+// FormatRows - formats query result using a given output format
+func FormatRows(format string, rows MetricRows) (string, error) {
+	switch format {
+	case FormatTable, "":
+		return formatTable(rows), nil
+	case FormatCSV, FormatTSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		if format == FormatTSV {
+			writer.Comma = '\t'
+		}
+		if err := writer.Write(rows.Columns); err != nil {
+			return "", err
+		}
+		for _, row := range rows.Rows {
+			if err := writer.Write(rowValues(row)); err != nil {
+				return "", err
+			}
+		}
+		writer.Flush()
+		return buf.String(), writer.Error()
+	case FormatJSON:
+		objs := []map[string]interface{}{}
+		for _, row := range rows.Rows {
+			obj := make(map[string]interface{})
+			for i, column := range rows.Columns {
+				if row[i] == nil {
+					obj[column] = nil
+					continue
+				}
+				obj[column] = *row[i]
+			}
+			objs = append(objs, obj)
+		}
+		data, err := json.MarshalIndent(objs, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	case FormatMarkdown:
+		escape := func(values []string) string {
+			for i := range values {
+				values[i] = strings.Replace(strings.Replace(values[i], "|", "\\|", -1), "\n", " ", -1)
+			}
+			return "| " + strings.Join(values, " | ") + " |\n"
+		}
+		s := escape(append([]string{}, rows.Columns...))
+		s += "|" + strings.Repeat(" --- |", len(rows.Columns)) + "\n"
+		for _, row := range rows.Rows {
+			s += escape(rowValues(row))
+		}
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown output format '%s', allowed: table, csv, tsv, json, md", format)
+}
+
+// formatTable - formats query result as an ASCII table
+func formatTable(rows MetricRows) string {
+	lengths := []int{}
+	for i, column := range rows.Columns {
+		maxLen := len(column)
+		for _, row := range rows.Rows {
+			if row[i] != nil && len(*row[i]) > maxLen {
+				maxLen = len(*row[i])
+			}
+		}
+		lengths = append(lengths, maxLen)
+	}
+	frame := func(left, middle, right string) string {
+		parts := []string{}
+		for _, l := range lengths {
+			parts = append(parts, strings.Repeat("-", l))
+		}
+		return left + strings.Join(parts, middle) + right + "\n"
+	}
+	line := func(values []string) string {
+		parts := []string{}
+		for i, value := range values {
+			parts = append(parts, fmt.Sprintf(fmt.Sprintf("%%-%ds", lengths[i]), value))
+		}
+		return "|" + strings.Join(parts, "|") + "|\n"
+	}
+	s := frame("/", "+", "\\")
+	s += line(rows.Columns)
+	s += frame("+", "+", "+")
+	for _, row := range rows.Rows {
+		s += line(rowValues(row))
+	}
+	s += frame("\\", "+", "/")
+	return s
+}
+
+// DiffRows - returns row level differences between two query results
+func DiffRows(a, b MetricRows) (diff RowsDiff) {
+	if strings.Join(a.Columns, "\x00") != strings.Join(b.Columns, "\x00") {
+		diff.Columns = []string{strings.Join(a.Columns, ","), strings.Join(b.Columns, ",")}
+	}
+	key := func(row []*string) string {
+		parts := []string{}
+		for _, pValue := range row {
+			if pValue == nil {
+				parts = append(parts, "\x01")
+				continue
+			}
+			parts = append(parts, *pValue)
+		}
+		return strings.Join(parts, "\x00")
+	}
+	counts := make(map[string]int)
+	for _, row := range b.Rows {
+		counts[key(row)]++
+	}
+	for _, row := range a.Rows {
+		k := key(row)
+		if counts[k] > 0 {
+			counts[k]--
+			continue
+		}
+		diff.Removed = append(diff.Removed, rowValues(row))
+	}
+	for _, row := range b.Rows {
+		k := key(row)
+		if counts[k] > 0 {
+			counts[k]--
+			diff.Added = append(diff.Added, rowValues(row))
+		}
+	}
+	return
+}
+
+// String - returns differences in a unified diff like format
+func (d *RowsDiff) String() string {
+	s := ""
+	if len(d.Columns) > 0 {
+		s += fmt.Sprintf("columns: -%s +%s\n", d.Columns[0], d.Columns[1])
+	}
+	for _, row := range d.Removed {
+		s += "- " + strings.Join(row, " | ") + "\n"
+	}
+	for _, row := range d.Added {
+		s += "+ " + strings.Join(row, " | ") + "\n"
+	}
+	return s
+}
+
+// LoadQueryParams - reads runq parameters from YAML file, returns them as `name value` pairs in file order
+// Keys can be `{{name}}` template parameters, `qr` or raw string replacements (applied in file order)
+func LoadQueryParams(data []byte) ([]string, error) {
+	var params yaml.MapSlice
+	if err := yaml.Unmarshal(data, &params); err != nil {
+		return nil, err
+	}
+	pairs := []string{}
+	for _, item := range params {
+		value := ""
+		if item.Value != nil {
+			value = fmt.Sprintf("%v", item.Value)
+		}
+		pairs = append(pairs, fmt.Sprintf("%v", item.Key), value)
+	}
+	return pairs, nil
+}
+
+var (
+	// sqlCommentsLiteralsRe - SQL comments, string literals and quoted identifiers
+	sqlCommentsLiteralsRe = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/|'(?:[^']|'')*'|"(?:[^"]|"")*"`)
+	// sqlModifyRe - statements that modify data or schema
+	sqlModifyRe = regexp.MustCompile(`(?i)\b(insert|update|delete|merge|upsert|truncate|create|drop|alter|copy|grant|revoke|vacuum|reindex|cluster|refresh|call|do)\b`)
+)
+
+// SQLModifiesData - returns true if SQL contains data or schema modifying statements (ignores comments and literals)
+func SQLModifiesData(sqlQuery string) bool {
+	return sqlModifyRe.MatchString(sqlCommentsLiteralsRe.ReplaceAllString(sqlQuery, " "))
+}
+
+// ExplainSummary - returns summary of `explain (analyze, buffers, format json)` output:
+// planning and execution time, top plan node, rows and buffers, and the slowest plan nodes (by exclusive time)
+func ExplainSummary(data []byte) (string, error) {
+	var plans []struct {
+		Plan          map[string]interface{} `json:"Plan"`
+		PlanningTime  float64                `json:"Planning Time"`
+		ExecutionTime float64                `json:"Execution Time"`
+	}
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return "", err
+	}
+	if len(plans) == 0 {
+		return "", fmt.Errorf("empty explain output")
+	}
+	p := plans[0]
+	num := func(node map[string]interface{}, key string) float64 {
+		v, _ := node[key].(float64)
+		return v
+	}
+	type nodeTime struct {
+		name string
+		time float64
+	}
+	// Node's exclusive time is its total time (all loops) without its child nodes total times
+	nodes := []nodeTime{}
+	var walk func(node map[string]interface{}) float64
+	walk = func(node map[string]interface{}) float64 {
+		name, _ := node["Node Type"].(string)
+		if rel, ok := node["Relation Name"].(string); ok {
+			name += " on " + rel
+		}
+		total := num(node, "Actual Total Time") * num(node, "Actual Loops")
+		index := len(nodes)
+		nodes = append(nodes, nodeTime{name: name})
+		exclusive := total
+		children, _ := node["Plans"].([]interface{})
+		for _, child := range children {
+			if c, ok := child.(map[string]interface{}); ok {
+				exclusive -= walk(c)
+			}
+		}
+		if exclusive < 0 {
+			exclusive = 0
+		}
+		nodes[index].time = exclusive
+		return total
+	}
+	walk(p.Plan)
+	s := fmt.Sprintf("Planning time: %.3f ms, execution time: %.3f ms\n", p.PlanningTime, p.ExecutionTime)
+	s += fmt.Sprintf(
+		"Top node: %s, cost: %.2f, rows: %.0f (estimated %.0f)\n",
+		nodes[0].name, num(p.Plan, "Total Cost"), num(p.Plan, "Actual Rows"), num(p.Plan, "Plan Rows"),
+	)
+	s += fmt.Sprintf(
+		"Buffers: shared hit: %.0f, read: %.0f, temp read: %.0f, written: %.0f\n",
+		num(p.Plan, "Shared Hit Blocks"), num(p.Plan, "Shared Read Blocks"), num(p.Plan, "Temp Read Blocks"), num(p.Plan, "Temp Written Blocks"),
+	)
+	sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].time > nodes[j].time })
+	for i, node := range nodes {
+		if i == 3 {
+			break
+		}
+		s += fmt.Sprintf("Slowest node #%d: %s: %.3f ms exclusive\n", i+1, node.name, node.time)
+	}
+	return s, nil
+}
@@ -0,0 +1,169 @@
+package devstats
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestFormatRows(t *testing.T) {
+	rows := metricRows([]string{"name", "value"}, []string{"a|b", "1"}, []string{"c", "NULL"})
+	var testCases = []struct {
+		format   string
+		rows     lib.MetricRows
+		expected string
+		err      string
+	}{
+		{
+			format:   lib.FormatTable,
+			rows:     rows,
+			expected: "/----+-----\\\n|name|value|\n+----+-----+\n|a|b |1    |\n|c   |     |\n\\----+-----/\n",
+		},
+		{
+			format:   lib.FormatCSV,
+			rows:     rows,
+			expected: "name,value\na|b,1\nc,\n",
+		},
+		{
+			format:   lib.FormatTSV,
+			rows:     rows,
+			expected: "name\tvalue\na|b\t1\nc\t\n",
+		},
+		{
+			format:   lib.FormatJSON,
+			rows:     rows,
+			expected: "[\n  {\n    \"name\": \"a|b\",\n    \"value\": \"1\"\n  },\n  {\n    \"name\": \"c\",\n    \"value\": null\n  }\n]\n",
+		},
+		{
+			format:   lib.FormatJSON,
+			rows:     metricRows([]string{"name"}),
+			expected: "[]\n",
+		},
+		{
+			format:   lib.FormatMarkdown,
+			rows:     rows,
+			expected: "| name | value |\n| --- | --- |\n| a\\|b | 1 |\n| c |  |\n",
+		},
+		{format: "xml", rows: rows, err: "unknown output format"},
+	}
+	for _, test := range testCases {
+		got, err := lib.FormatRows(test.format, test.rows)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error '%s', got %v", test.format, test.err, err)
+			}
+			continue
+		}
+		if err != nil || got != test.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s\nerror: %v", test.format, test.expected, got, err)
+		}
+	}
+}
+
+func TestDiffRows(t *testing.T) {
+	columns := []string{"name", "value"}
+	var testCases = []struct {
+		a, b     lib.MetricRows
+		expected lib.RowsDiff
+	}{
+		{
+			a:        metricRows(columns, []string{"a", "1"}, []string{"b", "2"}),
+			b:        metricRows(columns, []string{"b", "2"}, []string{"a", "1"}),
+			expected: lib.RowsDiff{},
+		},
+		{
+			a: metricRows(columns, []string{"a", "1"}, []string{"b", "2"}, []string{"c", "NULL"}),
+			b: metricRows(columns, []string{"a", "1"}, []string{"b", "3"}, []string{"c", ""}),
+			expected: lib.RowsDiff{
+				Removed: [][]string{{"b", "2"}, {"c", ""}},
+				Added:   [][]string{{"b", "3"}, {"c", ""}},
+			},
+		},
+		{
+			a:        metricRows(columns, []string{"a", "1"}, []string{"a", "1"}),
+			b:        metricRows([]string{"name", "val"}, []string{"a", "1"}),
+			expected: lib.RowsDiff{Columns: []string{"name,value", "name,val"}, Removed: [][]string{{"a", "1"}}},
+		},
+	}
+	for index, test := range testCases {
+		got := lib.DiffRows(test.a, test.b)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+		if got.Empty() != reflect.DeepEqual(test.expected, lib.RowsDiff{}) {
+			t.Errorf("test number %d, unexpected Empty() result for %+v", index+1, got)
+		}
+	}
+}
+
+func TestLoadQueryParams(t *testing.T) {
+	var testCases = []struct {
+		data     string
+		expected []string
+		err      bool
+	}{
+		{
+			data:     "'{{from}}': '2018-01-01'\n'{{to}}': '2018-02-01'\n'{{n}}': 1.5\nqr: '1 week,,'\nREPLACE: ~\n",
+			expected: []string{"{{from}}", "2018-01-01", "{{to}}", "2018-02-01", "{{n}}", "1.5", "qr", "1 week,,", "REPLACE", ""},
+		},
+		{data: "", expected: []string{}},
+		{data: "- a\n- b\n", err: true},
+	}
+	for _, test := range testCases {
+		got, err := lib.LoadQueryParams([]byte(test.data))
+		if test.err {
+			if err == nil {
+				t.Errorf("'%s': expected error, got %+v", test.data, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("'%s': expected %+v, got %+v, %v", test.data, test.expected, got, err)
+		}
+	}
+}
+
+func TestExplainSummary(t *testing.T) {
+	plan := `[{"Plan": {"Node Type": "Aggregate", "Total Cost": 125.5, "Plan Rows": 1, "Actual Rows": 1,
+		"Actual Total Time": 9.5, "Actual Loops": 1, "Shared Hit Blocks": 100, "Shared Read Blocks": 20,
+		"Plans": [{"Node Type": "Seq Scan", "Relation Name": "gha_events", "Actual Total Time": 7.25, "Actual Loops": 1},
+			{"Node Type": "Index Scan", "Relation Name": "gha_actors", "Actual Total Time": 0.5, "Actual Loops": 4}]},
+		"Planning Time": 0.25, "Execution Time": 10.125}]`
+	expected := "Planning time: 0.250 ms, execution time: 10.125 ms\n" +
+		"Top node: Aggregate, cost: 125.50, rows: 1 (estimated 1)\n" +
+		"Buffers: shared hit: 100, read: 20, temp read: 0, written: 0\n" +
+		"Slowest node #1: Seq Scan on gha_events: 7.250 ms exclusive\n" +
+		"Slowest node #2: Index Scan on gha_actors: 2.000 ms exclusive\n" +
+		"Slowest node #3: Aggregate: 0.250 ms exclusive\n"
+	got, err := lib.ExplainSummary([]byte(plan))
+	if err != nil || got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s\nerror: %v", expected, got, err)
+	}
+	for _, data := range []string{"[]", "not json"} {
+		if _, err := lib.ExplainSummary([]byte(data)); err == nil {
+			t.Errorf("'%s': expected error", data)
+		}
+	}
+}
+
+func TestSQLModifiesData(t *testing.T) {
+	var testCases = []struct {
+		sql      string
+		expected bool
+	}{
+		{sql: "select created_at, updated_at, deleted from gha_issues", expected: false},
+		{sql: "select 1 -- delete from gha_events\n/* drop table x; */ where body = 'update ''x'' now' and \"insert\" = 1", expected: false},
+		{sql: "with d as (delete from gha_texts returning 1) select count(*) from d", expected: true},
+		{sql: "select 1;\nINSERT into gha_vars values(1)", expected: true},
+		{sql: "create temp table t as select 1", expected: true},
+		{sql: "Truncate gha_logs", expected: true},
+	}
+	for index, test := range testCases {
+		got := lib.SQLModifiesData(test.sql)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
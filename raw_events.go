@@ -0,0 +1,121 @@
+package devstats
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// GHAEventTables - tables with data of a single GHA event (by `event_id` column, `gha_events` uses `id`)
+// Shared data (actors, repos, orgs, labels) is not included, it is only inserted when missing
+// Last three tables are filled from other event tables by postprocess scripts, see `RebuildEventsData`
+var GHAEventTables = []string{
+	"gha_payloads",
+	"gha_commits",
+	"gha_pages",
+	"gha_comments",
+	"gha_issues",
+	"gha_issues_assignees",
+	"gha_issues_labels",
+	"gha_milestones",
+	"gha_forkees",
+	"gha_branches",
+	"gha_releases",
+	"gha_releases_assets",
+	"gha_assets",
+	"gha_pull_requests",
+	"gha_pull_requests_assignees",
+	"gha_pull_requests_requested_reviewers",
+	"gha_teams",
+	"gha_teams_repositories",
+	"gha_texts",
+	"gha_issues_events_labels",
+	"gha_events_commits_files",
+}
+
+// RawEventJSON - returns event JSON that can be stored in a jsonb column
+// Postgres jsonb cannot store "\u0000" escapes, so they're removed (escaped backslashes are kept)
+func RawEventJSON(jsonStr []byte) string {
+	if !bytes.Contains(jsonStr, []byte(`\u0000`)) {
+		return string(jsonStr)
+	}
+	var sb strings.Builder
+	n := len(jsonStr)
+	for i := 0; i < n; i++ {
+		c := jsonStr[i]
+		if c != '\\' || i+1 >= n {
+			sb.WriteByte(c)
+			continue
+		}
+		if i+5 < n && string(jsonStr[i+1:i+6]) == "u0000" {
+			i += 5
+			continue
+		}
+		sb.WriteByte(c)
+		sb.WriteByte(jsonStr[i+1])
+		i++
+	}
+	return sb.String()
+}
+
+// eventIDsIn - returns SQL "(id1,id2,...)" list of given event IDs
+func eventIDsIn(eventIDs []int64) string {
+	ids := make([]string, len(eventIDs))
+	for i, id := range eventIDs {
+		ids[i] = fmt.Sprintf("%d", id)
+	}
+	return "(" + strings.Join(ids, ",") + ")"
+}
+
+// DeleteEventsData - deletes all data of given GHA events (see GHAEventTables) using a given transaction
+// Use the same transaction to write events again and then call `RebuildEventsData`
+func DeleteEventsData(tc *sql.Tx, ctx *Ctx, eventIDs []int64) {
+	if len(eventIDs) == 0 {
+		return
+	}
+	in := eventIDsIn(eventIDs)
+	for _, table := range GHAEventTables {
+		ExecSQLTxWithErr(tc, ctx, "delete from "+table+" where event_id in "+in)
+	}
+	ExecSQLTxWithErr(tc, ctx, "delete from gha_events where id in "+in)
+}
+
+// RebuildEventsData - refills `gha_texts` and `gha_issues_events_labels` of given (re-written) GHA events
+// Postprocess scripts only add rows of events newer than already processed ones, so they would skip them
+// `gha_events_commits_files` is refilled by its postprocess script, it adds all missing rows
+func RebuildEventsData(tc *sql.Tx, ctx *Ctx, eventIDs []int64) {
+	if len(eventIDs) == 0 {
+		return
+	}
+	in := eventIDsIn(eventIDs)
+	texts := []string{
+		"select event_id, body, created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_comments where body != '' and event_id in " + in,
+		"select event_id, message, dup_created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_commits where message != '' and event_id in " + in,
+		"select event_id, title, created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_issues where title != '' and event_id in " + in,
+		"select event_id, body, created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_issues where body != '' and event_id in " + in,
+		"select event_id, title, created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_pull_requests where title != '' and event_id in " + in,
+		"select event_id, body, created_at, dup_repo_id, dup_repo_name, dup_actor_id, dup_actor_login, dup_type " +
+			"from gha_pull_requests where body != '' and event_id in " + in,
+	}
+	ExecSQLTxWithErr(
+		tc,
+		ctx,
+		"insert into gha_texts(event_id, body, created_at, repo_id, repo_name, actor_id, actor_login, type) "+
+			strings.Join(texts, " union "),
+	)
+	ExecSQLTxWithErr(
+		tc,
+		ctx,
+		"insert into gha_issues_events_labels(issue_id, event_id, label_id, label_name, created_at, "+
+			"repo_id, repo_name, actor_id, actor_login, type, issue_number) "+
+			"select il.issue_id, il.event_id, lb.id, lb.name, il.dup_created_at, il.dup_repo_id, il.dup_repo_name, "+
+			"il.dup_actor_id, il.dup_actor_login, il.dup_type, il.dup_issue_number "+
+			"from gha_issues_labels il, gha_labels lb where il.label_id = lb.id and il.event_id in "+in,
+	)
+}
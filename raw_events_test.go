@@ -0,0 +1,26 @@
+package devstats
+
+import (
+	"testing"
+
+	lib "devstats"
+)
+
+func TestRawEventJSON(t *testing.T) {
+	var testCases = []struct {
+		json     string
+		expected string
+	}{
+		{json: `{"a":"b"}`, expected: `{"a":"b"}`},
+		{json: `{"a":"x\u0000y"}`, expected: `{"a":"xy"}`},
+		{json: `{"a":"\u0000\u0000","b":"\u0001"}`, expected: `{"a":"","b":"\u0001"}`},
+		{json: `{"a":"\\u0000"}`, expected: `{"a":"\\u0000"}`},
+		{json: `{"a":"\\\u0000\"\u0000"}`, expected: `{"a":"\\\""}`},
+	}
+	for index, test := range testCases {
+		got := lib.RawEventJSON([]byte(test.json))
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
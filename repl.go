@@ -0,0 +1,410 @@
+package devstats
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReplDefaultScratch - default schema that `write` command writes time series points to
+const ReplDefaultScratch = "scratch"
+
+// replSchemaRe - allowed scratch schema names
+var replSchemaRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// replPeriodRe - periods supported by time series metrics: h, d, w, m, q, y with optional aggregation (d7, m3)
+var replPeriodRe = regexp.MustCompile(`^[hdwmqy][0-9]*$`)
+
+// replHelp - `help` command output
+const replHelp = `Commands:
+  metrics                      - list metrics from project's metrics.yaml
+  metric name|sql              - choose metric from metrics.yaml by name or SQL file name
+  sql file.sql [series_func]   - use SQL file directly, series_func is series name or function (multi_row_single_column, ...)
+  period h|d|w|m|q|y[N]        - set period (with optional aggregation, like d7)
+  from YYYY-MM-DD [HH:MI:SS]   - set start date
+  to YYYY-MM-DD [HH:MI:SS]     - set end date
+  set name value               - set SQL template parameter, unset name - remove it
+  show                         - display current session settings
+  render                       - display SQL rendered for the last interval
+  run                          - execute SQL for all intervals and display results
+  points                       - display time series points that calc_metric would write
+  write [schema]               - write time series points to a scratch schema (default: scratch)
+  quit                         - end session
+`
+
+// Repl - interactive metric development session bound to a project database
+// It renders metric SQL templates for chosen periods, runs them and previews (or writes to a scratch schema)
+// time series points exactly as `calc_metric` computes them
+type Repl struct {
+	Ctx      *Ctx
+	Out      io.Writer
+	Metrics  []Metric     // Project's metrics (metrics.yaml)
+	Projects *AllProjects // Used to resolve cross-project metrics sources, can be nil
+	Metric   *Metric      // Current metric
+	SQLFile  string       // Current metric's SQL file
+	Period   string
+	From     time.Time
+	To       time.Time
+	Params   map[string]string // Session SQL template parameters, override metric params
+	Scratch  string            // Schema used by `write`
+	con      *sql.DB
+}
+
+// NewRepl - returns new session with the last 7 days daily period
+func NewRepl(ctx *Ctx, out io.Writer) *Repl {
+	to := HourStart(time.Now())
+	return &Repl{
+		Ctx:     ctx,
+		Out:     out,
+		Period:  "d",
+		From:    DayStart(to).AddDate(0, 0, -7),
+		To:      to,
+		Params:  make(map[string]string),
+		Scratch: ReplDefaultScratch,
+	}
+}
+
+// Run - reads commands from in until EOF or `quit`
+func (r *Repl) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(r.Out, "%s> ", r.Ctx.Project)
+		if !scanner.Scan() {
+			fmt.Fprintf(r.Out, "\n")
+			return scanner.Err()
+		}
+		quit, err := r.Execute(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(r.Out, "Error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// Close - closes database connection
+func (r *Repl) Close() (err error) {
+	if r.con != nil {
+		err = r.con.Close()
+		r.con = nil
+	}
+	return
+}
+
+// conn - returns project database connection, connects on first use
+func (r *Repl) conn() *sql.DB {
+	if r.con == nil {
+		r.con = PgConn(r.Ctx)
+	}
+	return r.con
+}
+
+// Execute - executes a single command, returns true when session should end
+func (r *Repl) Execute(line string) (bool, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return false, nil
+	}
+	cmd := fields[0]
+	args := fields[1:]
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), cmd))
+	switch cmd {
+	case "quit", "exit", `\q`:
+		return true, nil
+	case "help", "?":
+		fmt.Fprint(r.Out, replHelp)
+	case "metrics":
+		r.listMetrics()
+	case "metric":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: metric name|sql")
+		}
+		return false, r.setMetric(args[0])
+	case "sql":
+		if len(args) < 1 || len(args) > 2 {
+			return false, fmt.Errorf("usage: sql file.sql [series_name_or_func]")
+		}
+		r.setSQL(args...)
+	case "period":
+		if len(args) != 1 || !replPeriodRe.MatchString(args[0]) {
+			return false, fmt.Errorf("usage: period h|d|w|m|q|y[N]")
+		}
+		r.Period = args[0]
+	case "from", "to":
+		dt, err := ParseTimeAny(rest)
+		if err != nil {
+			return false, err
+		}
+		if cmd == "from" {
+			r.From = dt
+		} else {
+			r.To = dt
+		}
+	case "set":
+		if len(args) < 2 {
+			return false, fmt.Errorf("usage: set name value")
+		}
+		r.Params[args[0]] = strings.TrimSpace(strings.TrimPrefix(rest, args[0]))
+	case "unset":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: unset name")
+		}
+		delete(r.Params, args[0])
+	case "show":
+		r.show()
+	case "render":
+		intervals := MetricIntervals(r.Period, false, r.From, r.To)
+		if len(intervals) == 0 {
+			return false, fmt.Errorf("no intervals in %v - %v", r.From, r.To)
+		}
+		sqlQuery, err := r.render(intervals[len(intervals)-1])
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintf(r.Out, "%s\n", sqlQuery)
+	case "run":
+		return false, r.run()
+	case "points":
+		pts, err := r.points()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprint(r.Out, pts.Str())
+		fmt.Fprintf(r.Out, "Points: %d\n", len(pts))
+	case "write":
+		if len(args) > 1 {
+			return false, fmt.Errorf("usage: write [schema]")
+		}
+		schema := r.Scratch
+		if len(args) == 1 {
+			schema = args[0]
+		}
+		return false, r.write(schema)
+	default:
+		return false, fmt.Errorf("unknown command '%s', use 'help'", cmd)
+	}
+	return false, nil
+}
+
+// listMetrics - displays project's metrics
+func (r *Repl) listMetrics() {
+	for _, metric := range r.Metrics {
+		kind := "series"
+		if metric.Histogram {
+			kind = "histogram"
+		}
+		fmt.Fprintf(
+			r.Out, "%s: sql: %s, %s: %s, periods: %s\n",
+			metric.Name, metric.MetricSQL, kind, metric.SeriesNameOrFunc, metric.Periods,
+		)
+	}
+	fmt.Fprintf(r.Out, "Metrics: %d\n", len(r.Metrics))
+}
+
+// setMetric - chooses metric from metrics.yaml by name or SQL file name
+func (r *Repl) setMetric(name string) error {
+	for i, metric := range r.Metrics {
+		if metric.Name != name && metric.MetricSQL != name {
+			continue
+		}
+		r.Metric = &r.Metrics[i]
+		metricsDir := DataDir + "metrics"
+		if r.Ctx.Local {
+			metricsDir = "./metrics"
+		}
+		if r.Ctx.Project != "" {
+			metricsDir += "/" + r.Ctx.Project
+		}
+		r.SQLFile = ResolveFile(r.Ctx, fmt.Sprintf("%s/%s.sql", metricsDir, metric.MetricSQL))
+		if periods := strings.Split(metric.Periods, ","); periods[0] != "" && replPeriodRe.MatchString(periods[0]) {
+			r.Period = periods[0]
+		}
+		return nil
+	}
+	return fmt.Errorf("metric '%s' not found, use 'metrics' to list them", name)
+}
+
+// setSQL - uses SQL file directly, series name (or function) defaults to SQL file name
+func (r *Repl) setSQL(args ...string) {
+	r.SQLFile = args[0]
+	series := strings.TrimSuffix(filepath.Base(args[0]), ".sql")
+	if len(args) > 1 {
+		series = args[1]
+	}
+	r.Metric = &Metric{Name: series, MetricSQL: args[0], SeriesNameOrFunc: series}
+}
+
+// show - displays session settings
+func (r *Repl) show() {
+	fmt.Fprintf(r.Out, "Project: %s, database: %s, scratch schema: %s\n", r.Ctx.Project, r.Ctx.PgDB, r.Scratch)
+	if r.Metric != nil {
+		fmt.Fprintf(
+			r.Out, "Metric: %s, SQL: %s, series: %s, multivalue: %v, escape_value_name: %v, desc: '%s'\n",
+			r.Metric.Name, r.SQLFile, r.seriesNameOrFunc(), r.Metric.MultiValue, r.Metric.EscapeValueName, r.Metric.Desc,
+		)
+		if r.Metric.Sources != "" {
+			fmt.Fprintf(r.Out, "Sources: %s, combine: '%s'\n", r.Metric.Sources, r.Metric.Combine)
+		}
+	}
+	fmt.Fprintf(r.Out, "Period: %s, from: %s, to: %s\n", r.Period, ToYMDHMSDate(r.From), ToYMDHMSDate(r.To))
+	names := []string{}
+	for name := range r.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(r.Out, "{{%s}}: %s\n", name, r.Params[name])
+	}
+}
+
+// seriesNameOrFunc - series name (with period suffix when metric uses `add_period_to_name`) or series function
+func (r *Repl) seriesNameOrFunc() string {
+	if r.Metric.AddPeriodToName {
+		return r.Metric.SeriesNameOrFunc + "_" + r.Period
+	}
+	return r.Metric.SeriesNameOrFunc
+}
+
+// render - renders current metric's SQL for a given interval (the same parameters as `calc_metric` uses)
+func (r *Repl) render(interval MetricInterval) (string, error) {
+	if r.Metric == nil {
+		return "", fmt.Errorf("no metric chosen, use 'metric' or 'sql'")
+	}
+	bytes, err := ReadFile(r.Ctx, r.SQLFile)
+	if err != nil {
+		return "", err
+	}
+	_, nIntervals, _, _, _ := GetIntervalFunctions(r.Period, false)
+	tmpl := NewSQLTemplate(r.Ctx).SetStrings(r.Metric.Params).SetStrings(r.Params)
+	tmpl.Params["period_abbr"] = r.Period
+	tmpl.Params["n"] = fmt.Sprintf("%d.0", nIntervals)
+	tmpl.Params["from"] = interval.From
+	tmpl.Params["to"] = interval.To
+	return tmpl.Render(string(bytes))
+}
+
+// query - executes SQL on project database, or on cross-project metric sources and combines results
+func (r *Repl) query(sqlQuery string) (MetricRows, error) {
+	dbs := []string{}
+	if r.Metric.Sources != "" {
+		if r.Projects == nil {
+			return MetricRows{}, fmt.Errorf("cross-project metric needs projects definition")
+		}
+		var err error
+		dbs, err = MetricSourcesDBs(r.Ctx, r.Projects, r.Metric.Sources)
+		if err != nil {
+			return MetricRows{}, err
+		}
+	}
+	if len(dbs) == 0 {
+		rows, err := QuerySQL(r.conn(), r.Ctx, sqlQuery)
+		if err != nil {
+			return MetricRows{}, err
+		}
+		return ScanMetricRows(rows)
+	}
+	results := []MetricRows{}
+	for _, db := range dbs {
+		con := PgConnDB(r.Ctx, db)
+		rows, err := QuerySQL(con, r.Ctx, sqlQuery)
+		if err == nil {
+			var res MetricRows
+			res, err = ScanMetricRows(rows)
+			results = append(results, res)
+		}
+		if e := con.Close(); err == nil {
+			err = e
+		}
+		if err != nil {
+			return MetricRows{}, fmt.Errorf("%s: %v", db, err)
+		}
+	}
+	return CombineMetricRows(r.Metric.Combine, results)
+}
+
+// forEachInterval - renders and executes SQL for all intervals
+func (r *Repl) forEachInterval(f func(interval MetricInterval, rows MetricRows) error) error {
+	if r.Metric == nil {
+		return fmt.Errorf("no metric chosen, use 'metric' or 'sql'")
+	}
+	intervals := MetricIntervals(r.Period, false, r.From, r.To)
+	if len(intervals) == 0 {
+		return fmt.Errorf("no intervals in %v - %v", r.From, r.To)
+	}
+	for _, interval := range intervals {
+		sqlQuery, err := r.render(interval)
+		if err != nil {
+			return err
+		}
+		rows, err := r.query(sqlQuery)
+		if err != nil {
+			return fmt.Errorf("%s - %s: %v", ToYMDHMSDate(interval.From), ToYMDHMSDate(interval.To), err)
+		}
+		if err = f(interval, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run - displays SQL results for all intervals
+func (r *Repl) run() error {
+	return r.forEachInterval(func(interval MetricInterval, rows MetricRows) error {
+		fmt.Fprintf(r.Out, "%s - %s: %d rows\n", ToYMDHMSDate(interval.From), ToYMDHMSDate(interval.To), len(rows.Rows))
+		if len(rows.Rows) == 0 {
+			return nil
+		}
+		output, err := FormatRows(FormatTable, rows)
+		fmt.Fprint(r.Out, output)
+		return err
+	})
+}
+
+// points - returns time series points for all intervals, histogram metrics are not supported
+func (r *Repl) points() (pts TSPoints, err error) {
+	if r.Metric != nil && r.Metric.Histogram {
+		return nil, fmt.Errorf("histogram metrics are not supported, use 'run' to see their results")
+	}
+	err = r.forEachInterval(func(interval MetricInterval, rows MetricRows) error {
+		intervalPts, err := MetricPoints(
+			r.Ctx, rows, r.seriesNameOrFunc(), r.Period, r.Metric.Desc,
+			r.Metric.MultiValue, r.Metric.EscapeValueName, r.Metric.TypedValues, interval.Dt,
+		)
+		pts = append(pts, intervalPts...)
+		return err
+	})
+	return
+}
+
+// write - writes time series points to a scratch schema (created if needed), live series are never modified
+func (r *Repl) write(schema string) (err error) {
+	if schema == "public" || !replSchemaRe.MatchString(schema) {
+		return fmt.Errorf("invalid scratch schema name '%s'", schema)
+	}
+	r.Scratch = schema
+	pts, err := r.points()
+	if err != nil {
+		return err
+	}
+	if _, err = ExecSQL(r.conn(), r.Ctx, "create schema if not exists "+r.Scratch); err != nil {
+		return err
+	}
+	con := PgConnDBSchema(r.Ctx, r.Ctx.PgDB, r.Scratch)
+	defer func() {
+		if e := con.Close(); err == nil {
+			err = e
+		}
+	}()
+	if err = WriteTSPointsErr(r.Ctx, con, &pts, r.Metric.MergeSeries, nil); err != nil {
+		return err
+	}
+	fmt.Fprintf(r.Out, "Written %d points to '%s' schema\n", len(pts), r.Scratch)
+	return nil
+}
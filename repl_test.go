@@ -0,0 +1,130 @@
+package devstats
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestReplExecute(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	sqlFile := filepath.Join(dir, "metric.sql")
+	sql := "select count(*) from gha_events where created_at >= '{{from}}' and created_at < '{{to}}' and {{cond}} and {{n}} > 0"
+	if err := ioutil.WriteFile(sqlFile, []byte(sql), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := lib.Ctx{Project: "kubernetes", PgDB: "gha"}
+	var testCases = []struct {
+		commands []string
+		expected []string
+		err      string
+		quit     bool
+	}{
+		{commands: []string{"help"}, expected: []string{"metric name|sql", "write [schema]"}},
+		{commands: []string{"# comment", ""}},
+		{
+			commands: []string{"metric prs_age", "show"},
+			expected: []string{"Metric: PRs age, SQL: ", "/prs_age.sql, series: multi_row_multi_column", "Period: w,"},
+		},
+		{
+			commands: []string{"metrics"},
+			expected: []string{"PRs age: sql: prs_age, series: multi_row_multi_column, periods: w,m", "Metrics: 2"},
+		},
+		{
+			commands: []string{"sql " + sqlFile, "period d7", "from 2018-01-01", "to 2018-01-03 10:00", "set cond 1 = 1", "show"},
+			expected: []string{"series: metric,", "Period: d7, from: 2018-01-01 00:00:00, to: 2018-01-03 10:00:00", "{{cond}}: 1 = 1"},
+		},
+		{
+			commands: []string{"sql " + sqlFile, "period d7", "from 2018-01-01", "to 2018-01-03", "set cond 1 = 1", "render"},
+			expected: []string{"created_at >= '2017-12-28 00:00:00' and created_at < '2018-01-04 00:00:00' and 1 = 1 and 7.0 > 0"},
+		},
+		{commands: []string{"sql " + sqlFile, "render"}, err: "cond"},
+		{commands: []string{"metric unknown"}, err: "metric 'unknown' not found"},
+		{commands: []string{"render"}, err: "no metric chosen"},
+		{commands: []string{"points"}, err: "no metric chosen"},
+		{commands: []string{"period x"}, err: "usage: period"},
+		{commands: []string{"from yesterday"}, err: "cannot parse date"},
+		{commands: []string{"set name"}, err: "usage: set"},
+		{commands: []string{"write public"}, err: "invalid scratch schema name"},
+		{commands: []string{"write Bad-Name"}, err: "invalid scratch schema name"},
+		{commands: []string{"metric hist", "points"}, err: "histogram metrics are not supported"},
+		{commands: []string{"select 1"}, err: "unknown command 'select'"},
+		{commands: []string{"quit"}, quit: true},
+	}
+	for index, test := range testCases {
+		var out bytes.Buffer
+		r := lib.NewRepl(&ctx, &out)
+		r.Metrics = []lib.Metric{
+			{Name: "PRs age", MetricSQL: "prs_age", SeriesNameOrFunc: "multi_row_multi_column", Periods: "w,m"},
+			{Name: "Hist", MetricSQL: "hist", SeriesNameOrFunc: "multi_row_single_column", Histogram: true},
+		}
+		var (
+			quit bool
+			err  error
+		)
+		for _, command := range test.commands {
+			if quit, err = r.Execute(command); err != nil {
+				break
+			}
+		}
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+			}
+			continue
+		}
+		if err != nil || quit != test.quit {
+			t.Errorf("test number %d, unexpected result: quit=%v, error=%v", index+1, quit, err)
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(out.String(), expected) {
+				t.Errorf("test number %d, expected output to contain '%s', got:\n%s", index+1, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestReplRun(t *testing.T) {
+	var out bytes.Buffer
+	ctx := lib.Ctx{Project: "kubernetes"}
+	r := lib.NewRepl(&ctx, &out)
+	if err := r.Run(strings.NewReader("period x\nperiod m\nquit\nperiod y\n")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if r.Period != "m" {
+		t.Errorf("expected period 'm' (commands after quit are not executed), got '%s'", r.Period)
+	}
+	expected := "kubernetes> Error: usage: period h|d|w|m|q|y[N]\nkubernetes> kubernetes> "
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestWriteTSPointsErr(t *testing.T) {
+	ctx := lib.Ctx{}
+	var pts lib.TSPoints
+	dt := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	long := strings.Repeat("x", 63)
+	lib.AddTSPoint(&ctx, &pts, lib.NewTSPoint(&ctx, long, "d", nil, map[string]interface{}{"value": 1.0}, dt))
+	// Errors are returned before connecting to the database
+	err := lib.WriteTSPointsErr(&ctx, nil, &pts, "", nil)
+	if err == nil || !strings.Contains(err.Error(), "name too long") {
+		t.Errorf("expected name too long error, got %v", err)
+	}
+	if err = lib.WriteTSPointsErr(&ctx, nil, &lib.TSPoints{}, "", nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = lib.NewRepl(&ctx, nil).Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
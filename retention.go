@@ -0,0 +1,424 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionRule - how long metric's points of a given period are kept (metrics.yaml `retention`)
+// Keep is "N unit", unit is hour, day, week, month or year (singular or plural), like "90 days" or "3 years"
+// RollUp - optional coarser period (d, w, m, q or y) that expired points are aggregated into before they are deleted,
+// rolled up points never overwrite points that metric computes for that period
+// RollUpFunc - how numeric values are aggregated: sum (default), avg, max or min,
+// text values use max, boolean values are or-ed and jsonb values use the latest one
+type RetentionRule struct {
+	Period     string `yaml:"period"`
+	Keep       string `yaml:"keep"`
+	RollUp     string `yaml:"rollup,omitempty"`
+	RollUpFunc string `yaml:"rollup_func,omitempty"`
+}
+
+// Periods that can be rolled up, from the finest to the coarsest
+var rollUpPeriods = []string{"h", "d", "w", "m", "q", "y"}
+
+// String - rule description, like "h: 90 days -> d (sum)"
+func (r RetentionRule) String() string {
+	if r.RollUp == "" {
+		return r.Period + ": " + r.Keep
+	}
+	fn := r.RollUpFunc
+	if fn == "" {
+		fn = "sum"
+	}
+	return fmt.Sprintf("%s: %s -> %s (%s)", r.Period, r.Keep, r.RollUp, fn)
+}
+
+// ParseRetentionKeep - parses "N unit" retention, returns N and unit in singular form
+func ParseRetentionKeep(keep string) (int, string, error) {
+	ary := strings.Fields(keep)
+	if len(ary) != 2 {
+		return 0, "", fmt.Errorf("retention '%s' must be in 'N unit' format, like '90 days'", keep)
+	}
+	n, err := strconv.Atoi(ary[0])
+	if err != nil || n < 1 {
+		return 0, "", fmt.Errorf("retention '%s': '%s' is not a positive number", keep, ary[0])
+	}
+	unit := strings.TrimSuffix(strings.ToLower(ary[1]), "s")
+	switch unit {
+	case "hour", "day", "week", "month", "year":
+		return n, unit, nil
+	default:
+		return 0, "", fmt.Errorf("retention '%s': unknown unit '%s', use hours, days, weeks, months or years", keep, ary[1])
+	}
+}
+
+// RetentionCutoff - returns time before which rule's points are expired
+// With roll up it is rounded down to the roll up period start, so only complete roll up periods are aggregated
+func RetentionCutoff(rule *RetentionRule, now time.Time) (time.Time, error) {
+	n, unit, err := ParseRetentionKeep(rule.Keep)
+	if err != nil {
+		return now, err
+	}
+	dt := now
+	switch unit {
+	case "hour":
+		dt = dt.Add(-time.Duration(n) * time.Hour)
+	case "day":
+		dt = dt.AddDate(0, 0, -n)
+	case "week":
+		dt = dt.AddDate(0, 0, -7*n)
+	case "month":
+		dt = dt.AddDate(0, -n, 0)
+	case "year":
+		dt = dt.AddDate(-n, 0, 0)
+	}
+	if rule.RollUp != "" {
+		_, _, intervalStart, _, _ := GetIntervalFunctions(rule.RollUp, false)
+		return intervalStart(dt), nil
+	}
+	return HourStart(dt), nil
+}
+
+// RetentionComputeFrom - returns the date metric's points of rule's period should be computed from:
+// points before retention cutoff would be expired by the next retention run, so they are not computed
+func RetentionComputeFrom(rule *RetentionRule, from, now time.Time) (time.Time, error) {
+	cutoff, err := RetentionCutoff(rule, now)
+	if err != nil {
+		return from, err
+	}
+	if from.Before(cutoff) {
+		return cutoff, nil
+	}
+	return from, nil
+}
+
+// MetricRetentionRule - returns metric's retention rule for a given period, nil when points are kept forever
+func MetricRetentionRule(metric *Metric, period string) *RetentionRule {
+	for i := range metric.Retention {
+		if metric.Retention[i].Period == period {
+			return &metric.Retention[i]
+		}
+	}
+	return nil
+}
+
+// MetricPeriods - returns all periods metric is computed for: periods with aggregations (like `d7`), without skipped ones
+// Annotations ranges metrics periods are quick ranges known only at sync time, nil is returned for them
+func MetricPeriods(metric *Metric) (periods []string) {
+	if metric.AnnotationsRanges || metric.Periods == "" {
+		return nil
+	}
+	aggregate := metric.Aggregate
+	if aggregate == "" {
+		aggregate = "1"
+	}
+	skipMap := make(map[string]struct{})
+	for _, skip := range strings.Split(metric.Skip, ",") {
+		skipMap[skip] = struct{}{}
+	}
+	for _, aggr := range strings.Split(aggregate, ",") {
+		aggrSuffix := aggr
+		if aggrSuffix == "1" {
+			aggrSuffix = ""
+		}
+		for _, period := range strings.Split(metric.Periods, ",") {
+			if _, skipped := skipMap[period+aggrSuffix]; skipped {
+				continue
+			}
+			periods = append(periods, period+aggrSuffix)
+		}
+	}
+	return
+}
+
+// MetricTables - returns series tables metric writes to
+// Returns nil for histograms (their points are not time based) and for metrics whose tables
+// depend on metric results (series name functions without `merge_series`)
+func MetricTables(metric *Metric) (tables []string) {
+	if metric.Histogram {
+		return nil
+	}
+	if metric.MergeSeries != "" {
+		return []string{"s" + metric.MergeSeries}
+	}
+	switch metric.SeriesNameOrFunc {
+	case "single_row_multi_column", "multi_row_single_column", "multi_row_multi_column":
+		return nil
+	}
+	if !metric.AddPeriodToName {
+		return []string{"s" + metric.SeriesNameOrFunc}
+	}
+	for _, period := range MetricPeriods(metric) {
+		tables = append(tables, "s"+metric.SeriesNameOrFunc+"_"+period)
+	}
+	return
+}
+
+// Returns metric's series table holding points of a given period
+func metricPeriodTable(metric *Metric, period string) string {
+	if metric.MergeSeries == "" && metric.AddPeriodToName {
+		return "s" + metric.SeriesNameOrFunc + "_" + period
+	}
+	return MetricTables(metric)[0]
+}
+
+// DefaultRetention - returns default retention rules that apply to a metric: rules for periods it computes
+// Metrics with unknown series tables (see MetricTables) get no default retention
+func DefaultRetention(metric *Metric, rules []RetentionRule) (result []RetentionRule) {
+	if len(rules) == 0 || len(MetricTables(metric)) == 0 {
+		return nil
+	}
+	periods := make(map[string]struct{})
+	for _, period := range MetricPeriods(metric) {
+		periods[period] = struct{}{}
+	}
+	for _, rule := range rules {
+		if _, ok := periods[rule.Period]; ok {
+			result = append(result, rule)
+		}
+	}
+	return
+}
+
+// ValidateRetention - checks metric's retention rules
+func ValidateRetention(metric *Metric) error {
+	if len(metric.Retention) == 0 {
+		return nil
+	}
+	if metric.Histogram || metric.AnnotationsRanges {
+		return fmt.Errorf("metric '%s': retention is not supported for histogram and annotations ranges metrics", metric.Name)
+	}
+	if len(MetricTables(metric)) == 0 {
+		return fmt.Errorf("metric '%s': retention needs `merge_series` or a series name, '%s' tables depend on metric results", metric.Name, metric.SeriesNameOrFunc)
+	}
+	periods := make(map[string]struct{})
+	for _, period := range MetricPeriods(metric) {
+		periods[period] = struct{}{}
+	}
+	order := make(map[string]int)
+	for i, period := range rollUpPeriods {
+		order[period] = i
+	}
+	seen := make(map[string]struct{})
+	for _, rule := range metric.Retention {
+		if _, ok := periods[rule.Period]; !ok {
+			return fmt.Errorf("metric '%s': retention period '%s' is not computed, periods: %v", metric.Name, rule.Period, MetricPeriods(metric))
+		}
+		if _, ok := seen[rule.Period]; ok {
+			return fmt.Errorf("metric '%s': multiple retention rules for period '%s'", metric.Name, rule.Period)
+		}
+		seen[rule.Period] = struct{}{}
+		if _, _, err := ParseRetentionKeep(rule.Keep); err != nil {
+			return fmt.Errorf("metric '%s': %v", metric.Name, err)
+		}
+		if rule.RollUp == "" {
+			if rule.RollUpFunc != "" {
+				return fmt.Errorf("metric '%s': period '%s': rollup_func without rollup", metric.Name, rule.Period)
+			}
+			continue
+		}
+		from, ok := order[rule.Period]
+		if !ok {
+			return fmt.Errorf("metric '%s': aggregated period '%s' cannot be rolled up", metric.Name, rule.Period)
+		}
+		to, ok := order[rule.RollUp]
+		if !ok || to <= from {
+			return fmt.Errorf("metric '%s': period '%s' can only be rolled up into a coarser period (%v), got '%s'", metric.Name, rule.Period, rollUpPeriods[from+1:], rule.RollUp)
+		}
+		if rule.Period == "w" {
+			return fmt.Errorf("metric '%s': weeks cannot be rolled up into '%s', they don't align with months", metric.Name, rule.RollUp)
+		}
+		switch rule.RollUpFunc {
+		case "", "sum", "avg", "max", "min":
+		default:
+			return fmt.Errorf("metric '%s': period '%s': unknown rollup_func '%s', use sum, avg, max or min", metric.Name, rule.Period, rule.RollUpFunc)
+		}
+	}
+	return nil
+}
+
+// RetentionRollUpSQL - returns SQL aggregating source table's points of a given period older than cutoff
+// into target table's rollUp period points ($1 - source period, $2 - cutoff), existing target points are kept
+func RetentionRollUpSQL(source, target string, columns []TableColumn, rollUp, fn string) string {
+	if fn == "" {
+		fn = "sum"
+	}
+	interval, _, _, _, _ := GetIntervalFunctions(rollUp, false)
+	bucket := "date_trunc('" + interval + "', time)"
+	names := []string{}
+	values := []string{}
+	group := []string{bucket}
+	for _, column := range columns {
+		name := "\"" + column.Name + "\""
+		names = append(names, name)
+		switch {
+		case column.Name == "time":
+			values = append(values, bucket)
+		case column.Name == "period":
+			values = append(values, "'"+rollUp+"'")
+		case column.Name == "series":
+			values = append(values, name)
+			group = append(group, name)
+		default:
+			switch TSTypeOfColumn(column.Type) {
+			case TSInt, TSFloat:
+				values = append(values, fn+"("+name+")")
+			case TSBool:
+				values = append(values, "bool_or("+name+")")
+			case TSJSON:
+				values = append(values, "(array_agg("+name+" order by time desc))[1]")
+			default:
+				values = append(values, "max("+name+")")
+			}
+		}
+	}
+	return fmt.Sprintf(
+		"insert into \"%s\"(%s) select %s from \"%s\" where period = %s and time < %s group by %s on conflict do nothing",
+		target,
+		strings.Join(names, ", "),
+		strings.Join(values, ", "),
+		source,
+		NValue(1),
+		NValue(2),
+		strings.Join(group, ", "),
+	)
+}
+
+// RetentionDeleteSQL - returns SQL deleting table's points of a given period older than cutoff ($1 - period, $2 - cutoff)
+func RetentionDeleteSQL(table string) string {
+	return fmt.Sprintf("delete from \"%s\" where period = %s and time < %s", table, NValue(1), NValue(2))
+}
+
+// ApplyRetention - enforces metric's retention rules: expired points are rolled up (if configured) and deleted
+// Each rule is applied to each table in a single transaction
+func ApplyRetention(con *sql.DB, ctx *Ctx, metric *Metric, now time.Time) error {
+	if err := ValidateRetention(metric); err != nil {
+		return err
+	}
+	for i := range metric.Retention {
+		rule := &metric.Retention[i]
+		cutoff, err := RetentionCutoff(rule, now)
+		if err != nil {
+			return err
+		}
+		table := metricPeriodTable(metric, rule.Period)
+		if !TableExists(con, ctx, table) {
+			continue
+		}
+		sqls := []string{}
+		if rule.RollUp != "" {
+			target := metricPeriodTable(metric, rule.RollUp)
+			if !TableExists(con, ctx, target) {
+				// Metric doesn't compute roll up period, its table has the same structure
+				sqls = append(
+					sqls,
+					"create table \""+target+"\"(like \""+table+"\" including all)",
+					"grant select on \""+target+"\" to ro_user",
+					"grant select on \""+target+"\" to devstats_team",
+				)
+			}
+			columns := schemaTableColumns(con, ctx, "public", table)
+			sqls = append(sqls, RetentionRollUpSQL(table, target, columns, rule.RollUp, rule.RollUpFunc))
+		}
+		tc, err := con.Begin()
+		if err != nil {
+			return err
+		}
+		for _, sq := range sqls {
+			if strings.HasPrefix(sq, "insert ") {
+				ExecSQLTxWithErr(tc, ctx, sq, rule.Period, cutoff)
+				continue
+			}
+			ExecSQLTxWithErr(tc, ctx, sq)
+		}
+		res := ExecSQLTxWithErr(tc, ctx, RetentionDeleteSQL(table), rule.Period, cutoff)
+		if err = tc.Commit(); err != nil {
+			return err
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		Printf("Retention: %s: %s: deleted %d points before %s (%s)\n", metric.Name, table, deleted, ToYMDHDate(cutoff), rule.String())
+	}
+	return nil
+}
+
+// SeriesTableSize - series table size (from Postgres catalog)
+type SeriesTableSize struct {
+	Table string
+	Size  string // human readable size (including indices)
+	Bytes int64
+	Rows  int64 // estimated number of rows
+}
+
+// SeriesTablesReport - returns series tables sizes report with metrics writing each table and their retention rules
+// Tables are reported in given order, followed by a total row
+func SeriesTablesReport(sizes []SeriesTableSize, metrics []Metric) MetricRows {
+	owners := make(map[string][]string)
+	rules := make(map[string][]string)
+	for i := range metrics {
+		metric := &metrics[i]
+		for _, table := range MetricTables(metric) {
+			owners[table] = append(owners[table], metric.Name)
+		}
+		for _, rule := range metric.Retention {
+			table := metricPeriodTable(metric, rule.Period)
+			rules[table] = append(rules[table], rule.String())
+		}
+	}
+	str := func(s string) *string { return &s }
+	report := MetricRows{Columns: []string{"table", "size", "bytes", "rows", "metrics", "retention"}}
+	var bytes, rows int64
+	for _, size := range sizes {
+		report.Rows = append(
+			report.Rows,
+			[]*string{
+				str(size.Table),
+				str(size.Size),
+				str(strconv.FormatInt(size.Bytes, 10)),
+				str(strconv.FormatInt(size.Rows, 10)),
+				str(strings.Join(owners[size.Table], ", ")),
+				str(strings.Join(rules[size.Table], ", ")),
+			},
+		)
+		bytes += size.Bytes
+		rows += size.Rows
+	}
+	report.Rows = append(
+		report.Rows,
+		[]*string{
+			str("total"),
+			str(fmt.Sprintf("%d tables", len(sizes))),
+			str(strconv.FormatInt(bytes, 10)),
+			str(strconv.FormatInt(rows, 10)),
+			nil,
+			nil,
+		},
+	)
+	return report
+}
+
+// SeriesTablesSizes - returns all series tables sizes, largest first
+func SeriesTablesSizes(con *sql.DB, ctx *Ctx) (sizes []SeriesTableSize) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		"select c.relname, pg_size_pretty(pg_total_relation_size(c.oid)), "+
+			"pg_total_relation_size(c.oid), greatest(c.reltuples, 0)::bigint "+
+			"from pg_class c join pg_namespace n on n.oid = c.relnamespace "+
+			"where n.nspname = 'public' and c.relkind = 'r' and c.relname like 's%' "+
+			"order by 3 desc, 1",
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var size SeriesTableSize
+		FatalOnError(rows.Scan(&size.Table, &size.Size, &size.Bytes, &size.Rows))
+		sizes = append(sizes, size)
+	}
+	FatalOnError(rows.Err())
+	return
+}
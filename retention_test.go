@@ -0,0 +1,302 @@
+package devstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestRetentionCutoff(t *testing.T) {
+	now := time.Date(2018, 5, 16, 13, 45, 0, 0, time.UTC)
+	var testCases = []struct {
+		rule     lib.RetentionRule
+		expected time.Time
+		err      string
+	}{
+		{rule: lib.RetentionRule{Period: "h", Keep: "90 days"}, expected: time.Date(2018, 2, 15, 13, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "h", Keep: "48 hours"}, expected: time.Date(2018, 5, 14, 13, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "d", Keep: "3 years"}, expected: time.Date(2015, 5, 16, 13, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "d", Keep: "1 Week"}, expected: time.Date(2018, 5, 9, 13, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "h", Keep: "90 days", RollUp: "d"}, expected: time.Date(2018, 2, 15, 0, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "d", Keep: "2 months", RollUp: "m"}, expected: time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{rule: lib.RetentionRule{Period: "h", Keep: "90"}, err: "'N unit' format"},
+		{rule: lib.RetentionRule{Period: "h", Keep: "-1 days"}, err: "not a positive number"},
+		{rule: lib.RetentionRule{Period: "h", Keep: "3 decades"}, err: "unknown unit 'decades'"},
+	}
+	for _, test := range testCases {
+		got, err := lib.RetentionCutoff(&test.rule, now)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error '%s', got %v", test.rule.String(), test.err, err)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(test.expected) {
+			t.Errorf("%s: expected %v, got %v, %v", test.rule.String(), test.expected, got, err)
+		}
+	}
+}
+
+func TestRetentionComputeFrom(t *testing.T) {
+	now := time.Date(2018, 5, 16, 13, 45, 0, 0, time.UTC)
+	metric := lib.Metric{
+		Periods:   "h,d",
+		Retention: []lib.RetentionRule{{Period: "h", Keep: "90 days"}, {Period: "d", Keep: "1 year", RollUp: "m"}},
+	}
+	var testCases = []struct {
+		period   string
+		from     time.Time
+		expected time.Time
+	}{
+		{period: "h", from: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), expected: time.Date(2018, 2, 15, 13, 0, 0, 0, time.UTC)},
+		{period: "h", from: time.Date(2018, 5, 16, 12, 0, 0, 0, time.UTC), expected: time.Date(2018, 5, 16, 12, 0, 0, 0, time.UTC)},
+		{period: "d", from: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC), expected: time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range testCases {
+		rule := lib.MetricRetentionRule(&metric, test.period)
+		if rule == nil {
+			t.Errorf("%s: expected retention rule", test.period)
+			continue
+		}
+		got, err := lib.RetentionComputeFrom(rule, test.from, now)
+		if err != nil || !got.Equal(test.expected) {
+			t.Errorf("%s: expected %v, got %v, %v", rule.String(), test.expected, got, err)
+		}
+	}
+	if rule := lib.MetricRetentionRule(&metric, "w"); rule != nil {
+		t.Errorf("expected no retention rule for 'w', got %s", rule.String())
+	}
+}
+
+func TestMetricTables(t *testing.T) {
+	var testCases = []struct {
+		metric   lib.Metric
+		periods  []string
+		expected []string
+	}{
+		{
+			metric:   lib.Metric{SeriesNameOrFunc: "multi_row_single_column", Periods: "h,d,w", Aggregate: "1,7", Skip: "h7,w7", MergeSeries: "gh_stats_r"},
+			periods:  []string{"h", "d", "w", "d7"},
+			expected: []string{"sgh_stats_r"},
+		},
+		{
+			metric:   lib.Metric{SeriesNameOrFunc: "events", Periods: "h,d", AddPeriodToName: true},
+			periods:  []string{"h", "d"},
+			expected: []string{"sevents_h", "sevents_d"},
+		},
+		{
+			metric:   lib.Metric{SeriesNameOrFunc: "events", Periods: "d"},
+			periods:  []string{"d"},
+			expected: []string{"sevents"},
+		},
+		{
+			metric:  lib.Metric{SeriesNameOrFunc: "multi_row_multi_column", Periods: "d"},
+			periods: []string{"d"},
+		},
+		{
+			metric:  lib.Metric{SeriesNameOrFunc: "hist_commenters", Periods: "d", Histogram: true},
+			periods: []string{"d"},
+		},
+		{
+			metric: lib.Metric{SeriesNameOrFunc: "events", AnnotationsRanges: true, AddPeriodToName: true},
+		},
+	}
+	for index, test := range testCases {
+		periods := lib.MetricPeriods(&test.metric)
+		tables := lib.MetricTables(&test.metric)
+		if !reflect.DeepEqual(periods, test.periods) || !reflect.DeepEqual(tables, test.expected) {
+			t.Errorf("test number %d, expected %v, %v, got %v, %v", index+1, test.periods, test.expected, periods, tables)
+		}
+	}
+}
+
+func TestValidateRetention(t *testing.T) {
+	metric := lib.Metric{Name: "Stats", SeriesNameOrFunc: "multi_row_single_column", Periods: "h,d,w,m", Aggregate: "1,7", Skip: "h7,w7,m7", MergeSeries: "gh_stats_r"}
+	var testCases = []struct {
+		metric lib.Metric
+		rules  []lib.RetentionRule
+		err    string
+	}{
+		{metric: metric},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "90 days"}, {Period: "d7", Keep: "3 years"}}},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "90 days", RollUp: "m", RollUpFunc: "avg"}}},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "q", Keep: "1 year"}}, err: "period 'q' is not computed"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "1 day"}, {Period: "h", Keep: "2 days"}}, err: "multiple retention rules"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "a day"}}, err: "not a positive number"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "d", Keep: "1 year", RollUp: "h"}}, err: "coarser period ([w m q y]), got 'h'"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "d7", Keep: "1 year", RollUp: "m"}}, err: "aggregated period 'd7' cannot be rolled up"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "w", Keep: "1 year", RollUp: "m"}}, err: "weeks cannot be rolled up"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "1 year", RollUp: "d", RollUpFunc: "median"}}, err: "unknown rollup_func 'median'"},
+		{metric: metric, rules: []lib.RetentionRule{{Period: "h", Keep: "1 year", RollUpFunc: "max"}}, err: "rollup_func without rollup"},
+		{
+			metric: lib.Metric{Name: "PRs", SeriesNameOrFunc: "multi_row_single_column", Periods: "d"},
+			rules:  []lib.RetentionRule{{Period: "d", Keep: "1 year"}},
+			err:    "retention needs `merge_series` or a series name",
+		},
+		{
+			metric: lib.Metric{Name: "Hist", SeriesNameOrFunc: "hist", Periods: "d", Histogram: true},
+			rules:  []lib.RetentionRule{{Period: "d", Keep: "1 year"}},
+			err:    "not supported for histogram",
+		},
+	}
+	for index, test := range testCases {
+		test.metric.Retention = test.rules
+		err := lib.ValidateRetention(&test.metric)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+		}
+	}
+}
+
+func TestRetentionSQLs(t *testing.T) {
+	columns := []lib.TableColumn{
+		{Name: "time", Type: "timestamp without time zone"},
+		{Name: "series", Type: "text"},
+		{Name: "period", Type: "text"},
+		{Name: "All", Type: "double precision"},
+		{Name: "descr", Type: "text"},
+	}
+	expected := `insert into "sgh_stats_r"("time", "series", "period", "All", "descr") ` +
+		`select date_trunc('day', time), "series", 'd', sum("All"), max("descr") from "sgh_stats_r" ` +
+		`where period = $1 and time < $2 group by date_trunc('day', time), "series" on conflict do nothing`
+	if got := lib.RetentionRollUpSQL("sgh_stats_r", "sgh_stats_r", columns, "d", ""); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	expected = `insert into "sevents_q"("time", "period", "value") ` +
+		`select date_trunc('quarter', time), 'q', avg("value") from "sevents_m" ` +
+		`where period = $1 and time < $2 group by date_trunc('quarter', time) on conflict do nothing`
+	got := lib.RetentionRollUpSQL("sevents_m", "sevents_q", []lib.TableColumn{columns[0], columns[2], {Name: "value", Type: "double precision"}}, "q", "avg")
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+	expected = `delete from "sevents_h" where period = $1 and time < $2`
+	if got := lib.RetentionDeleteSQL("sevents_h"); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLoadMetricsRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devstats_retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	files := map[string]string{
+		"shared/metrics.yaml": `---
+retention:
+  - period: h
+    keep: 90 days
+metrics:
+  - name: Stats
+    series_name_or_func: multi_row_single_column
+    sql: stats
+    periods: h,d
+    merge_series: stats
+  - name: Events
+    series_name_or_func: events
+    sql: events
+    periods: d,w
+    add_period_to_name: true
+  - name: PRs
+    series_name_or_func: multi_row_single_column
+    sql: prs
+    periods: h
+`,
+		"proj/metrics.yaml": `---
+extends: ../shared/metrics.yaml
+retention:
+  - period: h
+    keep: 30 days
+  - period: w
+    keep: 5 years
+metrics:
+  - name: Stats
+    retention:
+      - period: h
+        keep: 1 year
+        rollup: m
+`,
+	}
+	for name, content := range files {
+		lib.FatalOnError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		lib.FatalOnError(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	ctx := lib.Ctx{}
+	var testCases = []struct {
+		file     string
+		expected map[string]string
+	}{
+		{
+			file:     "shared/metrics.yaml",
+			expected: map[string]string{"Stats": "h: 90 days", "Events": "", "PRs": ""},
+		},
+		{
+			file:     "proj/metrics.yaml",
+			expected: map[string]string{"Stats": "h: 1 year -> m (sum)", "Events": "w: 5 years", "PRs": ""},
+		},
+	}
+	for _, test := range testCases {
+		allMetrics, err := lib.LoadMetrics(&ctx, filepath.Join(dir, test.file))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.file, err)
+			continue
+		}
+		got := make(map[string]string)
+		for _, metric := range allMetrics.Metrics {
+			rules := []string{}
+			for _, rule := range metric.Retention {
+				rules = append(rules, rule.String())
+			}
+			got[metric.Name] = strings.Join(rules, ", ")
+			if err := lib.ValidateRetention(&metric); err != nil {
+				t.Errorf("%s: unexpected error: %v", test.file, err)
+			}
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.file, test.expected, got)
+		}
+	}
+}
+
+func TestSeriesTablesReport(t *testing.T) {
+	metrics := []lib.Metric{
+		{
+			Name: "Stats", SeriesNameOrFunc: "multi_row_single_column", Periods: "h,d", MergeSeries: "stats",
+			Retention: []lib.RetentionRule{{Period: "h", Keep: "90 days"}, {Period: "d", Keep: "3 years"}},
+		},
+		{
+			Name: "Events", SeriesNameOrFunc: "events", Periods: "h,d", AddPeriodToName: true,
+			Retention: []lib.RetentionRule{{Period: "h", Keep: "30 days", RollUp: "d"}},
+		},
+	}
+	sizes := []lib.SeriesTableSize{
+		{Table: "sstats", Size: "2048 kB", Bytes: 2097152, Rows: 1000},
+		{Table: "sevents_h", Size: "16 kB", Bytes: 16384, Rows: 24},
+		{Table: "sprs_opened", Size: "8192 bytes", Bytes: 8192, Rows: 0},
+	}
+	report := lib.SeriesTablesReport(sizes, metrics)
+	got, err := lib.FormatRows(lib.FormatCSV, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "table,size,bytes,rows,metrics,retention\n" +
+		"sstats,2048 kB,2097152,1000,Stats,\"h: 90 days, d: 3 years\"\n" +
+		"sevents_h,16 kB,16384,24,Events,h: 30 days -> d (sum)\n" +
+		"sprs_opened,8192 bytes,8192,0,,\n" +
+		"total,3 tables,2121728,1024,,\n"
+	if got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
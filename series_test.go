@@ -426,7 +426,18 @@ func TestProcessAnnotations(t *testing.T) {
 	// Execute test cases
 	for index, test := range testCases {
 		// Execute annotations & quick ranges call
-		lib.ProcessAnnotations(&ctx, &test.annotations, test.startDate, test.joinDate)
+		lib.ProcessAnnotations(&ctx, &test.annotations, nil, test.startDate, test.joinDate)
+
+		// Quick ranges are swapped from a shadow schema, it must be dropped
+		nShadows := 0
+		lib.FatalOnError(
+			lib.QueryRowSQL(
+				c, &ctx, "select count(*) from information_schema.schemata where schema_name like "+lib.NValue(1), lib.ShadowSchemaPrefix+"%",
+			).Scan(&nShadows),
+		)
+		if nShadows != 0 {
+			t.Errorf("test number %d: expected no shadow schemas left, got %d", index+1, nShadows)
+		}
 
 		// Check annotations created
 		rows := lib.QuerySQLWithErr(c, &ctx, "select time, description, title from \"sannotations\" order by time asc")
@@ -0,0 +1,279 @@
+package devstats
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ShadowSchemaPrefix - all shadow schemas names start with this prefix
+const ShadowSchemaPrefix = "shadow_"
+
+// ShadowMaxAge - shadow schemas older than this are left by failed (killed) recomputes and can be dropped
+const ShadowMaxAge = 24 * time.Hour
+
+// Shadow schemas created by this process (to make names unique between threads)
+var shadowSeq int64
+
+// Shadow - schema that recomputed series are written into (GHA2DB_SHADOW)
+// Grafana only reads live (public schema) tables, so it never sees partially recomputed data
+// Shadow data is swapped into live tables in a single transaction when metric completes
+// If recompute fails, live data is left intact and the shadow schema is dropped later by DropStaleShadowSchemas
+type Shadow struct {
+	Schema string  // shadow schema name
+	Con    *sql.DB // connection using shadow schema as search_path, write points using it
+}
+
+// TableColumn - table column name and its Postgres data type (from information_schema)
+type TableColumn struct {
+	Name     string
+	Type     string
+	Nullable bool
+}
+
+// ShadowSchemaName - returns shadow schema name for a given creation time, process ID and sequence number
+func ShadowSchemaName(dt time.Time, pid int, seq int64) string {
+	return fmt.Sprintf("%s%d_%d_%d", ShadowSchemaPrefix, dt.Unix(), pid, seq)
+}
+
+// ShadowSchemaTime - returns shadow schema creation time, false if this is not a shadow schema name
+func ShadowSchemaTime(schema string) (time.Time, bool) {
+	if !strings.HasPrefix(schema, ShadowSchemaPrefix) {
+		return time.Time{}, false
+	}
+	ary := strings.Split(schema[len(ShadowSchemaPrefix):], "_")
+	if len(ary) != 3 {
+		return time.Time{}, false
+	}
+	for _, s := range ary[1:] {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return time.Time{}, false
+		}
+	}
+	unix, err := strconv.ParseInt(ary[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0).UTC(), true
+}
+
+// StaleShadowSchemas - returns shadow schemas created more than maxAge before now
+func StaleShadowSchemas(schemas []string, now time.Time, maxAge time.Duration) (stale []string) {
+	for _, schema := range schemas {
+		dt, ok := ShadowSchemaTime(schema)
+		if ok && now.Sub(dt) > maxAge {
+			stale = append(stale, schema)
+		}
+	}
+	return
+}
+
+// Returns column definition used when adding shadow column to a live table
+// Same definitions as columns created by WriteTSPoints
+func shadowColumnDef(column TableColumn) string {
+	if ty := TSTypeOfColumn(column.Type); ty != TSUnknown {
+		return TSColumnDef(ty, column.Nullable)
+	}
+	return column.Type
+}
+
+// ShadowSwapSQLs - returns SQLs replacing live table data with its shadow table data, to be executed in a single transaction
+// live are live table columns by name, nil means that there is no live table yet - shadow table is just moved
+// Live columns are added or evolved (see TSColumnAlterations) to hold shadow columns values
+// cond is a where condition selecting live rows being replaced, "" means that the whole live table is replaced by shadow table
+func ShadowSwapSQLs(schema, table string, live map[string]TableColumn, shadow []TableColumn, cond string) (sqls []string, err error) {
+	move := "alter table \"" + schema + "\".\"" + table + "\" set schema public"
+	if live == nil {
+		return []string{move}, nil
+	}
+	if cond == "" {
+		return []string{"drop table \"public\".\"" + table + "\"", move}, nil
+	}
+	columns := []string{}
+	for _, column := range shadow {
+		liveColumn, ok := live[column.Name]
+		if !ok {
+			sqls = append(sqls, "alter table \"public\".\""+table+"\" add column if not exists \""+column.Name+"\" "+shadowColumnDef(column))
+		} else {
+			clauses, _, err := TSColumnAlterations(
+				column.Name,
+				TSTypeOfColumn(liveColumn.Type),
+				liveColumn.Nullable,
+				TSTypeOfColumn(column.Type),
+				column.Nullable,
+			)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: %v", table, err)
+			}
+			if len(clauses) > 0 {
+				sqls = append(sqls, "alter table \"public\".\""+table+"\" "+strings.Join(clauses, ", "))
+			}
+		}
+		columns = append(columns, "\""+column.Name+"\"")
+	}
+	cols := strings.Join(columns, ", ")
+	sqls = append(sqls, "delete from \"public\".\""+table+"\" where "+cond)
+	sqls = append(sqls, "insert into \"public\".\""+table+"\"("+cols+") select "+cols+" from \""+schema+"\".\""+table+"\"")
+	return sqls, nil
+}
+
+// NewShadow - creates a new, empty shadow schema and connects to it
+func NewShadow(con *sql.DB, ctx *Ctx) *Shadow {
+	schema := ShadowSchemaName(time.Now(), os.Getpid(), atomic.AddInt64(&shadowSeq, 1))
+	ExecSQLWithErr(con, ctx, "create schema \""+schema+"\"")
+	if ctx.Debug > 0 {
+		Printf("Created shadow schema %s\n", schema)
+	}
+	return &Shadow{Schema: schema, Con: PgConnDBSchema(ctx, ctx.PgDB, schema)}
+}
+
+// Close - closes shadow connection and drops shadow schema
+func (s *Shadow) Close(con *sql.DB, ctx *Ctx) {
+	FatalOnError(s.Con.Close())
+	ExecSQLWithErr(con, ctx, "drop schema if exists \""+s.Schema+"\" cascade")
+}
+
+// Returns given schema's tables
+func schemaTables(con *sql.DB, ctx *Ctx, schema string) (tables []string) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf("select table_name from information_schema.tables where table_schema = %s order by table_name", NValue(1)),
+		schema,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	table := ""
+	for rows.Next() {
+		FatalOnError(rows.Scan(&table))
+		tables = append(tables, table)
+	}
+	FatalOnError(rows.Err())
+	return
+}
+
+// Returns given table's columns (in definition order), nil if there is no such table
+func schemaTableColumns(con *sql.DB, ctx *Ctx, schema, table string) (columns []TableColumn) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf(
+			"select column_name, data_type, is_nullable = 'YES' from information_schema.columns "+
+				"where table_schema = %s and table_name = %s order by ordinal_position",
+			NValue(1),
+			NValue(2),
+		),
+		schema,
+		table,
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	for rows.Next() {
+		var column TableColumn
+		FatalOnError(rows.Scan(&column.Name, &column.Type, &column.Nullable))
+		columns = append(columns, column)
+	}
+	FatalOnError(rows.Err())
+	return
+}
+
+// swap - replaces live data with shadow data for all shadow tables and live tables from clearTables, in a single transaction
+// Live rows selected by cond (with args) are replaced, empty cond replaces whole tables
+func (s *Shadow) swap(con *sql.DB, ctx *Ctx, cond string, args []interface{}, clearTables []string) {
+	tables := schemaTables(con, ctx, s.Schema)
+	inShadow := make(map[string]struct{})
+	type tableSQL struct {
+		sql  string
+		args []interface{}
+	}
+	sqls := []tableSQL{}
+	for _, table := range tables {
+		inShadow[table] = struct{}{}
+		var live map[string]TableColumn
+		liveColumns := schemaTableColumns(con, ctx, "public", table)
+		if liveColumns != nil {
+			live = make(map[string]TableColumn)
+			for _, column := range liveColumns {
+				live[column.Name] = column
+			}
+		}
+		tableSQLs, err := ShadowSwapSQLs(s.Schema, table, live, schemaTableColumns(con, ctx, s.Schema, table), cond)
+		FatalOnError(err)
+		for _, sq := range tableSQLs {
+			// Only delete uses cond (and its args)
+			var sqArgs []interface{}
+			if strings.HasPrefix(sq, "delete ") {
+				sqArgs = args
+			}
+			sqls = append(sqls, tableSQL{sql: sq, args: sqArgs})
+		}
+	}
+	// Live tables without any new data
+	sort.Strings(clearTables)
+	for _, table := range clearTables {
+		if _, ok := inShadow[table]; ok || !TableExists(con, ctx, table) {
+			continue
+		}
+		if cond == "" {
+			sqls = append(sqls, tableSQL{sql: "truncate \"public\".\"" + table + "\""})
+			continue
+		}
+		sqls = append(sqls, tableSQL{sql: "delete from \"public\".\"" + table + "\" where " + cond, args: args})
+	}
+	if len(sqls) == 0 {
+		return
+	}
+	if ctx.Debug > 0 {
+		Printf("Swapping %d shadow tables from %s\n", len(tables), s.Schema)
+	}
+	tc, err := con.Begin()
+	FatalOnError(err)
+	for _, sq := range sqls {
+		ExecSQLTxWithErr(tc, ctx, sq.sql, sq.args...)
+	}
+	FatalOnError(tc.Commit())
+}
+
+// SwapSeries - replaces live series data with shadow data in a single transaction
+// Only given period's live rows are replaced, and only in [from, to) range when from and to are given
+// Live tables from clearTables have their period data removed even if recompute produced no data for them
+func (s *Shadow) SwapSeries(con *sql.DB, ctx *Ctx, period string, from, to *time.Time, clearTables ...string) {
+	cond := fmt.Sprintf("period = %s", NValue(1))
+	args := []interface{}{period}
+	if from != nil && to != nil {
+		cond += fmt.Sprintf(" and time >= %s and time < %s", NValue(2), NValue(3))
+		args = append(args, *from, *to)
+	}
+	s.swap(con, ctx, cond, args, clearTables)
+}
+
+// SwapTables - replaces whole live tables with shadow tables in a single transaction (used for tags)
+// Live tables from clearTables are truncated if recompute produced no data for them
+func (s *Shadow) SwapTables(con *sql.DB, ctx *Ctx, clearTables ...string) {
+	s.swap(con, ctx, "", nil, clearTables)
+}
+
+// DropStaleShadowSchemas - drops shadow schemas left by failed recomputes (older than maxAge)
+func DropStaleShadowSchemas(con *sql.DB, ctx *Ctx, maxAge time.Duration) {
+	rows := QuerySQLWithErr(
+		con,
+		ctx,
+		fmt.Sprintf("select schema_name from information_schema.schemata where schema_name like %s", NValue(1)),
+		ShadowSchemaPrefix+"%",
+	)
+	defer func() { FatalOnError(rows.Close()) }()
+	schemas := []string{}
+	schema := ""
+	for rows.Next() {
+		FatalOnError(rows.Scan(&schema))
+		schemas = append(schemas, schema)
+	}
+	FatalOnError(rows.Err())
+	for _, schema := range StaleShadowSchemas(schemas, time.Now(), maxAge) {
+		Printf("Dropping stale shadow schema %s\n", schema)
+		ExecSQLWithErr(con, ctx, "drop schema if exists \""+schema+"\" cascade")
+	}
+}
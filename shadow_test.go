@@ -0,0 +1,156 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestShadowSchemaTime(t *testing.T) {
+	dt := time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC)
+	name := lib.ShadowSchemaName(dt, 1234, 2)
+	if name != "shadow_1520139967_1234_2" {
+		t.Errorf("unexpected shadow schema name: %s", name)
+	}
+	var testCases = []struct {
+		schema   string
+		expected time.Time
+		ok       bool
+	}{
+		{schema: name, expected: dt, ok: true},
+		{schema: "shadow_0_1_1", expected: time.Unix(0, 0).UTC(), ok: true},
+		{schema: "public"},
+		{schema: "shadow_1520139967_1234"},
+		{schema: "shadow_x_1_1"},
+		{schema: "shadow_1520139967_1_a"},
+		{schema: "scratch_1520139967_1_1"},
+	}
+	for _, test := range testCases {
+		got, ok := lib.ShadowSchemaTime(test.schema)
+		if ok != test.ok || !got.Equal(test.expected) {
+			t.Errorf("%s: expected %v, %v, got %v, %v", test.schema, test.expected, test.ok, got, ok)
+		}
+	}
+}
+
+func TestStaleShadowSchemas(t *testing.T) {
+	now := time.Date(2018, 3, 4, 12, 0, 0, 0, time.UTC)
+	schemas := []string{
+		lib.ShadowSchemaName(now.Add(-48*time.Hour), 1, 1),
+		lib.ShadowSchemaName(now.Add(-time.Hour), 1, 2),
+		lib.ShadowSchemaName(now.Add(-25*time.Hour), 7, 1),
+		"shadow_work",
+		"public",
+	}
+	expected := []string{schemas[0], schemas[2]}
+	got := lib.StaleShadowSchemas(schemas, now, lib.ShadowMaxAge)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+	}
+	if got := lib.StaleShadowSchemas(schemas, now, 72*time.Hour); got != nil {
+		t.Errorf("expected no stale schemas, got %+v", got)
+	}
+}
+
+func TestShadowSwapSQLs(t *testing.T) {
+	shadow := []lib.TableColumn{
+		{Name: "time", Type: "timestamp without time zone"},
+		{Name: "period", Type: "text"},
+		{Name: "value", Type: "double precision"},
+		{Name: "descr", Type: "text"},
+	}
+	live := map[string]lib.TableColumn{
+		"time":   {Name: "time", Type: "timestamp without time zone"},
+		"period": {Name: "period", Type: "text"},
+		"value":  {Name: "value", Type: "double precision"},
+		"old":    {Name: "old", Type: "double precision"},
+	}
+	var testCases = []struct {
+		live     map[string]lib.TableColumn
+		shadow   []lib.TableColumn
+		cond     string
+		expected []string
+		err      bool
+	}{
+		{
+			cond:     "period = $1",
+			expected: []string{`alter table "shadow_1_2_3"."sevents" set schema public`},
+		},
+		{
+			live: live,
+			expected: []string{
+				`drop table "public"."sevents"`,
+				`alter table "shadow_1_2_3"."sevents" set schema public`,
+			},
+		},
+		{
+			live: live,
+			cond: "period = $1 and time >= $2 and time < $3",
+			expected: []string{
+				`alter table "public"."sevents" add column if not exists "descr" text not null default ''`,
+				`delete from "public"."sevents" where period = $1 and time >= $2 and time < $3`,
+				`insert into "public"."sevents"("time", "period", "value", "descr") ` +
+					`select "time", "period", "value", "descr" from "shadow_1_2_3"."sevents"`,
+			},
+		},
+		{
+			live: map[string]lib.TableColumn{
+				"time":   {Name: "time", Type: "timestamp without time zone"},
+				"period": {Name: "period", Type: "text"},
+				"descr":  {Name: "descr", Type: "text"},
+			},
+			cond: "period = $1",
+			expected: []string{
+				`alter table "public"."sevents" add column if not exists "value" double precision not null default 0.0`,
+				`delete from "public"."sevents" where period = $1`,
+				`insert into "public"."sevents"("time", "period", "value", "descr") ` +
+					`select "time", "period", "value", "descr" from "shadow_1_2_3"."sevents"`,
+			},
+		},
+		{
+			live: map[string]lib.TableColumn{
+				"time":  {Name: "time", Type: "timestamp without time zone"},
+				"value": {Name: "value", Type: "bigint"},
+			},
+			shadow: []lib.TableColumn{
+				{Name: "time", Type: "timestamp without time zone"},
+				{Name: "value", Type: "double precision", Nullable: true},
+				{Name: "flag", Type: "boolean"},
+			},
+			cond: "period = $1",
+			expected: []string{
+				`alter table "public"."sevents" alter column "value" drop default, ` +
+					`alter column "value" type double precision using "value"::double precision, ` +
+					`alter column "value" set default 0.0, alter column "value" drop not null`,
+				`alter table "public"."sevents" add column if not exists "flag" boolean not null default false`,
+				`delete from "public"."sevents" where period = $1`,
+				`insert into "public"."sevents"("time", "value", "flag") ` +
+					`select "time", "value", "flag" from "shadow_1_2_3"."sevents"`,
+			},
+		},
+		{
+			live:   live,
+			shadow: []lib.TableColumn{{Name: "value", Type: "jsonb", Nullable: true}},
+			cond:   "period = $1",
+			err:    true,
+		},
+	}
+	for index, test := range testCases {
+		columns := shadow
+		if test.shadow != nil {
+			columns = test.shadow
+		}
+		got, err := lib.ShadowSwapSQLs("shadow_1_2_3", "sevents", test.live, columns, test.cond)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %+v", index+1, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected:\n%+v\ngot:\n%+v\nerror: %v", index+1, test.expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package devstats
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SQLTemplate - renders metrics, tags and runq SQL templates, it uses text/template with SQL specific functions
+// Legacy placeholders are supported:
+// `{{name}}` - parameter value, error if parameter is not defined
+// `'{{name}}'` - parameter value as a safely quoted SQL string literal (dates are formatted as YYYY-MM-DD HH:MI:SS)
+// `{{period:alias.column}}` - condition on alias.column: last `period` interval or [`from`, `to`) range
+// In quick range mode (see WithQuickRange) unquoted `{{from}}` and `{{to}}` are SQL expressions:
+// `(now() -'period'::interval)` and `(now())` for a period or quoted dates for a dates range
+// Template actions can also be used, for example:
+// `{{if period_in "h" "d"}}...{{else}}...{{end}}` - conditionals on period abbreviation (`period_abbr` parameter)
+// `{{include "util_sql/file.sql"}}` - include partial SQL file (rendered with the same parameters)
+// `{{quote .name}}`, `{{.name}}` - parameters can also be accessed directly
+type SQLTemplate struct {
+	Dir      string                 // Directory to include partial SQL files from
+	Params   map[string]interface{} // Parameters: strings, numbers or time.Time values
+	Partials map[string]string      // Parameters that default to included partial SQL files: name -> file
+	ctx      *Ctx
+	qr       bool // Quick range mode
+	cache    *sqlTemplateCache
+}
+
+// sqlTemplateCache - partial SQL files cache, shared between copies of SQLTemplate
+type sqlTemplateCache struct {
+	mtx   sync.Mutex
+	files map[string]string
+}
+
+// Maximum depth of nested includes
+const sqlTemplateMaxDepth = 8
+
+var (
+	sqlTemplatePeriodRe = regexp.MustCompile(`\{\{\s*period:\s*([^}]+?)\s*\}\}`)
+	sqlTemplateQuotedRe = regexp.MustCompile(`'\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}'`)
+	sqlTemplateParamRe  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+	sqlTemplateKeywords = map[string]struct{}{"end": {}, "else": {}, "break": {}, "continue": {}, "nil": {}, "true": {}, "false": {}}
+)
+
+// NewSQLTemplate - returns SQL template renderer reading partials from data directory (or current directory in local mode)
+// `{{exclude_bots}}` defaults to `util_sql/exclude_bots.sql`
+func NewSQLTemplate(ctx *Ctx) *SQLTemplate {
+	dir := DataDir
+	if ctx.Local {
+		dir = "./"
+	}
+	return &SQLTemplate{
+		Dir:      dir,
+		Params:   make(map[string]interface{}),
+		Partials: map[string]string{"exclude_bots": "util_sql/exclude_bots.sql"},
+		ctx:      ctx,
+		cache:    &sqlTemplateCache{files: make(map[string]string)},
+	}
+}
+
+// With - returns copy of SQL template with additional parameters set, original template is not modified
+// Copies share partial files cache, so they can be used by multiple goroutines
+func (t *SQLTemplate) With(params map[string]interface{}) *SQLTemplate {
+	c := *t
+	c.Params = make(map[string]interface{})
+	for k, v := range t.Params {
+		c.Params[k] = v
+	}
+	for k, v := range params {
+		c.Params[k] = v
+	}
+	return &c
+}
+
+// WithQuickRange - returns copy of SQL template for a quick range: either last `period` or [`from`, `to`) dates range
+// Empty `from` and `to` are not set
+func (t *SQLTemplate) WithQuickRange(period, from, to string) *SQLTemplate {
+	params := map[string]interface{}{"period": period}
+	if from != "" {
+		params["from"] = from
+	}
+	if to != "" {
+		params["to"] = to
+	}
+	c := t.With(params)
+	c.qr = true
+	return c
+}
+
+// SetStrings - sets string parameters (for example metric params from metrics.yaml)
+func (t *SQLTemplate) SetStrings(params map[string]string) *SQLTemplate {
+	for k, v := range params {
+		t.Params[k] = v
+	}
+	return t
+}
+
+// Render - renders SQL template, returns error for undefined parameters, invalid template syntax or missing partials
+func (t *SQLTemplate) Render(sql string) (string, error) {
+	return t.render("sql", sql, 0)
+}
+
+// MustRender - renders SQL template, fatal on error
+func (t *SQLTemplate) MustRender(sql string) string {
+	res, err := t.Render(sql)
+	FatalOnError(err)
+	return res
+}
+
+// ApplySQLReplaces - applies raw [from, to] string replacements (tests.yaml `replaces`, runq non-placeholder arguments)
+func ApplySQLReplaces(sql string, replaces [][]string) (string, error) {
+	for _, replace := range replaces {
+		if len(replace) != 2 {
+			return sql, fmt.Errorf("replace(s) should have length 2, invalid: %+v", replace)
+		}
+		sql = strings.Replace(sql, replace[0], replace[1], -1)
+	}
+	return sql, nil
+}
+
+// IsSQLPlaceholder - checks if string is a `{{name}}` placeholder and returns name
+func IsSQLPlaceholder(s string) (string, bool) {
+	m := sqlTemplateParamRe.FindStringSubmatch(s)
+	if m == nil || m[0] != s {
+		return "", false
+	}
+	return m[1], true
+}
+
+// QuoteSQL - returns value as a SQL string literal, dates are formatted as YYYY-MM-DD HH:MI:SS
+func QuoteSQL(v interface{}) string {
+	return "'" + strings.Replace(sqlParamString(v), "'", "''", -1) + "'"
+}
+
+// sqlParamString - returns parameter value as a string
+func sqlParamString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case time.Time:
+		return ToYMDHMSDate(value)
+	case *time.Time:
+		return ToYMDHMSDate(*value)
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// readFile - reads partial or SQL file using cache
+func (t *SQLTemplate) readFile(path string) (string, error) {
+	t.cache.mtx.Lock()
+	defer t.cache.mtx.Unlock()
+	if data, ok := t.cache.files[path]; ok {
+		return data, nil
+	}
+	ctx := t.ctx
+	if ctx == nil {
+		ctx = &Ctx{}
+	}
+	data, err := ReadFile(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	t.cache.files[path] = string(data)
+	return string(data), nil
+}
+
+// param - returns parameter value or included partial, error if not defined
+// In quick range mode `from` and `to` are returned as SQL expressions
+func (t *SQLTemplate) param(name string, depth int) (string, error) {
+	if t.qr && (name == "from" || name == "to") {
+		if period, ok := t.Params["period"]; ok && sqlParamString(period) != "" {
+			if name == "from" {
+				return "(now() -" + QuoteSQL(period) + "::interval)", nil
+			}
+			return "(now())", nil
+		}
+		if v, ok := t.Params[name]; ok {
+			return QuoteSQL(v), nil
+		}
+	}
+	return t.value(name, depth)
+}
+
+// value - returns parameter value or included partial, error if not defined
+func (t *SQLTemplate) value(name string, depth int) (string, error) {
+	if v, ok := t.Params[name]; ok {
+		return sqlParamString(v), nil
+	}
+	if file, ok := t.Partials[name]; ok {
+		return t.include(file, depth)
+	}
+	return "", fmt.Errorf("undefined SQL template parameter '%s'", name)
+}
+
+// include - renders partial SQL file
+func (t *SQLTemplate) include(file string, depth int) (string, error) {
+	if depth >= sqlTemplateMaxDepth {
+		return "", fmt.Errorf("too deep SQL includes: '%s'", file)
+	}
+	data, err := t.readFile(t.Dir + file)
+	if err != nil {
+		return "", err
+	}
+	return t.render(file, strings.TrimRight(data, "\n"), depth+1)
+}
+
+// periodRange - condition for quick ranges and histograms: last `period` or [from, to) dates range
+func (t *SQLTemplate) periodRange(col string) (string, error) {
+	if period, ok := t.Params["period"]; ok && sqlParamString(period) != "" {
+		return " (" + col + " >= now() - " + QuoteSQL(period) + "::interval) ", nil
+	}
+	from, okFrom := t.Params["from"]
+	to, okTo := t.Params["to"]
+	if !okFrom || !okTo || sqlParamString(from) == "" || sqlParamString(to) == "" {
+		return "", fmt.Errorf("'{{period:%s}}' needs either non-empty 'period' or non-empty 'from' and 'to' parameters", col)
+	}
+	return " (" + col + " >= " + QuoteSQL(from) + " and " + col + " < " + QuoteSQL(to) + ") ", nil
+}
+
+// preprocessSQLTemplate - converts legacy placeholders to template actions
+func preprocessSQLTemplate(sql string) string {
+	sql = sqlTemplatePeriodRe.ReplaceAllString(sql, `{{period_range "$1"}}`)
+	sql = sqlTemplateQuotedRe.ReplaceAllStringFunc(sql, func(s string) string {
+		name := sqlTemplateQuotedRe.FindStringSubmatch(s)[1]
+		if _, ok := sqlTemplateKeywords[name]; ok {
+			return s
+		}
+		return `{{quote (value "` + name + `")}}`
+	})
+	return sqlTemplateParamRe.ReplaceAllStringFunc(sql, func(s string) string {
+		name := sqlTemplateParamRe.FindStringSubmatch(s)[1]
+		if _, ok := sqlTemplateKeywords[name]; ok {
+			return s
+		}
+		return `{{param "` + name + `"}}`
+	})
+}
+
+// render - parses and executes SQL template
+func (t *SQLTemplate) render(name, sql string, depth int) (string, error) {
+	if !strings.Contains(sql, "{{") {
+		return sql, nil
+	}
+	abbr := ""
+	if v, ok := t.Params["period_abbr"]; ok {
+		abbr = sqlParamString(v)
+	}
+	funcs := template.FuncMap{
+		"param":        func(name string) (string, error) { return t.param(name, depth) },
+		"value":        func(name string) (string, error) { return t.value(name, depth) },
+		"include":      func(file string) (string, error) { return t.include(file, depth) },
+		"quote":        QuoteSQL,
+		"period_range": t.periodRange,
+		"period_in": func(abbrs ...string) bool {
+			for _, a := range abbrs {
+				if a == abbr {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(preprocessSQLTemplate(sql))
+	if err != nil {
+		return "", err
+	}
+	data := make(map[string]string)
+	for k, v := range t.Params {
+		data[k] = sqlParamString(v)
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,193 @@
+package devstats
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	lib "devstats"
+)
+
+func TestSQLTemplateRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "devstats_sql_template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	files := map[string]string{
+		"util_sql/exclude_bots.sql": "not like all(array['%bot%'])\n",
+		"util_sql/repo.sql":         "r.repo_group = '{{repo_group}}' and {{include \"util_sql/deep.sql\"}}",
+		"util_sql/deep.sql":         "r.alias is not null",
+		"util_sql/loop.sql":         "{{include \"util_sql/loop.sql\"}}",
+	}
+	for name, content := range files {
+		lib.FatalOnError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		lib.FatalOnError(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	var ctx lib.Ctx
+	tmpl := lib.NewSQLTemplate(&ctx)
+	tmpl.Dir = dir + "/"
+	from := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2018, 2, 1, 0, 0, 0, 0, time.UTC)
+	tmpl.Params["repo_group"] = "Apps'; drop table gha_events; --"
+	tmpl.Params["n"] = "7.0"
+
+	var testCases = []struct {
+		sql      string
+		params   map[string]interface{}
+		expected string
+		err      string
+	}{
+		{sql: "select 1", expected: "select 1"},
+		{
+			sql:      "select count(*) / {{n}} from e where e.created_at >= '{{from}}' and e.created_at < '{{to}}' and lower(e.dup_actor_login) {{exclude_bots}}",
+			params:   map[string]interface{}{"from": from, "to": to},
+			expected: "select count(*) / 7.0 from e where e.created_at >= '2018-01-01 00:00:00' and e.created_at < '2018-02-01 00:00:00' and lower(e.dup_actor_login) not like all(array['%bot%'])",
+		},
+		{
+			sql:      "where {{include \"util_sql/repo.sql\"}}",
+			expected: "where r.repo_group = 'Apps''; drop table gha_events; --' and r.alias is not null",
+		},
+		{
+			sql:      "where {{period:e.created_at}} and {{ period:c.dup_created_at }}",
+			params:   map[string]interface{}{"period": "1 week"},
+			expected: "where  (e.created_at >= now() - '1 week'::interval)  and  (c.dup_created_at >= now() - '1 week'::interval) ",
+		},
+		{
+			sql:      "where {{period:e.created_at}}",
+			params:   map[string]interface{}{"period": "", "from": "2018-01-01", "to": "2018-02-01"},
+			expected: "where  (e.created_at >= '2018-01-01' and e.created_at < '2018-02-01') ",
+		},
+		{
+			sql:      "select {{if period_in \"h\" \"d\"}}'short'{{else}}'long'{{end}}, {{if eq .period_abbr \"w7\"}}7{{end}}",
+			params:   map[string]interface{}{"period_abbr": "d"},
+			expected: "select 'short', ",
+		},
+		{
+			sql:      "select {{if period_in \"h\" \"d\"}}'short'{{else}}'long'{{end}}, {{if eq .period_abbr \"w7\"}}7{{end}}",
+			params:   map[string]interface{}{"period_abbr": "w7"},
+			expected: "select 'long', 7",
+		},
+		{sql: "select {{quote .repo_group}}", expected: "select 'Apps''; drop table gha_events; --'"},
+		{sql: "select '{{undefined}}'", err: "undefined SQL template parameter 'undefined'"},
+		{sql: "select {{.undefined}}", err: `map has no entry for key "undefined"`},
+		{sql: "where {{period:e.created_at}}", err: "needs either non-empty 'period' or non-empty 'from' and 'to' parameters"},
+		{sql: "{{include \"util_sql/missing.sql\"}}", err: "no such file or directory"},
+		{sql: "{{include \"util_sql/loop.sql\"}}", err: "too deep SQL includes"},
+		{sql: "select {{if true}}1", err: "unexpected EOF"},
+	}
+	for index, test := range testCases {
+		got, err := tmpl.With(test.params).Render(test.sql)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("test number %d, expected:\n%s\ngot:\n%s", index+1, test.expected, got)
+		}
+	}
+	if _, ok := tmpl.Params["from"]; ok {
+		t.Errorf("With must not modify original template parameters")
+	}
+}
+
+func TestSQLPlaceholders(t *testing.T) {
+	for s, expected := range map[string]string{"{{lim}}": "lim", "{{ exclude_bots }}": "exclude_bots", " sub.name": "", "{{lim}} ": "", "{{period:a.b}}": ""} {
+		name, ok := lib.IsSQLPlaceholder(s)
+		if name != expected || ok != (expected != "") {
+			t.Errorf("'%s': expected '%s', got '%s', %v", s, expected, name, ok)
+		}
+	}
+	got, err := lib.ApplySQLReplaces("select {{lim}} from x where a <= 12", [][]string{{" <= 12", " <= 3"}, {"x", "y"}})
+	if err != nil || got != "select {{lim}} from y where a <= 3" {
+		t.Errorf("unexpected replaces result: '%s', %v", got, err)
+	}
+	if _, err = lib.ApplySQLReplaces("", [][]string{{"a"}}); err == nil {
+		t.Errorf("expected error for invalid replace")
+	}
+}
+
+func TestSQLTemplateQuickRange(t *testing.T) {
+	var ctx lib.Ctx
+	tmpl := lib.NewSQLTemplate(&ctx)
+	// Test cases
+	var testCases = []struct {
+		sql      string
+		period   string
+		from     string
+		to       string
+		expected string
+		err      string
+	}{
+		{sql: "simplest no-period case", expected: "simplest no-period case"},
+		{sql: "simplest period {{period:a}} case", err: "needs either non-empty 'period' or non-empty 'from' and 'to' parameters"},
+		{sql: "created_at < {{to}}", err: "undefined SQL template parameter 'to'"},
+		{
+			sql:      "simplest period {{period:a}} case",
+			period:   "1 day",
+			expected: "simplest period  (a >= now() - '1 day'::interval)  case",
+		},
+		{
+			sql:      "simplest period {{period:a}} case",
+			from:     "2010-01-01 12:00:00",
+			to:       "2015-02-02 13:00:00",
+			expected: "simplest period  (a >= '2010-01-01 12:00:00' and a < '2015-02-02 13:00:00')  case",
+		},
+		{
+			sql:      "simplest period {{period:a}} case",
+			period:   "1 week",
+			from:     "2010-01-01 12:00:00",
+			to:       "2015-02-02 13:00:00",
+			expected: "simplest period  (a >= now() - '1 week'::interval)  case",
+		},
+		{
+			sql:      "and ({{period:a.b.c}} and x is null) or {{period:c.d.e}} and {{from}} - {{to}}",
+			from:     "1982-07-16",
+			to:       "2017-12-01",
+			expected: "and ( (a.b.c >= '1982-07-16' and a.b.c < '2017-12-01')  and x is null) or  (c.d.e >= '1982-07-16' and c.d.e < '2017-12-01')  and '1982-07-16' - '2017-12-01'",
+		},
+		{
+			sql:      "and ({{period:a.b.c}} and x is null) or {{period:c.d.e}} and {{from}} or {{to}}",
+			period:   "3 months",
+			expected: "and ( (a.b.c >= now() - '3 months'::interval)  and x is null) or  (c.d.e >= now() - '3 months'::interval)  and (now() -'3 months'::interval) or (now())",
+		},
+		{
+			sql:      "created_at >= '{{from}}' and created_at < {{to}}",
+			from:     "2017-03-01 00:00:00",
+			to:       "2017-04-01 00:00:00",
+			expected: "created_at >= '2017-03-01 00:00:00' and created_at < '2017-04-01 00:00:00'",
+		},
+	}
+	// Execute test cases
+	for index, test := range testCases {
+		got, err := tmpl.WithQuickRange(test.period, test.from, test.to).Render(test.sql)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("test number %d, expected error '%s', got %v", index+1, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%v', got '%v'", index+1, test.expected, got)
+		}
+	}
+
+	// Unquoted dates are only SQL expressions in quick range mode
+	got, err := tmpl.With(map[string]interface{}{"from": "2017-03-01"}).Render("{{from}}")
+	if err != nil || got != "2017-03-01" {
+		t.Errorf("unexpected result outside of quick range mode: '%s', %v", got, err)
+	}
+}
@@ -794,6 +794,7 @@ func Structure(ctx *Ctx) {
 					"dup_user_login varchar(120) not null, "+
 					"dupn_assignee_login varchar(120), "+
 					"dupn_merged_by_login varchar(120), "+
+					"review_decision varchar(20), "+
 					"primary key(id, event_id)"+
 					")",
 			),
@@ -965,6 +966,15 @@ func Structure(ctx *Ctx) {
 		ExecSQLWithErr(c, ctx, "create index logs_run_dt_idx on gha_logs(run_dt)")
 	}
 
+	// GDPR requests (only in `devstats` database) and per database anonymization audit log, used by `hide_data` tool
+	// They're created when missing and never dropped
+	if ctx.Table {
+		if ctx.PgDB == Devstats {
+			GDPRRequestsStructure(c, ctx)
+		}
+		GDPRAuditStructure(c, ctx)
+	}
+
 	// `Commit - file list it refers to` mapping table, used by `get_repos` tool
 	if ctx.Table {
 		ExecSQLWithErr(c, ctx, "drop table if exists gha_commits_files")
@@ -977,6 +987,9 @@ func Structure(ctx *Ctx) {
 					"path text not null, "+
 					"size bigint not null, "+
 					"dt {{ts}} not null, "+
+					"additions bigint, "+
+					"deletions bigint, "+
+					"language varchar(40), "+
 					"primary key(sha, path)"+
 					")",
 			),
@@ -993,6 +1006,9 @@ func Structure(ctx *Ctx) {
 					"size bigint not null, "+
 					"dt {{ts}} not null, "+
 					"repo_group varchar(80), "+
+					"additions bigint, "+
+					"deletions bigint, "+
+					"language varchar(40), "+
 					"dup_repo_id bigint not null, "+
 					"dup_repo_name varchar(160) not null, "+
 					"dup_type varchar(40) not null, "+
@@ -1019,12 +1035,14 @@ func Structure(ctx *Ctx) {
 		ExecSQLWithErr(c, ctx, "create index commits_files_path_idx on gha_commits_files(path)")
 		ExecSQLWithErr(c, ctx, "create index commits_files_size_idx on gha_commits_files(size)")
 		ExecSQLWithErr(c, ctx, "create index commits_files_dt_idx on gha_commits_files(dt)")
+		ExecSQLWithErr(c, ctx, "create index commits_files_language_idx on gha_commits_files(language)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_sha_idx on gha_events_commits_files(sha)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_event_id_idx on gha_events_commits_files(event_id)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_path_idx on gha_events_commits_files(path)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_size_idx on gha_events_commits_files(size)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_dt_idx on gha_events_commits_files(dt)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_repo_group_idx on gha_events_commits_files(repo_group)")
+		ExecSQLWithErr(c, ctx, "create index events_commits_files_language_idx on gha_events_commits_files(language)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_dup_repo_id_idx on gha_events_commits_files(dup_repo_id)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_dup_repo_name_idx on gha_events_commits_files(dup_repo_name)")
 		ExecSQLWithErr(c, ctx, "create index events_commits_files_dup_type_idx on gha_events_commits_files(dup_type)")
@@ -1032,6 +1050,240 @@ func Structure(ctx *Ctx) {
 		ExecSQLWithErr(c, ctx, "create index skip_commits_sha_idx on gha_skip_commits(sha)")
 	}
 
+	// Commits imported from local git repositories (not from GitHub archives), used by `get_repos` tool
+	// Each commit has its own artificial (negative ID) event, they are removed when the same commit comes from GitHub archives
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_git_commits")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_git_commits("+
+					"sha varchar(40) not null, "+
+					"repo varchar(160) not null, "+
+					"event_id bigint not null, "+
+					"dt {{ts}} not null, "+
+					"primary key(sha, repo)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index git_commits_event_id_idx on gha_git_commits(event_id)")
+		ExecSQLWithErr(c, ctx, "create index git_commits_repo_idx on gha_git_commits(repo)")
+		ExecSQLWithErr(c, ctx, "create index git_commits_dt_idx on gha_git_commits(dt)")
+	}
+
+	// Repositories owners (from OWNERS, OWNERS_ALIASES and CODEOWNERS files), used by `get_repos` tool
+	// ref is either "HEAD" (current state) or annotation tag name
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_owners")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_owners("+
+					"repo varchar(160) not null, "+
+					"ref varchar(200) not null, "+
+					"dt {{ts}} not null, "+
+					"file text not null, "+
+					"path text not null, "+
+					"role varchar(40) not null, "+
+					"login varchar(120) not null, "+
+					"primary key(repo, ref, file, path, role, login)"+
+					")",
+			),
+		)
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_owners_aliases")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_owners_aliases("+
+					"repo varchar(160) not null, "+
+					"ref varchar(200) not null, "+
+					"dt {{ts}} not null, "+
+					"file text not null, "+
+					"alias varchar(160) not null, "+
+					"login varchar(120) not null, "+
+					"primary key(repo, ref, file, alias, login)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index owners_repo_idx on gha_owners(repo)")
+		ExecSQLWithErr(c, ctx, "create index owners_ref_idx on gha_owners(ref)")
+		ExecSQLWithErr(c, ctx, "create index owners_dt_idx on gha_owners(dt)")
+		ExecSQLWithErr(c, ctx, "create index owners_path_idx on gha_owners(path)")
+		ExecSQLWithErr(c, ctx, "create index owners_role_idx on gha_owners(role)")
+		ExecSQLWithErr(c, ctx, "create index owners_login_idx on gha_owners(login)")
+		ExecSQLWithErr(c, ctx, "create index owners_aliases_repo_idx on gha_owners_aliases(repo)")
+		ExecSQLWithErr(c, ctx, "create index owners_aliases_ref_idx on gha_owners_aliases(ref)")
+		ExecSQLWithErr(c, ctx, "create index owners_aliases_alias_idx on gha_owners_aliases(alias)")
+		ExecSQLWithErr(c, ctx, "create index owners_aliases_login_idx on gha_owners_aliases(login)")
+	}
+
+	// Lines of code per repository and language snapshots, used by `get_repos` tool
+	// ref is either "HEAD" (current state) or annotation tag name, sha is the commit used for a given ref
+	// For repositories other than project's main repository, commit is the last one before annotation date
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_loc")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_loc("+
+					"repo varchar(160) not null, "+
+					"ref varchar(200) not null, "+
+					"dt {{ts}} not null, "+
+					"sha varchar(40) not null, "+
+					"language varchar(40) not null, "+
+					"files bigint not null, "+
+					"lines bigint not null, "+
+					"size bigint not null, "+
+					"primary key(repo, ref, language)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index loc_repo_idx on gha_loc(repo)")
+		ExecSQLWithErr(c, ctx, "create index loc_ref_idx on gha_loc(ref)")
+		ExecSQLWithErr(c, ctx, "create index loc_dt_idx on gha_loc(dt)")
+		ExecSQLWithErr(c, ctx, "create index loc_language_idx on gha_loc(language)")
+	}
+
+	// PR reviews from GitHub API (GitHub archives don't have all of them), used by `ghapi2db` tool
+	// comments is a number of review comments that belong to a given review
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_reviews")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_reviews("+
+					"id bigint not null primary key, "+
+					"pull_request_id bigint not null, "+
+					"repo_name varchar(160) not null, "+
+					"number int not null, "+
+					"user_id bigint, "+
+					"user_login varchar(120), "+
+					"state varchar(40) not null, "+
+					"body text, "+
+					"commit_id varchar(40), "+
+					"submitted_at {{ts}} not null, "+
+					"comments int not null, "+
+					"dt {{ts}} not null"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index reviews_pull_request_id_idx on gha_reviews(pull_request_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_repo_name_idx on gha_reviews(repo_name)")
+		ExecSQLWithErr(c, ctx, "create index reviews_user_id_idx on gha_reviews(user_id)")
+		ExecSQLWithErr(c, ctx, "create index reviews_user_login_idx on gha_reviews(user_login)")
+		ExecSQLWithErr(c, ctx, "create index reviews_state_idx on gha_reviews(state)")
+		ExecSQLWithErr(c, ctx, "create index reviews_submitted_at_idx on gha_reviews(submitted_at)")
+	}
+
+	// PR review comments (comments on diff lines) from GitHub API, used by `ghapi2db` tool
+	// review_id is null for comments that don't belong to any review
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_review_comments")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_review_comments("+
+					"id bigint not null primary key, "+
+					"review_id bigint, "+
+					"in_reply_to bigint, "+
+					"pull_request_id bigint not null, "+
+					"repo_name varchar(160) not null, "+
+					"number int not null, "+
+					"user_id bigint, "+
+					"user_login varchar(120), "+
+					"path text, "+
+					"commit_id varchar(40), "+
+					"body text, "+
+					"created_at {{ts}} not null, "+
+					"updated_at {{ts}}, "+
+					"dt {{ts}} not null"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index review_comments_review_id_idx on gha_review_comments(review_id)")
+		ExecSQLWithErr(c, ctx, "create index review_comments_pull_request_id_idx on gha_review_comments(pull_request_id)")
+		ExecSQLWithErr(c, ctx, "create index review_comments_repo_name_idx on gha_review_comments(repo_name)")
+		ExecSQLWithErr(c, ctx, "create index review_comments_user_id_idx on gha_review_comments(user_id)")
+		ExecSQLWithErr(c, ctx, "create index review_comments_user_login_idx on gha_review_comments(user_login)")
+		ExecSQLWithErr(c, ctx, "create index review_comments_created_at_idx on gha_review_comments(created_at)")
+	}
+
+	// PR head commit statuses and check runs from GitHub API, used by `ghapi2db` tool
+	// type is either "status" or "check_run", name is a status context or a check run name
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_checks")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_checks("+
+					"id bigint not null, "+
+					"type varchar(20) not null, "+
+					"pull_request_id bigint not null, "+
+					"repo_name varchar(160) not null, "+
+					"number int not null, "+
+					"sha varchar(40) not null, "+
+					"name varchar(200) not null, "+
+					"state varchar(40) not null, "+
+					"conclusion varchar(40), "+
+					"creator_login varchar(120), "+
+					"started_at {{ts}}, "+
+					"completed_at {{ts}}, "+
+					"dt {{ts}} not null, "+
+					"primary key(id, type)"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index checks_pull_request_id_idx on gha_checks(pull_request_id)")
+		ExecSQLWithErr(c, ctx, "create index checks_repo_name_idx on gha_checks(repo_name)")
+		ExecSQLWithErr(c, ctx, "create index checks_sha_idx on gha_checks(sha)")
+		ExecSQLWithErr(c, ctx, "create index checks_name_idx on gha_checks(name)")
+		ExecSQLWithErr(c, ctx, "create index checks_conclusion_idx on gha_checks(conclusion)")
+		ExecSQLWithErr(c, ctx, "create index checks_completed_at_idx on gha_checks(completed_at)")
+	}
+
+	// Full events JSONs as downloaded from GHA, used by `gha2db` tool when GHA2DB_RAW_EVENTS is set
+	// `gha2db reparse` rebuilds all event tables from this table without downloading GHA archives
+	if ctx.Table {
+		ExecSQLWithErr(c, ctx, "drop table if exists gha_raw_events")
+		ExecSQLWithErr(
+			c,
+			ctx,
+			CreateTable(
+				"gha_raw_events("+
+					"id bigint not null primary key, "+
+					"dt {{ts}} not null, "+
+					"repo varchar(160) not null, "+
+					"type varchar(40) not null, "+
+					"payload jsonb not null"+
+					")",
+			),
+		)
+	}
+	if ctx.Index {
+		ExecSQLWithErr(c, ctx, "create index raw_events_dt_idx on gha_raw_events(dt)")
+		ExecSQLWithErr(c, ctx, "create index raw_events_repo_idx on gha_raw_events(repo)")
+		ExecSQLWithErr(c, ctx, "create index raw_events_type_idx on gha_raw_events(type)")
+	}
+
 	// Scripts to run on a given database
 	if ctx.Table {
 		ExecSQLWithErr(c, ctx, "drop table if exists gha_postprocess_scripts")
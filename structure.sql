@@ -181,7 +181,10 @@ CREATE TABLE gha_commits_files (
     sha character varying(40) NOT NULL,
     path text NOT NULL,
     size bigint NOT NULL,
-    dt timestamp without time zone NOT NULL
+    dt timestamp without time zone NOT NULL,
+    additions bigint,
+    deletions bigint,
+    language character varying(40)
 );
 
 
@@ -241,6 +244,9 @@ CREATE TABLE gha_events_commits_files (
     size bigint NOT NULL,
     dt timestamp without time zone NOT NULL,
     repo_group character varying(80),
+    additions bigint,
+    deletions bigint,
+    language character varying(40),
     dup_repo_id bigint NOT NULL,
     dup_repo_name character varying(160) NOT NULL,
     dup_type character varying(40) NOT NULL,
@@ -608,7 +614,8 @@ CREATE TABLE gha_pull_requests (
     dup_created_at timestamp without time zone NOT NULL,
     dup_user_login character varying(120) NOT NULL,
     dupn_assignee_login character varying(120),
-    dupn_merged_by_login character varying(120)
+    dupn_merged_by_login character varying(120),
+    review_decision character varying(20)
 );
 
 
@@ -2,8 +2,6 @@ package devstats
 
 import (
 	"database/sql"
-	"fmt"
-	"strings"
 	"time"
 )
 
@@ -20,6 +18,7 @@ type Tag struct {
 	NameTag    string            `yaml:"name_tag"`
 	ValueTag   string            `yaml:"value_tag"`
 	OtherTags  map[string]string `yaml:"other_tags"`
+	Params     map[string]string `yaml:"params"`
 }
 
 // ProcessTag - insert given Tag into Postgres TSDB
@@ -42,33 +41,26 @@ func ProcessTag(con *sql.DB, ctx *Ctx, tg *Tag, replaces [][]string) {
 	// Read SQL file
 	bytes, err := ReadFile(ctx, dataPrefix+dir+tg.SQLFile+".sql")
 	FatalOnError(err)
-	sqlQuery := string(bytes)
 
-	// Handle excluding bots
-	bytes, err = ReadFile(ctx, dataPrefix+"util_sql/exclude_bots.sql")
+	// Replaces
+	sqlQuery, err := ApplySQLReplaces(string(bytes), replaces)
 	FatalOnError(err)
-	excludeBots := string(bytes)
 
-	// Transform SQL
-	sqlQuery = strings.Replace(sqlQuery, "{{lim}}", "69", -1)
-	sqlQuery = strings.Replace(sqlQuery, "{{exclude_bots}}", excludeBots, -1)
-
-	// Replaces
-	for _, replace := range replaces {
-		if len(replace) != 2 {
-			FatalOnError(fmt.Errorf("replace(s) should have length 2, invalid: %+v", replace))
-		}
-		sqlQuery = strings.Replace(sqlQuery, replace[0], replace[1], -1)
-	}
+	// Transform SQL: `{{lim}}` defaults to 69, can be overridden by tag's params
+	tmpl := NewSQLTemplate(ctx)
+	tmpl.Params["lim"] = "69"
+	sqlQuery = tmpl.SetStrings(tg.Params).MustRender(sqlQuery)
 
 	// Execute SQL
 	rows := QuerySQLWithErr(con, ctx, sqlQuery)
 	defer func() { FatalOnError(rows.Close()) }()
 
-	// Drop current tags
+	// Tags are written into a shadow schema, whole live table is replaced when new tags are ready
 	table := "t" + tg.SeriesName
-	if TableExists(con, ctx, table) {
-		ExecSQLWithErr(con, ctx, "truncate "+table)
+	var shadow *Shadow
+	if !ctx.SkipTSDB {
+		shadow = NewShadow(con, ctx)
+		defer shadow.Close(con, ctx)
 	}
 	tm := TimeParseAny("2014-01-01")
 
@@ -129,8 +121,9 @@ func ProcessTag(con *sql.DB, ctx *Ctx, tg *Tag, replaces [][]string) {
 	}
 
 	// Write the batch
-	if !ctx.SkipTSDB {
-		WriteTSPoints(ctx, con, &pts, "", nil)
+	if shadow != nil {
+		WriteTSPoints(ctx, shadow.Con, &pts, "", nil)
+		shadow.SwapTables(con, ctx, table)
 	} else if ctx.Debug > 0 {
 		Printf("Skipping tags series write\n")
 	}
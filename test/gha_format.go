@@ -0,0 +1,42 @@
+package test
+
+// GHAFormatEvents - pairs of the same events in new (2015+) and old (pre 2015) GHA formats
+// Old events happen an hour earlier, so they're in the last pre 2015 GHA hour file
+var GHAFormatEvents = []struct {
+	Name string
+	New  string
+	Old  string
+}{
+	{
+		Name: "push",
+		New: `{"id":"2489651045","type":"PushEvent","actor":{"id":1,"login":"alice"},"repo":{"id":10,"name":"org/repo"},` +
+			`"payload":{"push_id":536863970,"size":2,"distinct_size":1,"ref":"refs/heads/master","head":"sha2","before":"sha0",` +
+			`"commits":[{"sha":"sha1","author":{"email":"a@b.c","name":"Alice"},"message":"First","distinct":false},` +
+			`{"sha":"sha2","author":{"email":"b@b.c","name":"Bob"},"message":"Second","distinct":true}]},` +
+			`"public":true,"created_at":"2015-01-01T00:00:00Z","org":{"id":100,"login":"org"}}`,
+		Old: `{"created_at":"2014-12-31T15:00:00-08:00","payload":{"shas":[["sha1","a@b.c","First","Alice",false],` +
+			`["sha2","b@b.c","Second","Bob",true]],"size":2,"ref":"refs/heads/master","head":"sha2"},"public":true,` +
+			`"type":"PushEvent","actor":"alice","actor_attributes":{"login":"alice","type":"User"},` +
+			`"repository":{"id":10,"name":"repo","owner":"org","organization":"org","created_at":"2014-01-01T00:00:00-08:00"}}`,
+	},
+	{
+		Name: "pull request",
+		New: `{"id":"2489651046","type":"PullRequestEvent","actor":{"id":1,"login":"alice"},"repo":{"id":10,"name":"org/repo"},` +
+			`"payload":{"action":"opened","number":7,"pull_request":{"id":700,"number":7,"state":"open","title":"PR",` +
+			`"user":{"id":1,"login":"alice"},"base":{"sha":"b"},"head":{"sha":"h"},"created_at":"2015-01-01T00:00:00Z",` +
+			`"updated_at":"2015-01-01T00:00:00Z"}},"public":true,"created_at":"2015-01-01T00:00:00Z"}`,
+		Old: `{"created_at":"2014-12-31T15:00:00-08:00","payload":{"action":"opened","number":7,"pull_request":{"id":700,` +
+			`"number":7,"state":"open","title":"PR","user":{"id":1,"login":"alice"},"base":{"sha":"b"},"head":{"sha":"h"},` +
+			`"created_at":"2014-12-31T15:00:00-08:00","updated_at":"2014-12-31T15:00:00-08:00"}},"public":true,` +
+			`"type":"PullRequestEvent","actor":"alice","repository":{"id":10,"name":"repo","owner":"org","organization":"org"}}`,
+	},
+	{
+		Name: "issue comment",
+		New: `{"id":"2489651047","type":"IssueCommentEvent","actor":{"id":1,"login":"alice"},"repo":{"id":10,"name":"org/repo"},` +
+			`"payload":{"action":"created","issue":{"id":800,"number":8,"title":"Issue","state":"open","comments":1,"user":{"id":2,"login":"bob"}},` +
+			`"comment":{"id":900,"body":"Hi","user":{"id":1,"login":"alice"},"created_at":"2015-01-01T00:00:00Z",` +
+			`"updated_at":"2015-01-01T00:00:00Z"}},"public":true,"created_at":"2015-01-01T00:00:00Z"}`,
+		Old: `{"created_at":"2014-12-31T15:00:00-08:00","payload":{"action":"created","issue_id":800,"comment_id":900},` +
+			`"public":true,"type":"IssueCommentEvent","actor":"alice","repository":{"id":10,"name":"repo","owner":"org","organization":"org"}}`,
+	},
+}
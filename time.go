@@ -242,6 +242,17 @@ func PrevYearStart(dt time.Time) time.Time {
 // TimeParseAny - attempts to parse time from string YYYY-MM-DD HH:MI:SS
 // Skipping parts from right until only YYYY id left
 func TimeParseAny(dtStr string) time.Time {
+	t, err := ParseTimeAny(dtStr)
+	if err != nil {
+		Printf("Error:\nCannot parse date: '%v'\n", dtStr)
+		fmt.Fprintf(os.Stdout, "Error:\nCannot parse date: '%v'\n", dtStr)
+		os.Exit(1)
+	}
+	return t
+}
+
+// ParseTimeAny - parses time like TimeParseAny, but returns error instead of exiting
+func ParseTimeAny(dtStr string) (time.Time, error) {
 	formats := []string{
 		"2006-01-02 15:04:05",
 		"2006-01-02 15:04",
@@ -253,13 +264,10 @@ func TimeParseAny(dtStr string) time.Time {
 	for _, format := range formats {
 		t, e := time.Parse(format, dtStr)
 		if e == nil {
-			return t
+			return t, nil
 		}
 	}
-	Printf("Error:\nCannot parse date: '%v'\n", dtStr)
-	fmt.Fprintf(os.Stdout, "Error:\nCannot parse date: '%v'\n", dtStr)
-	os.Exit(1)
-	return time.Now()
+	return time.Now(), fmt.Errorf("cannot parse date: '%v'", dtStr)
 }
 
 // ToGHADate - return time formatted as YYYY-MM-DD-H
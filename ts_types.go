@@ -0,0 +1,243 @@
+package devstats
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TSType - time series field (column) type
+// Numeric types are ordered from the narrowest to the widest: boolean < bigint < double precision
+type TSType int
+
+// Time series field types
+const (
+	TSUnknown TSType = iota // NULL value without a type or unknown column type
+	TSBool                  // bool values, boolean column
+	TSInt                   // int, int32 and int64 values, bigint column
+	TSFloat                 // float64 and float32 values, double precision column
+	TSString                // string values, text column
+	TSJSON                  // TSJSONValue, map[string]interface{} and []interface{} values, jsonb column
+)
+
+// TSJSONValue - JSON time series field value (stored in a jsonb column)
+type TSJSONValue string
+
+// String - Postgres column type
+func (t TSType) String() string {
+	switch t {
+	case TSBool:
+		return "boolean"
+	case TSInt:
+		return "bigint"
+	case TSFloat:
+		return "double precision"
+	case TSString:
+		return "text"
+	case TSJSON:
+		return "jsonb"
+	default:
+		return "unknown"
+	}
+}
+
+// Is this a numeric type (boolean is treated as 0/1)
+func (t TSType) numeric() bool {
+	return t == TSBool || t == TSInt || t == TSFloat
+}
+
+// TSValueType - returns field value type and whether value is NULL
+// NULLs are nil or nil pointers (*float64, *int64, *bool, *string), nil pointers keep the type
+func TSValueType(value interface{}) (TSType, bool, error) {
+	switch v := value.(type) {
+	case nil:
+		return TSUnknown, true, nil
+	case float64, float32:
+		return TSFloat, false, nil
+	case int, int32, int64:
+		return TSInt, false, nil
+	case bool:
+		return TSBool, false, nil
+	case string:
+		return TSString, false, nil
+	case TSJSONValue, map[string]interface{}, []interface{}:
+		return TSJSON, false, nil
+	case *float64:
+		return TSFloat, v == nil, nil
+	case *int64:
+		return TSInt, v == nil, nil
+	case *bool:
+		return TSBool, v == nil, nil
+	case *string:
+		return TSString, v == nil, nil
+	default:
+		return TSUnknown, false, fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+// TSTypeOfColumn - returns time series type of a Postgres column type (information_schema data_type)
+func TSTypeOfColumn(dataType string) TSType {
+	switch dataType {
+	case "boolean":
+		return TSBool
+	case "bigint", "integer", "smallint":
+		return TSInt
+	case "double precision", "real", "numeric":
+		return TSFloat
+	case "text", "character varying":
+		return TSString
+	case "jsonb", "json":
+		return TSJSON
+	default:
+		return TSUnknown
+	}
+}
+
+// MergeTSTypes - returns type of a column that can hold values of both types
+// Numeric types are widened, other types can only hold values of the same type
+func MergeTSTypes(a, b TSType) (TSType, error) {
+	if a == TSUnknown {
+		return b, nil
+	}
+	if b == TSUnknown || a == b {
+		return a, nil
+	}
+	if a.numeric() && b.numeric() {
+		if b > a {
+			return b, nil
+		}
+		return a, nil
+	}
+	return a, fmt.Errorf("%s and %s values cannot be stored in the same column", a, b)
+}
+
+// TSColumnDef - returns column definition for a given type
+// Columns have a default value (zero) used for rows that don't set them, like multi value series without some values
+// NULLs are only allowed when nullable is set (columns only holding NULLs are double precision)
+func TSColumnDef(ty TSType, nullable bool) string {
+	def := ""
+	switch ty {
+	case TSBool:
+		def = "boolean"
+	case TSInt:
+		def = "bigint"
+	case TSString:
+		def = "text"
+	case TSJSON:
+		return "jsonb"
+	default:
+		ty = TSFloat
+		def = "double precision"
+	}
+	if !nullable {
+		def += " not null"
+	}
+	return def + " default " + tsDefault(ty)
+}
+
+// Returns column default value for a given type
+func tsDefault(ty TSType) string {
+	switch ty {
+	case TSBool:
+		return "false"
+	case TSInt:
+		return "0"
+	case TSString:
+		return "''"
+	default:
+		return "0.0"
+	}
+}
+
+// TSColumnAlterations - returns `alter table` clauses needed for an existing column so it can hold values of a given type
+// and returns column type (values must be converted to it). Schema evolution rules:
+// - numeric columns are widened (boolean -> bigint -> double precision), they are never narrowed,
+// - text and jsonb columns never change type, storing other values in them (or them in numeric columns) is an error,
+// - not null constraint is dropped when NULL is stored (default value is kept),
+// - columns of unknown types are left as they are.
+func TSColumnAlterations(column string, current TSType, nullable bool, wanted TSType, null bool) ([]string, TSType, error) {
+	clauses := []string{}
+	ty := current
+	if current == TSUnknown {
+		ty = wanted
+	} else if wanted != TSUnknown && wanted != current {
+		merged, err := MergeTSTypes(current, wanted)
+		if err != nil {
+			return nil, current, fmt.Errorf("column %s: %v", column, err)
+		}
+		if merged != current {
+			using := "\"" + column + "\"::double precision"
+			if current == TSBool {
+				using = "\"" + column + "\"::int"
+			}
+			clauses = append(
+				clauses,
+				"alter column \""+column+"\" drop default",
+				"alter column \""+column+"\" type "+merged.String()+" using "+using,
+				"alter column \""+column+"\" set default "+tsDefault(merged),
+			)
+			ty = merged
+		}
+	}
+	if null && !nullable {
+		clauses = append(clauses, "alter column \""+column+"\" drop not null")
+	}
+	return clauses, ty, nil
+}
+
+// TSConvertValue - returns field value converted to its column type (NULLs are nil)
+func TSConvertValue(value interface{}, ty TSType) (interface{}, error) {
+	switch v := value.(type) {
+	case *float64:
+		if v == nil {
+			return nil, nil
+		}
+		value = *v
+	case *int64:
+		if v == nil {
+			return nil, nil
+		}
+		value = *v
+	case *bool:
+		if v == nil {
+			return nil, nil
+		}
+		value = *v
+	case *string:
+		if v == nil {
+			return nil, nil
+		}
+		value = *v
+	case int:
+		value = int64(v)
+	case int32:
+		value = int64(v)
+	case float32:
+		value = float64(v)
+	case TSJSONValue:
+		return string(v), nil
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	}
+	switch v := value.(type) {
+	case bool:
+		n := int64(0)
+		if v {
+			n = 1
+		}
+		switch ty {
+		case TSInt:
+			return n, nil
+		case TSFloat:
+			return float64(n), nil
+		}
+	case int64:
+		if ty == TSFloat {
+			return float64(v), nil
+		}
+	}
+	return value, nil
+}
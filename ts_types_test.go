@@ -0,0 +1,187 @@
+package devstats
+
+import (
+	"reflect"
+	"testing"
+
+	lib "devstats"
+)
+
+func TestTSValueType(t *testing.T) {
+	f := 1.5
+	var nilInt *int64
+	var testCases = []struct {
+		value    interface{}
+		expected lib.TSType
+		null     bool
+		err      bool
+	}{
+		{value: nil, expected: lib.TSUnknown, null: true},
+		{value: 1.5, expected: lib.TSFloat},
+		{value: float32(1.5), expected: lib.TSFloat},
+		{value: 3, expected: lib.TSInt},
+		{value: int64(3), expected: lib.TSInt},
+		{value: true, expected: lib.TSBool},
+		{value: "text", expected: lib.TSString},
+		{value: lib.TSJSONValue("{}"), expected: lib.TSJSON},
+		{value: map[string]interface{}{"a": 1}, expected: lib.TSJSON},
+		{value: &f, expected: lib.TSFloat},
+		{value: nilInt, expected: lib.TSInt, null: true},
+		{value: (*string)(nil), expected: lib.TSString, null: true},
+		{value: struct{}{}, err: true},
+	}
+	for index, test := range testCases {
+		got, null, err := lib.TSValueType(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %v", index+1, got)
+			}
+			continue
+		}
+		if err != nil || got != test.expected || null != test.null {
+			t.Errorf("test number %d, expected %v, %v, got %v, %v, %v", index+1, test.expected, test.null, got, null, err)
+		}
+	}
+}
+
+func TestMergeTSTypes(t *testing.T) {
+	var testCases = []struct {
+		a, b     lib.TSType
+		expected lib.TSType
+		err      bool
+	}{
+		{a: lib.TSUnknown, b: lib.TSInt, expected: lib.TSInt},
+		{a: lib.TSString, b: lib.TSUnknown, expected: lib.TSString},
+		{a: lib.TSBool, b: lib.TSInt, expected: lib.TSInt},
+		{a: lib.TSFloat, b: lib.TSInt, expected: lib.TSFloat},
+		{a: lib.TSBool, b: lib.TSFloat, expected: lib.TSFloat},
+		{a: lib.TSJSON, b: lib.TSJSON, expected: lib.TSJSON},
+		{a: lib.TSString, b: lib.TSFloat, err: true},
+		{a: lib.TSInt, b: lib.TSJSON, err: true},
+	}
+	for _, test := range testCases {
+		got, err := lib.MergeTSTypes(test.a, test.b)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v, %v: expected error, got %v", test.a, test.b, got)
+			}
+			continue
+		}
+		if err != nil || got != test.expected {
+			t.Errorf("%v, %v: expected %v, got %v, %v", test.a, test.b, test.expected, got, err)
+		}
+	}
+}
+
+func TestTSColumnDef(t *testing.T) {
+	var testCases = []struct {
+		ty       lib.TSType
+		nullable bool
+		expected string
+	}{
+		{ty: lib.TSFloat, expected: "double precision not null default 0.0"},
+		{ty: lib.TSUnknown, expected: "double precision not null default 0.0"},
+		{ty: lib.TSUnknown, nullable: true, expected: "double precision default 0.0"},
+		{ty: lib.TSInt, expected: "bigint not null default 0"},
+		{ty: lib.TSBool, nullable: true, expected: "boolean default false"},
+		{ty: lib.TSString, expected: "text not null default ''"},
+		{ty: lib.TSJSON, expected: "jsonb"},
+	}
+	for _, test := range testCases {
+		got := lib.TSColumnDef(test.ty, test.nullable)
+		if got != test.expected {
+			t.Errorf("%v, %v: expected '%s', got '%s'", test.ty, test.nullable, test.expected, got)
+		}
+	}
+}
+
+func TestTSColumnAlterations(t *testing.T) {
+	var testCases = []struct {
+		current  lib.TSType
+		nullable bool
+		wanted   lib.TSType
+		null     bool
+		expected []string
+		ty       lib.TSType
+		err      bool
+	}{
+		{current: lib.TSFloat, wanted: lib.TSFloat, expected: []string{}, ty: lib.TSFloat},
+		{current: lib.TSFloat, wanted: lib.TSInt, expected: []string{}, ty: lib.TSFloat},
+		{current: lib.TSFloat, wanted: lib.TSUnknown, expected: []string{}, ty: lib.TSFloat},
+		{current: lib.TSUnknown, wanted: lib.TSInt, expected: []string{}, ty: lib.TSInt},
+		{
+			current: lib.TSFloat,
+			wanted:  lib.TSUnknown,
+			null:    true,
+			expected: []string{
+				`alter column "v" drop not null`,
+			},
+			ty: lib.TSFloat,
+		},
+		{current: lib.TSFloat, nullable: true, wanted: lib.TSFloat, null: true, expected: []string{}, ty: lib.TSFloat},
+		{
+			current: lib.TSInt,
+			wanted:  lib.TSFloat,
+			expected: []string{
+				`alter column "v" drop default`,
+				`alter column "v" type double precision using "v"::double precision`,
+				`alter column "v" set default 0.0`,
+			},
+			ty: lib.TSFloat,
+		},
+		{
+			current:  lib.TSBool,
+			nullable: true,
+			wanted:   lib.TSInt,
+			null:     true,
+			expected: []string{
+				`alter column "v" drop default`,
+				`alter column "v" type bigint using "v"::int`,
+				`alter column "v" set default 0`,
+			},
+			ty: lib.TSInt,
+		},
+		{current: lib.TSString, wanted: lib.TSFloat, err: true},
+		{current: lib.TSFloat, wanted: lib.TSJSON, err: true},
+	}
+	for index, test := range testCases {
+		got, ty, err := lib.TSColumnAlterations("v", test.current, test.nullable, test.wanted, test.null)
+		if test.err {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %+v", index+1, got)
+			}
+			continue
+		}
+		if err != nil || ty != test.ty || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, %v, got %+v, %v, %v", index+1, test.expected, test.ty, got, ty, err)
+		}
+	}
+}
+
+func TestTSConvertValue(t *testing.T) {
+	i := int64(4)
+	var testCases = []struct {
+		value    interface{}
+		ty       lib.TSType
+		expected interface{}
+	}{
+		{value: 1.5, ty: lib.TSFloat, expected: 1.5},
+		{value: 3, ty: lib.TSInt, expected: int64(3)},
+		{value: 3, ty: lib.TSFloat, expected: 3.0},
+		{value: &i, ty: lib.TSFloat, expected: 4.0},
+		{value: (*int64)(nil), ty: lib.TSInt, expected: nil},
+		{value: nil, ty: lib.TSFloat, expected: nil},
+		{value: true, ty: lib.TSBool, expected: true},
+		{value: true, ty: lib.TSInt, expected: int64(1)},
+		{value: false, ty: lib.TSFloat, expected: 0.0},
+		{value: "x", ty: lib.TSString, expected: "x"},
+		{value: lib.TSJSONValue(`{"a":1}`), ty: lib.TSJSON, expected: `{"a":1}`},
+		{value: []interface{}{1, "a"}, ty: lib.TSJSON, expected: `[1,"a"]`},
+	}
+	for index, test := range testCases {
+		got, err := lib.TSConvertValue(test.value, test.ty)
+		if err != nil || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %#v, got %#v, %v", index+1, test.expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+alter table gha_commits_files add additions bigint;
+alter table gha_commits_files add deletions bigint;
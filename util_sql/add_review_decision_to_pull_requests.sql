@@ -0,0 +1 @@
+alter table gha_pull_requests add review_decision varchar(20);
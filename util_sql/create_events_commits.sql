@@ -4,6 +4,9 @@ insert into gha_events_commits_files(
   path,
   dt,
   size,
+  additions,
+  deletions,
+  language,
   dup_repo_id,
   dup_repo_name,
   dup_type,
@@ -15,6 +18,9 @@ select
   sub.path,
   sub.dt,
   sub.size,
+  sub.additions,
+  sub.deletions,
+  sub.language,
   sub.dup_repo_id,
   sub.dup_repo_name,
   sub.dup_type,
@@ -25,6 +31,9 @@ from (
     c.dup_repo_name || '/' || cf.path as path,
     cf.dt,
     cf.size,
+    cf.additions,
+    cf.deletions,
+    cf.language,
     c.dup_repo_id,
     c.dup_repo_name,
     c.dup_type,
@@ -40,6 +49,9 @@ from (
     c.dup_repo_name || '/' || cf.path as path,
     cf.dt,
     cf.size,
+    cf.additions,
+    cf.deletions,
+    cf.language,
     c.dup_repo_id,
     c.dup_repo_name,
     c.dup_type,
@@ -54,6 +66,9 @@ from (
     p.dup_repo_name || '/' || cf.path as path,
     cf.dt,
     cf.size,
+    cf.additions,
+    cf.deletions,
+    cf.language,
     p.dup_repo_id,
     p.dup_repo_name,
     p.dup_type,
@@ -68,6 +83,9 @@ from (
     pl.dup_repo_name || '/' || cf.path as path,
     cf.dt,
     cf.size,
+    cf.additions,
+    cf.deletions,
+    cf.language,
     pl.dup_repo_id,
     pl.dup_repo_name,
     pl.dup_type,
@@ -86,6 +104,9 @@ from (
     pr.dup_repo_name || '/' || cf.path as path,
     cf.dt,
     cf.size,
+    cf.additions,
+    cf.deletions,
+    cf.language,
     pr.dup_repo_id,
     pr.dup_repo_name,
     pr.dup_type,
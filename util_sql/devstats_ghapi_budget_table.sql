@@ -0,0 +1,9 @@
+CREATE TABLE gha_ghapi_budget (
+    token character varying(40) NOT NULL,
+    remaining integer NOT NULL,
+    reset_at timestamp without time zone NOT NULL,
+    abuse_until timestamp without time zone,
+    dt timestamp without time zone NOT NULL DEFAULT now()
+);
+ALTER TABLE gha_ghapi_budget OWNER TO gha_admin;
+ALTER TABLE ONLY gha_ghapi_budget ADD CONSTRAINT gha_ghapi_budget_pkey PRIMARY KEY (token);
@@ -0,0 +1,13 @@
+CREATE TABLE gha_git_commits (
+  sha character varying(40) NOT NULL,
+  repo character varying(160) NOT NULL,
+  event_id bigint NOT NULL,
+  dt timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_git_commits OWNER TO gha_admin;
+ALTER TABLE ONLY gha_git_commits ADD CONSTRAINT gha_git_commits_pkey PRIMARY KEY (sha, repo);
+CREATE INDEX git_commits_event_id_idx ON gha_git_commits USING btree (event_id);
+CREATE INDEX git_commits_repo_idx ON gha_git_commits USING btree (repo);
+CREATE INDEX git_commits_dt_idx ON gha_git_commits USING btree (dt);
+GRANT SELECT ON TABLE gha_git_commits TO ro_user;
+GRANT SELECT ON TABLE gha_git_commits TO devstats_team;
@@ -0,0 +1,24 @@
+alter table gha_commits_files add language varchar(40);
+alter table gha_events_commits_files add additions bigint;
+alter table gha_events_commits_files add deletions bigint;
+alter table gha_events_commits_files add language varchar(40);
+CREATE INDEX commits_files_language_idx ON gha_commits_files USING btree (language);
+CREATE INDEX events_commits_files_language_idx ON gha_events_commits_files USING btree (language);
+CREATE TABLE gha_loc (
+  repo character varying(160) NOT NULL,
+  ref character varying(200) NOT NULL,
+  dt timestamp without time zone NOT NULL,
+  sha character varying(40) NOT NULL,
+  language character varying(40) NOT NULL,
+  files bigint NOT NULL,
+  lines bigint NOT NULL,
+  size bigint NOT NULL
+);
+ALTER TABLE gha_loc OWNER TO gha_admin;
+ALTER TABLE ONLY gha_loc ADD CONSTRAINT gha_loc_pkey PRIMARY KEY (repo, ref, language);
+CREATE INDEX loc_repo_idx ON gha_loc USING btree (repo);
+CREATE INDEX loc_ref_idx ON gha_loc USING btree (ref);
+CREATE INDEX loc_dt_idx ON gha_loc USING btree (dt);
+CREATE INDEX loc_language_idx ON gha_loc USING btree (language);
+GRANT SELECT ON TABLE gha_loc TO ro_user;
+GRANT SELECT ON TABLE gha_loc TO devstats_team;
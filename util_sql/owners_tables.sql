@@ -0,0 +1,36 @@
+CREATE TABLE gha_owners (
+  repo character varying(160) NOT NULL,
+  ref character varying(200) NOT NULL,
+  dt timestamp without time zone NOT NULL,
+  file text NOT NULL,
+  path text NOT NULL,
+  role character varying(40) NOT NULL,
+  login character varying(120) NOT NULL
+);
+ALTER TABLE gha_owners OWNER TO gha_admin;
+ALTER TABLE ONLY gha_owners ADD CONSTRAINT gha_owners_pkey PRIMARY KEY (repo, ref, file, path, role, login);
+CREATE INDEX owners_repo_idx ON gha_owners USING btree (repo);
+CREATE INDEX owners_ref_idx ON gha_owners USING btree (ref);
+CREATE INDEX owners_dt_idx ON gha_owners USING btree (dt);
+CREATE INDEX owners_path_idx ON gha_owners USING btree (path);
+CREATE INDEX owners_role_idx ON gha_owners USING btree (role);
+CREATE INDEX owners_login_idx ON gha_owners USING btree (login);
+GRANT SELECT ON TABLE gha_owners TO ro_user;
+GRANT SELECT ON TABLE gha_owners TO devstats_team;
+
+CREATE TABLE gha_owners_aliases (
+  repo character varying(160) NOT NULL,
+  ref character varying(200) NOT NULL,
+  dt timestamp without time zone NOT NULL,
+  file text NOT NULL,
+  alias character varying(160) NOT NULL,
+  login character varying(120) NOT NULL
+);
+ALTER TABLE gha_owners_aliases OWNER TO gha_admin;
+ALTER TABLE ONLY gha_owners_aliases ADD CONSTRAINT gha_owners_aliases_pkey PRIMARY KEY (repo, ref, file, alias, login);
+CREATE INDEX owners_aliases_repo_idx ON gha_owners_aliases USING btree (repo);
+CREATE INDEX owners_aliases_ref_idx ON gha_owners_aliases USING btree (ref);
+CREATE INDEX owners_aliases_alias_idx ON gha_owners_aliases USING btree (alias);
+CREATE INDEX owners_aliases_login_idx ON gha_owners_aliases USING btree (login);
+GRANT SELECT ON TABLE gha_owners_aliases TO ro_user;
+GRANT SELECT ON TABLE gha_owners_aliases TO devstats_team;
@@ -0,0 +1,14 @@
+CREATE TABLE gha_raw_events (
+  id bigint NOT NULL,
+  dt timestamp without time zone NOT NULL,
+  repo character varying(160) NOT NULL,
+  type character varying(40) NOT NULL,
+  payload jsonb NOT NULL
+);
+ALTER TABLE gha_raw_events OWNER TO gha_admin;
+ALTER TABLE ONLY gha_raw_events ADD CONSTRAINT gha_raw_events_pkey PRIMARY KEY (id);
+CREATE INDEX raw_events_dt_idx ON gha_raw_events USING btree (dt);
+CREATE INDEX raw_events_repo_idx ON gha_raw_events USING btree (repo);
+CREATE INDEX raw_events_type_idx ON gha_raw_events USING btree (type);
+GRANT SELECT ON TABLE gha_raw_events TO ro_user;
+GRANT SELECT ON TABLE gha_raw_events TO devstats_team;
@@ -0,0 +1,75 @@
+CREATE TABLE gha_reviews (
+  id bigint NOT NULL,
+  pull_request_id bigint NOT NULL,
+  repo_name character varying(160) NOT NULL,
+  number integer NOT NULL,
+  user_id bigint,
+  user_login character varying(120),
+  state character varying(40) NOT NULL,
+  body text,
+  commit_id character varying(40),
+  submitted_at timestamp without time zone NOT NULL,
+  comments integer NOT NULL,
+  dt timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_reviews OWNER TO gha_admin;
+ALTER TABLE ONLY gha_reviews ADD CONSTRAINT gha_reviews_pkey PRIMARY KEY (id);
+CREATE INDEX reviews_pull_request_id_idx ON gha_reviews USING btree (pull_request_id);
+CREATE INDEX reviews_repo_name_idx ON gha_reviews USING btree (repo_name);
+CREATE INDEX reviews_user_id_idx ON gha_reviews USING btree (user_id);
+CREATE INDEX reviews_user_login_idx ON gha_reviews USING btree (user_login);
+CREATE INDEX reviews_state_idx ON gha_reviews USING btree (state);
+CREATE INDEX reviews_submitted_at_idx ON gha_reviews USING btree (submitted_at);
+GRANT SELECT ON TABLE gha_reviews TO ro_user;
+GRANT SELECT ON TABLE gha_reviews TO devstats_team;
+CREATE TABLE gha_review_comments (
+  id bigint NOT NULL,
+  review_id bigint,
+  in_reply_to bigint,
+  pull_request_id bigint NOT NULL,
+  repo_name character varying(160) NOT NULL,
+  number integer NOT NULL,
+  user_id bigint,
+  user_login character varying(120),
+  path text,
+  commit_id character varying(40),
+  body text,
+  created_at timestamp without time zone NOT NULL,
+  updated_at timestamp without time zone,
+  dt timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_review_comments OWNER TO gha_admin;
+ALTER TABLE ONLY gha_review_comments ADD CONSTRAINT gha_review_comments_pkey PRIMARY KEY (id);
+CREATE INDEX review_comments_review_id_idx ON gha_review_comments USING btree (review_id);
+CREATE INDEX review_comments_pull_request_id_idx ON gha_review_comments USING btree (pull_request_id);
+CREATE INDEX review_comments_repo_name_idx ON gha_review_comments USING btree (repo_name);
+CREATE INDEX review_comments_user_id_idx ON gha_review_comments USING btree (user_id);
+CREATE INDEX review_comments_user_login_idx ON gha_review_comments USING btree (user_login);
+CREATE INDEX review_comments_created_at_idx ON gha_review_comments USING btree (created_at);
+GRANT SELECT ON TABLE gha_review_comments TO ro_user;
+GRANT SELECT ON TABLE gha_review_comments TO devstats_team;
+CREATE TABLE gha_checks (
+  id bigint NOT NULL,
+  type character varying(20) NOT NULL,
+  pull_request_id bigint NOT NULL,
+  repo_name character varying(160) NOT NULL,
+  number integer NOT NULL,
+  sha character varying(40) NOT NULL,
+  name character varying(200) NOT NULL,
+  state character varying(40) NOT NULL,
+  conclusion character varying(40),
+  creator_login character varying(120),
+  started_at timestamp without time zone,
+  completed_at timestamp without time zone,
+  dt timestamp without time zone NOT NULL
+);
+ALTER TABLE gha_checks OWNER TO gha_admin;
+ALTER TABLE ONLY gha_checks ADD CONSTRAINT gha_checks_pkey PRIMARY KEY (id, type);
+CREATE INDEX checks_pull_request_id_idx ON gha_checks USING btree (pull_request_id);
+CREATE INDEX checks_repo_name_idx ON gha_checks USING btree (repo_name);
+CREATE INDEX checks_sha_idx ON gha_checks USING btree (sha);
+CREATE INDEX checks_name_idx ON gha_checks USING btree (name);
+CREATE INDEX checks_conclusion_idx ON gha_checks USING btree (conclusion);
+CREATE INDEX checks_completed_at_idx ON gha_checks USING btree (completed_at);
+GRANT SELECT ON TABLE gha_checks TO ro_user;
+GRANT SELECT ON TABLE gha_checks TO devstats_team;
@@ -0,0 +1,14 @@
+update
+  gha_events_commits_files ecf
+set
+  additions = cf.additions,
+  deletions = cf.deletions,
+  language = cf.language
+from
+  gha_commits_files cf
+where
+  ecf.sha = cf.sha
+  and ecf.path = ecf.dup_repo_name || '/' || cf.path
+  and ecf.language is null
+  and cf.language is not null
+;